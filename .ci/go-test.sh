@@ -3,8 +3,17 @@
 script_dir=$(cd `dirname $0`; pwd)
 root_dir=`dirname $script_dir`
 
-test_packages="."
-go_test_flags="-v -race -timeout 2s"
+test_packages=". ./virtcontainers/..."
+go_test_flags="-v -race -timeout 120s"
+
+# The virtcontainers CNI tests expect the plugins installed by the CI setup
+# under /tmp/cni/bin.
+cni_bin_dir=/opt/cni/bin
+cni_test_bin_dir=/tmp/cni/bin
+if [ -d "$cni_bin_dir" ] && [ ! -e "$cni_test_bin_dir" ]; then
+	mkdir -p `dirname $cni_test_bin_dir`
+	ln -s "$cni_bin_dir" "$cni_test_bin_dir"
+fi
 
 echo Running go test on packages "'$test_packages'" with flags "'$go_test_flags'"
 
@@ -0,0 +1,278 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	goruntime "runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
+)
+
+// OCI annotations overriding the VM settings of a pod. They are only
+// honoured when listed in the allowed_annotations of the configuration
+// file.
+const (
+	vmAnnotationPrefix = "com.intel.cc.vm."
+
+	vcpusAnnotation        = vmAnnotationPrefix + "vcpus"
+	memoryAnnotation       = vmAnnotationPrefix + "memory"
+	memoryTargetAnnotation = vmAnnotationPrefix + "memory_target"
+	kernelParamsAnnotation = vmAnnotationPrefix + "kernel_params"
+	debugAnnotation        = vmAnnotationPrefix + "debug"
+)
+
+var vmAnnotations = map[string]bool{
+	vcpusAnnotation:        true,
+	memoryAnnotation:       true,
+	memoryTargetAnnotation: true,
+	kernelParamsAnnotation: true,
+	debugAnnotation:        true,
+}
+
+// annotationBounds limits the values the VM annotations can take.
+type annotationBounds struct {
+	MaxVCPUs     int      `toml:"max_vcpus"`
+	MinMemory    int      `toml:"min_memory"`
+	MaxMemory    int      `toml:"max_memory"`
+	KernelParams []string `toml:"kernel_params"`
+}
+
+// annotationPolicy decides which VM annotations a pod can use, and within
+// which bounds. The zero value rejects all the annotations.
+type annotationPolicy struct {
+	allowed map[string]bool
+
+	// maxVCPUs is the maximum number of vCPUs, which is at most the
+	// number of host CPUs.
+	maxVCPUs uint
+
+	// minMemory and maxMemory bound the memory in MiB, 0 meaning no
+	// bound.
+	minMemory uint
+	maxMemory uint
+
+	// kernelParams lists the names of the kernel parameters which can
+	// be added.
+	kernelParams map[string]bool
+}
+
+func newAnnotationPolicy(r runtime) (annotationPolicy, error) {
+	policy := annotationPolicy{
+		allowed:      make(map[string]bool),
+		kernelParams: make(map[string]bool),
+	}
+
+	for _, annotation := range r.AllowedAnnotations {
+		if !vmAnnotations[annotation] {
+			return annotationPolicy{}, fmt.Errorf("Invalid allowed_annotations entry %q: must be one of %s",
+				annotation, strings.Join(sortedVMAnnotations(), ", "))
+		}
+
+		policy.allowed[annotation] = true
+	}
+
+	bounds := r.AnnotationBounds
+
+	for key, value := range map[string]int{
+		"max_vcpus":  bounds.MaxVCPUs,
+		"min_memory": bounds.MinMemory,
+		"max_memory": bounds.MaxMemory,
+	} {
+		if value < 0 {
+			return annotationPolicy{}, fmt.Errorf("Invalid annotation_bounds %s %d: must be positive", key, value)
+		}
+	}
+
+	if bounds.MaxMemory > 0 && bounds.MinMemory > bounds.MaxMemory {
+		return annotationPolicy{}, fmt.Errorf("Invalid annotation_bounds: min_memory %d is larger than max_memory %d",
+			bounds.MinMemory, bounds.MaxMemory)
+	}
+
+	policy.maxVCPUs = uint(goruntime.NumCPU())
+	if bounds.MaxVCPUs > 0 && uint(bounds.MaxVCPUs) < policy.maxVCPUs {
+		policy.maxVCPUs = uint(bounds.MaxVCPUs)
+	}
+
+	policy.minMemory = uint(bounds.MinMemory)
+	policy.maxMemory = uint(bounds.MaxMemory)
+
+	for _, param := range bounds.KernelParams {
+		policy.kernelParams[param] = true
+	}
+
+	return policy, nil
+}
+
+func sortedVMAnnotations() []string {
+	var annotations []string
+
+	for annotation := range vmAnnotations {
+		annotations = append(annotations, annotation)
+	}
+
+	sort.Strings(annotations)
+
+	return annotations
+}
+
+// applyVMAnnotations returns the configuration of a pod modified by the
+// VM annotations of the spec, which override the VM size derived from the
+// resource limits. Any annotation which is unknown, not allowed or out of
+// bounds is rejected.
+func applyVMAnnotations(ociSpec oci.CompatOCISpec, config vc.PodConfig, policy annotationPolicy) (vc.PodConfig, error) {
+	var keys []string
+	for key := range ociSpec.Annotations {
+		if strings.HasPrefix(key, vmAnnotationPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := ociSpec.Annotations[key]
+
+		if !vmAnnotations[key] {
+			return vc.PodConfig{}, annotationError(key, value, "unknown annotation")
+		}
+
+		if !policy.allowed[key] {
+			return vc.PodConfig{}, annotationError(key, value, "not listed in allowed_annotations")
+		}
+
+		var err error
+
+		switch key {
+		case vcpusAnnotation:
+			config.VMConfig.VCPUs, err = policy.vcpus(key, value)
+		case memoryAnnotation:
+			config.VMConfig.Memory, err = policy.memory(key, value)
+		case memoryTargetAnnotation:
+			// The annotation sorts after the memory one, so the
+			// VM size is final. cc-reclaim reads the target from
+			// the annotations of the pod.
+			err = memoryTarget(key, value, config.VMConfig.Memory)
+			if err == nil {
+				config.Annotations = withAnnotation(config.Annotations, key, value)
+			}
+		case kernelParamsAnnotation:
+			config.HypervisorConfig.KernelParams, err = policy.extraKernelParams(key, value, config.HypervisorConfig.KernelParams)
+		case debugAnnotation:
+			config.HypervisorConfig.Debug, err = strconv.ParseBool(value)
+			if err != nil {
+				err = annotationError(key, value, "must be a boolean")
+			}
+		}
+
+		if err != nil {
+			return vc.PodConfig{}, err
+		}
+	}
+
+	return config, nil
+}
+
+func annotationError(key, value, reason string) error {
+	return newRuntimeError(errCodeUsage, "", "",
+		fmt.Errorf("Rejected annotation %s=%q: %s", key, value, reason))
+}
+
+func (p annotationPolicy) vcpus(key, value string) (uint, error) {
+	vcpus, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || vcpus == 0 {
+		return 0, annotationError(key, value, "must be a positive integer")
+	}
+
+	if uint(vcpus) > p.maxVCPUs {
+		return 0, annotationError(key, value, fmt.Sprintf("must be at most %d", p.maxVCPUs))
+	}
+
+	return uint(vcpus), nil
+}
+
+func (p annotationPolicy) memory(key, value string) (uint, error) {
+	memory, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || memory == 0 {
+		return 0, annotationError(key, value, "must be a positive number of MiB")
+	}
+
+	if uint(memory) < p.minMemory {
+		return 0, annotationError(key, value, fmt.Sprintf("must be at least %d MiB", p.minMemory))
+	}
+
+	if p.maxMemory > 0 && uint(memory) > p.maxMemory {
+		return 0, annotationError(key, value, fmt.Sprintf("must be at most %d MiB", p.maxMemory))
+	}
+
+	return uint(memory), nil
+}
+
+// memoryTarget checks the memory in MiB left to the guest of an idle pod
+// is within the memory of its VM, 0 meaning the VM size is unknown.
+func memoryTarget(key, value string, memory uint) error {
+	target, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || target == 0 {
+		return annotationError(key, value, "must be a positive number of MiB")
+	}
+
+	if memory > 0 && uint(target) > memory {
+		return annotationError(key, value, fmt.Sprintf("must be at most the VM memory, %d MiB", memory))
+	}
+
+	return nil
+}
+
+// withAnnotation returns a copy of the annotations with the specified one
+// added, as the annotations of the configuration must not be modified in
+// place.
+func withAnnotation(annotations map[string]string, key, value string) map[string]string {
+	result := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		result[k] = v
+	}
+
+	result[key] = value
+
+	return result
+}
+
+// extraKernelParams returns the kernel parameters of the configuration
+// followed by those of the annotation, whose names must be listed in the
+// kernel_params bound.
+func (p annotationPolicy) extraKernelParams(key, value string, params []vc.Param) ([]vc.Param, error) {
+	extraParams, err := parseKernelParams(value)
+	if err != nil {
+		return nil, annotationError(key, value, "invalid kernel parameters")
+	}
+
+	for _, param := range extraParams {
+		if !p.kernelParams[param.Key] {
+			return nil, annotationError(key, value,
+				fmt.Sprintf("kernel parameter %q is not listed in annotation_bounds kernel_params", param.Key))
+		}
+	}
+
+	// The parameters of the configuration are shared by all the pods,
+	// so they must not be appended to in place.
+	result := make([]vc.Param, 0, len(params)+len(extraParams))
+	result = append(result, params...)
+	result = append(result, extraParams...)
+
+	return result, nil
+}
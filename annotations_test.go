@@ -0,0 +1,208 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	goruntime "runtime"
+	"testing"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAnnotationPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := newAnnotationPolicy(runtime{})
+	assert.NoError(err)
+	assert.Empty(policy.allowed)
+	assert.Equal(uint(goruntime.NumCPU()), policy.maxVCPUs)
+
+	policy, err = newAnnotationPolicy(runtime{
+		AllowedAnnotations: []string{vcpusAnnotation, memoryAnnotation},
+		AnnotationBounds: annotationBounds{
+			MaxVCPUs:     1,
+			MinMemory:    256,
+			MaxMemory:    4096,
+			KernelParams: []string{"quiet"},
+		},
+	})
+	assert.NoError(err)
+	assert.Equal(map[string]bool{vcpusAnnotation: true, memoryAnnotation: true}, policy.allowed)
+	assert.Equal(uint(1), policy.maxVCPUs)
+	assert.Equal(uint(256), policy.minMemory)
+	assert.Equal(uint(4096), policy.maxMemory)
+	assert.Equal(map[string]bool{"quiet": true}, policy.kernelParams)
+
+	for _, r := range []runtime{
+		{AllowedAnnotations: []string{"com.intel.cc.vm.foo"}},
+		{AllowedAnnotations: []string{"vcpus"}},
+		{AnnotationBounds: annotationBounds{MaxVCPUs: -1}},
+		{AnnotationBounds: annotationBounds{MinMemory: -1}},
+		{AnnotationBounds: annotationBounds{MinMemory: 512, MaxMemory: 256}},
+	} {
+		_, err := newAnnotationPolicy(r)
+		assert.Error(err, "%+v", r)
+	}
+}
+
+func TestApplyVMAnnotations(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := newAnnotationPolicy(runtime{
+		AllowedAnnotations: []string{vcpusAnnotation, memoryAnnotation, memoryTargetAnnotation, kernelParamsAnnotation, debugAnnotation},
+		AnnotationBounds: annotationBounds{
+			MaxVCPUs:     1,
+			MinMemory:    256,
+			MaxMemory:    4096,
+			KernelParams: []string{"quiet", "systemd.show_status"},
+		},
+	})
+	assert.NoError(err)
+
+	config := vc.PodConfig{
+		HypervisorConfig: vc.HypervisorConfig{
+			KernelParams: make([]vc.Param, 1, 4),
+		},
+		VMConfig:    vc.Resources{VCPUs: 1, Memory: 2048},
+		Annotations: map[string]string{"io.other.annotation": "ignored"},
+	}
+	config.HypervisorConfig.KernelParams[0] = vc.Param{Key: "root", Value: "/dev/pmem0p1"}
+
+	spec := oci.CompatOCISpec{Spec: specs.Spec{Annotations: map[string]string{
+		"io.other.annotation":  "ignored",
+		vcpusAnnotation:        "1",
+		memoryAnnotation:       "512",
+		memoryTargetAnnotation: "256",
+		kernelParamsAnnotation: "quiet systemd.show_status=false",
+		debugAnnotation:        "true",
+	}}}
+
+	result, err := applyVMAnnotations(spec, config, policy)
+	assert.NoError(err)
+	assert.Equal(vc.Resources{VCPUs: 1, Memory: 512}, result.VMConfig)
+	assert.True(result.HypervisorConfig.Debug)
+	assert.Equal(map[string]string{
+		"io.other.annotation":  "ignored",
+		memoryTargetAnnotation: "256",
+	}, result.Annotations)
+	assert.Equal([]vc.Param{
+		{Key: "root", Value: "/dev/pmem0p1"},
+		{Key: "quiet"},
+		{Key: "systemd.show_status", Value: "false"},
+	}, result.HypervisorConfig.KernelParams)
+
+	// The configuration of the profile is left untouched.
+	assert.Equal(vc.Resources{VCPUs: 1, Memory: 2048}, config.VMConfig)
+	assert.False(config.HypervisorConfig.Debug)
+	assert.Equal(map[string]string{"io.other.annotation": "ignored"}, config.Annotations)
+	assert.Equal([]vc.Param{{Key: "root", Value: "/dev/pmem0p1"}}, config.HypervisorConfig.KernelParams)
+	assert.Equal(vc.Param{}, config.HypervisorConfig.KernelParams[:2][1])
+
+	// Without annotations, the configuration is unchanged.
+	result, err = applyVMAnnotations(oci.CompatOCISpec{}, config, policy)
+	assert.NoError(err)
+	assert.Equal(config, result)
+}
+
+func TestApplyVMAnnotationsRejected(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := newAnnotationPolicy(runtime{
+		AllowedAnnotations: []string{vcpusAnnotation, memoryAnnotation, memoryTargetAnnotation, kernelParamsAnnotation, debugAnnotation},
+		AnnotationBounds: annotationBounds{
+			MaxVCPUs:     1,
+			MinMemory:    256,
+			MaxMemory:    4096,
+			KernelParams: []string{"quiet"},
+		},
+	})
+	assert.NoError(err)
+
+	type testData struct {
+		key   string
+		value string
+	}
+
+	for _, d := range []testData{
+		{"com.intel.cc.vm.foo", "1"},
+		{vcpusAnnotation, "0"},
+		{vcpusAnnotation, "2"},
+		{vcpusAnnotation, "-1"},
+		{vcpusAnnotation, "one"},
+		{memoryAnnotation, "128"},
+		{memoryAnnotation, "8192"},
+		{memoryAnnotation, "0"},
+		{memoryTargetAnnotation, "0"},
+		{memoryTargetAnnotation, "-1"},
+		{kernelParamsAnnotation, "init=/bin/sh"},
+		{kernelParamsAnnotation, "quiet init=/bin/sh"},
+		{debugAnnotation, "yes please"},
+	} {
+		spec := oci.CompatOCISpec{Spec: specs.Spec{Annotations: map[string]string{d.key: d.value}}}
+
+		_, err := applyVMAnnotations(spec, vc.PodConfig{}, policy)
+		assert.Error(err, "%+v", d)
+		assert.Equal(errCodeUsage, classifyError(err).code, "%+v", d)
+		assert.Contains(err.Error(), d.key)
+	}
+
+	// The memory target cannot exceed the memory of the VM, as
+	// overridden by the memory annotation.
+	spec := oci.CompatOCISpec{Spec: specs.Spec{Annotations: map[string]string{
+		memoryAnnotation:       "512",
+		memoryTargetAnnotation: "1024",
+	}}}
+
+	_, err = applyVMAnnotations(spec, vc.PodConfig{VMConfig: vc.Resources{Memory: 2048}}, policy)
+	assert.Error(err)
+	assert.Contains(err.Error(), memoryTargetAnnotation)
+
+	// The zero policy rejects all the annotations.
+	spec = oci.CompatOCISpec{Spec: specs.Spec{Annotations: map[string]string{vcpusAnnotation: "1"}}}
+
+	_, err = applyVMAnnotations(spec, vc.PodConfig{}, annotationPolicy{})
+	assert.Error(err)
+	assert.Contains(err.Error(), "not listed in allowed_annotations")
+}
+
+func TestLoadConfigurationAnnotations(t *testing.T) {
+	assert := assert.New(t)
+
+	configPath, err := createConfig("runtime.toml", testProfilesConfig+`
+	[runtime]
+	allowed_annotations = ["com.intel.cc.vm.memory"]
+
+	[runtime.annotation_bounds]
+	max_memory = 1024
+`)
+	assert.NoError(err)
+
+	_, _, _, settings, err := loadConfiguration(configPath, true)
+	assert.NoError(err)
+	assert.Equal(map[string]bool{memoryAnnotation: true}, settings.annotations.allowed)
+	assert.Equal(uint(1024), settings.annotations.maxMemory)
+
+	configPath, err = createConfig("runtime.toml", testProfilesConfig+`
+	[runtime]
+	allowed_annotations = ["com.intel.cc.vm.kernel"]
+`)
+	assert.NoError(err)
+
+	_, _, _, _, err = loadConfiguration(configPath, true)
+	assert.Error(err)
+}
@@ -0,0 +1,324 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/BurntSushi/toml"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
+)
+
+const (
+	// imageMetadataSuffix is appended to the path of the image to find
+	// the metadata file describing it.
+	imageMetadataSuffix = ".metadata.toml"
+
+	// hyperstartProtocol is the version of the hyperstart protocol
+	// spoken by the runtime.
+	hyperstartProtocol = 1
+
+	// checksumCacheMode is the mode used to create the checksum cache.
+	checksumCacheMode = os.FileMode(0640)
+
+	// checksumCacheDirMode is the mode used to create the directory
+	// holding the checksum cache.
+	checksumCacheDirMode = os.FileMode(0750)
+)
+
+// checksumCachePath caches the checksums of the VM files, which are too
+// large to be hashed each time a VM starts. It is a variable to allow
+// tests to modify it.
+var checksumCachePath = filepath.Join(defaultRuntimeLib, "checksums.json")
+
+// supportedAgentProtocols is the version of the protocol of each agent
+// the runtime talks to inside the VM.
+var supportedAgentProtocols = map[vc.AgentType]int{
+	vc.HyperstartAgent: hyperstartProtocol,
+}
+
+// vmAsset is a file a VM is started from.
+type vmAsset struct {
+	// kind is "hypervisor", "kernel", "image" or "initrd".
+	kind string
+	path string
+
+	// sha256 is the expected checksum of the file, an empty string
+	// meaning it is not verified.
+	sha256 string
+}
+
+// vmAssets are the files the VMs of a profile are started from.
+type vmAssets struct {
+	files []vmAsset
+
+	// image is the path of the image or initrd the guest boots from,
+	// next to which its metadata file may be found.
+	image string
+
+	// agent is the agent expected to run in the image.
+	agent vc.AgentType
+}
+
+// imageMetadata is the content of the metadata file of an image.
+type imageMetadata struct {
+	Agent         string `toml:"agent"`
+	AgentProtocol int    `toml:"agent_protocol"`
+}
+
+// checksumCacheEntry is the checksum of a file, valid as long as the file
+// has the same inode, size and modification time.
+type checksumCacheEntry struct {
+	Device  uint64 `json:"device"`
+	Inode   uint64 `json:"inode"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	SHA256  string `json:"sha256"`
+}
+
+// checkSHA256 checks the syntax of a checksum of the configuration file.
+func checkSHA256(key, sum string) error {
+	if sum == "" {
+		return nil
+	}
+
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+		return fmt.Errorf("Invalid %s %q: must be %d hexadecimal digits", key, sum, 2*sha256.Size)
+	}
+
+	return nil
+}
+
+// newVMAssets returns the files the VMs described by the configuration
+// are started from. The mock hypervisor starts no VM, so it has none.
+func newVMAssets(tomlConf tomlConfig, config oci.RuntimeConfig) (vmAssets, error) {
+	for k, h := range tomlConf.Hypervisor {
+		if k != qemu && k != qemuLite {
+			continue
+		}
+
+		for key, sum := range map[string]string{
+			"path_sha256":   h.PathSHA256,
+			"kernel_sha256": h.KernelSHA256,
+			"image_sha256":  h.ImageSHA256,
+			"initrd_sha256": h.InitrdSHA256,
+		} {
+			if err := checkSHA256(key, sum); err != nil {
+				return vmAssets{}, err
+			}
+		}
+
+		hConfig := config.HypervisorConfig
+
+		// The checksums are computed as lowercase hexadecimal digits,
+		// which the configuration can write in uppercase.
+		h.PathSHA256 = strings.ToLower(h.PathSHA256)
+		h.KernelSHA256 = strings.ToLower(h.KernelSHA256)
+		h.ImageSHA256 = strings.ToLower(h.ImageSHA256)
+		h.InitrdSHA256 = strings.ToLower(h.InitrdSHA256)
+
+		assets := vmAssets{
+			files: []vmAsset{
+				{"hypervisor", hConfig.HypervisorPath, h.PathSHA256},
+				{"kernel", hConfig.KernelPath, h.KernelSHA256},
+			},
+			agent: config.AgentType,
+		}
+
+		if hConfig.InitrdPath != "" {
+			if h.ImageSHA256 != "" {
+				return vmAssets{}, errors.New("image_sha256 cannot be set with initrd")
+			}
+
+			assets.files = append(assets.files, vmAsset{"initrd", hConfig.InitrdPath, h.InitrdSHA256})
+			assets.image = hConfig.InitrdPath
+		} else {
+			if h.InitrdSHA256 != "" {
+				return vmAssets{}, errors.New("initrd_sha256 cannot be set without initrd")
+			}
+
+			assets.files = append(assets.files, vmAsset{"image", hConfig.ImagePath, h.ImageSHA256})
+			assets.image = hConfig.ImagePath
+		}
+
+		return assets, nil
+	}
+
+	return vmAssets{}, nil
+}
+
+// verify checks the files of the VMs against their checksums and the
+// metadata of the image against the agent, so that a VM which could not
+// work is not started.
+func (a vmAssets) verify() error {
+	for _, file := range a.files {
+		if err := file.verify(); err != nil {
+			return err
+		}
+	}
+
+	if a.image == "" {
+		return nil
+	}
+
+	_, err := checkImageMetadata(a.image, a.agent)
+
+	return err
+}
+
+func (f vmAsset) verify() error {
+	if f.sha256 == "" {
+		return nil
+	}
+
+	sum, err := fileSHA256(f.path)
+	if err != nil {
+		return fmt.Errorf("Cannot verify %s %v: %v", f.kind, f.path, err)
+	}
+
+	if sum != f.sha256 {
+		return fmt.Errorf("Checksum mismatch for %s %v: expected sha256 %s, got %s",
+			f.kind, f.path, f.sha256, sum)
+	}
+
+	return nil
+}
+
+// checkImageMetadata checks that the agent declared by the metadata file
+// of the image, if any, is the one configured and that the runtime
+// speaks its protocol. It returns whether the metadata file exists.
+func checkImageMetadata(image string, agent vc.AgentType) (bool, error) {
+	path := image + imageMetadataSuffix
+
+	var metadata imageMetadata
+	if _, err := toml.DecodeFile(path, &metadata); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return true, fmt.Errorf("Invalid image metadata %v: %v", path, err)
+	}
+
+	// The noop agent does not talk to the image.
+	if agent == vc.NoopAgentType {
+		return true, nil
+	}
+
+	if metadata.Agent != "" && vc.AgentType(metadata.Agent) != agent {
+		return true, fmt.Errorf("Image %v is built for the %s agent, not %s", image, metadata.Agent, agent)
+	}
+
+	if metadata.AgentProtocol != 0 && metadata.AgentProtocol != supportedAgentProtocols[agent] {
+		return true, fmt.Errorf("Image %v uses version %d of the %s protocol, the runtime supports version %d",
+			image, metadata.AgentProtocol, agent, supportedAgentProtocols[agent])
+	}
+
+	return true, nil
+}
+
+// fileSHA256 returns the checksum of a file, which is only computed when
+// the cache does not hold it.
+func fileSHA256(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	entry := checksumCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		entry.Device = uint64(stat.Dev)
+		entry.Inode = stat.Ino
+	}
+
+	cache := readChecksumCache(checksumCachePath)
+
+	if cached, ok := cache[path]; ok && cached.sameFile(entry) {
+		return cached.SHA256, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	cache[path] = entry
+
+	// The cache only saves time, so the checksum is valid even if it
+	// cannot be stored.
+	if err := writeChecksumCache(checksumCachePath, cache); err != nil {
+		ccLog.Warnf("Cannot update the checksum cache: %v", err)
+	}
+
+	return entry.SHA256, nil
+}
+
+// sameFile returns whether the entries describe the same version of a
+// file.
+func (e checksumCacheEntry) sameFile(other checksumCacheEntry) bool {
+	return e.Device == other.Device && e.Inode == other.Inode &&
+		e.Size == other.Size && e.ModTime == other.ModTime
+}
+
+// readChecksumCache returns the checksum cache, which is empty if it does
+// not exist or cannot be read.
+func readChecksumCache(path string) map[string]checksumCacheEntry {
+	cache := make(map[string]checksumCacheEntry)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return make(map[string]checksumCacheEntry)
+	}
+
+	return cache
+}
+
+func writeChecksumCache(path string, cache map[string]checksumCacheEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), checksumCacheDirMode); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, checksumCacheMode)
+}
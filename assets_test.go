@@ -0,0 +1,342 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+// setTestChecksumCachePath makes the checksum cache live in dir until the
+// returned function is called.
+func setTestChecksumCachePath(dir string) func() {
+	savedChecksumCachePath := checksumCachePath
+	checksumCachePath = filepath.Join(dir, "checksums.json")
+
+	return func() {
+		checksumCachePath = savedChecksumCachePath
+	}
+}
+
+func testSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// makeTestVMAssets creates the files of a VM in dir, each holding its
+// kind, and returns them with the right checksums.
+func makeTestVMAssets(dir string) (vmAssets, error) {
+	assets := vmAssets{agent: vc.HyperstartAgent}
+
+	for _, kind := range []string{"hypervisor", "kernel", "image"} {
+		path := filepath.Join(dir, kind)
+
+		if err := ioutil.WriteFile(path, []byte(kind), testFileMode); err != nil {
+			return vmAssets{}, err
+		}
+
+		assets.files = append(assets.files, vmAsset{kind, path, testSHA256(kind)})
+	}
+
+	assets.image = filepath.Join(dir, "image")
+
+	return assets, nil
+}
+
+func TestCheckSHA256(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(checkSHA256("image_sha256", ""))
+	assert.NoError(checkSHA256("image_sha256", testSHA256("image")))
+
+	for _, sum := range []string{"1234", testSHA256("image")[1:], "z" + testSHA256("image")[1:]} {
+		err := checkSHA256("image_sha256", sum)
+		assert.Error(err, sum)
+		assert.Contains(err.Error(), "image_sha256")
+	}
+}
+
+func TestVMAssetsVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "assets-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	defer setTestChecksumCachePath(dir)()
+
+	assets, err := makeTestVMAssets(dir)
+	assert.NoError(err)
+	assert.NoError(assets.verify())
+
+	// A file without checksum is not verified.
+	assets.files[0].sha256 = ""
+	assert.NoError(ioutil.WriteFile(assets.files[0].path, []byte("tampered"), testFileMode))
+	assert.NoError(assets.verify())
+
+	assets.files[1].sha256 = testSHA256("other kernel")
+	err = assets.verify()
+	assert.Error(err)
+	assert.Contains(err.Error(), "Checksum mismatch for kernel")
+
+	assets.files[1].sha256 = testSHA256("kernel")
+	assert.NoError(os.Remove(assets.files[2].path))
+	err = assets.verify()
+	assert.Error(err)
+	assert.Contains(err.Error(), "Cannot verify image")
+
+	// The mock hypervisor has no files to verify.
+	assert.NoError(vmAssets{}.verify())
+}
+
+func TestFileSHA256Cache(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "assets-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	defer setTestChecksumCachePath(dir)()
+
+	path := filepath.Join(dir, "image")
+	assert.NoError(ioutil.WriteFile(path, []byte("image"), testFileMode))
+
+	sum, err := fileSHA256(path)
+	assert.NoError(err)
+	assert.Equal(testSHA256("image"), sum)
+
+	cache := readChecksumCache(checksumCachePath)
+	assert.Equal(sum, cache[path].SHA256)
+
+	// The cached checksum is used while the file is unchanged.
+	entry := cache[path]
+	entry.SHA256 = testSHA256("cached")
+	cache[path] = entry
+	assert.NoError(writeChecksumCache(checksumCachePath, cache))
+
+	sum, err = fileSHA256(path)
+	assert.NoError(err)
+	assert.Equal(testSHA256("cached"), sum)
+
+	// Modifying the file invalidates the cached checksum.
+	mtime := time.Now().Add(time.Hour)
+	assert.NoError(os.Chtimes(path, mtime, mtime))
+
+	sum, err = fileSHA256(path)
+	assert.NoError(err)
+	assert.Equal(testSHA256("image"), sum)
+
+	// A corrupted cache is ignored.
+	assert.NoError(ioutil.WriteFile(checksumCachePath, []byte("{"), testFileMode))
+
+	sum, err = fileSHA256(path)
+	assert.NoError(err)
+	assert.Equal(testSHA256("image"), sum)
+}
+
+func TestCheckImageMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "assets-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image")
+	metadataPath := image + imageMetadataSuffix
+
+	found, err := checkImageMetadata(image, vc.HyperstartAgent)
+	assert.NoError(err)
+	assert.False(found)
+
+	type testData struct {
+		metadata string
+		agent    vc.AgentType
+		valid    bool
+	}
+
+	for _, d := range []testData{
+		{`agent = "hyperstart"`, vc.HyperstartAgent, true},
+		{`agent_protocol = 1`, vc.HyperstartAgent, true},
+		{"agent = \"hyperstart\"\nagent_protocol = 1", vc.HyperstartAgent, true},
+		{"agent = \"hyperstart\"\nagent_protocol = 2", vc.HyperstartAgent, false},
+		{`agent = "sshd"`, vc.HyperstartAgent, false},
+		{`agent = "sshd"`, vc.NoopAgentType, true},
+		{`agent_protocol = "one"`, vc.HyperstartAgent, false},
+	} {
+		assert.NoError(ioutil.WriteFile(metadataPath, []byte(d.metadata), testFileMode))
+
+		found, err := checkImageMetadata(image, d.agent)
+		assert.True(found)
+		if d.valid {
+			assert.NoError(err, "%+v", d)
+		} else {
+			assert.Error(err, "%+v", d)
+		}
+	}
+}
+
+func TestNewVMAssets(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "assets-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	_, err = makeTestVMAssets(dir)
+	assert.NoError(err)
+
+	config := `
+	[hypervisor.qemu-lite]
+	path = "` + filepath.Join(dir, "hypervisor") + `"
+	kernel = "` + filepath.Join(dir, "kernel") + `"
+	image = "` + filepath.Join(dir, "image") + `"
+	kernel_sha256 = "` + testSHA256("kernel") + `"
+
+	[agent.noop]
+
+	[proxy.noop]
+
+	[shim.noop]
+
+	[profile.sim.hypervisor.mock]
+`
+
+	configPath, err := createConfig("runtime.toml", config)
+	assert.NoError(err)
+
+	_, _, _, settings, err := loadConfiguration(configPath, true)
+	assert.NoError(err)
+
+	assets := settings.profiles.assets[defaultProfile]
+	assert.Equal([]vmAsset{
+		{"hypervisor", filepath.Join(dir, "hypervisor"), ""},
+		{"kernel", filepath.Join(dir, "kernel"), testSHA256("kernel")},
+		{"image", filepath.Join(dir, "image"), ""},
+	}, assets.files)
+	assert.Equal(filepath.Join(dir, "image"), assets.image)
+	assert.Equal(vc.NoopAgentType, assets.agent)
+
+	assert.Equal(vmAssets{}, settings.profiles.assets["sim"])
+
+	configPath, err = createConfig("runtime.toml",
+		strings.Replace(config, testSHA256("kernel"), "kernel", 1))
+	assert.NoError(err)
+
+	_, _, _, _, err = loadConfiguration(configPath, true)
+	assert.Error(err)
+	assert.Contains(err.Error(), "kernel_sha256")
+
+	// The checksums can be written in uppercase.
+	configPath, err = createConfig("runtime.toml",
+		strings.Replace(config, testSHA256("kernel"), strings.ToUpper(testSHA256("kernel")), 1))
+	assert.NoError(err)
+
+	_, _, _, settings, err = loadConfiguration(configPath, true)
+	assert.NoError(err)
+	assert.NoError(settings.profiles.assets[defaultProfile].verify())
+
+	// The initrd replaces the image.
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "initrd"), []byte("initrd"), testFileMode))
+
+	initrdConfig := strings.Replace(config, `image = "`+filepath.Join(dir, "image")+`"`,
+		`initrd = "`+filepath.Join(dir, "initrd")+`"
+	initrd_sha256 = "`+testSHA256("initrd")+`"`, 1)
+
+	configPath, err = createConfig("runtime.toml", initrdConfig)
+	assert.NoError(err)
+
+	_, _, _, settings, err = loadConfiguration(configPath, true)
+	assert.NoError(err)
+
+	assets = settings.profiles.assets[defaultProfile]
+	assert.Equal(vmAsset{"initrd", filepath.Join(dir, "initrd"), testSHA256("initrd")}, assets.files[2])
+	assert.Equal(filepath.Join(dir, "initrd"), assets.image)
+
+	configPath, err = createConfig("runtime.toml", strings.Replace(initrdConfig, "initrd_sha256", "image_sha256", 1))
+	assert.NoError(err)
+
+	_, _, _, _, err = loadConfiguration(configPath, true)
+	assert.Error(err)
+	assert.Contains(err.Error(), "image_sha256")
+}
+
+func TestGetVerificationInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "assets-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	defer setTestChecksumCachePath(dir)()
+
+	assert.Equal(VerificationInfo{
+		Hypervisor:    verificationNotConfigured,
+		Kernel:        verificationNotConfigured,
+		Image:         verificationNotConfigured,
+		Initrd:        verificationNotConfigured,
+		ImageMetadata: verificationAbsent,
+	}, getVerificationInfo(vmAssets{}))
+
+	assets, err := makeTestVMAssets(dir)
+	assert.NoError(err)
+
+	assets.files[0].sha256 = ""
+	assets.files[1].sha256 = testSHA256("other kernel")
+	assert.NoError(ioutil.WriteFile(assets.image+imageMetadataSuffix, []byte(`agent_protocol = 1`), testFileMode))
+
+	info := getVerificationInfo(assets)
+	assert.Equal(verificationNotConfigured, info.Hypervisor)
+	assert.Contains(info.Kernel, "Checksum mismatch")
+	assert.Equal(verificationOK, info.Image)
+	assert.Equal(verificationOK, info.ImageMetadata)
+}
+
+func TestCheckVMAssets(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "assets-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	defer setTestChecksumCachePath(dir)()
+
+	assets, err := makeTestVMAssets(dir)
+	assert.NoError(err)
+
+	profiles := runtimeProfiles{
+		assets: map[string]vmAssets{
+			defaultProfile: assets,
+			"sim":          {},
+		},
+		configs: map[string]oci.RuntimeConfig{
+			defaultProfile: {},
+			"sim":          {},
+		},
+	}
+
+	assert.NoError(checkVMAssets(profiles))
+
+	assert.NoError(ioutil.WriteFile(assets.image, []byte("tampered"), testFileMode))
+
+	err = checkVMAssets(profiles)
+	assert.Error(err)
+	assert.Contains(err.Error(), `profile "default"`)
+}
@@ -16,9 +16,11 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/urfave/cli"
@@ -40,6 +42,7 @@ const (
 // variables rather than consts to allow tests to modify them
 var (
 	procCPUInfo  = "/proc/cpuinfo"
+	procMemInfo  = "/proc/meminfo"
 	sysModuleDir = "/sys/module"
 	modInfoCmd   = "modinfo"
 )
@@ -223,6 +226,99 @@ func hostIsClearContainersCapable(cpuinfoFile string) error {
 	return nil
 }
 
+// checkVMAssets verifies the files the VMs of every profile are started
+// from.
+func checkVMAssets(profiles runtimeProfiles) error {
+	for _, name := range profiles.names() {
+		assets := profiles.assets[name]
+
+		if err := assets.verify(); err != nil {
+			return fmt.Errorf("profile %q: %v", name, err)
+		}
+
+		verified := 0
+		for _, file := range assets.files {
+			if file.sha256 != "" {
+				verified++
+			}
+		}
+
+		ccLog.Infof("Profile %q: %d of %d VM files verified", name, verified, len(assets.files))
+	}
+
+	return nil
+}
+
+// getFreeHugePages returns the memory in MiB available as free huge
+// pages, as reported by the specified meminfo file.
+func getFreeHugePages(memInfoFile string) (uint64, error) {
+	bytes, err := ioutil.ReadFile(memInfoFile)
+	if err != nil {
+		return 0, err
+	}
+
+	var free, size uint64
+	var foundFree, foundSize bool
+
+	for _, line := range strings.Split(string(bytes), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "HugePages_Free:":
+			free, err = strconv.ParseUint(fields[1], 10, 64)
+			foundFree = true
+		case "Hugepagesize:":
+			// size is expressed in kB
+			size, err = strconv.ParseUint(fields[1], 10, 64)
+			foundSize = true
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("Invalid line in %s: %q", memInfoFile, line)
+		}
+	}
+
+	if !foundFree || !foundSize {
+		return 0, fmt.Errorf("No huge pages information in %s", memInfoFile)
+	}
+
+	return free * size / 1024, nil
+}
+
+// checkHugePages verifies enough huge pages are reserved to start a VM
+// of every profile backed by huge pages.
+func checkHugePages(profiles runtimeProfiles, memInfoFile string) error {
+	var freeMemory uint64
+	var err error
+
+	for _, name := range profiles.names() {
+		config := profiles.configs[name]
+
+		if !config.HypervisorConfig.HugePages {
+			continue
+		}
+
+		if freeMemory == 0 {
+			if freeMemory, err = getFreeHugePages(memInfoFile); err != nil {
+				return err
+			}
+		}
+
+		memory := uint64(config.VMConfig.Memory)
+		if freeMemory < memory {
+			return fmt.Errorf("profile %q: %dMiB of huge pages required but only %dMiB free",
+				name, memory, freeMemory)
+		}
+
+		ccLog.Infof("Profile %q: %dMiB of huge pages required, %dMiB free", name, memory, freeMemory)
+	}
+
+	return nil
+}
+
 var ccCheckCommand = cli.Command{
 	Name:  "cc-check",
 	Usage: "tests if system can run " + project,
@@ -232,6 +328,21 @@ var ccCheckCommand = cli.Command{
 			return fmt.Errorf("ERROR: %v", err)
 		}
 
+		// beforeSubcommands() does not load the configuration
+		// for this command.
+		_, _, _, settings, err := loadConfiguration(context.GlobalString("cc-config"), true)
+		if err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+
+		if err = checkVMAssets(settings.profiles); err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+
+		if err = checkHugePages(settings.profiles, procMemInfo); err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+
 		ccLog.Info("")
 		ccLog.Info("System is capable of running " + project)
 
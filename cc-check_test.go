@@ -21,6 +21,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -446,3 +448,83 @@ func TestCheckHostIsClearContainersCapable(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckGetFreeHugePages(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "meminfo-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "meminfo")
+
+	// file doesn't exist
+	_, err = getFreeHugePages(file)
+	assert.Error(err)
+
+	type testData struct {
+		contents       string
+		expectedResult uint64
+		expectError    bool
+	}
+
+	data := []testData{
+		{"", 0, true},
+		{"MemTotal: 16318704 kB\n", 0, true},
+		{"HugePages_Free: 512\n", 0, true},
+		{"HugePages_Free: foo\nHugepagesize: 2048 kB\n", 0, true},
+		{"HugePages_Free: 0\nHugepagesize: 2048 kB\n", 0, false},
+		{"MemTotal: 16318704 kB\nHugePages_Total: 512\nHugePages_Free: 256\nHugepagesize: 2048 kB\n", 512, false},
+		{"HugePages_Free: 2\nHugepagesize: 1048576 kB\n", 2048, false},
+	}
+
+	for _, d := range data {
+		assert.NoError(createFile(file, d.contents))
+
+		free, err := getFreeHugePages(file)
+		if d.expectError {
+			assert.Error(err, "contents: %q", d.contents)
+			continue
+		}
+
+		assert.NoError(err, "contents: %q", d.contents)
+		assert.Equal(d.expectedResult, free, "contents: %q", d.contents)
+	}
+}
+
+func TestCheckCheckHugePages(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "meminfo-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "meminfo")
+
+	profiles := runtimeProfiles{
+		configs: map[string]oci.RuntimeConfig{
+			defaultProfile: {
+				VMConfig: vc.Resources{Memory: 1024},
+			},
+		},
+		defaultName: defaultProfile,
+	}
+
+	// no profile uses huge pages so the file is not read
+	assert.NoError(checkHugePages(profiles, file))
+
+	profiles.configs["hugepages"] = oci.RuntimeConfig{
+		HypervisorConfig: vc.HypervisorConfig{HugePages: true},
+		VMConfig:         vc.Resources{Memory: 1024},
+	}
+
+	assert.Error(checkHugePages(profiles, file))
+
+	assert.NoError(createFile(file, "HugePages_Free: 256\nHugepagesize: 2048 kB\n"))
+	err = checkHugePages(profiles, file)
+	assert.Error(err)
+	assert.Contains(err.Error(), `profile "hugepages"`)
+
+	assert.NoError(createFile(file, "HugePages_Free: 512\nHugepagesize: 2048 kB\n"))
+	assert.NoError(checkHugePages(profiles, file))
+}
@@ -0,0 +1,538 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+const (
+	// collectBundleDir is the top-level directory of every file
+	// stored in the bundle.
+	collectBundleDir = name + "-collect"
+
+	// collectErrorsFile lists the items that could not be collected.
+	collectErrorsFile = "errors.txt"
+
+	// collectLogTailLines is the maximum number of lines kept from
+	// the end of a log.
+	collectLogTailLines = 1000
+
+	// collectLogTailBytes is the maximum number of bytes read from
+	// the end of a log file.
+	collectLogTailBytes = 1024 * 1024
+
+	// collectFileMode is the mode of the files stored in the bundle
+	// and of the bundle itself.
+	collectFileMode = os.FileMode(0600)
+
+	// redactedValue replaces every redacted value.
+	redactedValue = "<redacted>"
+
+	// podConsoleSocket is the name of the socket virtcontainers
+	// exposes the guest console on.
+	podConsoleSocket = "console.sock"
+)
+
+// variables rather than consts to allow tests to modify them
+var (
+	// vcConfigStoragePath and vcRunStoragePath are the virtcontainers
+	// directories holding the configuration and the runtime state of
+	// every pod.
+	vcConfigStoragePath = "/var/lib/virtcontainers/pods"
+	vcRunStoragePath    = "/run/virtcontainers/pods"
+
+	dmesgCmd = "dmesg"
+
+	// consoleReadTimeout is the time given to the guest console to
+	// provide its buffered output.
+	consoleReadTimeout = time.Second
+)
+
+var errNeedBundleOutput = errors.New("Missing bundle output path")
+
+// collectParams holds everything required to build a bundle.
+type collectParams struct {
+	containerID   string
+	output        string
+	redact        bool
+	configFile    string
+	logfilePath   string
+	runtimeConfig oci.RuntimeConfig
+	profiles      runtimeProfiles
+}
+
+// collectItem describes one file of the bundle and how to obtain
+// its contents.
+type collectItem struct {
+	name    string
+	collect func() ([]byte, error)
+
+	// redact is true if the item is JSON which may contain
+	// environment variables or annotations.
+	redact bool
+}
+
+// bundleWriter adds files to a compressed tar archive.
+type bundleWriter struct {
+	tw     *tar.Writer
+	now    time.Time
+	errors []string
+}
+
+var ccCollectCommand = cli.Command{
+	Name:  "cc-collect",
+	Usage: "gather diagnostic information into a bundle for bug reports",
+	Description: `The cc-collect command creates a compressed tar archive holding the
+   runtime environment, its configuration, the tail of the global log and
+   of the host kernel log, the host capability checks and, if a container
+   is specified, the stored state of its pod and the guest console output.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "container",
+			Usage: "also collect the details of the specified container",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "path of the bundle to create (for example bundle.tar.gz)",
+		},
+		cli.BoolFlag{
+			Name:  "redact",
+			Usage: "replace environment variables and annotations values in the bundle",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		metadata := context.App.Metadata
+
+		configFile, ok := metadata["configFile"].(string)
+		if !ok {
+			return errors.New("cannot determine config file")
+		}
+
+		runtimeConfig, ok := metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if !ok {
+			return errors.New("cannot determine runtime config")
+		}
+
+		logfilePath, ok := metadata["logfilePath"].(string)
+		if !ok {
+			return errors.New("cannot determine logfile config")
+		}
+
+		settings, ok := metadata["runtimeSettings"].(runtimeSettings)
+		if !ok {
+			return errors.New("cannot determine runtime settings")
+		}
+
+		return collect(collectParams{
+			containerID:   context.String("container"),
+			output:        context.String("output"),
+			redact:        context.Bool("redact"),
+			configFile:    configFile,
+			logfilePath:   logfilePath,
+			runtimeConfig: runtimeConfig,
+			profiles:      settings.profiles,
+		})
+	},
+}
+
+// collect creates the bundle described by params.
+func collect(params collectParams) (err error) {
+	if params.output == "" {
+		return errNeedBundleOutput
+	}
+
+	items, err := collectItems(params)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(params.output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, collectFileMode)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			os.Remove(params.output)
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+
+	b := &bundleWriter{
+		tw:  tar.NewWriter(gz),
+		now: time.Now(),
+	}
+
+	for _, item := range items {
+		data, err := item.collect()
+		if err == nil && item.redact && params.redact {
+			data, err = redactJSON(data)
+		}
+
+		if err != nil {
+			ccLog.Warnf("Failed to collect %s: %v", item.name, err)
+			b.errors = append(b.errors, fmt.Sprintf("%s: %v", item.name, err))
+			continue
+		}
+
+		if err := b.addFile(item.name, data); err != nil {
+			return err
+		}
+	}
+
+	if len(b.errors) > 0 {
+		if err := b.addFile(collectErrorsFile, []byte(strings.Join(b.errors, "\n")+"\n")); err != nil {
+			return err
+		}
+	}
+
+	if err := b.tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// collectItems returns the list of items to store in the bundle.
+func collectItems(params collectParams) ([]collectItem, error) {
+	items := []collectItem{
+		{
+			name: "cc-env.toml",
+			collect: func() ([]byte, error) {
+				return collectEnv(params)
+			},
+		},
+		{
+			name:    "cc-check.txt",
+			collect: collectCheck,
+		},
+		{
+			name: "configuration.toml",
+			collect: func() ([]byte, error) {
+				return ioutil.ReadFile(params.configFile)
+			},
+		},
+		{
+			name: "global.log",
+			collect: func() ([]byte, error) {
+				return collectGlobalLog(params.logfilePath)
+			},
+		},
+		{
+			name:    "host/kernel.log",
+			collect: collectKernelLog,
+		},
+	}
+
+	if params.containerID == "" {
+		return items, nil
+	}
+
+	status, podID, err := getExistingContainerInfo(context.Background(), params.containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	podItems, err := collectPodItems(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	items = append(items, podItems...)
+
+	items = append(items, collectItem{
+		name: filepath.Join("pods", podID, "console.log"),
+		collect: func() ([]byte, error) {
+			return collectConsole(filepath.Join(vcRunStoragePath, podID, podConsoleSocket))
+		},
+	})
+
+	ccLog.Infof("Collecting details of container %s (pod %s)", status.ID, podID)
+
+	return items, nil
+}
+
+// collectPodItems returns one item per JSON file stored by
+// virtcontainers for the specified pod and its containers.
+func collectPodItems(podID string) ([]collectItem, error) {
+	var items []collectItem
+
+	dirs := map[string]string{
+		"config": filepath.Join(vcConfigStoragePath, podID),
+		"run":    filepath.Join(vcRunStoragePath, podID),
+	}
+
+	for kind, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.Mode().IsRegular() || filepath.Ext(path) != ".json" {
+				return nil
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+
+			file := path
+			items = append(items, collectItem{
+				name: filepath.Join("pods", podID, kind, rel),
+				collect: func() ([]byte, error) {
+					return ioutil.ReadFile(file)
+				},
+				redact: true,
+			})
+
+			return nil
+		})
+
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+func collectEnv(params collectParams) ([]byte, error) {
+	ccEnv, err := getEnvInfo(params.configFile, params.logfilePath, params.runtimeConfig, params.profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+
+	if err := showSettings(ccEnv, buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func collectCheck() ([]byte, error) {
+	if err := hostIsClearContainersCapable(procCPUInfo); err != nil {
+		return []byte(fmt.Sprintf("System is not capable of running %s: %v\n", project, err)), nil
+	}
+
+	return []byte(fmt.Sprintf("System is capable of running %s\n", project)), nil
+}
+
+func collectGlobalLog(logfilePath string) ([]byte, error) {
+	path := resolveGlobalLogPath(logfilePath)
+	if path == "" {
+		return nil, errors.New("global logging is not enabled")
+	}
+
+	data, err := readFileTail(path, collectLogTailBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return tailLines(data, collectLogTailLines), nil
+}
+
+func collectKernelLog() ([]byte, error) {
+	out, err := exec.Command(dmesgCmd).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return tailLines(out, collectLogTailLines), nil
+}
+
+// collectConsole returns whatever guest console output is available
+// from the specified socket within consoleReadTimeout.
+func collectConsole(socketPath string) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", socketPath, consoleReadTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(consoleReadTimeout)); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(conn, collectLogTailBytes))
+	if err != nil {
+		// The console is never closed by the guest so a timeout
+		// simply means all the buffered output has been read.
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// readFileTail returns at most the last max bytes of the file.
+func readFileTail(path string, max int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if st.Size() > max {
+		if _, err := f.Seek(st.Size()-max, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	return ioutil.ReadAll(io.LimitReader(f, max))
+}
+
+// tailLines returns the last n lines of data.
+func tailLines(data []byte, n int) []byte {
+	trimmed := bytes.TrimRight(data, "\n")
+	if len(trimmed) == 0 {
+		return trimmed
+	}
+
+	lines := bytes.Split(trimmed, []byte("\n"))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return append(bytes.Join(lines, []byte("\n")), '\n')
+}
+
+// redactJSON replaces the values of all environment variables and
+// annotations found in the JSON document.
+func redactJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(redactValue(doc)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			switch strings.ToLower(key) {
+			case "annotations":
+				v[key] = redactAnnotations(elem)
+			case "env", "envs":
+				v[key] = redactEnv(elem)
+			default:
+				v[key] = redactValue(elem)
+			}
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = redactValue(elem)
+		}
+	}
+
+	return value
+}
+
+func redactAnnotations(value interface{}) interface{} {
+	annotations, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	for key := range annotations {
+		annotations[key] = redactedValue
+	}
+
+	return annotations
+}
+
+// redactEnv handles both the OCI ("NAME=value") and the virtcontainers
+// ({"Var": "NAME", "Value": "value"}) representations.
+func redactEnv(value interface{}) interface{} {
+	envs, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+
+	for i, env := range envs {
+		switch e := env.(type) {
+		case string:
+			fields := strings.SplitN(e, "=", 2)
+			envs[i] = fields[0] + "=" + redactedValue
+		case map[string]interface{}:
+			if _, ok := e["Value"]; ok {
+				e["Value"] = redactedValue
+			}
+		}
+	}
+
+	return envs
+}
+
+func (b *bundleWriter) addFile(name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    filepath.Join(collectBundleDir, name),
+		Mode:    int64(collectFileMode),
+		Size:    int64(len(data)),
+		ModTime: b.now,
+	}
+
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := b.tw.Write(data)
+
+	return err
+}
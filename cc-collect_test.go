@@ -0,0 +1,328 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readBundle returns the contents of every file in the bundle, indexed
+// by name relative to the bundle directory.
+func readBundle(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := filepath.Rel(collectBundleDir, hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		files[name] = string(data)
+	}
+
+	return files, nil
+}
+
+func TestCollectTailLines(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		data     string
+		lines    int
+		expected string
+	}
+
+	data := []testData{
+		{"", 3, ""},
+		{"\n\n", 3, ""},
+		{"a\nb\nc\n", 3, "a\nb\nc\n"},
+		{"a\nb\nc", 3, "a\nb\nc\n"},
+		{"a\nb\nc\nd\n", 2, "c\nd\n"},
+		{"a\nb\nc\nd\n", 1, "d\n"},
+	}
+
+	for _, d := range data {
+		result := tailLines([]byte(d.data), d.lines)
+		assert.Equal(d.expected, string(result), "%+v", d)
+	}
+}
+
+func TestCollectReadFileTail(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "collect-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+
+	_, err = readFileTail(file, 10)
+	assert.Error(err)
+
+	err = ioutil.WriteFile(file, []byte("0123456789"), testFileMode)
+	assert.NoError(err)
+
+	data, err := readFileTail(file, 4)
+	assert.NoError(err)
+	assert.Equal("6789", string(data))
+
+	data, err = readFileTail(file, 100)
+	assert.NoError(err)
+	assert.Equal("0123456789", string(data))
+}
+
+func TestCollectRedactJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := redactJSON([]byte("not json"))
+	assert.Error(err)
+
+	doc := `{
+		"ID": "foo",
+		"Annotations": {"key": "secret-annotation"},
+		"Containers": [{
+			"Cmd": {
+				"Envs": [{"Var": "PASSWORD", "Value": "secret-env"}]
+			},
+			"process": {
+				"env": ["TOKEN=secret-oci-env", "EMPTY"]
+			}
+		}]
+	}`
+
+	data, err := redactJSON([]byte(doc))
+	assert.NoError(err)
+
+	result := string(data)
+
+	for _, secret := range []string{"secret-annotation", "secret-env", "secret-oci-env"} {
+		assert.NotContains(result, secret)
+	}
+
+	for _, kept := range []string{"foo", "key", "PASSWORD", "TOKEN=" + redactedValue, "EMPTY=" + redactedValue} {
+		assert.Contains(result, kept)
+	}
+
+	var v interface{}
+	assert.NoError(json.Unmarshal(data, &v))
+}
+
+func TestCollectNeedOutput(t *testing.T) {
+	err := collect(collectParams{})
+	assert.Equal(t, errNeedBundleOutput, err)
+}
+
+func TestCollectBundle(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "collect-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	configFile, config, err := makeRuntimeConfig(dir)
+	assert.NoError(err)
+
+	logFile := filepath.Join(dir, "global.log")
+	var logData string
+	for i := 0; i < collectLogTailLines+10; i++ {
+		logData += "line\n"
+	}
+	err = ioutil.WriteFile(logFile, []byte(logData+"last line\n"), testFileMode)
+	assert.NoError(err)
+
+	savedDmesgCmd := dmesgCmd
+	dmesgCmd = "true"
+	defer func() {
+		dmesgCmd = savedDmesgCmd
+	}()
+
+	output := filepath.Join(dir, "bundle.tar.gz")
+
+	err = collect(collectParams{
+		output:        output,
+		configFile:    configFile,
+		logfilePath:   logFile,
+		runtimeConfig: config,
+	})
+	assert.NoError(err)
+
+	files, err := readBundle(output)
+	assert.NoError(err)
+
+	configData, err := ioutil.ReadFile(configFile)
+	assert.NoError(err)
+	assert.Equal(string(configData), files["configuration.toml"])
+
+	log := files["global.log"]
+	assert.Equal(collectLogTailLines, strings.Count(log, "\n"))
+	assert.True(strings.HasSuffix(log, "last line\n"))
+
+	assert.Contains(files, "cc-check.txt")
+	assert.Contains(files, "host/kernel.log")
+
+	// The bundle must be created even if some items are missing.
+	err = collect(collectParams{
+		output:        output,
+		configFile:    filepath.Join(dir, "does-not-exist"),
+		runtimeConfig: config,
+	})
+	assert.NoError(err)
+
+	files, err = readBundle(output)
+	assert.NoError(err)
+	assert.NotContains(files, "configuration.toml")
+	assert.NotContains(files, "global.log")
+	assert.Contains(files[collectErrorsFile], "configuration.toml")
+	assert.Contains(files[collectErrorsFile], "global.log")
+}
+
+func TestCollectPodItems(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "collect-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedConfigPath, savedRunPath := vcConfigStoragePath, vcRunStoragePath
+	vcConfigStoragePath = filepath.Join(dir, "lib")
+	vcRunStoragePath = filepath.Join(dir, "run")
+	defer func() {
+		vcConfigStoragePath, vcRunStoragePath = savedConfigPath, savedRunPath
+	}()
+
+	const podID = "pod"
+
+	items, err := collectPodItems(podID)
+	assert.NoError(err)
+	assert.Empty(items)
+
+	files := []string{
+		filepath.Join(vcConfigStoragePath, podID, "config.json"),
+		filepath.Join(vcConfigStoragePath, podID, "ctr", "config.json"),
+		filepath.Join(vcRunStoragePath, podID, "state.json"),
+		filepath.Join(vcRunStoragePath, podID, "network.json"),
+		filepath.Join(vcRunStoragePath, podID, "lock"),
+		filepath.Join(vcRunStoragePath, podID, "ctr", "process.json"),
+	}
+
+	for _, file := range files {
+		assert.NoError(os.MkdirAll(filepath.Dir(file), testDirMode))
+		assert.NoError(ioutil.WriteFile(file, []byte(`{}`), testFileMode))
+	}
+
+	items, err = collectPodItems(podID)
+	assert.NoError(err)
+
+	var names []string
+	for _, item := range items {
+		assert.True(item.redact)
+
+		data, err := item.collect()
+		assert.NoError(err)
+		assert.Equal(`{}`, string(data))
+
+		names = append(names, item.name)
+	}
+
+	sort.Strings(names)
+
+	assert.Equal([]string{
+		"pods/pod/config/config.json",
+		"pods/pod/config/ctr/config.json",
+		"pods/pod/run/ctr/process.json",
+		"pods/pod/run/network.json",
+		"pods/pod/run/state.json",
+	}, names)
+}
+
+func TestCollectConsole(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "collect-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedTimeout := consoleReadTimeout
+	consoleReadTimeout = 100 * time.Millisecond
+	defer func() {
+		consoleReadTimeout = savedTimeout
+	}()
+
+	socket := filepath.Join(dir, podConsoleSocket)
+
+	_, err = collectConsole(socket)
+	assert.Error(err)
+
+	l, err := net.Listen("unix", socket)
+	assert.NoError(err)
+	defer l.Close()
+
+	const output = "guest console output\n"
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte(output))
+
+		// Keep the connection open like the hypervisor does.
+		time.Sleep(2 * consoleReadTimeout)
+	}()
+
+	data, err := collectConsole(socket)
+	assert.NoError(err)
+	assert.Equal(output, string(data))
+}
@@ -18,12 +18,14 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/BurntSushi/toml"
-	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
 )
@@ -32,7 +34,15 @@ import (
 //
 // XXX: Increment for every change to the output format
 // (meaning any change to the EnvInfo type).
-const formatVersion = "1.0.0"
+const formatVersion = "1.5.0"
+
+// Verification status of the files the VMs are started from, when they
+// do not fail.
+const (
+	verificationOK            = "ok"
+	verificationNotConfigured = "not configured"
+	verificationAbsent        = "absent"
+)
 
 // MetaInfo stores information on the format of the output itself
 type MetaInfo struct {
@@ -46,6 +56,23 @@ type PathInfo struct {
 	Resolved string
 }
 
+// HypervisorInfo stores hypervisor details and the settings of the VMs
+// it runs.
+type HypervisorInfo struct {
+	Path             string
+	Resolved         string
+	MachineType      string
+	KernelParams     string
+	HypervisorParams string
+	DefaultVCPUs     uint
+	DefaultMemory    uint
+	Debug            bool
+	HugePages        bool
+	MemPrealloc      bool
+	NUMANodes        []uint
+	CPUModel         string
+}
+
 // CPUInfo stores host CPU details
 type CPUInfo struct {
 	Vendor string
@@ -57,6 +84,9 @@ type RuntimeConfigInfo struct {
 	Location PathInfo
 	// Note a PathInfo as it may not exist (validly)
 	GlobalLogPath string
+	// DefaultProfile is the profile used by the containers which do
+	// not select one.
+	DefaultProfile string
 }
 
 // RuntimeInfo stores runtime details.
@@ -107,20 +137,46 @@ type HostInfo struct {
 	CCCapable bool
 }
 
+// VerificationInfo stores the result of the verification of the files
+// the VMs are started from.
+type VerificationInfo struct {
+	Hypervisor    string
+	Kernel        string
+	Image         string
+	Initrd        string
+	ImageMetadata string
+}
+
+// ProfileInfo stores the details of the components configured by a
+// profile.
+type ProfileInfo struct {
+	Hypervisor   HypervisorInfo
+	Image        PathInfo
+	Initrd       PathInfo
+	Kernel       PathInfo
+	Proxy        ProxyInfo
+	Shim         ShimInfo
+	Agent        AgentInfo
+	Verification VerificationInfo
+}
+
 // EnvInfo collects all information that will be displayed by the
 // "cc-env" command.
 //
 // XXX: Any changes must be coupled with a change to formatVersion.
 type EnvInfo struct {
-	Meta       MetaInfo
-	Runtime    RuntimeInfo
-	Hypervisor PathInfo
-	Image      PathInfo
-	Kernel     PathInfo
-	Proxy      ProxyInfo
-	Shim       ShimInfo
-	Agent      AgentInfo
-	Host       HostInfo
+	Meta         MetaInfo
+	Runtime      RuntimeInfo
+	Hypervisor   HypervisorInfo
+	Image        PathInfo
+	Initrd       PathInfo
+	Kernel       PathInfo
+	Proxy        ProxyInfo
+	Shim         ShimInfo
+	Agent        AgentInfo
+	Verification VerificationInfo
+	Host         HostInfo
+	Profiles     map[string]ProfileInfo
 }
 
 func getMetaInfo() MetaInfo {
@@ -216,6 +272,14 @@ func getHostInfo() (HostInfo, error) {
 }
 
 func getProxyInfo(config oci.RuntimeConfig) (ProxyInfo, error) {
+	// The noop proxy has no configuration.
+	if config.ProxyType == vc.NoopProxyType {
+		return ProxyInfo{
+			Type:    string(config.ProxyType),
+			Version: unknown,
+		}, nil
+	}
+
 	proxyConfig, ok := config.ProxyConfig.(vc.CCProxyConfig)
 	if !ok {
 		return ProxyInfo{}, errors.New("cannot determine proxy config")
@@ -233,6 +297,14 @@ func getProxyInfo(config oci.RuntimeConfig) (ProxyInfo, error) {
 }
 
 func getShimInfo(config oci.RuntimeConfig) (ShimInfo, error) {
+	// The noop shim has no configuration.
+	if config.ShimType == vc.NoopShimType {
+		return ShimInfo{
+			Type:    string(config.ShimType),
+			Version: unknown,
+		}, nil
+	}
+
 	shimConfig, ok := config.ShimConfig.(vc.CCShimConfig)
 	if !ok {
 		return ShimInfo{}, errors.New("cannot determine shim config")
@@ -257,6 +329,14 @@ func getShimInfo(config oci.RuntimeConfig) (ShimInfo, error) {
 }
 
 func getAgentInfo(config oci.RuntimeConfig) (AgentInfo, error) {
+	// The noop agent has no configuration.
+	if config.AgentType == vc.NoopAgentType {
+		return AgentInfo{
+			Type:    string(config.AgentType),
+			Version: unknown,
+		}, nil
+	}
+
 	agentConfig, ok := config.AgentConfig.(vc.HyperConfig)
 	if !ok {
 		return AgentInfo{}, errors.New("cannot determine agent config")
@@ -280,7 +360,40 @@ func getAgentInfo(config oci.RuntimeConfig) (AgentInfo, error) {
 	return ccAgent, nil
 }
 
-func getEnvInfo(configFile, logfilePath string, config oci.RuntimeConfig) (env EnvInfo, err error) {
+func getHypervisorInfo(config oci.RuntimeConfig, resolved hypervisorDetails) HypervisorInfo {
+	return HypervisorInfo{
+		Path:             config.HypervisorConfig.HypervisorPath,
+		Resolved:         resolved.HypervisorPath,
+		MachineType:      config.HypervisorConfig.HypervisorMachineType,
+		KernelParams:     formatParams(config.HypervisorConfig.KernelParams, "="),
+		HypervisorParams: formatParams(config.HypervisorConfig.HypervisorParams, " "),
+		DefaultVCPUs:     config.VMConfig.VCPUs,
+		DefaultMemory:    config.VMConfig.Memory,
+		Debug:            config.HypervisorConfig.Debug,
+		HugePages:        config.HypervisorConfig.HugePages,
+		MemPrealloc:      config.HypervisorConfig.MemPrealloc,
+		NUMANodes:        config.HypervisorConfig.NUMANodes,
+		CPUModel:         config.HypervisorConfig.CPUModel,
+	}
+}
+
+// formatParams returns the parameters as written in the configuration
+// file.
+func formatParams(params []vc.Param, delim string) string {
+	var fields []string
+
+	for _, p := range params {
+		if p.Value == "" {
+			fields = append(fields, p.Key)
+		} else {
+			fields = append(fields, p.Key+delim+p.Value)
+		}
+	}
+
+	return strings.Join(fields, " ")
+}
+
+func getEnvInfo(configFile, logfilePath string, config oci.RuntimeConfig, profiles runtimeProfiles) (env EnvInfo, err error) {
 	meta := getMetaInfo()
 
 	ccRuntime, err := getRuntimeInfo(configFile, logfilePath, config)
@@ -288,62 +401,148 @@ func getEnvInfo(configFile, logfilePath string, config oci.RuntimeConfig) (env E
 		return EnvInfo{}, err
 	}
 
-	resolvedHypervisor, err := getHypervisorDetails(config)
+	ccRuntime.Config.DefaultProfile = profiles.defaultName
+
+	ccHost, err := getHostInfo()
 	if err != nil {
 		return EnvInfo{}, err
 	}
 
-	ccHost, err := getHostInfo()
+	ccProfile, err := getProfileInfo(config, profiles.assets[profiles.defaultName])
 	if err != nil {
 		return EnvInfo{}, err
 	}
 
+	var ccProfiles map[string]ProfileInfo
+
+	for _, name := range profiles.names() {
+		profile, err := getProfileInfo(profiles.configs[name], profiles.assets[name])
+		if err != nil {
+			return EnvInfo{}, fmt.Errorf("profile %q: %v", name, err)
+		}
+
+		if ccProfiles == nil {
+			ccProfiles = make(map[string]ProfileInfo)
+		}
+
+		ccProfiles[name] = profile
+	}
+
+	env = EnvInfo{
+		Meta:         meta,
+		Runtime:      ccRuntime,
+		Hypervisor:   ccProfile.Hypervisor,
+		Image:        ccProfile.Image,
+		Initrd:       ccProfile.Initrd,
+		Kernel:       ccProfile.Kernel,
+		Proxy:        ccProfile.Proxy,
+		Shim:         ccProfile.Shim,
+		Agent:        ccProfile.Agent,
+		Verification: ccProfile.Verification,
+		Host:         ccHost,
+		Profiles:     ccProfiles,
+	}
+
+	return env, nil
+}
+
+// getProfileInfo returns the details of the components configured by a
+// profile, and the verification status of the files of its VMs.
+func getProfileInfo(config oci.RuntimeConfig, assets vmAssets) (ProfileInfo, error) {
+	resolvedHypervisor, err := getHypervisorDetails(config)
+	if err != nil {
+		return ProfileInfo{}, err
+	}
+
 	ccProxy, err := getProxyInfo(config)
 	if err != nil {
-		return EnvInfo{}, err
+		return ProfileInfo{}, err
 	}
 
 	ccShim, err := getShimInfo(config)
 	if err != nil {
-		return EnvInfo{}, err
+		return ProfileInfo{}, err
 	}
 
 	ccAgent, err := getAgentInfo(config)
 	if err != nil {
-		return EnvInfo{}, err
+		return ProfileInfo{}, err
 	}
 
-	hypervisor := PathInfo{
-		Path:     config.HypervisorConfig.HypervisorPath,
-		Resolved: resolvedHypervisor.HypervisorPath,
-	}
+	hypervisor := getHypervisorInfo(config, resolvedHypervisor)
 
 	image := PathInfo{
 		Path:     config.HypervisorConfig.ImagePath,
 		Resolved: resolvedHypervisor.ImagePath,
 	}
 
+	initrd := PathInfo{
+		Path:     config.HypervisorConfig.InitrdPath,
+		Resolved: resolvedHypervisor.InitrdPath,
+	}
+
 	kernel := PathInfo{
 		Path:     config.HypervisorConfig.KernelPath,
 		Resolved: resolvedHypervisor.KernelPath,
 	}
 
-	env = EnvInfo{
-		Meta:       meta,
-		Runtime:    ccRuntime,
-		Hypervisor: hypervisor,
-		Image:      image,
-		Kernel:     kernel,
-		Proxy:      ccProxy,
-		Shim:       ccShim,
-		Agent:      ccAgent,
-		Host:       ccHost,
+	return ProfileInfo{
+		Hypervisor:   hypervisor,
+		Image:        image,
+		Initrd:       initrd,
+		Kernel:       kernel,
+		Proxy:        ccProxy,
+		Shim:         ccShim,
+		Agent:        ccAgent,
+		Verification: getVerificationInfo(assets),
+	}, nil
+}
+
+// getVerificationInfo verifies the files of the VMs. Unlike when a VM is
+// started, all the files are verified and a failure is only reported.
+func getVerificationInfo(assets vmAssets) VerificationInfo {
+	status := map[string]string{
+		"hypervisor": verificationNotConfigured,
+		"kernel":     verificationNotConfigured,
+		"image":      verificationNotConfigured,
+		"initrd":     verificationNotConfigured,
 	}
 
-	return env, nil
+	for _, file := range assets.files {
+		if file.sha256 == "" {
+			continue
+		}
+
+		status[file.kind] = verificationStatus(file.verify())
+	}
+
+	metadata := verificationAbsent
+
+	if assets.image != "" {
+		found, err := checkImageMetadata(assets.image, assets.agent)
+		if found {
+			metadata = verificationStatus(err)
+		}
+	}
+
+	return VerificationInfo{
+		Hypervisor:    status["hypervisor"],
+		Kernel:        status["kernel"],
+		Image:         status["image"],
+		Initrd:        status["initrd"],
+		ImageMetadata: metadata,
+	}
 }
 
-func showSettings(ccEnv EnvInfo, file *os.File) error {
+func verificationStatus(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+
+	return verificationOK
+}
+
+func showSettings(ccEnv EnvInfo, file io.Writer) error {
 
 	buf := new(bytes.Buffer)
 	encoder := toml.NewEncoder(buf)
@@ -376,7 +575,12 @@ func handleSettings(context *cli.Context) error {
 		return errors.New("cannot determine logfile config")
 	}
 
-	ccEnv, err := getEnvInfo(configFile, logfilePath, runtimeConfig)
+	settings, ok := metadata["runtimeSettings"].(runtimeSettings)
+	if !ok {
+		return errors.New("cannot determine runtime settings")
+	}
+
+	ccEnv, err := getEnvInfo(configFile, logfilePath, runtimeConfig, settings.profiles)
 	if err != nil {
 		return err
 	}
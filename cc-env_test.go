@@ -24,10 +24,10 @@ import (
 	"testing"
 
 	"github.com/BurntSushi/toml"
-	vc "github.com/containers/virtcontainers"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 
-	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -77,7 +77,7 @@ func makeRuntimeConfig(prefixDir string) (configFile string, config oci.RuntimeC
 		return "", oci.RuntimeConfig{}, err
 	}
 
-	_, _, config, err = loadConfiguration(configFile, true)
+	_, _, config, _, err = loadConfiguration(configFile, true)
 	if err != nil {
 		return "", oci.RuntimeConfig{}, err
 	}
@@ -197,10 +197,20 @@ model name	: %s
 	return expectedHostDetails, nil
 }
 
-func getExpectedHypervisor(config oci.RuntimeConfig) PathInfo {
-	return PathInfo{
-		Path:     config.HypervisorConfig.HypervisorPath,
-		Resolved: config.HypervisorConfig.HypervisorPath,
+func getExpectedHypervisor(config oci.RuntimeConfig) HypervisorInfo {
+	return HypervisorInfo{
+		Path:             config.HypervisorConfig.HypervisorPath,
+		Resolved:         config.HypervisorConfig.HypervisorPath,
+		MachineType:      config.HypervisorConfig.HypervisorMachineType,
+		KernelParams:     formatParams(config.HypervisorConfig.KernelParams, "="),
+		HypervisorParams: formatParams(config.HypervisorConfig.HypervisorParams, " "),
+		DefaultVCPUs:     config.VMConfig.VCPUs,
+		DefaultMemory:    config.VMConfig.Memory,
+		Debug:            config.HypervisorConfig.Debug,
+		HugePages:        config.HypervisorConfig.HugePages,
+		MemPrealloc:      config.HypervisorConfig.MemPrealloc,
+		NUMANodes:        config.HypervisorConfig.NUMANodes,
+		CPUModel:         config.HypervisorConfig.CPUModel,
 	}
 }
 
@@ -264,16 +274,25 @@ func getExpectedSettings(config oci.RuntimeConfig, tmpdir, configFile, logFile s
 	kernel := getExpectedKernel(config)
 	image := getExpectedImage(config)
 
+	verification := VerificationInfo{
+		Hypervisor:    verificationNotConfigured,
+		Kernel:        verificationNotConfigured,
+		Image:         verificationNotConfigured,
+		Initrd:        verificationNotConfigured,
+		ImageMetadata: verificationAbsent,
+	}
+
 	ccEnv := EnvInfo{
-		Meta:       meta,
-		Runtime:    runtime,
-		Hypervisor: hypervisor,
-		Image:      image,
-		Kernel:     kernel,
-		Proxy:      proxy,
-		Shim:       shim,
-		Agent:      agent,
-		Host:       host,
+		Meta:         meta,
+		Runtime:      runtime,
+		Hypervisor:   hypervisor,
+		Image:        image,
+		Kernel:       kernel,
+		Proxy:        proxy,
+		Shim:         shim,
+		Agent:        agent,
+		Verification: verification,
+		Host:         host,
 	}
 
 	return ccEnv, nil
@@ -324,7 +343,7 @@ func TestCCEnvGetEnvInfo(t *testing.T) {
 	expectedCCEnv, err := getExpectedSettings(config, tmpdir, configFile, logFile)
 	assert.NoError(t, err)
 
-	ccEnv, err := getEnvInfo(configFile, logFile, config)
+	ccEnv, err := getEnvInfo(configFile, logFile, config, runtimeProfiles{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, expectedCCEnv, ccEnv)
@@ -416,9 +435,19 @@ func TestCCEnvShowSettings(t *testing.T) {
 
 	ccRuntime := RuntimeInfo{}
 
-	ccHypervisor := PathInfo{
-		Path:     "/hypervisor/path",
-		Resolved: "/resolved/hypervisor/path",
+	ccHypervisor := HypervisorInfo{
+		Path:             "/hypervisor/path",
+		Resolved:         "/resolved/hypervisor/path",
+		MachineType:      "hypervisor-machine-type",
+		KernelParams:     "foo=bar quiet",
+		HypervisorParams: "-no-reboot",
+		DefaultVCPUs:     2,
+		DefaultMemory:    1024,
+		Debug:            true,
+		HugePages:        true,
+		MemPrealloc:      true,
+		NUMANodes:        []uint{0, 1},
+		CPUModel:         "Haswell",
 	}
 
 	ccImage := PathInfo{
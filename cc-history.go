@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+var ccHistoryCommand = cli.Command{
+	Name:  "cc-history",
+	Usage: "display the lifecycle history of containers",
+	Description: `The cc-history command displays a record of every lifecycle command
+   (create, start, run, exec, kill, pause, resume and delete) run on this
+   host, including for containers that have since been deleted.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "container",
+			Usage: "only display the records of the containers whose ID starts with this value",
+		},
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "only display the records more recent than a duration (for example 2h) or an RFC3339 time",
+		},
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "table",
+			Usage: `select one of: ` + formatOptions,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		since, err := parseSince(context.String("since"), time.Now())
+		if err != nil {
+			return err
+		}
+
+		records, err := readHistory(historyFilePath, historyFilter{
+			containerID: context.String("container"),
+			since:       since,
+		})
+		if err != nil {
+			return err
+		}
+
+		switch context.String("format") {
+		case "table":
+			return writeHistoryTable(records, os.Stdout)
+		case "json":
+			return json.NewEncoder(os.Stdout).Encode(records)
+		default:
+			return fmt.Errorf("invalid format option")
+		}
+	},
+}
+
+// parseSince converts the value of the "--since" option into a time.
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since value %q: expecting a duration or an RFC3339 time", since)
+	}
+
+	return t, nil
+}
+
+func writeHistoryTable(records []historyRecord, file io.Writer) error {
+	// values used by runc
+	flags := uint(0)
+	minWidth := 12
+	tabWidth := 1
+	padding := 3
+
+	w := tabwriter.NewWriter(file, minWidth, tabWidth, padding, ' ', flags)
+
+	fmt.Fprint(w, "TIME\tCOMMAND\tCONTAINER\tPOD\tUID\tOUTCOME\tDURATION\tERROR\n")
+
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			r.Time.Format(time.RFC3339Nano),
+			r.Command,
+			r.ContainerID,
+			r.PodID,
+			r.UID,
+			r.Outcome,
+			r.Duration,
+			r.Error)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/urfave/cli"
+)
+
+var ccMetricsCommand = cli.Command{
+	Name:  "cc-metrics",
+	Usage: "display the runtime metrics in Prometheus text format",
+	Description: `The cc-metrics command displays the counters and latency histograms
+   recorded by every runtime operation run on this host, in the Prometheus
+   text exposition format. With --output, the metrics are written
+   atomically to a file, as expected by the textfile collector of the
+   node exporter.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "write the metrics to this file rather than to the standard output",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		store, err := readMetrics(metricsFilePath)
+		if err != nil {
+			return err
+		}
+
+		output := context.String("output")
+		if output == "" {
+			return writeMetrics(os.Stdout, store)
+		}
+
+		var b bytes.Buffer
+		if err := writeMetrics(&b, store); err != nil {
+			return err
+		}
+
+		return writeFileAtomic(output, b.Bytes(), metricsOutputMode)
+	},
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+var ccReclaimCommand = cli.Command{
+	Name:  "cc-reclaim",
+	Usage: "reclaim the memory of the idle VMs",
+	Description: `The cc-reclaim command inflates the memory balloon of the VM of every
+   running pod with a memory target annotation on which no lifecycle
+   command was run for the idle period of the configuration, so that its
+   guest is left with its memory target. The balloon of the other pods is
+   deflated. It is meant to be run periodically, for example from cron.`,
+	Action: func(context *cli.Context) error {
+		settings, ok := context.App.Metadata["runtimeSettings"].(runtimeSettings)
+		if !ok {
+			return errors.New("invalid runtime settings")
+		}
+
+		ctx, done := operationContext(context, "cc-reclaim")
+
+		return done(reclaimMemory(ctx, settings.reclaim, time.Now()))
+	},
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/urfave/cli"
+)
+
+var ccStateMigrateCommand = cli.Command{
+	Name:  "cc-state-migrate",
+	Usage: "upgrade the stored state of all the pods to the current format",
+	Description: `The cc-state-migrate command rewrites the stored state of every pod
+   with the format of this version of the runtime. It is meant to be run
+   once after an upgrade: the state stored by an older version is
+   otherwise upgraded in memory every time it is read.
+
+   The pods whose stored state is corrupted are quarantined: their VM is
+   killed and their state is moved out of the way, so that they no longer
+   prevent the other pods from being listed.`,
+	Action: func(context *cli.Context) error {
+		ctx, done := operationContext(context, "cc-state-migrate")
+
+		result, err := vc.MigratePods(ctx)
+
+		// Report the pods migrated before a failure too.
+		if reportErr := writeMigrationReport(result, os.Stdout); err == nil {
+			err = reportErr
+		}
+
+		return done(err)
+	},
+}
+
+// writeMigrationReport writes the outcome of the migration of every pod,
+// returning an error if any of them could not be migrated nor quarantined.
+func writeMigrationReport(result []vc.PodMigration, file io.Writer) error {
+	failed := 0
+
+	for _, pod := range result {
+		if pod.Quarantined != nil {
+			fmt.Fprintf(file, "pod %s: corrupted, quarantined to %s: %v\n",
+				pod.ID, pod.Quarantined.ConfigPath, pod.Err)
+			continue
+		}
+
+		if pod.Err != nil {
+			failed++
+			fmt.Fprintf(file, "pod %s: migration failed: %v\n", pod.ID, pod.Err)
+			continue
+		}
+
+		fmt.Fprintf(file, "pod %s: %d files upgraded\n", pod.ID, pod.Upgraded)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("could not migrate %d of %d pods", failed, len(result))
+	}
+
+	return nil
+}
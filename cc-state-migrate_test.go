@@ -0,0 +1,61 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMigrationReport(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := new(bytes.Buffer)
+	assert.NoError(writeMigrationReport([]vc.PodMigration{}, buf))
+	assert.Empty(buf.String())
+
+	result := []vc.PodMigration{
+		{ID: "pod1", Upgraded: 3},
+		{ID: "pod2", Err: errors.New("newer schema version")},
+		{ID: "pod3"},
+	}
+
+	err := writeMigrationReport(result, buf)
+	assert.EqualError(err, "could not migrate 1 of 3 pods")
+	assert.Equal(`pod pod1: 3 files upgraded
+pod pod2: migration failed: newer schema version
+pod pod3: 0 files upgraded
+`, buf.String())
+}
+
+func TestWriteMigrationReportQuarantined(t *testing.T) {
+	assert := assert.New(t)
+
+	result := []vc.PodMigration{
+		{
+			ID:          "pod1",
+			Quarantined: &vc.QuarantinedPod{ID: "pod1", ConfigPath: "/quarantine/pod1"},
+			Err:         errors.New("Corrupted file"),
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(writeMigrationReport(result, buf))
+	assert.Equal("pod pod1: corrupted, quarantined to /quarantine/pod1: Corrupted file\n", buf.String())
+}
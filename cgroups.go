@@ -0,0 +1,888 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// defaultCgroupMemoryOverhead is the memory in MiB added to the
+	// maxmem of the VM in the memory limit of a pod, for qemu itself.
+	defaultCgroupMemoryOverhead = 256
+
+	// defaultCgroupPidsOverhead is the number of tasks added to the pids
+	// limit of a pod for the threads of qemu.
+	defaultCgroupPidsOverhead = 128
+)
+
+// cgroupOverhead is the [runtime.cgroup_overhead] section of the
+// configuration.
+type cgroupOverhead struct {
+	Memory int `toml:"memory"`
+	Pids   int `toml:"pids"`
+}
+
+// vmOverhead is what the host processes running a VM need on top of the
+// resources of its container.
+type vmOverhead struct {
+	// memory is in bytes.
+	memory uint64
+	pids   int64
+}
+
+// cgroup is the directory of a container in the hierarchy of a
+// controller, or in the unified hierarchy, whose controller is empty.
+type cgroup struct {
+	controller string
+	path       string
+}
+
+// shimDeviceRules are the devices the shim needs, allowed whatever the
+// device rules of the container. The VM process does not join the devices
+// cgroup: the rules of the container concern its workload, while qemu
+// opens the devices given to the VM, such as block devices and the VFIO
+// groups of assigned devices.
+var shimDeviceRules = []string{
+	"c 1:3 rwm",   // /dev/null
+	"c 1:5 rwm",   // /dev/zero
+	"c 1:8 rwm",   // /dev/random
+	"c 1:9 rwm",   // /dev/urandom
+	"c 5:0 rwm",   // /dev/tty
+	"c 5:2 rwm",   // /dev/ptmx
+	"c 136:* rwm", // /dev/pts/*
+}
+
+// newVMOverhead returns the overhead of the configuration, the defaults
+// replacing the values which are not set.
+func newVMOverhead(r runtime) (vmOverhead, error) {
+	config := r.CgroupOverhead
+
+	if config.Memory < 0 {
+		return vmOverhead{}, fmt.Errorf("Invalid cgroup_overhead memory %d: must be positive", config.Memory)
+	}
+
+	if config.Pids < 0 {
+		return vmOverhead{}, fmt.Errorf("Invalid cgroup_overhead pids %d: must be positive", config.Pids)
+	}
+
+	overhead := vmOverhead{
+		memory: defaultCgroupMemoryOverhead << 20,
+		pids:   defaultCgroupPidsOverhead,
+	}
+
+	if config.Memory > 0 {
+		overhead.memory = uint64(config.Memory) << 20
+	}
+
+	if config.Pids > 0 {
+		overhead.pids = int64(config.Pids)
+	}
+
+	return overhead, nil
+}
+
+// add returns a copy of resources whose memory and pids limits are raised
+// by the overhead.
+func (o vmOverhead) add(resources *specs.LinuxResources) *specs.LinuxResources {
+	if resources == nil {
+		return nil
+	}
+
+	r := *resources
+
+	if r.Memory != nil {
+		memory := *r.Memory
+		memory.Limit = o.addMemory(memory.Limit)
+		memory.Swap = o.addMemory(memory.Swap)
+		r.Memory = &memory
+	}
+
+	if r.Pids != nil && r.Pids.Limit > 0 {
+		pids := *r.Pids
+		pids.Limit += o.pids
+		r.Pids = &pids
+	}
+
+	return &r
+}
+
+// addMemory raises a memory limit by the memory overhead, an unset or
+// unlimited limit being left as is.
+func (o vmOverhead) addMemory(limit *uint64) *uint64 {
+	if limit == nil || *limit == 0 || *limit > math.MaxInt64-o.memory {
+		return limit
+	}
+
+	value := *limit + o.memory
+	return &value
+}
+
+// setCgroupResources writes the OCI resources of a container into the
+// files of its cgroup in the hierarchy of a controller.
+func setCgroupResources(cg cgroup, resources *specs.LinuxResources) error {
+	if resources == nil {
+		return nil
+	}
+
+	var lines []cgroupFileLine
+
+	switch cg.controller {
+	case "memory":
+		lines = memoryCgroupLines(resources.Memory)
+	case "cpu":
+		lines = cpuCgroupLines(resources.CPU)
+	case "cpuset":
+		var err error
+		if lines, err = cpusetCgroupLines(cg.path, resources.CPU); err != nil {
+			return err
+		}
+	case "pids":
+		if resources.Pids != nil {
+			limit := cgroup2Max
+			if resources.Pids.Limit > 0 {
+				limit = fmt.Sprintf("%d", resources.Pids.Limit)
+			}
+
+			lines = append(lines, cgroupFileLine{"pids.max", limit})
+		}
+	case "blkio":
+		lines = blkioCgroupLines(resources.BlockIO)
+	case "hugetlb":
+		for _, limit := range resources.HugepageLimits {
+			file := fmt.Sprintf("hugetlb.%s.limit_in_bytes", limit.Pagesize)
+			lines = append(lines, cgroupFileLine{file, fmt.Sprintf("%d", limit.Limit)})
+		}
+	case "devices":
+		lines = devicesCgroupLines(resources.Devices)
+	}
+
+	return writeCgroupFiles(cg.path, lines)
+}
+
+// memoryCgroupLines returns the memory controller values of the memory
+// resources. The kernel memory limits are not written: they concern the
+// guest kernel, not the host processes running the VM.
+func memoryCgroupLines(memory *specs.LinuxMemory) []cgroupFileLine {
+	if memory == nil {
+		return nil
+	}
+
+	var lines []cgroupFileLine
+
+	// The limit must be set before the limit including the swap, which
+	// cannot be lower.
+	for _, value := range []struct {
+		file  string
+		value *uint64
+	}{
+		{cgroupMemoryLimitFile, memory.Limit},
+		{"memory.soft_limit_in_bytes", memory.Reservation},
+		{cgroupMemorySwapLimitFile, memory.Swap},
+		{"memory.swappiness", memory.Swappiness},
+	} {
+		if value.value != nil && *value.value > 0 {
+			lines = append(lines, cgroupFileLine{value.file, fmt.Sprintf("%d", *value.value)})
+		}
+	}
+
+	return lines
+}
+
+// cpuCgroupLines returns the cpu controller values of the CPU resources.
+func cpuCgroupLines(cpu *specs.LinuxCPU) []cgroupFileLine {
+	if cpu == nil {
+		return nil
+	}
+
+	var lines []cgroupFileLine
+
+	if cpu.Shares != nil && *cpu.Shares > 0 {
+		lines = append(lines, cgroupFileLine{"cpu.shares", fmt.Sprintf("%d", *cpu.Shares)})
+	}
+
+	// The period comes first, the quota being checked against it.
+	if cpu.Period != nil && *cpu.Period > 0 {
+		lines = append(lines, cgroupFileLine{"cpu.cfs_period_us", fmt.Sprintf("%d", *cpu.Period)})
+	}
+
+	if cpu.Quota != nil && *cpu.Quota != 0 {
+		lines = append(lines, cgroupFileLine{"cpu.cfs_quota_us", fmt.Sprintf("%d", *cpu.Quota)})
+	}
+
+	if cpu.RealtimePeriod != nil && *cpu.RealtimePeriod > 0 {
+		lines = append(lines, cgroupFileLine{"cpu.rt_period_us", fmt.Sprintf("%d", *cpu.RealtimePeriod)})
+	}
+
+	if cpu.RealtimeRuntime != nil && *cpu.RealtimeRuntime != 0 {
+		lines = append(lines, cgroupFileLine{"cpu.rt_runtime_us", fmt.Sprintf("%d", *cpu.RealtimeRuntime)})
+	}
+
+	return lines
+}
+
+// cpusetCgroupLines returns the cpuset controller values of the CPU
+// resources. A new cpuset cannot hold any task until its CPUs and memory
+// nodes are set, so those the container does not restrict are inherited
+// from its parent.
+func cpusetCgroupLines(cgroupPath string, cpu *specs.LinuxCPU) ([]cgroupFileLine, error) {
+	parent := filepath.Dir(cgroupPath)
+	if err := inheritCpuset(parent); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	if cpu != nil {
+		values["cpuset.cpus"] = cpu.Cpus
+		values["cpuset.mems"] = cpu.Mems
+	}
+
+	var lines []cgroupFileLine
+
+	for _, file := range cpusetFiles {
+		value := values[file]
+		if value == "" {
+			data, err := ioutil.ReadFile(filepath.Join(parent, file))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+
+			value = strings.TrimSpace(string(data))
+		}
+
+		if value != "" {
+			lines = append(lines, cgroupFileLine{file, value})
+		}
+	}
+
+	return lines, nil
+}
+
+// cpusetFiles are the files of a cpuset which must be set before it can
+// hold tasks or children.
+var cpusetFiles = []string{"cpuset.cpus", "cpuset.mems"}
+
+// inheritCpuset sets the CPUs and memory nodes of the cpuset dir, and of
+// its parents, which have none to those of their own parent, a cpuset
+// only using the CPUs and memory nodes of its parent.
+func inheritCpuset(dir string) error {
+	for _, file := range cpusetFiles {
+		path := filepath.Join(dir, file)
+
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			// Above the root of the hierarchy.
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(string(data)) != "" {
+			continue
+		}
+
+		parent := filepath.Dir(dir)
+		if err := inheritCpuset(parent); err != nil {
+			return err
+		}
+
+		data, err = ioutil.ReadFile(filepath.Join(parent, file))
+		if err != nil {
+			return err
+		}
+
+		if err := writeCgroupFile(path, strings.TrimSpace(string(data))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blkioCgroupLines returns the blkio controller values of the block IO
+// resources.
+func blkioCgroupLines(blockIO *specs.LinuxBlockIO) []cgroupFileLine {
+	if blockIO == nil {
+		return nil
+	}
+
+	var lines []cgroupFileLine
+
+	if blockIO.Weight != nil {
+		lines = append(lines, cgroupFileLine{"blkio.weight", fmt.Sprintf("%d", *blockIO.Weight)})
+	}
+
+	if blockIO.LeafWeight != nil {
+		lines = append(lines, cgroupFileLine{"blkio.leaf_weight", fmt.Sprintf("%d", *blockIO.LeafWeight)})
+	}
+
+	for _, device := range blockIO.WeightDevice {
+		id := fmt.Sprintf("%d:%d", device.Major, device.Minor)
+
+		if device.Weight != nil {
+			lines = append(lines, cgroupFileLine{"blkio.weight_device", fmt.Sprintf("%s %d", id, *device.Weight)})
+		}
+
+		if device.LeafWeight != nil {
+			lines = append(lines, cgroupFileLine{"blkio.leaf_weight_device", fmt.Sprintf("%s %d", id, *device.LeafWeight)})
+		}
+	}
+
+	for _, throttle := range []struct {
+		file    string
+		devices []specs.LinuxThrottleDevice
+	}{
+		{"blkio.throttle.read_bps_device", blockIO.ThrottleReadBpsDevice},
+		{"blkio.throttle.write_bps_device", blockIO.ThrottleWriteBpsDevice},
+		{"blkio.throttle.read_iops_device", blockIO.ThrottleReadIOPSDevice},
+		{"blkio.throttle.write_iops_device", blockIO.ThrottleWriteIOPSDevice},
+	} {
+		for _, device := range throttle.devices {
+			lines = append(lines, cgroupFileLine{throttle.file,
+				fmt.Sprintf("%d:%d %d", device.Major, device.Minor, device.Rate)})
+		}
+	}
+
+	return lines
+}
+
+// devicesCgroupLines returns the devices controller values of the device
+// rules, followed by the rules allowing the devices of shimDeviceRules.
+func devicesCgroupLines(devices []specs.LinuxDeviceCgroup) []cgroupFileLine {
+	var lines []cgroupFileLine
+
+	number := func(n *int64) string {
+		if n == nil || *n < 0 {
+			return "*"
+		}
+
+		return fmt.Sprintf("%d", *n)
+	}
+
+	for _, device := range devices {
+		file := "devices.deny"
+		if device.Allow {
+			file = "devices.allow"
+		}
+
+		deviceType := device.Type
+		if deviceType == "" {
+			deviceType = "a"
+		}
+
+		access := device.Access
+		if access == "" {
+			access = "rwm"
+		}
+
+		rule := fmt.Sprintf("%s %s:%s %s", deviceType, number(device.Major), number(device.Minor), access)
+		lines = append(lines, cgroupFileLine{file, rule})
+	}
+
+	for _, rule := range shimDeviceRules {
+		lines = append(lines, cgroupFileLine{"devices.allow", rule})
+	}
+
+	return lines
+}
+
+// Files of the unified cgroup hierarchy.
+const (
+	cgroup2SubtreeControlFile = "cgroup.subtree_control"
+	cgroup2MemoryMaxFile      = "memory.max"
+	cgroup2CPUMaxFile         = "cpu.max"
+	cgroup2PidsMaxFile        = "pids.max"
+	cgroup2IOMaxFile          = "io.max"
+
+	// cgroup2Max is the value of an unlimited resource.
+	cgroup2Max = "max"
+
+	// cgroup2DefaultCPUPeriod is the CFS period in microseconds used
+	// when the container has a quota but no period.
+	cgroup2DefaultCPUPeriod = 100000
+)
+
+// cgroup2Controllers are the controllers the limits of a container are
+// written to in the unified hierarchy.
+var cgroup2Controllers = []string{"memory", "cpu", "pids", "io"}
+
+// setCgroup2Resources writes the OCI resources of a container into the
+// files of its cgroup in the unified hierarchy.
+func setCgroup2Resources(cgroupPath string, resources *specs.LinuxResources) error {
+	if resources == nil {
+		return nil
+	}
+
+	enableCgroup2Controllers(cgroupPath)
+
+	var lines []cgroupFileLine
+
+	if resources.Memory != nil && resources.Memory.Limit != nil && *resources.Memory.Limit > 0 {
+		lines = append(lines, cgroupFileLine{cgroup2MemoryMaxFile, fmt.Sprintf("%d", *resources.Memory.Limit)})
+	}
+
+	if cpu := resources.CPU; cpu != nil && (cpu.Quota != nil || cpu.Period != nil) {
+		quota := cgroup2Max
+		if cpu.Quota != nil && *cpu.Quota > 0 {
+			quota = fmt.Sprintf("%d", *cpu.Quota)
+		}
+
+		period := uint64(cgroup2DefaultCPUPeriod)
+		if cpu.Period != nil && *cpu.Period > 0 {
+			period = *cpu.Period
+		}
+
+		lines = append(lines, cgroupFileLine{cgroup2CPUMaxFile, fmt.Sprintf("%s %d", quota, period)})
+	}
+
+	if resources.Pids != nil {
+		limit := cgroup2Max
+		if resources.Pids.Limit > 0 {
+			limit = fmt.Sprintf("%d", resources.Pids.Limit)
+		}
+
+		lines = append(lines, cgroupFileLine{cgroup2PidsMaxFile, limit})
+	}
+
+	if resources.BlockIO != nil {
+		for _, limit := range cgroup2IOMax(*resources.BlockIO) {
+			lines = append(lines, cgroupFileLine{cgroup2IOMaxFile, limit})
+		}
+	}
+
+	return writeCgroupFiles(cgroupPath, lines)
+}
+
+// cgroup2IOMax returns the lines of the io.max file limiting the block
+// devices throttled by blockIO, one line per device.
+func cgroup2IOMax(blockIO specs.LinuxBlockIO) []string {
+	var devices []string
+	limits := make(map[string]string)
+
+	for _, throttle := range []struct {
+		key     string
+		devices []specs.LinuxThrottleDevice
+	}{
+		{"rbps", blockIO.ThrottleReadBpsDevice},
+		{"wbps", blockIO.ThrottleWriteBpsDevice},
+		{"riops", blockIO.ThrottleReadIOPSDevice},
+		{"wiops", blockIO.ThrottleWriteIOPSDevice},
+	} {
+		for _, device := range throttle.devices {
+			id := fmt.Sprintf("%d:%d", device.Major, device.Minor)
+			if _, ok := limits[id]; !ok {
+				devices = append(devices, id)
+				limits[id] = id
+			}
+
+			limits[id] += fmt.Sprintf(" %s=%d", throttle.key, device.Rate)
+		}
+	}
+
+	var lines []string
+	for _, id := range devices {
+		lines = append(lines, limits[id])
+	}
+
+	return lines
+}
+
+// enableCgroup2Controllers enables the controllers of cgroup2Controllers
+// in the parents of cgroupPath, from the root of the hierarchy down, so
+// that the limit files of the cgroup exist. A controller which cannot be
+// enabled is only logged: it might be enabled already, and writing the
+// limits fails otherwise.
+func enableCgroup2Controllers(cgroupPath string) {
+	var parents []string
+
+	for dir := filepath.Dir(cgroupPath); isCgroup2Mounted(dir); dir = filepath.Dir(dir) {
+		parents = append([]string{dir}, parents...)
+
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	for _, parent := range parents {
+		for _, controller := range cgroup2Controllers {
+			path := filepath.Join(parent, cgroup2SubtreeControlFile)
+			if err := writeCgroupFile(path, "+"+controller); err != nil {
+				ccLog.Warnf("Could not enable the %s cgroup controller in %s: %v", controller, parent, err)
+			}
+		}
+	}
+}
+
+// cgroupFileLine is a value to write to a file of a cgroup.
+type cgroupFileLine struct {
+	file  string
+	value string
+}
+
+// writeCgroupFiles writes lines, in order, to the files of the cgroup
+// cgroupPath.
+func writeCgroupFiles(cgroupPath string, lines []cgroupFileLine) error {
+	for _, line := range lines {
+		if err := writeCgroupFile(filepath.Join(cgroupPath, line.file), line.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeCgroupFile writes value to a cgroup file. The kernel handles each
+// write to a cgroup file separately, so files holding a line per device
+// are written a line at a time.
+func writeCgroupFile(path, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, cgroupsFileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := f.WriteString(value)
+	if err != nil {
+		return err
+	}
+
+	if n < len(value) {
+		return fmt.Errorf("Could not write %q to %q: only %d bytes written out of %d",
+			value, path, n, len(value))
+	}
+
+	return nil
+}
+
+const (
+	// sandboxCgroupAnnotation records the sandbox cgroup parent of a
+	// pod in its configuration, so that its cgroups are found whatever
+	// the configuration of the runtime has become.
+	sandboxCgroupAnnotation = "com.github.clearcontainers.runtime.sandbox_cgroup_parent"
+
+	// Files holding the usage accounted by the sandbox cgroups.
+	cgroupCPUUsageFile     = "cpuacct.usage"
+	cgroupMemoryUsageFile  = "memory.usage_in_bytes"
+	cgroup2CPUStatFile     = "cpu.stat"
+	cgroup2MemoryUsageFile = "memory.current"
+
+	// Files holding the memory limits of a cgroup.
+	cgroupMemoryLimitFile     = "memory.limit_in_bytes"
+	cgroupMemorySwapLimitFile = "memory.memsw.limit_in_bytes"
+)
+
+// sandboxAccountingControllers are the controllers the sandbox cgroups of
+// a pod always join, for its overhead to be accounted.
+var sandboxAccountingControllers = []string{"cpu", "cpuacct", "memory"}
+
+// procDir is a variable to allow tests to use a fake proc filesystem.
+var procDir = "/proc"
+
+// newSandboxCgroupParent returns the sandbox cgroup parent of the
+// configuration, relative to the root of each cgroup hierarchy.
+func newSandboxCgroupParent(r runtime) (string, error) {
+	if r.SandboxCgroupParent == "" {
+		return "", nil
+	}
+
+	for _, elem := range strings.Split(r.SandboxCgroupParent, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("Invalid sandbox_cgroup_parent %q: must not contain %q",
+				r.SandboxCgroupParent, elem)
+		}
+	}
+
+	return filepath.Join("/", r.SandboxCgroupParent), nil
+}
+
+// podSandboxCgroupParent returns the parent of the sandbox cgroups of a
+// pod whose OCI cgroups path is cgroupsPath. The sandbox cgroups of a pod
+// given a cgroups path are nested in its own cgroups, which keep its
+// limits, so that the orchestrator still finds and bounds the whole pod.
+func podSandboxCgroupParent(parent, cgroupsPath string) string {
+	if parent == "" || cgroupsPath == "" {
+		return parent
+	}
+
+	return filepath.Join("/", cgroupsPath, parent)
+}
+
+// sandboxCgroups returns the cgroups of the pod podID under the sandbox
+// cgroup parent: one in the hierarchy of each controller accounting its
+// usage or used by its resources, or one in the unified hierarchy.
+func sandboxCgroups(parent, podID string, resources *specs.LinuxResources) []cgroup {
+	if isCgroup2Mounted(cgroupsDirPath) {
+		return []cgroup{{path: filepath.Join(cgroupsDirPath, parent, podID)}}
+	}
+
+	var cgroups []cgroup
+	joined := make(map[string]bool)
+
+	controllers := append([]string{}, sandboxAccountingControllers...)
+	controllers = append(controllers, cgroupControllers(resources)...)
+
+	for _, controller := range controllers {
+		if joined[controller] {
+			continue
+		}
+
+		joined[controller] = true
+		cgroups = append(cgroups, cgroup{controller, filepath.Join(cgroupsDirPath, controller, parent, podID)})
+	}
+
+	return cgroups
+}
+
+// sandboxCgroupsPaths returns the paths of the sandbox cgroups of the pod
+// podID, each followed by the directories nesting it in the cgroups of the
+// pod at cgroupsPath, so that removing them in order leaves no empty
+// cgroup behind and the cgroups of the pod can then be removed.
+func sandboxCgroupsPaths(parent, podID, cgroupsPath string, resources *specs.LinuxResources) []string {
+	var paths []string
+
+	for _, cg := range sandboxCgroups(parent, podID, resources) {
+		paths = append(paths, cg.path)
+
+		if cgroupsPath == "" {
+			continue
+		}
+
+		root := filepath.Join(cgroupsDirPath, cg.controller, cgroupsPath)
+		for dir := filepath.Dir(cg.path); dir == root || strings.HasPrefix(dir, root+"/"); dir = filepath.Dir(dir) {
+			paths = append(paths, dir)
+		}
+	}
+
+	return paths
+}
+
+// vhostThreads returns the PIDs of the vhost kernel threads serving the
+// VM process vmPID.
+func vhostThreads(vmPID int) []int {
+	var pids []int
+
+	if vmPID == 0 {
+		return pids
+	}
+
+	comms, err := filepath.Glob(filepath.Join(procDir, "[0-9]*", "comm"))
+	if err != nil {
+		return pids
+	}
+
+	name := fmt.Sprintf("vhost-%d", vmPID)
+
+	for _, comm := range comms {
+		// The process might have exited since the glob.
+		data, err := ioutil.ReadFile(comm)
+		if err != nil || strings.TrimSpace(string(data)) != name {
+			continue
+		}
+
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(comm)))
+		if err != nil {
+			continue
+		}
+
+		pids = append(pids, pid)
+	}
+
+	return pids
+}
+
+// moveVhostThreads moves the vhost kernel threads of the VM process vmPID
+// into its sandbox cgroups. They are created in the cgroups qemu had at
+// the time, which it has left since. A thread which cannot be moved is
+// only logged, as it only escapes the accounting.
+func moveVhostThreads(cgroups []cgroup, vmPID int) {
+	for _, pid := range vhostThreads(vmPID) {
+		for _, cg := range cgroups {
+			path := filepath.Join(cg.path, cgroupsTasksFile)
+			if cg.controller == "" {
+				path = filepath.Join(cg.path, cgroupsProcsFile)
+			}
+
+			if err := writeCgroupFile(path, strconv.Itoa(pid)); err != nil {
+				ccLog.Warnf("Could not move vhost thread %d into %s: %v", pid, cg.path, err)
+			}
+		}
+	}
+}
+
+// processMemoryCgroup returns the cgroup holding the memory of the process
+// pid, read from its cgroup file.
+func processMemoryCgroup(pid int) (cgroup, error) {
+	data, err := ioutil.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return cgroup{}, err
+	}
+
+	unified := isCgroup2Mounted(cgroupsDirPath)
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		if unified {
+			if fields[0] == "0" {
+				return cgroup{path: filepath.Join(cgroupsDirPath, fields[2])}, nil
+			}
+
+			continue
+		}
+
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == "memory" {
+				return cgroup{controller, filepath.Join(cgroupsDirPath, controller, fields[2])}, nil
+			}
+		}
+	}
+
+	return cgroup{}, fmt.Errorf("No memory cgroup found for process %d", pid)
+}
+
+// raiseVMMemoryLimit raises the memory limit of the cgroup holding the VM
+// process vmPID by the memory MiB hotplugged to the VM, so that qemu is not
+// killed by its own cgroup once the guest uses that memory. An unlimited
+// limit is left as is.
+func raiseVMMemoryLimit(vmPID int, memory uint) error {
+	if vmPID == 0 || memory == 0 {
+		return nil
+	}
+
+	cg, err := processMemoryCgroup(vmPID)
+	if err != nil {
+		return err
+	}
+
+	raise := uint64(memory) << 20
+
+	limitFile := filepath.Join(cg.path, cgroupMemoryLimitFile)
+	if cg.controller == "" {
+		limitFile = filepath.Join(cg.path, cgroup2MemoryMaxFile)
+	}
+
+	limit, err := readCgroupLimit(limitFile)
+	if err != nil || limit > math.MaxInt64-raise {
+		return err
+	}
+
+	// The limit including the swap cannot be lower than the limit, it
+	// is raised first, by as much as the limit.
+	swapFile := filepath.Join(cg.path, cgroupMemorySwapLimitFile)
+	if swap, err := readCgroupLimit(swapFile); err == nil && cg.controller != "" && swap <= math.MaxInt64-raise {
+		value := strconv.FormatUint(swap+raise, 10)
+		if err := ioutil.WriteFile(swapFile, []byte(value), cgroupsFileMode); err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(limitFile, []byte(strconv.FormatUint(limit+raise, 10)), cgroupsFileMode)
+}
+
+// readCgroupLimit returns the limit held by a cgroup file, the largest
+// value for the "max" of the unified hierarchy.
+func readCgroupLimit(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == cgroup2Max {
+		return math.MaxUint64, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// sandboxCgroupUsage returns the CPU time in nanoseconds and the memory in
+// bytes used by the processes of the sandbox cgroups of the pod podID.
+func sandboxCgroupUsage(parent, podID string) (uint64, uint64, error) {
+	if isCgroup2Mounted(cgroupsDirPath) {
+		path := filepath.Join(cgroupsDirPath, parent, podID)
+
+		cpu, err := readCgroup2CPUUsage(filepath.Join(path, cgroup2CPUStatFile))
+		if err != nil {
+			return 0, 0, err
+		}
+
+		memory, err := readCgroupUint(filepath.Join(path, cgroup2MemoryUsageFile))
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return cpu, memory, nil
+	}
+
+	cpu, err := readCgroupUint(filepath.Join(cgroupsDirPath, "cpuacct", parent, podID, cgroupCPUUsageFile))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	memory, err := readCgroupUint(filepath.Join(cgroupsDirPath, "memory", parent, podID, cgroupMemoryUsageFile))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return cpu, memory, nil
+}
+
+// readCgroupUint returns the number held by a cgroup file.
+func readCgroupUint(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readCgroup2CPUUsage returns the CPU time in nanoseconds of the
+// usage_usec line of a cpu.stat file.
+func readCgroup2CPUUsage(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "usage_usec" {
+			continue
+		}
+
+		usec, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+
+		return usec * 1000, nil
+	}
+
+	return 0, fmt.Errorf("No usage_usec line in %s", path)
+}
@@ -0,0 +1,787 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// fakeCgroup2 makes a temporary directory pass for the cgroup root of a
+// host with the unified hierarchy only. The returned function restores
+// the real cgroup root.
+func fakeCgroup2(t *testing.T) (string, func()) {
+	root, err := ioutil.TempDir(testDir, "cgroup2-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedCgroupsDirPath := cgroupsDirPath
+	savedStatfs := statfs
+
+	cgroupsDirPath = root
+	statfs = func(path string, buf *syscall.Statfs_t) error {
+		if path != root && !strings.HasPrefix(path, root+"/") {
+			return syscall.ENOENT
+		}
+
+		buf.Type = cgroup2FsType
+		return nil
+	}
+
+	return root, func() {
+		cgroupsDirPath = savedCgroupsDirPath
+		statfs = savedStatfs
+		os.RemoveAll(root)
+	}
+}
+
+func testCgroup2Spec(cgroupsPath string) oci.CompatOCISpec {
+	limit := uint64(256 << 20)
+	quota := int64(50000)
+	period := uint64(100000)
+
+	ociSpec := oci.CompatOCISpec{}
+	ociSpec.Linux = &specs.Linux{
+		CgroupsPath: cgroupsPath,
+		Resources: &specs.LinuxResources{
+			Memory: &specs.LinuxMemory{Limit: &limit},
+			CPU:    &specs.LinuxCPU{Quota: &quota, Period: &period},
+			Pids:   &specs.LinuxPids{Limit: 100},
+		},
+	}
+
+	return ociSpec
+}
+
+func TestProcessCgroupsPathCgroup2(t *testing.T) {
+	root, cleanup := fakeCgroup2(t)
+	defer cleanup()
+
+	// All the controllers share a single directory.
+	ociSpec := testCgroup2Spec("relative/cgroups/path")
+	testProcessCgroupsPath(t, ociSpec, []string{filepath.Join(root, "relative/cgroups/path")})
+
+	ociSpec = testCgroup2Spec("/absolute/cgroups/path")
+	ociSpec.Mounts = []specs.Mount{
+		{
+			Type:        "cgroup",
+			Destination: root,
+		},
+	}
+	testProcessCgroupsPath(t, ociSpec, []string{filepath.Join(root, "absolute/cgroups/path")})
+}
+
+func TestCreateCgroupsFilesCgroup2(t *testing.T) {
+	root, cleanup := fakeCgroup2(t)
+	defer cleanup()
+
+	ociSpec := testCgroup2Spec("pod/container")
+	ociSpec.Linux.Resources.BlockIO = &specs.LinuxBlockIO{
+		ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{
+			{Rate: 1048576},
+		},
+		ThrottleWriteIOPSDevice: []specs.LinuxThrottleDevice{
+			{Rate: 100},
+		},
+	}
+	ociSpec.Linux.Resources.BlockIO.ThrottleReadBpsDevice[0].Major = 8
+	ociSpec.Linux.Resources.BlockIO.ThrottleWriteIOPSDevice[0].Major = 8
+
+	cgroups, err := processCgroups(ociSpec, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createCgroupsFiles(cgroups, ociSpec.Linux.Resources, testPID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	cgroupPath := filepath.Join(root, "pod/container")
+
+	for file, expected := range map[string]string{
+		cgroupsProcsFile:     testStrPID,
+		cgroup2MemoryMaxFile: "268435456",
+		cgroup2CPUMaxFile:    "50000 100000",
+		cgroup2PidsMaxFile:   "100",
+		cgroup2IOMaxFile:     "8:0 rbps=1048576 wiops=100",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(cgroupPath, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != expected {
+			t.Errorf("Got %q in %s, expecting %q", string(data), file, expected)
+		}
+	}
+
+	// The unified hierarchy has no tasks file.
+	if _, err := os.Stat(filepath.Join(cgroupPath, cgroupsTasksFile)); !os.IsNotExist(err) {
+		t.Fatalf("Unexpected %s file: %v", cgroupsTasksFile, err)
+	}
+
+	// The controllers are enabled in the parents of the cgroup.
+	for _, dir := range []string{root, filepath.Join(root, "pod")} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, cgroup2SubtreeControlFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != "+memory+cpu+pids+io" {
+			t.Errorf("Got %q controllers enabled in %s", string(data), dir)
+		}
+	}
+
+	if err := removeCgroupsPath([]string{cgroupPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(cgroupPath); !os.IsNotExist(err) {
+		t.Fatalf("Cgroup %s should have been removed: %v", cgroupPath, err)
+	}
+}
+
+func TestCgroup2IOMax(t *testing.T) {
+	device := func(major, minor int64, rate uint64) specs.LinuxThrottleDevice {
+		d := specs.LinuxThrottleDevice{Rate: rate}
+		d.Major = major
+		d.Minor = minor
+		return d
+	}
+
+	blockIO := specs.LinuxBlockIO{
+		ThrottleReadBpsDevice:   []specs.LinuxThrottleDevice{device(8, 0, 10), device(8, 16, 20)},
+		ThrottleWriteBpsDevice:  []specs.LinuxThrottleDevice{device(8, 16, 30)},
+		ThrottleReadIOPSDevice:  []specs.LinuxThrottleDevice{device(253, 1, 40)},
+		ThrottleWriteIOPSDevice: []specs.LinuxThrottleDevice{device(8, 0, 50)},
+	}
+
+	expected := []string{
+		"8:0 rbps=10 wiops=50",
+		"8:16 rbps=20 wbps=30",
+		"253:1 riops=40",
+	}
+
+	if lines := cgroup2IOMax(blockIO); !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("Got %q, expecting %q", lines, expected)
+	}
+}
+
+func TestSetCgroup2ResourcesUnlimited(t *testing.T) {
+	root, cleanup := fakeCgroup2(t)
+	defer cleanup()
+
+	quota := int64(-1)
+	resources := &specs.LinuxResources{
+		CPU:  &specs.LinuxCPU{Quota: &quota},
+		Pids: &specs.LinuxPids{Limit: -1},
+	}
+
+	if err := setCgroup2Resources(root, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]string{
+		cgroup2CPUMaxFile:  "max 100000",
+		cgroup2PidsMaxFile: "max",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(root, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != expected {
+			t.Errorf("Got %q in %s, expecting %q", string(data), file, expected)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, cgroup2MemoryMaxFile)); !os.IsNotExist(err) {
+		t.Fatalf("Unexpected %s file: %v", cgroup2MemoryMaxFile, err)
+	}
+}
+
+// fakeCgroupV1 makes a temporary directory pass for the cgroup root of a
+// host with a hierarchy per controller. The returned function restores the
+// real cgroup root.
+func fakeCgroupV1(t *testing.T) (string, func()) {
+	root, err := ioutil.TempDir(testDir, "cgroup-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedCgroupsDirPath := cgroupsDirPath
+	cgroupsDirPath = root
+
+	return root, func() {
+		cgroupsDirPath = savedCgroupsDirPath
+		os.RemoveAll(root)
+	}
+}
+
+func TestProcessCgroupsControllers(t *testing.T) {
+	root, cleanup := fakeCgroupV1(t)
+	defer cleanup()
+
+	ociSpec := testCgroup2Spec("pod")
+	resources := ociSpec.Linux.Resources
+	resources.CPU.Cpus = "0-1"
+	resources.BlockIO = &specs.LinuxBlockIO{}
+	resources.HugepageLimits = []specs.LinuxHugepageLimit{{Pagesize: "2MB", Limit: 1 << 30}}
+	resources.Devices = []specs.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}}
+
+	cgroups, err := processCgroups(ociSpec, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []cgroup
+	for _, controller := range []string{"memory", "cpu", "pids", "blkio", "cpuset", "hugetlb", "devices"} {
+		expected = append(expected, cgroup{controller, filepath.Join(root, controller, "pod")})
+	}
+
+	if !reflect.DeepEqual(cgroups, expected) {
+		t.Fatalf("Got %+v, expecting %+v", cgroups, expected)
+	}
+}
+
+func TestCreateCgroupsFilesLimits(t *testing.T) {
+	root, cleanup := fakeCgroupV1(t)
+	defer cleanup()
+
+	// The cpuset root has CPUs and memory nodes, unlike the cpuset of
+	// the pod parent.
+	for dir, values := range map[string][]string{
+		"cpuset":          {"0-3\n", "0\n"},
+		"cpuset/kubepods": {"", ""},
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), cgroupsDirMode); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, file := range cpusetFiles {
+			if err := ioutil.WriteFile(filepath.Join(root, dir, file), []byte(values[i]), cgroupsFileMode); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	shares := uint64(512)
+	weight := uint16(500)
+	major := int64(10)
+	minor := int64(229)
+
+	ociSpec := testCgroup2Spec("kubepods/pod")
+	resources := ociSpec.Linux.Resources
+	resources.CPU.Shares = &shares
+	resources.CPU.Cpus = "0-1"
+	resources.BlockIO = &specs.LinuxBlockIO{
+		Weight: &weight,
+		ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{
+			{Rate: 1048576},
+		},
+	}
+	resources.BlockIO.ThrottleReadBpsDevice[0].Major = 8
+	resources.HugepageLimits = []specs.LinuxHugepageLimit{{Pagesize: "2MB", Limit: 1 << 30}}
+	resources.Devices = []specs.LinuxDeviceCgroup{
+		{Allow: false, Access: "rwm"},
+		{Allow: true, Type: "c", Major: &major, Minor: &minor, Access: "rwm"},
+	}
+
+	cgroups, err := processCgroups(ociSpec, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overhead := vmOverhead{memory: 256 << 20, pids: 128}
+	if err := createCgroupsFiles(cgroups, overhead.add(resources), testPID, 200); err != nil {
+		t.Fatal(err)
+	}
+
+	devicesAllow := "c 10:229 rwm" + strings.Join(shimDeviceRules, "")
+
+	for file, expected := range map[string]string{
+		"memory/kubepods/pod/memory.limit_in_bytes":         "536870912",
+		"memory/kubepods/pod/" + cgroupsProcsFile:           testStrPID + "200",
+		"memory/kubepods/pod/" + cgroupsTasksFile:           testStrPID + "200",
+		"cpu/kubepods/pod/cpu.shares":                       "512",
+		"cpu/kubepods/pod/cpu.cfs_period_us":                "100000",
+		"cpu/kubepods/pod/cpu.cfs_quota_us":                 "50000",
+		"pids/kubepods/pod/pids.max":                        "228",
+		"blkio/kubepods/pod/blkio.weight":                   "500",
+		"blkio/kubepods/pod/blkio.throttle.read_bps_device": "8:0 1048576",
+		"cpuset/kubepods/pod/cpuset.cpus":                   "0-1",
+		"cpuset/kubepods/pod/cpuset.mems":                   "0",
+		"cpuset/kubepods/cpuset.cpus":                       "0-3",
+		"cpuset/kubepods/cpuset.mems":                       "0",
+		"hugetlb/kubepods/pod/hugetlb.2MB.limit_in_bytes":   "1073741824",
+		"devices/kubepods/pod/devices.deny":                 "a *:* rwm",
+		"devices/kubepods/pod/devices.allow":                devicesAllow,
+		"devices/kubepods/pod/" + cgroupsProcsFile:          testStrPID,
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(root, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != expected {
+			t.Errorf("Got %q in %s, expecting %q", string(data), file, expected)
+		}
+	}
+
+	// The resources of the container are left untouched.
+	if *resources.Memory.Limit != 256<<20 || resources.Pids.Limit != 100 {
+		t.Fatalf("The resources of the container were modified: %+v", resources)
+	}
+}
+
+func TestNewVMOverhead(t *testing.T) {
+	overhead, err := newVMOverhead(runtime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := vmOverhead{memory: defaultCgroupMemoryOverhead << 20, pids: defaultCgroupPidsOverhead}
+	if overhead != expected {
+		t.Fatalf("Got %+v, expecting %+v", overhead, expected)
+	}
+
+	overhead, err = newVMOverhead(runtime{CgroupOverhead: cgroupOverhead{Memory: 64, Pids: 32}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = vmOverhead{memory: 64 << 20, pids: 32}
+	if overhead != expected {
+		t.Fatalf("Got %+v, expecting %+v", overhead, expected)
+	}
+
+	for _, config := range []cgroupOverhead{{Memory: -1}, {Pids: -1}} {
+		if _, err := newVMOverhead(runtime{CgroupOverhead: config}); err == nil {
+			t.Fatalf("Expected invalid overhead %+v to fail", config)
+		}
+	}
+}
+
+func TestVMOverheadUnlimited(t *testing.T) {
+	overhead := vmOverhead{memory: 256 << 20, pids: 128}
+
+	if overhead.add(nil) != nil {
+		t.Fatal("Expected no resources")
+	}
+
+	unlimited := uint64(math.MaxUint64)
+	resources := overhead.add(&specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &unlimited},
+		Pids:   &specs.LinuxPids{Limit: -1},
+	})
+
+	if *resources.Memory.Limit != unlimited || resources.Pids.Limit != -1 {
+		t.Fatalf("Unlimited resources should stay unlimited: %+v", resources)
+	}
+}
+
+func TestVMOverheadMemory(t *testing.T) {
+	overhead := vmOverhead{memory: 256 << 20, pids: 128}
+
+	limit := uint64(256 << 20)
+	swap := uint64(384 << 20)
+
+	// The limits of the container are raised by the overhead, not
+	// replaced.
+	resources := overhead.add(&specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &limit, Swap: &swap},
+	})
+
+	if *resources.Memory.Limit != 512<<20 || *resources.Memory.Swap != 640<<20 {
+		t.Fatalf("Got limit %d and swap %d, expecting %d and %d",
+			*resources.Memory.Limit, *resources.Memory.Swap, uint64(512<<20), uint64(640<<20))
+	}
+
+	if limit != 256<<20 || swap != 384<<20 {
+		t.Fatalf("The limits of the container were modified: %d and %d", limit, swap)
+	}
+
+	if resources := overhead.add(&specs.LinuxResources{Memory: &specs.LinuxMemory{}}); resources.Memory.Limit != nil {
+		t.Fatalf("An unset limit should stay unset: %+v", resources.Memory)
+	}
+}
+
+// fakeVMMemoryCgroup makes the VM process 200 a member of the memory
+// cgroup pod, whose files are written with values.
+func fakeVMMemoryCgroup(t *testing.T, cgroupLine, path string, values map[string]string) func() {
+	restore := fakeProc(t, map[int]string{200: "qemu-system-x86"})
+
+	if err := ioutil.WriteFile(filepath.Join(procDir, "200", "cgroup"), []byte(cgroupLine), testFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(path, testDirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, value := range values {
+		if err := ioutil.WriteFile(filepath.Join(path, file), []byte(value), testFileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return restore
+}
+
+func TestRaiseVMMemoryLimit(t *testing.T) {
+	root, cleanup := fakeCgroupV1(t)
+	defer cleanup()
+
+	path := filepath.Join(root, "memory/kubepods/pod")
+	defer fakeVMMemoryCgroup(t, "4:cpu,cpuacct:/kubepods/pod\n3:memory:/kubepods/pod\n", path, map[string]string{
+		cgroupMemoryLimitFile:     "536870912\n",
+		cgroupMemorySwapLimitFile: "671088640\n",
+	})()
+
+	// The limits are raised by the hotplugged memory only.
+	if err := raiseVMMemoryLimit(200, 512); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]string{
+		cgroupMemoryLimitFile:     "1073741824",
+		cgroupMemorySwapLimitFile: "1207959552",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(path, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != expected {
+			t.Errorf("Got %q in %s, expecting %q", string(data), file, expected)
+		}
+	}
+
+	// No hotplugged memory leaves the limit as is.
+	if err := raiseVMMemoryLimit(200, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(path, cgroupMemoryLimitFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "1073741824" {
+		t.Fatalf("Got a limit of %q, expecting it unchanged", string(data))
+	}
+
+	if err := raiseVMMemoryLimit(0, 512); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRaiseVMMemoryLimitCgroup2(t *testing.T) {
+	root, cleanup := fakeCgroup2(t)
+	defer cleanup()
+
+	path := filepath.Join(root, "kubepods/pod")
+	defer fakeVMMemoryCgroup(t, "0::/kubepods/pod\n", path, map[string]string{
+		cgroup2MemoryMaxFile: "max\n",
+	})()
+
+	// An unlimited cgroup is left unlimited.
+	if err := raiseVMMemoryLimit(200, 512); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(path, cgroup2MemoryMaxFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "max\n" {
+		t.Fatalf("Got %q, expecting the cgroup to stay unlimited", string(data))
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(path, cgroup2MemoryMaxFile), []byte("536870912\n"), testFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := raiseVMMemoryLimit(200, 512); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(path, cgroup2MemoryMaxFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "1073741824" {
+		t.Fatalf("Got %q, expecting 1073741824", string(data))
+	}
+}
+
+func TestNewSandboxCgroupParent(t *testing.T) {
+	for config, expected := range map[string]string{
+		"":               "",
+		"cc-pods":        "/cc-pods",
+		"/system.slice/": "/system.slice",
+	} {
+		parent, err := newSandboxCgroupParent(runtime{SandboxCgroupParent: config})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parent != expected {
+			t.Errorf("Got %q for %q, expecting %q", parent, config, expected)
+		}
+	}
+
+	if _, err := newSandboxCgroupParent(runtime{SandboxCgroupParent: "../escape"}); err == nil {
+		t.Fatal("Expected a parent out of the cgroup root to fail")
+	}
+}
+
+func TestSandboxCgroups(t *testing.T) {
+	root, cleanup := fakeCgroupV1(t)
+	defer cleanup()
+
+	resources := testCgroup2Spec("").Linux.Resources
+
+	expected := []cgroup{
+		{"cpu", filepath.Join(root, "cpu/cc-pods/pod")},
+		{"cpuacct", filepath.Join(root, "cpuacct/cc-pods/pod")},
+		{"memory", filepath.Join(root, "memory/cc-pods/pod")},
+		{"pids", filepath.Join(root, "pids/cc-pods/pod")},
+	}
+
+	cgroups := sandboxCgroups("/cc-pods", "pod", resources)
+	if !reflect.DeepEqual(cgroups, expected) {
+		t.Fatalf("Got %+v, expecting %+v", cgroups, expected)
+	}
+
+	// The accounting controllers do not depend on the resources.
+	if cgroups := sandboxCgroups("/cc-pods", "pod", nil); !reflect.DeepEqual(cgroups, expected[:3]) {
+		t.Fatalf("Got %+v, expecting %+v", cgroups, expected[:3])
+	}
+}
+
+func TestSandboxCgroupsCgroup2(t *testing.T) {
+	root, cleanup := fakeCgroup2(t)
+	defer cleanup()
+
+	expected := []cgroup{{path: filepath.Join(root, "cc-pods/pod")}}
+
+	cgroups := sandboxCgroups("/cc-pods", "pod", nil)
+	if !reflect.DeepEqual(cgroups, expected) {
+		t.Fatalf("Got %+v, expecting %+v", cgroups, expected)
+	}
+}
+
+func TestPodSandboxCgroupParent(t *testing.T) {
+	for _, d := range []struct {
+		parent      string
+		cgroupsPath string
+		expected    string
+	}{
+		{"", "kubepods/pod", ""},
+		{"/cc-pods", "", "/cc-pods"},
+		{"/cc-pods", "kubepods/pod", "/kubepods/pod/cc-pods"},
+		{"/cc-pods", "/kubepods/pod", "/kubepods/pod/cc-pods"},
+	} {
+		if parent := podSandboxCgroupParent(d.parent, d.cgroupsPath); parent != d.expected {
+			t.Errorf("Got %q for %+v, expecting %q", parent, d, d.expected)
+		}
+	}
+}
+
+func TestSandboxCgroupsPaths(t *testing.T) {
+	root, cleanup := fakeCgroupV1(t)
+	defer cleanup()
+
+	parent := podSandboxCgroupParent("/cc/pods", "kubepods/pod")
+
+	// The sandbox cgroups come before the directories nesting them, up
+	// to the cgroups of the pod, whatever the controllers of these.
+	expected := []string{
+		filepath.Join(root, "cpu/kubepods/pod/cc/pods/pod"),
+		filepath.Join(root, "cpu/kubepods/pod/cc/pods"),
+		filepath.Join(root, "cpu/kubepods/pod/cc"),
+		filepath.Join(root, "cpu/kubepods/pod"),
+		filepath.Join(root, "cpuacct/kubepods/pod/cc/pods/pod"),
+		filepath.Join(root, "cpuacct/kubepods/pod/cc/pods"),
+		filepath.Join(root, "cpuacct/kubepods/pod/cc"),
+		filepath.Join(root, "cpuacct/kubepods/pod"),
+		filepath.Join(root, "memory/kubepods/pod/cc/pods/pod"),
+		filepath.Join(root, "memory/kubepods/pod/cc/pods"),
+		filepath.Join(root, "memory/kubepods/pod/cc"),
+		filepath.Join(root, "memory/kubepods/pod"),
+	}
+
+	paths := sandboxCgroupsPaths(parent, "pod", "kubepods/pod", nil)
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Got %v, expecting %v", paths, expected)
+	}
+
+	// The shared parent of pods without cgroups path is left alone.
+	paths = sandboxCgroupsPaths("/cc/pods", "pod", "", nil)
+	if len(paths) != 3 || paths[2] != filepath.Join(root, "memory/cc/pods/pod") {
+		t.Fatalf("Got %v, expecting the sandbox cgroups only", paths)
+	}
+
+	// A pod created before its sandbox cgroups were nested keeps them
+	// under the shared parent.
+	paths = sandboxCgroupsPaths("/cc/pods", "pod", "kubepods/pod", nil)
+	if len(paths) != 3 {
+		t.Fatalf("Got %v, expecting the sandbox cgroups only", paths)
+	}
+}
+
+// fakeProc makes a temporary directory pass for the proc filesystem, with
+// a process directory per PID holding its command name. The returned
+// function restores the real proc filesystem.
+func fakeProc(t *testing.T, comms map[int]string) func() {
+	dir, err := ioutil.TempDir(testDir, "proc-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for pid, comm := range comms {
+		pidDir := filepath.Join(dir, strconv.Itoa(pid))
+		if err := os.MkdirAll(pidDir, testDirMode); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(pidDir, "comm"), []byte(comm+"\n"), testFileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	savedProcDir := procDir
+	procDir = dir
+
+	return func() {
+		procDir = savedProcDir
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMoveVhostThreads(t *testing.T) {
+	root, cleanup := fakeCgroupV1(t)
+	defer cleanup()
+
+	defer fakeProc(t, map[int]string{
+		200: "qemu-system-x86",
+		201: "vhost-200",
+		202: "vhost-2000",
+		203: "vhost-200",
+	})()
+
+	pids := vhostThreads(200)
+	sort.Ints(pids)
+
+	if !reflect.DeepEqual(pids, []int{201, 203}) {
+		t.Fatalf("Got vhost threads %v, expecting [201 203]", pids)
+	}
+
+	if pids := vhostThreads(0); len(pids) != 0 {
+		t.Fatalf("Got vhost threads %v without a VM", pids)
+	}
+
+	cgroups := sandboxCgroups("/cc-pods", "pod", nil)
+	if err := createCgroupsFiles(cgroups, nil, testPID, 200); err != nil {
+		t.Fatal(err)
+	}
+
+	moveVhostThreads(cgroups, 200)
+
+	data, err := ioutil.ReadFile(filepath.Join(root, "cpuacct/cc-pods/pod", cgroupsTasksFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := testStrPID + "200" + "201" + "203"
+	if string(data) != expected {
+		t.Fatalf("Got tasks %q, expecting %q", string(data), expected)
+	}
+}
+
+func TestSandboxCgroupUsage(t *testing.T) {
+	root, cleanup := fakeCgroupV1(t)
+	defer cleanup()
+
+	for file, value := range map[string]string{
+		"cpuacct/cc-pods/pod/" + cgroupCPUUsageFile:   "1500000000\n",
+		"memory/cc-pods/pod/" + cgroupMemoryUsageFile: "314572800\n",
+	} {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), testDirMode); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(value), testFileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cpu, memory, err := sandboxCgroupUsage("/cc-pods", "pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu != 1500000000 || memory != 300<<20 {
+		t.Fatalf("Got CPU %d and memory %d", cpu, memory)
+	}
+
+	if _, _, err := sandboxCgroupUsage("/cc-pods", "other"); err == nil {
+		t.Fatal("Expected a pod without sandbox cgroups to fail")
+	}
+}
+
+func TestSandboxCgroupUsageCgroup2(t *testing.T) {
+	root, cleanup := fakeCgroup2(t)
+	defer cleanup()
+
+	dir := filepath.Join(root, "cc-pods/pod")
+	if err := os.MkdirAll(dir, testDirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, value := range map[string]string{
+		cgroup2CPUStatFile:     "usage_usec 1500000\nuser_usec 1000000\nsystem_usec 500000\n",
+		cgroup2MemoryUsageFile: "314572800\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(value), testFileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cpu, memory, err := sandboxCgroupUsage("/cc-pods", "pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu != 1500000000 || memory != 300<<20 {
+		t.Fatalf("Got CPU %d and memory %d", cpu, memory)
+	}
+}
@@ -20,10 +20,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	goruntime "runtime"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
-	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 )
 
 const (
@@ -33,22 +36,45 @@ const (
 	defaultAgent      = vc.HyperstartAgent
 )
 
+const (
+	// defaultMachineType is the machine emulated by qemu.
+	defaultMachineType = vc.QemuPCLite
+
+	// defaultMemSize is the memory of the VMs in MiB.
+	defaultMemSize = 2048
+
+	// defaultMemoryOverhead is the memory in MiB added to the memory
+	// limit of a container to size its VM.
+	defaultMemoryOverhead = 128
+
+	// defaultCPUModel makes the vCPUs have the model of the host CPUs.
+	defaultCPUModel = "host"
+)
+
 const (
 	qemuLite   = "qemu-lite"
 	qemu       = "qemu"
 	shimBinary = "cc-shim"
+
+	// mockHypervisor does not start any VM. Along with the noop agent,
+	// proxy and shim, it simulates containers on hosts without
+	// virtualization support.
+	mockHypervisor = "mock"
 )
 
 const (
-	ccProxy = "cc"
+	ccProxy   = "cc"
+	noopProxy = "noop"
 )
 
 const (
-	ccShim = "cc"
+	ccShim   = "cc"
+	noopShim = "noop"
 )
 
 const (
 	hyperstartAgent = "hyperstart"
+	noopAgent       = "noop"
 )
 
 var (
@@ -60,18 +86,42 @@ var (
 	errTooManyAgents      = errors.New("too many agent sections")
 )
 
+// supportedMachineTypes lists the machines qemu can emulate.
+var supportedMachineTypes = []string{vc.QemuPCLite, vc.QemuQ35}
+
 type tomlConfig struct {
 	Hypervisor map[string]hypervisor
 	Proxy      map[string]proxy
 	Shim       map[string]shim
 	Agent      map[string]agent
 	Runtime    runtime
+	Profile    map[string]profile
 }
 
 type hypervisor struct {
-	Path   string
-	Kernel string
-	Image  string
+	Path             string
+	Kernel           string
+	Image            string
+	Initrd           string
+	KernelParams     string `toml:"kernel_params"`
+	HypervisorParams string `toml:"hypervisor_params"`
+	MachineType      string `toml:"machine_type"`
+	DefaultVCPUs     int    `toml:"default_vcpus"`
+	DefaultMemSz     int    `toml:"default_memory"`
+	MemoryOverhead   int    `toml:"memory_overhead"`
+	MinVCPUs         int    `toml:"min_vcpus"`
+	MaxVCPUs         int    `toml:"max_vcpus"`
+	MinMemory        int    `toml:"min_memory"`
+	MaxMemory        int    `toml:"max_memory"`
+	HugePages        bool   `toml:"enable_hugepages"`
+	MemPrealloc      bool   `toml:"enable_mem_prealloc"`
+	NUMANodes        []int  `toml:"numa_nodes"`
+	CPUModel         string `toml:"cpu_model"`
+	Debug            bool   `toml:"enable_debug"`
+	PathSHA256       string `toml:"path_sha256"`
+	KernelSHA256     string `toml:"kernel_sha256"`
+	ImageSHA256      string `toml:"image_sha256"`
+	InitrdSHA256     string `toml:"initrd_sha256"`
 }
 
 type proxy struct {
@@ -79,7 +129,54 @@ type proxy struct {
 }
 
 type runtime struct {
-	GlobalLogPath string `toml:"global_log_path"`
+	DefaultProfile    string            `toml:"default_profile"`
+	GlobalLogPath     string            `toml:"global_log_path"`
+	GlobalLogMaxSize  int               `toml:"global_log_max_size"`
+	GlobalLogMaxAge   string            `toml:"global_log_max_age"`
+	GlobalLogMaxFiles int               `toml:"global_log_max_files"`
+	LogSinks          []string          `toml:"log_sinks"`
+	SyslogSocket      string            `toml:"syslog_socket"`
+	Trace             string            `toml:"trace"`
+	Timeouts          map[string]string `toml:"timeouts"`
+
+	AllowedAnnotations []string         `toml:"allowed_annotations"`
+	AnnotationBounds   annotationBounds `toml:"annotation_bounds"`
+
+	MemoryReclaim memoryReclaim `toml:"memory_reclaim"`
+
+	SandboxCgroupParent string         `toml:"sandbox_cgroup_parent"`
+	CgroupOverhead      cgroupOverhead `toml:"cgroup_overhead"`
+}
+
+// runtimeSettings holds the configuration used by the runtime itself
+// rather than by virtcontainers.
+type runtimeSettings struct {
+	// timeouts bounds the duration of each operation, indexed by
+	// command name.
+	timeouts map[string]time.Duration
+
+	// trace is where the traces of the operations are exported, an
+	// empty string meaning tracing is disabled.
+	trace string
+
+	// profiles holds the runtime configuration of each profile.
+	profiles runtimeProfiles
+
+	// annotations decides which VM settings the pods can override.
+	annotations annotationPolicy
+
+	// reclaim decides how cc-reclaim shrinks the guests of the idle
+	// pods.
+	reclaim reclaimPolicy
+
+	// overhead raises the limits of the host cgroups of a pod for the
+	// processes running its VM.
+	overhead vmOverhead
+
+	// sandboxCgroupParent is the cgroup under which each pod gets the
+	// cgroups holding its VM, an empty string meaning the VM stays in
+	// the cgroups of the sandbox container.
+	sandboxCgroupParent string
 }
 
 type shim struct {
@@ -114,6 +211,56 @@ func (h hypervisor) image() string {
 	return h.Image
 }
 
+func (h hypervisor) machineType() string {
+	if h.MachineType == "" {
+		return defaultMachineType
+	}
+
+	return h.MachineType
+}
+
+// cpuModel returns the CPU model of the vCPUs, the model of the host CPUs
+// by default.
+func (h hypervisor) cpuModel() string {
+	if h.CPUModel == "" {
+		return defaultCPUModel
+	}
+
+	return h.CPUModel
+}
+
+// numaNodes returns the host NUMA nodes of the VMs, checked by
+// checkHypervisorParams.
+func (h hypervisor) numaNodes() []uint {
+	var nodes []uint
+
+	for _, node := range h.NUMANodes {
+		nodes = append(nodes, uint(node))
+	}
+
+	return nodes
+}
+
+// defaultVCPUs returns the number of vCPUs of the VMs, which is capped to
+// the number of host CPUs.
+func (h hypervisor) defaultVCPUs() uint {
+	numCPUs := goruntime.NumCPU()
+
+	if h.DefaultVCPUs <= 0 || h.DefaultVCPUs > numCPUs {
+		return uint(numCPUs)
+	}
+
+	return uint(h.DefaultVCPUs)
+}
+
+func (h hypervisor) defaultMemSz() uint {
+	if h.DefaultMemSz <= 0 {
+		return defaultMemSize
+	}
+
+	return uint(h.DefaultMemSz)
+}
+
 func (p proxy) url() string {
 	if p.URL == "" {
 		return defaultProxyURL
@@ -158,25 +305,261 @@ func checkConfigParams(tomlConf tomlConfig) error {
 	return nil
 }
 
+func newRuntimeSettings(r runtime) (runtimeSettings, error) {
+	settings := runtimeSettings{
+		timeouts: make(map[string]time.Duration),
+		trace:    r.Trace,
+	}
+
+	for operation, value := range r.Timeouts {
+		if !timeoutOperations[operation] {
+			return runtimeSettings{}, fmt.Errorf("Invalid timeout operation %q", operation)
+		}
+
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return runtimeSettings{}, fmt.Errorf("Invalid %s timeout %q: %v", operation, value, err)
+		}
+
+		if timeout <= 0 {
+			return runtimeSettings{}, fmt.Errorf("Invalid %s timeout %q: must be positive", operation, value)
+		}
+
+		settings.timeouts[operation] = timeout
+	}
+
+	annotations, err := newAnnotationPolicy(r)
+	if err != nil {
+		return runtimeSettings{}, err
+	}
+
+	settings.annotations = annotations
+
+	reclaim, err := newReclaimPolicy(r)
+	if err != nil {
+		return runtimeSettings{}, err
+	}
+
+	settings.reclaim = reclaim
+
+	overhead, err := newVMOverhead(r)
+	if err != nil {
+		return runtimeSettings{}, err
+	}
+
+	settings.overhead = overhead
+
+	sandboxCgroupParent, err := newSandboxCgroupParent(r)
+	if err != nil {
+		return runtimeSettings{}, err
+	}
+
+	settings.sandboxCgroupParent = sandboxCgroupParent
+
+	return settings, nil
+}
+
 func newQemuHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
-	hypervisor := h.path()
-	kernel := h.kernel()
-	image := h.image()
+	config, err := newHypervisorConfig(h)
+	if err != nil {
+		return vc.HypervisorConfig{}, err
+	}
 
-	for _, file := range []string{hypervisor, kernel, image} {
+	files := []string{config.HypervisorPath, config.KernelPath}
+	if config.InitrdPath != "" {
+		files = append(files, config.InitrdPath)
+	} else {
+		files = append(files, config.ImagePath)
+	}
+
+	for _, file := range files {
 		if !fileExists(file) {
 			return vc.HypervisorConfig{},
 				fmt.Errorf("File does not exist: %v", file)
 		}
 	}
 
+	return config, nil
+}
+
+// newMockHypervisorConfig returns the configuration of the mock
+// hypervisor. Unlike qemu, the files it refers to do not need to exist as
+// no VM is started.
+func newMockHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
+	return newHypervisorConfig(h)
+}
+
+// newHypervisorConfig returns the hypervisor configuration described by
+// h, whose files are not checked.
+func newHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
+	if err := checkHypervisorParams(h); err != nil {
+		return vc.HypervisorConfig{}, err
+	}
+
+	kernelParams, err := parseKernelParams(h.KernelParams)
+	if err != nil {
+		return vc.HypervisorConfig{}, err
+	}
+
+	hypervisorParams, err := parseHypervisorParams(h.HypervisorParams)
+	if err != nil {
+		return vc.HypervisorConfig{}, err
+	}
+
+	// The guest boots from the initrd rather than from the image.
+	image := h.image()
+	if h.Initrd != "" {
+		image = ""
+	}
+
 	return vc.HypervisorConfig{
-		HypervisorPath: hypervisor,
-		KernelPath:     kernel,
-		ImagePath:      image,
+		HypervisorPath:        h.path(),
+		KernelPath:            h.kernel(),
+		ImagePath:             image,
+		InitrdPath:            h.Initrd,
+		KernelParams:          kernelParams,
+		HypervisorParams:      hypervisorParams,
+		HypervisorMachineType: h.machineType(),
+		Debug:                 h.Debug,
+		HugePages:             h.HugePages,
+		MemPrealloc:           h.MemPrealloc,
+		NUMANodes:             h.numaNodes(),
+		CPUModel:              h.cpuModel(),
 	}, nil
 }
 
+// checkHypervisorParams checks the values of the hypervisor section which
+// are not parsed.
+func checkHypervisorParams(h hypervisor) error {
+	machineType := h.machineType()
+
+	supported := false
+	for _, m := range supportedMachineTypes {
+		if m == machineType {
+			supported = true
+			break
+		}
+	}
+
+	if !supported {
+		return fmt.Errorf("Invalid machine_type %q: must be one of %s",
+			machineType, strings.Join(supportedMachineTypes, ", "))
+	}
+
+	if h.DefaultVCPUs < 0 {
+		return fmt.Errorf("Invalid default_vcpus %d: must be positive", h.DefaultVCPUs)
+	}
+
+	if h.DefaultMemSz < 0 {
+		return fmt.Errorf("Invalid default_memory %d: must be positive", h.DefaultMemSz)
+	}
+
+	for key, value := range map[string]int{
+		"memory_overhead": h.MemoryOverhead,
+		"min_vcpus":       h.MinVCPUs,
+		"max_vcpus":       h.MaxVCPUs,
+		"min_memory":      h.MinMemory,
+		"max_memory":      h.MaxMemory,
+	} {
+		if value < 0 {
+			return fmt.Errorf("Invalid %s %d: must be positive", key, value)
+		}
+	}
+
+	if h.MaxVCPUs > 0 && h.MinVCPUs > h.MaxVCPUs {
+		return fmt.Errorf("Invalid min_vcpus %d: larger than max_vcpus %d", h.MinVCPUs, h.MaxVCPUs)
+	}
+
+	if h.MaxMemory > 0 && h.MinMemory > h.MaxMemory {
+		return fmt.Errorf("Invalid min_memory %d: larger than max_memory %d", h.MinMemory, h.MaxMemory)
+	}
+
+	for _, node := range h.NUMANodes {
+		if node < 0 {
+			return fmt.Errorf("Invalid numa_nodes %v: must be positive", h.NUMANodes)
+		}
+	}
+
+	if h.Image != "" && h.Initrd != "" {
+		return errors.New("image and initrd cannot both be set")
+	}
+
+	return nil
+}
+
+// parseKernelParams converts a space separated list of kernel parameters,
+// such as "console=hvc0 quiet", to virtcontainers parameters.
+func parseKernelParams(params string) ([]vc.Param, error) {
+	var kernelParams []vc.Param
+
+	for _, field := range strings.Fields(params) {
+		kv := strings.SplitN(field, "=", 2)
+
+		if kv[0] == "" {
+			return nil, fmt.Errorf("Invalid kernel_params %q: missing name in %q", params, field)
+		}
+
+		param := vc.Param{Key: kv[0]}
+		if len(kv) == 2 {
+			param.Value = kv[1]
+		}
+
+		kernelParams = append(kernelParams, param)
+	}
+
+	return kernelParams, nil
+}
+
+// parseHypervisorParams converts a space separated list of hypervisor
+// arguments, such as "-no-reboot -device virtio-rng-pci", to
+// virtcontainers parameters. Each argument is kept as is.
+func parseHypervisorParams(params string) ([]vc.Param, error) {
+	var hypervisorParams []vc.Param
+
+	fields := strings.Fields(params)
+
+	if len(fields) > 0 && !strings.HasPrefix(fields[0], "-") {
+		return nil, fmt.Errorf("Invalid hypervisor_params %q: must start with an option", params)
+	}
+
+	for _, field := range fields {
+		hypervisorParams = append(hypervisorParams, vc.Param{Key: field})
+	}
+
+	return hypervisorParams, nil
+}
+
+// newVMSizing returns the bounds of the VMs sized from the resource limits
+// of their container. The number of vCPUs never exceeds the number of
+// host CPUs.
+func newVMSizing(h hypervisor) oci.VMSizing {
+	overhead := uint(defaultMemoryOverhead)
+	if h.MemoryOverhead > 0 {
+		overhead = uint(h.MemoryOverhead)
+	}
+
+	maxVCPUs := uint(goruntime.NumCPU())
+	if h.MaxVCPUs > 0 && uint(h.MaxVCPUs) < maxVCPUs {
+		maxVCPUs = uint(h.MaxVCPUs)
+	}
+
+	return oci.VMSizing{
+		MemoryOverhead: overhead,
+		MinVCPUs:       uint(h.MinVCPUs),
+		MaxVCPUs:       maxVCPUs,
+		MinMemory:      uint(h.MinMemory),
+		MaxMemory:      uint(h.MaxMemory),
+	}
+}
+
+// newVMConfig returns the resources of the VMs described by h.
+func newVMConfig(h hypervisor) vc.Resources {
+	return vc.Resources{
+		VCPUs:  h.defaultVCPUs(),
+		Memory: h.defaultMemSz(),
+	}
+}
+
 func newHyperstartAgentConfig(a agent) (vc.HyperConfig, error) {
 	dir := a.pauseRootPath()
 
@@ -219,6 +602,23 @@ func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.Run
 			}
 
 			config.HypervisorConfig = hConfig
+			config.VMConfig = newVMConfig(hypervisor)
+			config.VMSizing = newVMSizing(hypervisor)
+
+			break
+		case mockHypervisor:
+			hConfig, err := newMockHypervisorConfig(hypervisor)
+			if err != nil {
+				return fmt.Errorf("%v: %v", configPath, err)
+			}
+
+			config.HypervisorType = vc.MockHypervisor
+			config.HypervisorConfig = hConfig
+			config.VMConfig = newVMConfig(hypervisor)
+			config.VMSizing = newVMSizing(hypervisor)
+
+			// There is no VM to plug the container network in.
+			config.NetworkModel = vc.NoopNetworkModel
 
 			break
 		}
@@ -234,6 +634,11 @@ func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.Run
 			config.ProxyType = vc.CCProxyType
 			config.ProxyConfig = pConfig
 
+			break
+		case noopProxy:
+			config.ProxyType = vc.NoopProxyType
+			config.ProxyConfig = nil
+
 			break
 		}
 	}
@@ -248,6 +653,11 @@ func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.Run
 
 			config.AgentConfig = agentConfig
 
+			break
+		case noopAgent:
+			config.AgentType = vc.NoopAgentType
+			config.AgentConfig = nil
+
 			break
 		}
 	}
@@ -263,6 +673,11 @@ func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.Run
 			config.ShimType = vc.CCShimType
 			config.ShimConfig = shConfig
 
+			break
+		case noopShim:
+			config.ShimType = vc.NoopShimType
+			config.ShimConfig = nil
+
 			break
 		}
 	}
@@ -275,11 +690,13 @@ func updateRuntimeConfig(configPath string, tomlConf tomlConfig, config *oci.Run
 //
 // If ignoreLogging is true, the global log will not be initialised nor
 // will this function make any log calls.
-func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPath, logfilePath string, config oci.RuntimeConfig, err error) {
+func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPath, logfilePath string, config oci.RuntimeConfig, settings runtimeSettings, err error) {
 	defaultHypervisorConfig := vc.HypervisorConfig{
-		HypervisorPath: defaultHypervisorPath,
-		KernelPath:     defaultKernelPath,
-		ImagePath:      defaultImagePath,
+		HypervisorPath:        defaultHypervisorPath,
+		KernelPath:            defaultKernelPath,
+		ImagePath:             defaultImagePath,
+		HypervisorMachineType: defaultMachineType,
+		CPUModel:              defaultCPUModel,
 	}
 
 	defaultAgentConfig := vc.HyperConfig{
@@ -290,6 +707,8 @@ func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPat
 	config = oci.RuntimeConfig{
 		HypervisorType:   defaultHypervisor,
 		HypervisorConfig: defaultHypervisorConfig,
+		VMConfig:         newVMConfig(hypervisor{}),
+		VMSizing:         newVMSizing(hypervisor{}),
 		AgentType:        defaultAgent,
 		AgentConfig:      defaultAgentConfig,
 		ProxyType:        defaultProxy,
@@ -305,43 +724,59 @@ func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPat
 		if os.IsNotExist(err) {
 			// Make the error clearer than the one returned
 			// by EvalSymlinks().
-			return "", "", config, fmt.Errorf("Config file %v does not exist", configPath)
+			return "", "", config, settings, fmt.Errorf("Config file %v does not exist", configPath)
 		}
 
-		return "", "", config, err
+		return "", "", config, settings, err
 	}
 
 	configData, err := ioutil.ReadFile(resolved)
 	if err != nil {
-		return "", "", config, err
+		return "", "", config, settings, err
 	}
 
 	var tomlConf tomlConfig
 	_, err = toml.Decode(string(configData), &tomlConf)
 	if err != nil {
-		return "", "", config, err
+		return "", "", config, settings, err
 	}
 
 	logfilePath = tomlConf.Runtime.GlobalLogPath
 
+	rotation, err := newGlobalLogRotation(tomlConf.Runtime)
+	if err != nil {
+		return "", "", config, settings, fmt.Errorf("%v: %v", resolved, err)
+	}
+
+	sinks, err := newLogSinks(tomlConf.Runtime)
+	if err != nil {
+		return "", "", config, settings, fmt.Errorf("%v: %v", resolved, err)
+	}
+
 	if !ignoreLogging {
-		// The configuration file may have enabled global logging,
-		// so handle that before any log calls.
-		err = handleGlobalLog(logfilePath)
+		// The configuration file may have enabled global logging
+		// or other log sinks, so handle that before any log calls.
+		err = handleLogSinks(logfilePath, sinks, rotation)
 		if err != nil {
-			return "", "", config, err
+			return "", "", config, settings, err
 		}
 
 		ccLog.Debugf("TOML configuration: %v", tomlConf)
 	}
 
-	if err := checkConfigParams(tomlConf); err != nil {
-		return "", "", config, err
+	profiles, err := newRuntimeProfiles(resolved, tomlConf, config)
+	if err != nil {
+		return "", "", config, settings, err
 	}
 
-	if err := updateRuntimeConfig(resolved, tomlConf, &config); err != nil {
-		return "", "", config, err
+	config = profiles.configs[profiles.defaultName]
+
+	settings, err = newRuntimeSettings(tomlConf.Runtime)
+	if err != nil {
+		return "", "", config, settings, fmt.Errorf("%v: %v", resolved, err)
 	}
 
-	return resolved, logfilePath, config, nil
+	settings.profiles = profiles
+
+	return resolved, logfilePath, config, settings, nil
 }
@@ -21,12 +21,14 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	goruntime "runtime"
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
-	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -96,7 +98,7 @@ func TestRuntimeConfig(t *testing.T) {
 	err = syscall.Symlink(configPath, configPathLink)
 	assert.NoError(t, err)
 
-	_, _, config, err := loadConfiguration(configPathLink, true)
+	_, _, config, _, err := loadConfiguration(configPathLink, true)
 	if err == nil {
 		t.Fatalf("Expected loadConfiguration to fail as no paths exist: %+v", config)
 	}
@@ -108,7 +110,7 @@ func TestRuntimeConfig(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, _, config, err = loadConfiguration(configPathLink, true)
+	_, _, config, _, err = loadConfiguration(configPathLink, true)
 	if err == nil {
 		t.Fatalf("Expected loadConfiguration to fail as only pause path exists: %+v", config)
 	}
@@ -120,7 +122,7 @@ func TestRuntimeConfig(t *testing.T) {
 	filesLen := len(files)
 
 	for i, file := range files {
-		_, _, _, err = loadConfiguration(configPathLink, true)
+		_, _, _, _, err = loadConfiguration(configPathLink, true)
 		if err == nil {
 			t.Fatalf("Expected loadConfiguration to fail as not all paths exist (not created %v)",
 				strings.Join(files[i:filesLen], ","))
@@ -137,7 +139,7 @@ func TestRuntimeConfig(t *testing.T) {
 	}
 
 	// all paths exist now
-	resolvedConfigPath, logfilePath, config, err := loadConfiguration(configPathLink, true)
+	resolvedConfigPath, logfilePath, config, _, err := loadConfiguration(configPathLink, true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -148,9 +150,11 @@ func TestRuntimeConfig(t *testing.T) {
 	assert.False(t, fileExists(logPath))
 
 	expectedHypervisorConfig := vc.HypervisorConfig{
-		HypervisorPath: hypervisorPath,
-		KernelPath:     kernelPath,
-		ImagePath:      imagePath,
+		HypervisorPath:        hypervisorPath,
+		KernelPath:            kernelPath,
+		ImagePath:             imagePath,
+		HypervisorMachineType: defaultMachineType,
+		CPUModel:              defaultCPUModel,
 	}
 
 	expectedAgentConfig := vc.HyperConfig{
@@ -166,6 +170,15 @@ func TestRuntimeConfig(t *testing.T) {
 	}
 
 	expectedConfig := oci.RuntimeConfig{
+		VMConfig: vc.Resources{
+			VCPUs:  uint(goruntime.NumCPU()),
+			Memory: defaultMemSize,
+		},
+		VMSizing: oci.VMSizing{
+			MemoryOverhead: defaultMemoryOverhead,
+			MaxVCPUs:       uint(goruntime.NumCPU()),
+		},
+
 		HypervisorType:   defaultHypervisor,
 		HypervisorConfig: expectedHypervisorConfig,
 
@@ -183,7 +196,7 @@ func TestRuntimeConfig(t *testing.T) {
 		t.Fatalf("Got %v\n expecting %v", config, expectedConfig)
 	}
 
-	resolvedConfigPath, logfilePath, _, err = loadConfiguration(configPathLink, false)
+	resolvedConfigPath, logfilePath, _, _, err = loadConfiguration(configPathLink, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -222,7 +235,7 @@ func TestMinimalRuntimeConfig(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, _, config, err := loadConfiguration(configPath, false)
+	_, _, config, _, err := loadConfiguration(configPath, false)
 	if err == nil {
 		t.Fatalf("Expected loadConfiguration to fail as shim path does not exist: %+v", config)
 	}
@@ -232,15 +245,17 @@ func TestMinimalRuntimeConfig(t *testing.T) {
 		t.Error(err)
 	}
 
-	_, _, config, err = loadConfiguration(configPath, false)
+	_, _, config, _, err = loadConfiguration(configPath, false)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	expectedHypervisorConfig := vc.HypervisorConfig{
-		HypervisorPath: defaultHypervisorPath,
-		KernelPath:     defaultKernelPath,
-		ImagePath:      defaultImagePath,
+		HypervisorPath:        defaultHypervisorPath,
+		KernelPath:            defaultKernelPath,
+		ImagePath:             defaultImagePath,
+		HypervisorMachineType: defaultMachineType,
+		CPUModel:              defaultCPUModel,
 	}
 
 	expectedAgentConfig := vc.HyperConfig{
@@ -256,6 +271,15 @@ func TestMinimalRuntimeConfig(t *testing.T) {
 	}
 
 	expectedConfig := oci.RuntimeConfig{
+		VMConfig: vc.Resources{
+			VCPUs:  uint(goruntime.NumCPU()),
+			Memory: defaultMemSize,
+		},
+		VMSizing: oci.VMSizing{
+			MemoryOverhead: defaultMemoryOverhead,
+			MaxVCPUs:       uint(goruntime.NumCPU()),
+		},
+
 		HypervisorType:   defaultHypervisor,
 		HypervisorConfig: expectedHypervisorConfig,
 
@@ -331,6 +355,49 @@ func TestNewQemuHypervisorConfig(t *testing.T) {
 	}
 }
 
+func TestNewQemuHypervisorConfigInitrd(t *testing.T) {
+	dir, err := ioutil.TempDir(testDir, "hypervisor-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hypervisor := hypervisor{
+		Path:   path.Join(dir, "hypervisor"),
+		Kernel: path.Join(dir, "kernel"),
+		Initrd: path.Join(dir, "initrd"),
+	}
+
+	for _, file := range []string{hypervisor.Path, hypervisor.Kernel} {
+		if err := createEmptyFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := newQemuHypervisorConfig(hypervisor); err == nil {
+		t.Fatal("Expected newQemuHypervisorConfig to fail as the initrd does not exist")
+	}
+
+	if err := createEmptyFile(hypervisor.Initrd); err != nil {
+		t.Fatal(err)
+	}
+
+	// The image does not need to exist as the guest boots from the
+	// initrd.
+	config, err := newQemuHypervisorConfig(hypervisor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.InitrdPath != hypervisor.Initrd {
+		t.Errorf("Expected initrd path %v, got %v", hypervisor.Initrd, config.InitrdPath)
+	}
+
+	if config.ImagePath != "" {
+		t.Errorf("Expected no image path, got %v", config.ImagePath)
+	}
+}
+
 func TestNewHyperstartAgentConfig(t *testing.T) {
 	dir, err := ioutil.TempDir(testDir, "hyperstart-agent-config-")
 	if err != nil {
@@ -548,6 +615,155 @@ func TestHypervisorDefaults(t *testing.T) {
 	image := "foo"
 	h.Image = image
 	assert.Equal(t, h.image(), image, "custom hypervisor image wrong")
+
+	assert.Equal(t, h.machineType(), defaultMachineType, "default hypervisor machine type wrong")
+	assert.Equal(t, h.defaultVCPUs(), uint(goruntime.NumCPU()), "default VM vCPUs wrong")
+	assert.Equal(t, h.defaultMemSz(), uint(defaultMemSize), "default VM memory wrong")
+
+	h.MachineType = vc.QemuQ35
+	assert.Equal(t, h.machineType(), vc.QemuQ35, "custom hypervisor machine type wrong")
+
+	h.DefaultVCPUs = 1
+	assert.Equal(t, h.defaultVCPUs(), uint(1), "custom VM vCPUs wrong")
+
+	h.DefaultVCPUs = goruntime.NumCPU() + 1
+	assert.Equal(t, h.defaultVCPUs(), uint(goruntime.NumCPU()), "VM vCPUs not capped to the host CPUs")
+
+	h.DefaultMemSz = 512
+	assert.Equal(t, h.defaultMemSz(), uint(512), "custom VM memory wrong")
+}
+
+func TestParseKernelParams(t *testing.T) {
+	assert := assert.New(t)
+
+	params, err := parseKernelParams("")
+	assert.NoError(err)
+	assert.Empty(params)
+
+	params, err = parseKernelParams(" console=hvc0  quiet rootflags=dax,data=ordered ")
+	assert.NoError(err)
+	assert.Equal([]vc.Param{
+		{Key: "console", Value: "hvc0"},
+		{Key: "quiet"},
+		{Key: "rootflags", Value: "dax,data=ordered"},
+	}, params)
+
+	_, err = parseKernelParams("quiet =hvc0")
+	assert.Error(err)
+}
+
+func TestParseHypervisorParams(t *testing.T) {
+	assert := assert.New(t)
+
+	params, err := parseHypervisorParams("")
+	assert.NoError(err)
+	assert.Empty(params)
+
+	params, err = parseHypervisorParams("-no-reboot -device virtio-rng-pci")
+	assert.NoError(err)
+	assert.Equal([]vc.Param{
+		{Key: "-no-reboot"},
+		{Key: "-device"},
+		{Key: "virtio-rng-pci"},
+	}, params)
+
+	_, err = parseHypervisorParams("virtio-rng-pci")
+	assert.Error(err)
+}
+
+func TestNewVMSizing(t *testing.T) {
+	assert := assert.New(t)
+
+	numCPUs := uint(goruntime.NumCPU())
+
+	assert.Equal(oci.VMSizing{
+		MemoryOverhead: defaultMemoryOverhead,
+		MaxVCPUs:       numCPUs,
+	}, newVMSizing(hypervisor{}))
+
+	assert.Equal(oci.VMSizing{
+		MemoryOverhead: 64,
+		MinVCPUs:       1,
+		MaxVCPUs:       1,
+		MinMemory:      256,
+		MaxMemory:      4096,
+	}, newVMSizing(hypervisor{
+		MemoryOverhead: 64,
+		MinVCPUs:       1,
+		MaxVCPUs:       1,
+		MinMemory:      256,
+		MaxMemory:      4096,
+	}))
+
+	// The VMs cannot have more vCPUs than the host has CPUs.
+	sizing := newVMSizing(hypervisor{MaxVCPUs: int(numCPUs) + 1})
+	assert.Equal(numCPUs, sizing.MaxVCPUs)
+}
+
+func TestNewHypervisorConfigInvalid(t *testing.T) {
+	for _, h := range []hypervisor{
+		{MachineType: "pc"},
+		{DefaultVCPUs: -1},
+		{DefaultMemSz: -1},
+		{KernelParams: "=foo"},
+		{HypervisorParams: "foo"},
+		{Image: "/image", Initrd: "/initrd"},
+		{MemoryOverhead: -1},
+		{MaxVCPUs: -1},
+		{MinVCPUs: 2, MaxVCPUs: 1},
+		{MinMemory: 512, MaxMemory: 256},
+		{NUMANodes: []int{0, -1}},
+	} {
+		if _, err := newHypervisorConfig(h); err == nil {
+			t.Errorf("Expected newHypervisorConfig to fail for %+v", h)
+		}
+	}
+}
+
+func TestRuntimeConfigHypervisorSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	configData := `
+	[hypervisor.mock]
+	kernel_params = "foo=bar quiet"
+	hypervisor_params = "-no-reboot"
+	machine_type = "q35"
+	default_vcpus = 1
+	default_memory = 512
+	enable_debug = true
+	enable_hugepages = true
+	enable_mem_prealloc = true
+	numa_nodes = [0, 1]
+	cpu_model = "Haswell"
+
+	[agent.noop]
+
+	[proxy.noop]
+
+	[shim.noop]
+`
+
+	configPath, err := createConfig("runtime.toml", configData)
+	assert.NoError(err)
+
+	_, _, config, _, err := loadConfiguration(configPath, true)
+	assert.NoError(err)
+
+	assert.Equal([]vc.Param{{Key: "foo", Value: "bar"}, {Key: "quiet"}}, config.HypervisorConfig.KernelParams)
+	assert.Equal([]vc.Param{{Key: "-no-reboot"}}, config.HypervisorConfig.HypervisorParams)
+	assert.Equal(vc.QemuQ35, config.HypervisorConfig.HypervisorMachineType)
+	assert.True(config.HypervisorConfig.Debug)
+	assert.True(config.HypervisorConfig.HugePages)
+	assert.True(config.HypervisorConfig.MemPrealloc)
+	assert.Equal([]uint{0, 1}, config.HypervisorConfig.NUMANodes)
+	assert.Equal("Haswell", config.HypervisorConfig.CPUModel)
+	assert.Equal(vc.Resources{VCPUs: 1, Memory: 512}, config.VMConfig)
+
+	configPath, err = createConfig("runtime.toml", strings.Replace(configData, "512", "-512", 1))
+	assert.NoError(err)
+
+	_, _, _, _, err = loadConfiguration(configPath, true)
+	assert.Error(err)
 }
 
 func TestProxyDefaults(t *testing.T) {
@@ -580,3 +796,152 @@ func TestAgentDefaults(t *testing.T) {
 	a.PauseRootPath = path
 	assert.Equal(t, a.pauseRootPath(), path, "custom agent pause root path wrong")
 }
+
+func TestRuntimeSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	settings, err := newRuntimeSettings(runtime{})
+	assert.NoError(err)
+	assert.Empty(settings.timeouts)
+
+	settings, err = newRuntimeSettings(runtime{
+		Timeouts: map[string]string{
+			"create": "30s",
+			"delete": "1m",
+		},
+	})
+	assert.NoError(err)
+	assert.Equal(30*time.Second, settings.timeouts["create"])
+	assert.Equal(time.Minute, settings.timeouts["delete"])
+	assert.Equal(time.Duration(0), settings.timeouts["start"])
+
+	for _, timeouts := range []map[string]string{
+		{"foo": "30s"},
+		{"create": "forever"},
+		{"create": "0s"},
+		{"create": "-1s"},
+	} {
+		_, err = newRuntimeSettings(runtime{Timeouts: timeouts})
+		assert.Error(err, "%v", timeouts)
+	}
+}
+
+func TestRuntimeConfigTimeouts(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "runtime-config-timeouts-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	shimPath := path.Join(dir, "shim")
+	assert.NoError(createEmptyFile(shimPath))
+
+	configData := `
+	[shim.cc]
+	path = "` + shimPath + `"
+
+	[runtime.timeouts]
+	create = "45s"
+`
+
+	configPath, err := createConfig("runtime.toml", configData)
+	assert.NoError(err)
+
+	_, _, _, settings, err := loadConfiguration(configPath, true)
+	assert.NoError(err)
+	assert.Equal(45*time.Second, settings.timeouts["create"])
+
+	configPath, err = createConfig("runtime.toml", configData+`
+	start = "soon"
+`)
+	assert.NoError(err)
+
+	_, _, _, _, err = loadConfiguration(configPath, true)
+	assert.Error(err)
+}
+
+func TestRuntimeConfigTrace(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "runtime-config-trace-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	shimPath := path.Join(dir, "shim")
+	assert.NoError(createEmptyFile(shimPath))
+
+	configData := `
+	[shim.cc]
+	path = "` + shimPath + `"
+`
+
+	configPath, err := createConfig("runtime.toml", configData)
+	assert.NoError(err)
+
+	_, _, _, settings, err := loadConfiguration(configPath, true)
+	assert.NoError(err)
+	assert.Empty(settings.trace)
+
+	configPath, err = createConfig("runtime.toml", configData+`
+	[runtime]
+	trace = "unix:///run/collector.sock"
+`)
+	assert.NoError(err)
+
+	_, _, _, settings, err = loadConfiguration(configPath, true)
+	assert.NoError(err)
+	assert.Equal("unix:///run/collector.sock", settings.trace)
+}
+
+func TestSimulationRuntimeConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "runtime-config-simulation-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// None of the files have to exist.
+	configData := `
+	[hypervisor.mock]
+	path = "` + path.Join(dir, "hypervisor") + `"
+
+	[proxy.noop]
+
+	[shim.noop]
+
+	[agent.noop]
+`
+
+	configPath, err := createConfig("runtime.toml", configData)
+	assert.NoError(err)
+
+	_, _, config, _, err := loadConfiguration(configPath, true)
+	assert.NoError(err)
+
+	assert.Equal(vc.MockHypervisor, config.HypervisorType)
+	assert.Equal(path.Join(dir, "hypervisor"), config.HypervisorConfig.HypervisorPath)
+	assert.Equal(defaultKernelPath, config.HypervisorConfig.KernelPath)
+	assert.Equal(vc.NoopNetworkModel, config.NetworkModel)
+	assert.Equal(vc.NoopProxyType, config.ProxyType)
+	assert.Nil(config.ProxyConfig)
+	assert.Equal(vc.NoopShimType, config.ShimType)
+	assert.Nil(config.ShimConfig)
+	assert.Equal(vc.NoopAgentType, config.AgentType)
+	assert.Nil(config.AgentConfig)
+
+	details, err := getHypervisorDetails(config)
+	assert.NoError(err)
+	assert.Equal(config.HypervisorConfig.ImagePath, details.ImagePath)
+
+	proxy, err := getProxyInfo(config)
+	assert.NoError(err)
+	assert.Equal(string(vc.NoopProxyType), proxy.Type)
+
+	shim, err := getShimInfo(config)
+	assert.NoError(err)
+	assert.Equal(string(vc.NoopShimType), shim.Type)
+
+	agent, err := getAgentInfo(config)
+	assert.NoError(err)
+	assert.Equal(string(vc.NoopAgentType), agent.Type)
+}
@@ -16,13 +16,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
-	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
 )
 
@@ -59,25 +61,29 @@ var createCommand = cli.Command{
 		},
 	},
 	Action: func(context *cli.Context) error {
-		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		settings, ok := context.App.Metadata["runtimeSettings"].(runtimeSettings)
 		if !ok {
-			return errors.New("invalid runtime config")
+			return errors.New("invalid runtime settings")
 		}
 
-		return create(context.Args().First(),
+		ctx, done := operationContext(context, "create")
+
+		return done(create(ctx, context.Args().First(),
 			context.String("bundle"),
 			context.String("console"),
 			context.String("pid-file"),
-			runtimeConfig,
-		)
+			settings,
+		))
 	},
 }
 
-func create(containerID, bundlePath, console, pidFilePath string,
-	runtimeConfig oci.RuntimeConfig) error {
+// create creates the container. Once its pod or container is created,
+// a failure of the following steps deletes it, so that no VM is leaked.
+func create(ctx context.Context, containerID, bundlePath, console, pidFilePath string,
+	settings runtimeSettings) (err error) {
 
 	// Checks the MUST and MUST NOT from OCI runtime specification
-	if err := validCreateParams(containerID, bundlePath); err != nil {
+	if err := validCreateParams(ctx, containerID, bundlePath); err != nil {
 		return err
 	}
 
@@ -92,15 +98,16 @@ func create(containerID, bundlePath, console, pidFilePath string,
 	}
 
 	var process vc.Process
+	var vm podVM
 
 	switch containerType {
 	case vc.PodSandbox:
-		process, err = createPod(ociSpec, runtimeConfig, containerID, bundlePath, console)
+		process, vm, err = createPod(ctx, ociSpec, settings, containerID, bundlePath, console)
 		if err != nil {
 			return err
 		}
 	case vc.PodContainer:
-		process, err = createContainer(ociSpec, containerID, bundlePath, console)
+		process, vm, err = createContainer(ctx, ociSpec, settings, containerID, bundlePath, console)
 		if err != nil {
 			return err
 		}
@@ -108,20 +115,69 @@ func create(containerID, bundlePath, console, pidFilePath string,
 		return fmt.Errorf("Invalid container type %q found", string(containerType))
 	}
 
+	defer func() {
+		if err != nil {
+			cleanupContainer(containerID, settings)
+		}
+	}()
+
+	if containerType == vc.PodContainer {
+
+		// The memory hotplugged for the container must fit in the
+		// memory limit of the cgroup holding the VM. The container is
+		// created by then, a failure only risks qemu being killed.
+		if err := raiseVMMemoryLimit(vm.pid, vm.hotplugMemory); err != nil {
+			ccLog.Warnf("Could not raise the memory limit of the VM: %v", err)
+		}
+	}
+
 	// config.json provides a cgroups path that has to be used to create "tasks"
 	// and "cgroups.procs" files. Those files have to be filled with a PID, which
 	// is shim's in our case. This is mandatory to make sure there is no one
 	// else (like Docker) trying to create those files on our behalf. We want to
 	// know those files location so that we can remove them when delete is called.
-	cgroupsPathList, err := processCgroupsPath(ociSpec, containerType.IsPod())
+	//
+	// The cgroups of a pod also hold its VM, so that their limits, raised
+	// by the overhead of the VM, bound the whole VM. The VM does not join
+	// the devices cgroup, whose rules concern the workload rather than
+	// the devices given to the VM. With a sandbox cgroup parent, the VM
+	// is held by the sandbox cgroups of the pod instead, along with the
+	// vhost threads of qemu, so that its overhead is accounted to the pod.
+	// The sandbox cgroups of a pod given a cgroups path are nested in its
+	// cgroups, which keep its limits but hold no process.
+	cgroups, err := processCgroups(ociSpec, containerType.IsPod())
 	if err != nil {
 		return err
 	}
 
-	if err := createCgroupsFiles(cgroupsPathList, process.Pid); err != nil {
+	resources := ociSpec.Linux.Resources
+	vmPID := 0
+	sandboxed := containerType.IsPod() && settings.sandboxCgroupParent != ""
+
+	if containerType.IsPod() {
+		resources = settings.overhead.add(resources)
+		vmPID = vm.pid
+	}
+
+	if sandboxed {
+		for _, cg := range cgroups {
+			if err := createCgroup(cg, resources); err != nil {
+				return err
+			}
+		}
+
+		parent := podSandboxCgroupParent(settings.sandboxCgroupParent, ociSpec.Linux.CgroupsPath)
+		cgroups = sandboxCgroups(parent, containerID, resources)
+	}
+
+	if err := createCgroupsFiles(cgroups, resources, process.Pid, vmPID); err != nil {
 		return err
 	}
 
+	if sandboxed {
+		moveVhostThreads(cgroups, vm.pid)
+	}
+
 	// Creation of PID file has to be the last thing done in the create
 	// because containerd considers the create complete after this file
 	// is created.
@@ -132,79 +188,183 @@ func create(containerID, bundlePath, console, pidFilePath string,
 	return nil
 }
 
-func createPod(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
-	containerID, bundlePath, console string) (vc.Process, error) {
+// cleanupContainer forcibly deletes the container of a command which
+// failed or did not complete in time. It uses its own context since the
+// one of the command may have expired.
+func cleanupContainer(containerID string, settings runtimeSettings) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	if err := delete(ctx, containerID, true, settings); err != nil {
+		ccLog.Warnf("Could not delete container %s: %v", containerID, err)
+	}
+}
+
+// podVM describes the VM of a pod as seen from the host.
+type podVM struct {
+	// pid is the PID of the VM process, 0 when there is none.
+	pid int
+
+	// hotplugMemory is the memory in MiB hotplugged to the VM for the
+	// container being created.
+	hotplugMemory uint
+}
+
+// newPodVM returns the VM of pod, as seen by the container containerID.
+func newPodVM(pod *vc.Pod, containerID string) (podVM, error) {
+	pid, err := pod.HypervisorPID()
+	if err != nil {
+		return podVM{}, err
+	}
+
+	return podVM{
+		pid:           pid,
+		hotplugMemory: pod.HotpluggedResources(containerID).Memory,
+	}, nil
+}
+
+// createPod creates the pod of the sandbox container and returns the shim
+// process of the container and the VM of the pod.
+func createPod(ctx context.Context, ociSpec oci.CompatOCISpec, settings runtimeSettings,
+	containerID, bundlePath, console string) (vc.Process, podVM, error) {
+
+	profileName, runtimeConfig, err := settings.profiles.selectProfile(ociSpec)
+	if err != nil {
+		return vc.Process{}, podVM{}, err
+	}
+
+	if err := settings.profiles.assets[profileName].verify(); err != nil {
+		return vc.Process{}, podVM{}, newRuntimeError(errCodeConfig, containerID, containerID, err)
+	}
 
 	podConfig, err := oci.PodConfig(ociSpec, runtimeConfig, bundlePath, containerID, console)
 	if err != nil {
-		return vc.Process{}, err
+		return vc.Process{}, podVM{}, err
 	}
 
-	pod, err := vc.CreatePod(podConfig)
+	podConfig, err = applyVMAnnotations(ociSpec, podConfig, settings.annotations)
 	if err != nil {
-		return vc.Process{}, err
+		return vc.Process{}, podVM{}, err
+	}
+
+	podConfig.Annotations[profileAnnotation] = profileName
+
+	if settings.sandboxCgroupParent != "" {
+		podConfig.Annotations[sandboxCgroupAnnotation] = podSandboxCgroupParent(settings.sandboxCgroupParent,
+			ociSpec.Linux.CgroupsPath)
+	}
+
+	setLogField(logFieldPodID, podConfig.ID)
+	noteHistoryContainer(containerID, podConfig.ID)
+
+	// The index entry is added first so that the container cannot be
+	// missing from the index, a stale entry being removed when found.
+	if err := addContainerIndex(containerID, podConfig.ID); err != nil {
+		return vc.Process{}, podVM{}, err
+	}
+
+	pod, err := vc.CreatePod(ctx, podConfig)
+	if err != nil {
+		removeContainerIndex(containerID)
+		return vc.Process{}, podVM{}, err
 	}
 
 	containers := pod.GetAllContainers()
 	if len(containers) != 1 {
-		return vc.Process{}, fmt.Errorf("BUG: Container list from pod is wrong, expecting only one container, found %d containers", len(containers))
+		cleanupContainer(containerID, settings)
+		return vc.Process{}, podVM{}, fmt.Errorf("BUG: Container list from pod is wrong, expecting only one container, found %d containers", len(containers))
 	}
 
-	return containers[0].Process(), nil
+	vm, err := newPodVM(pod, containerID)
+	if err != nil {
+		cleanupContainer(containerID, settings)
+		return vc.Process{}, podVM{}, err
+	}
+
+	return containers[0].Process(), vm, nil
 }
 
-func createContainer(ociSpec oci.CompatOCISpec, containerID, bundlePath,
-	console string) (vc.Process, error) {
+// createContainer creates a container in its pod and returns its shim
+// process and the VM of the pod.
+func createContainer(ctx context.Context, ociSpec oci.CompatOCISpec, settings runtimeSettings,
+	containerID, bundlePath, console string) (vc.Process, podVM, error) {
 
 	contConfig, err := oci.ContainerConfig(ociSpec, bundlePath, containerID, console)
 	if err != nil {
-		return vc.Process{}, err
+		return vc.Process{}, podVM{}, err
 	}
 
 	podID, err := ociSpec.PodID()
 	if err != nil {
-		return vc.Process{}, err
+		return vc.Process{}, podVM{}, err
+	}
+
+	setLogField(logFieldPodID, podID)
+	noteHistoryContainer(containerID, podID)
+
+	if err := addContainerIndex(containerID, podID); err != nil {
+		return vc.Process{}, podVM{}, err
+	}
+
+	pod, c, err := vc.CreateContainer(ctx, podID, contConfig)
+	if err != nil {
+		removeContainerIndex(containerID)
+		return vc.Process{}, podVM{}, err
 	}
 
-	_, c, err := vc.CreateContainer(podID, contConfig)
+	vm, err := newPodVM(pod, containerID)
 	if err != nil {
-		return vc.Process{}, err
+		cleanupContainer(containerID, settings)
+		return vc.Process{}, podVM{}, err
 	}
 
-	return c.Process(), nil
+	return c.Process(), vm, nil
 }
 
-func createCgroupsFiles(cgroupsPathList []string, pid int) error {
-	if len(cgroupsPathList) == 0 {
+// createCgroupsFiles creates the cgroups, writes the resources into them
+// and moves the shim process pid into them, along with the VM process
+// vmPID when there is one. The VM does not join the devices cgroup.
+func createCgroupsFiles(cgroups []cgroup, resources *specs.LinuxResources, pid, vmPID int) error {
+	if len(cgroups) == 0 {
 		ccLog.Info("Cgroups files not created because cgroupsPath was empty")
 		return nil
 	}
 
-	for _, cgroupsPath := range cgroupsPathList {
-		if err := os.MkdirAll(cgroupsPath, cgroupsDirMode); err != nil {
+	// Writing 0 would move the runtime itself into the cgroups.
+	if pid == 0 {
+		ccLog.Info("Cgroups files not created because the container has no shim process")
+		return nil
+	}
+
+	for _, cg := range cgroups {
+		// The limits are written before any process joins the
+		// cgroup, which a cpuset cannot hold before its CPUs are
+		// set.
+		if err := createCgroup(cg, resources); err != nil {
 			return err
 		}
 
-		tasksFilePath := filepath.Join(cgroupsPath, cgroupsTasksFile)
-		procsFilePath := filepath.Join(cgroupsPath, cgroupsProcsFile)
-
-		pidStr := fmt.Sprintf("%d", pid)
+		paths := []string{
+			filepath.Join(cg.path, cgroupsTasksFile),
+			filepath.Join(cg.path, cgroupsProcsFile),
+		}
 
-		for _, path := range []string{tasksFilePath, procsFilePath} {
-			f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, cgroupsFileMode)
-			if err != nil {
-				return err
-			}
-			defer f.Close()
+		// The unified hierarchy has no tasks file.
+		if cg.controller == "" {
+			paths = paths[1:]
+		}
 
-			n, err := f.WriteString(pidStr)
-			if err != nil {
-				return err
-			}
+		pids := []int{pid}
+		if vmPID != 0 && cg.controller != "devices" {
+			pids = append(pids, vmPID)
+		}
 
-			if n < len(pidStr) {
-				return fmt.Errorf("Could not write pid to %q: only %d bytes written out of %d",
-					path, n, len(pidStr))
+		// The kernel moves a single process per write.
+		for _, path := range paths {
+			for _, p := range pids {
+				if err := writeCgroupFile(path, fmt.Sprintf("%d", p)); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -212,6 +372,19 @@ func createCgroupsFiles(cgroupsPathList []string, pid int) error {
 	return nil
 }
 
+// createCgroup creates the cgroup cg and writes the resources into it.
+func createCgroup(cg cgroup, resources *specs.LinuxResources) error {
+	if err := os.MkdirAll(cg.path, cgroupsDirMode); err != nil {
+		return err
+	}
+
+	if cg.controller == "" {
+		return setCgroup2Resources(cg.path, resources)
+	}
+
+	return setCgroupResources(cg, resources)
+}
+
 func createPIDFile(pidFilePath string, pid int) error {
 	if pidFilePath == "" {
 		// runtime should not fail since pid file is optional
@@ -26,7 +26,12 @@ var testPID = 100
 var testStrPID = fmt.Sprintf("%d", testPID)
 
 func testCreateCgroupsFilesSuccessful(t *testing.T, cgroupsPathList []string, pid int) {
-	if err := createCgroupsFiles(cgroupsPathList, pid); err != nil {
+	var cgroups []cgroup
+	for _, cgroupsPath := range cgroupsPathList {
+		cgroups = append(cgroups, cgroup{"memory", cgroupsPath})
+	}
+
+	if err := createCgroupsFiles(cgroups, nil, pid, 0); err != nil {
 		t.Fatalf("This test should succeed (cgroupsPath %q, pid %d): %s", cgroupsPathList, pid, err)
 	}
 }
@@ -64,6 +69,23 @@ func TestCgroupsFilesNonEmptyCgroupsPathSuccessful(t *testing.T) {
 	}
 }
 
+func TestCgroupsFilesNoShimProcess(t *testing.T) {
+	cgroupsPath, err := ioutil.TempDir(testDir, "cgroups-path-")
+	if err != nil {
+		t.Fatalf("Could not create temporary cgroups directory: %s", err)
+	}
+	defer os.RemoveAll(cgroupsPath)
+
+	testCreateCgroupsFilesSuccessful(t, []string{cgroupsPath}, 0)
+
+	for _, file := range []string{cgroupsTasksFile, cgroupsProcsFile} {
+		path := filepath.Join(cgroupsPath, file)
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("Path %q should not have been created: %v", path, err)
+		}
+	}
+}
+
 func TestCreatePIDFileSuccessful(t *testing.T) {
 	pidDirPath, err := ioutil.TempDir(testDir, "pid-path-")
 	if err != nil {
@@ -16,11 +16,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 
-	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
 )
 
@@ -44,25 +46,33 @@ EXAMPLE:
 		},
 	},
 	Action: func(context *cli.Context) error {
+		settings, ok := context.App.Metadata["runtimeSettings"].(runtimeSettings)
+		if !ok {
+			return errors.New("invalid runtime settings")
+		}
+
 		args := context.Args()
 		if args.Present() == false {
-			return fmt.Errorf("Missing container ID, should at least provide one")
+			return newRuntimeError(errCodeUsage, "", "",
+				fmt.Errorf("Missing container ID, should at least provide one"))
 		}
 
+		ctx, done := operationContext(context, "delete")
+
 		force := context.Bool("force")
 		for _, cID := range []string(args) {
-			if err := delete(cID, force); err != nil {
-				return err
+			if err := delete(ctx, cID, force, settings); err != nil {
+				return done(err)
 			}
 		}
 
-		return nil
+		return done(nil)
 	},
 }
 
-func delete(containerID string, force bool) error {
+func delete(ctx context.Context, containerID string, force bool, settings runtimeSettings) error {
 	// Checks the MUST and MUST NOT from OCI runtime specification
-	status, podID, err := getExistingContainerInfo(containerID)
+	status, podID, err := getExistingContainerInfo(ctx, containerID)
 	if err != nil {
 		return err
 	}
@@ -80,13 +90,14 @@ func delete(containerID string, force bool) error {
 		return err
 	}
 
-	running, err := processRunning(status.PID)
+	running, err := containerProcessRunning(status)
 	if err != nil {
 		return err
 	}
 
 	if !force && running {
-		return fmt.Errorf("Container still running, should be stopped")
+		return newRuntimeError(errCodeInvalidState, containerID, podID,
+			fmt.Errorf("Container still running, should be stopped"))
 	}
 
 	forceStop := false
@@ -95,52 +106,90 @@ func delete(containerID string, force bool) error {
 		ccLog.Info("Force stopping the pod/container before deleting")
 	}
 
+	var sandboxCgroupsPathList []string
+
 	switch containerType {
 	case vc.PodSandbox:
-		if err := deletePod(podID, forceStop); err != nil {
+		// The annotations of the pod are gone once it is deleted. A pod
+		// whose state cannot be read must still be deletable, its
+		// sandbox cgroups are then assumed to be under the configured
+		// parent.
+		sandboxCgroupsPathList = getSandboxCgroupsPath(ctx, podID, ociSpec, settings)
+
+		if err := deletePod(ctx, podID, forceStop); err != nil {
 			return err
 		}
 	case vc.PodContainer:
-		if err := deleteContainer(podID, containerID, forceStop); err != nil {
+		if err := deleteContainer(ctx, podID, containerID, forceStop); err != nil {
 			return err
 		}
 	default:
 		return fmt.Errorf("Invalid container type found")
 	}
 
+	if err := removeContainerIndex(containerID); err != nil {
+		return err
+	}
+
 	// In order to prevent any file descriptor leak related to cgroups files
 	// that have been previously created, we have to remove them before this
-	// function returns.
+	// function returns. The sandbox cgroups go first, as they may be
+	// nested in the other ones.
 	cgroupsPathList, err := processCgroupsPath(ociSpec, containerType.IsPod())
 	if err != nil {
 		return err
 	}
 
-	return removeCgroupsPath(cgroupsPathList)
+	return removeCgroupsPath(append(sandboxCgroupsPathList, cgroupsPathList...))
+}
+
+// getSandboxCgroupsPath returns the paths of the sandbox cgroups of the
+// pod, if it was created with a sandbox cgroup parent. They are found from
+// the resources create wrote into them, raised by the VM overhead.
+func getSandboxCgroupsPath(ctx context.Context, podID string, ociSpec oci.CompatOCISpec,
+	settings runtimeSettings) []string {
+
+	var parent string
+
+	pod, err := vc.StatusPod(ctx, podID)
+	if err == nil {
+		parent = pod.Annotations[sandboxCgroupAnnotation]
+	} else {
+		parent = podSandboxCgroupParent(settings.sandboxCgroupParent, ociSpec.Linux.CgroupsPath)
+		ccLog.Warnf("Cannot read the sandbox cgroup parent of pod %s, assuming %q: %v", podID, parent, err)
+	}
+
+	if parent == "" {
+		return nil
+	}
+
+	resources := settings.overhead.add(ociSpec.Linux.Resources)
+
+	return sandboxCgroupsPaths(parent, podID, ociSpec.Linux.CgroupsPath, resources)
 }
 
-func deletePod(podID string, forceStop bool) error {
+func deletePod(ctx context.Context, podID string, forceStop bool) error {
 	if forceStop {
-		if _, err := vc.StopPod(podID); err != nil {
+		if _, err := vc.StopPod(ctx, podID); err != nil {
 			return err
 		}
 	}
 
-	if _, err := vc.DeletePod(podID); err != nil {
+	if _, err := vc.DeletePod(ctx, podID); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func deleteContainer(podID, containerID string, forceStop bool) error {
+func deleteContainer(ctx context.Context, podID, containerID string, forceStop bool) error {
 	if forceStop {
-		if _, err := vc.StopContainer(podID, containerID); err != nil {
+		if _, err := vc.StopContainer(ctx, podID, containerID); err != nil {
 			return err
 		}
 	}
 
-	if _, err := vc.DeleteContainer(podID, containerID); err != nil {
+	if _, err := vc.DeleteContainer(ctx, podID, containerID); err != nil {
 		return err
 	}
 
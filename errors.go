@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+)
+
+// errorCode identifies the category of a runtime error.
+type errorCode string
+
+// The error codes and their exit codes are documented in the README:
+// they must not be changed as orchestrators rely on them.
+const (
+	errCodeFailure       errorCode = "failure"
+	errCodeUsage         errorCode = "usage"
+	errCodeConfig        errorCode = "configuration"
+	errCodeNotFound      errorCode = "not-found"
+	errCodeAlreadyExists errorCode = "already-exists"
+	errCodeInvalidState  errorCode = "invalid-state"
+	errCodeTimeout       errorCode = "timeout"
+	errCodeProxy         errorCode = "proxy-unreachable"
+	errCodeHypervisor    errorCode = "hypervisor-failure"
+	errCodeAgent         errorCode = "agent-failure"
+	errCodeCorruptState  errorCode = "corrupt-state"
+)
+
+var exitCodes = map[errorCode]int{
+	errCodeFailure:       1,
+	errCodeUsage:         2,
+	errCodeConfig:        3,
+	errCodeNotFound:      4,
+	errCodeAlreadyExists: 5,
+	errCodeInvalidState:  6,
+	errCodeTimeout:       7,
+	errCodeProxy:         8,
+	errCodeHypervisor:    9,
+	errCodeAgent:         10,
+	errCodeCorruptState:  11,
+}
+
+// vcErrorCodes maps the virtcontainers error codes to the runtime ones.
+var vcErrorCodes = map[vc.ErrorCode]errorCode{
+	vc.ErrCodePodNotFound:       errCodeNotFound,
+	vc.ErrCodeContainerNotFound: errCodeNotFound,
+	vc.ErrCodeInvalidState:      errCodeInvalidState,
+	vc.ErrCodeProxyUnreachable:  errCodeProxy,
+	vc.ErrCodeHypervisor:        errCodeHypervisor,
+	vc.ErrCodeAgent:             errCodeAgent,
+	vc.ErrCodeCorruptState:      errCodeCorruptState,
+}
+
+// runtimeError is an error whose category is known. Its message is the one
+// of the error causing the failure.
+type runtimeError struct {
+	code        errorCode
+	containerID string
+	podID       string
+	err         error
+}
+
+func (e *runtimeError) Error() string {
+	return e.err.Error()
+}
+
+func newRuntimeError(code errorCode, containerID, podID string, err error) error {
+	return &runtimeError{
+		code:        code,
+		containerID: containerID,
+		podID:       podID,
+		err:         err,
+	}
+}
+
+// errorJSON is the error object written to stderr when the log format is
+// JSON.
+type errorJSON struct {
+	Code        errorCode `json:"code"`
+	ExitCode    int       `json:"exitCode"`
+	Message     string    `json:"message"`
+	ContainerID string    `json:"containerID,omitempty"`
+	PodID       string    `json:"podID,omitempty"`
+}
+
+// classifyError returns the category and the IDs related to err.
+func classifyError(err error) runtimeError {
+	switch e := err.(type) {
+	case *runtimeError:
+		return *e
+	case *vc.Error:
+		code, ok := vcErrorCodes[e.Code]
+		if !ok {
+			code = errCodeFailure
+		}
+
+		return runtimeError{
+			code:        code,
+			containerID: e.ContainerID,
+			podID:       e.PodID,
+			err:         e.Err,
+		}
+	}
+
+	if err == errPrefixContIDNotUnique {
+		return runtimeError{code: errCodeUsage, err: err}
+	}
+
+	return runtimeError{code: errCodeFailure, err: err}
+}
+
+// writeError writes err to w, as a JSON object if asked to, and returns
+// the corresponding exit code.
+func writeError(w io.Writer, err error, asJSON bool) int {
+	e := classifyError(err)
+	code := exitCodes[e.code]
+
+	if !asJSON {
+		fmt.Fprintln(w, err)
+		return code
+	}
+
+	data, jsonErr := json.Marshal(errorJSON{
+		Code:        e.code,
+		ExitCode:    code,
+		Message:     err.Error(),
+		ContainerID: e.containerID,
+		PodID:       e.podID,
+	})
+	if jsonErr != nil {
+		fmt.Fprintln(w, err)
+		return code
+	}
+
+	fmt.Fprintf(w, "%s\n", data)
+
+	return code
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		err         error
+		code        errorCode
+		containerID string
+		podID       string
+	}
+
+	data := []testData{
+		{errors.New("failed"), errCodeFailure, "", ""},
+		{errPrefixContIDNotUnique, errCodeUsage, "", ""},
+		{newRuntimeError(errCodeNotFound, "foo", "", errors.New("not found")), errCodeNotFound, "foo", ""},
+		{&vc.Error{Code: vc.ErrCodeProxyUnreachable, PodID: "bar", Err: errors.New("refused")}, errCodeProxy, "", "bar"},
+		{&vc.Error{Code: vc.ErrCodeInvalidState, PodID: "bar", ContainerID: "foo", Err: errors.New("stopped")}, errCodeInvalidState, "foo", "bar"},
+		{&vc.Error{Code: vc.ErrCodeCorruptState, PodID: "bar", Err: errors.New("corrupted")}, errCodeCorruptState, "", "bar"},
+		{&vc.Error{Code: "unknown", Err: errors.New("unknown")}, errCodeFailure, "", ""},
+	}
+
+	for _, d := range data {
+		e := classifyError(d.err)
+		assert.Equal(d.code, e.code, "%v", d.err)
+		assert.Equal(d.containerID, e.containerID, "%v", d.err)
+		assert.Equal(d.podID, e.podID, "%v", d.err)
+		assert.Equal(d.err.Error(), e.Error())
+	}
+
+	// All error codes must have a distinct exit code.
+	seen := make(map[int]bool)
+	for code, exitCode := range exitCodes {
+		assert.False(seen[exitCode], "%s", code)
+		seen[exitCode] = true
+	}
+	assert.Equal(1, exitCodes[errCodeFailure])
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	_, _, err := getExistingContainerInfo(ctx, "")
+	assert.Equal(errCodeUsage, classifyError(err).code)
+
+	_, err = processSignal("SIGFOO")
+	assert.Equal(errCodeUsage, classifyError(err).code)
+}
+
+func TestWriteError(t *testing.T) {
+	assert := assert.New(t)
+
+	err := newRuntimeError(errCodeNotFound, "foo", "bar", errors.New("Container ID does not exist"))
+
+	buf := new(bytes.Buffer)
+	code := writeError(buf, err, false)
+	assert.Equal(exitCodes[errCodeNotFound], code)
+	assert.Equal("Container ID does not exist\n", buf.String())
+
+	buf.Reset()
+	code = writeError(buf, err, true)
+	assert.Equal(exitCodes[errCodeNotFound], code)
+
+	var obj errorJSON
+	assert.NoError(json.Unmarshal(buf.Bytes(), &obj))
+	assert.Equal(errorJSON{
+		Code:        errCodeNotFound,
+		ExitCode:    exitCodes[errCodeNotFound],
+		Message:     "Container ID does not exist",
+		ContainerID: "foo",
+		PodID:       "bar",
+	}, obj)
+
+	buf.Reset()
+	code = writeError(buf, errors.New("failed"), true)
+	assert.Equal(1, code)
+
+	var failure errorJSON
+	assert.NoError(json.Unmarshal(buf.Bytes(), &failure))
+	assert.Equal(errCodeFailure, failure.Code)
+	assert.Empty(failure.ContainerID)
+}
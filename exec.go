@@ -16,12 +16,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 
-	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
 )
@@ -113,7 +114,9 @@ EXAMPLE:
 			return err
 		}
 
-		return execute(params)
+		ctx, done := operationContext(context, "exec")
+
+		return done(execute(ctx, params))
 	},
 }
 
@@ -158,8 +161,8 @@ func generateExecParams(context *cli.Context) (execParams, error) {
 	return params, nil
 }
 
-func execute(params execParams) error {
-	status, podID, err := getExistingContainerInfo(params.cID)
+func execute(ctx context.Context, params execParams) error {
+	status, podID, err := getExistingContainerInfo(ctx, params.cID)
 	if err != nil {
 		return err
 	}
@@ -168,20 +171,22 @@ func execute(params execParams) error {
 
 	// container MUST be running
 	if status.State.State != vc.StateRunning {
-		return fmt.Errorf("Container %s is not running", params.cID)
+		return newRuntimeError(errCodeInvalidState, params.cID, podID,
+			fmt.Errorf("Container %s is not running", params.cID))
 	}
 
 	// Check status of process running inside the container
-	running, err := processRunning(status.PID)
+	running, err := containerProcessRunning(status)
 	if err != nil {
 		return err
 	}
 	if running == false {
-		if err := stopContainer(podID, status); err != nil {
+		if err := stopContainer(ctx, podID, status); err != nil {
 			return err
 		}
 
-		return fmt.Errorf("Process not running inside container %s", params.cID)
+		return newRuntimeError(errCodeInvalidState, params.cID, podID,
+			fmt.Errorf("Process not running inside container %s", params.cID))
 	}
 
 	envVars, err := oci.EnvVars(params.ociProcess.Env)
@@ -198,7 +203,7 @@ func execute(params execParams) error {
 		Console:     params.console,
 	}
 
-	_, _, process, err := vc.EnterContainer(podID, params.cID, cmd)
+	_, _, process, err := vc.EnterContainer(ctx, podID, params.cID, cmd)
 	if err != nil {
 		return err
 	}
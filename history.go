@@ -0,0 +1,390 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	// historyFileMode is the mode used to create the history file.
+	historyFileMode = os.FileMode(0640)
+
+	// historyDirMode is the mode used to create the directory
+	// holding the history file.
+	historyDirMode = os.FileMode(0750)
+
+	historyOutcomeSuccess = "success"
+	historyOutcomeFailure = "failure"
+
+	// historyRotatedSuffix is appended to the name of the history file
+	// once it is rotated.
+	historyRotatedSuffix = ".1"
+)
+
+// historyFilePath is the per-host store of lifecycle records. It is a
+// variable to allow tests to modify it.
+var historyFilePath = filepath.Join(defaultRuntimeLib, "history.json")
+
+// historyMaxSize is the size beyond which the history file is rotated, the
+// previous history being kept in a single rotated file. It is a variable
+// to allow tests to modify it.
+var historyMaxSize int64 = 4 << 20
+
+// historyContainers holds the containers resolved by the command, mapped
+// to their pod ID, so that they are recorded without looking them up
+// again.
+var historyContainers = struct {
+	sync.Mutex
+	pods map[string]string
+}{
+	pods: make(map[string]string),
+}
+
+// noteHistoryContainer records that the command resolved the container,
+// either looking it up or creating it.
+func noteHistoryContainer(containerID, podID string) {
+	historyContainers.Lock()
+	defer historyContainers.Unlock()
+
+	historyContainers.pods[containerID] = podID
+}
+
+// historyCommands lists the lifecycle commands recorded in the history.
+var historyCommands = map[string]bool{
+	"create": true,
+	"delete": true,
+	"exec":   true,
+	"kill":   true,
+	"pause":  true,
+	"resume": true,
+	"run":    true,
+	"start":  true,
+}
+
+// historyRecord describes a single invocation of a lifecycle command.
+type historyRecord struct {
+	Time        time.Time     `json:"time"`
+	Command     string        `json:"command"`
+	ContainerID string        `json:"containerID,omitempty"`
+	PodID       string        `json:"podID,omitempty"`
+	UID         int           `json:"uid"`
+	PID         int           `json:"pid"`
+	Outcome     string        `json:"outcome"`
+	ExitCode    int           `json:"exitCode,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// historyFilter selects records from the history.
+type historyFilter struct {
+	// containerID matches all the containers whose ID starts with it.
+	containerID string
+
+	// since ignores all the records older than it.
+	since time.Time
+}
+
+// recordHistory wraps the action of the lifecycle commands so that every
+// invocation is appended to the history, whatever its outcome.
+func recordHistory(commands []cli.Command) []cli.Command {
+	for i, command := range commands {
+		if !historyCommands[command.Name] {
+			continue
+		}
+
+		action := command.Action
+		commandName := command.Name
+
+		commands[i].Action = func(context *cli.Context) error {
+			start := time.Now().UTC()
+
+			// "delete" is the only command taking several
+			// containers, each of them getting a record.
+			containerIDs := []string{context.Args().First()}
+			if commandName == "delete" && context.NArg() > 1 {
+				containerIDs = context.Args()
+			}
+
+			var records []historyRecord
+			for _, containerID := range containerIDs {
+				records = append(records, historyRecord{
+					Time:        start,
+					Command:     commandName,
+					ContainerID: containerID,
+					UID:         os.Getuid(),
+					PID:         os.Getpid(),
+				})
+			}
+
+			historyContainers.Lock()
+			historyContainers.pods = make(map[string]string)
+			historyContainers.Unlock()
+
+			err := cli.HandleAction(action, context)
+
+			outcome, exitCode, errMsg := historyOutcome(err)
+
+			resolveHistoryIDs(records)
+
+			for _, record := range records {
+				record.Duration = time.Since(start)
+				record.Outcome = outcome
+				record.ExitCode = exitCode
+				record.Error = errMsg
+
+				if histErr := appendHistory(historyFilePath, record); histErr != nil {
+					ccLog.Warnf("Failed to record %q in history: %v", commandName, histErr)
+				}
+			}
+
+			return err
+		}
+	}
+
+	return commands
+}
+
+// historyOutcome returns the outcome, the exit code and the error message
+// recorded for the error returned by a command.
+func historyOutcome(err error) (string, int, string) {
+	if err == nil {
+		return historyOutcomeSuccess, 0, ""
+	}
+
+	exitCode := 1
+	if exitErr, ok := err.(cli.ExitCoder); ok {
+		exitCode = exitErr.ExitCode()
+	}
+
+	// "run" returns the exit status of the workload as an error
+	// without a message, which only fails the command if it is not
+	// zero.
+	if err.Error() == "" {
+		if exitCode == 0 {
+			return historyOutcomeSuccess, 0, ""
+		}
+
+		return historyOutcomeFailure, exitCode, fmt.Sprintf("workload exited with status %d", exitCode)
+	}
+
+	return historyOutcomeFailure, exitCode, err.Error()
+}
+
+// resolveHistoryIDs expands the container IDs of the records and finds
+// their pod IDs among the containers the command resolved. It is not an
+// error for a container not to have been resolved, the command may have
+// failed before.
+func resolveHistoryIDs(records []historyRecord) {
+	historyContainers.Lock()
+	defer historyContainers.Unlock()
+
+	for i, record := range records {
+		if record.ContainerID == "" {
+			continue
+		}
+
+		if podID, ok := historyContainers.pods[record.ContainerID]; ok {
+			records[i].PodID = podID
+			continue
+		}
+
+		// The container is only resolved by a single match.
+		matches := 0
+		var containerID string
+
+		for id := range historyContainers.pods {
+			if strings.HasPrefix(id, record.ContainerID) {
+				containerID = id
+				matches++
+			}
+		}
+
+		if matches == 1 {
+			records[i].ContainerID = containerID
+			records[i].PodID = historyContainers.pods[containerID]
+		}
+	}
+}
+
+// lockedHistoryFile opens the history file and locks it with the
+// specified flock(2) operation.
+func lockedHistoryFile(path string, flag int, how int) (*os.File, error) {
+	f, err := os.OpenFile(path, flag, historyFileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// appendHistory adds the record to the history file, one JSON
+// document per line. The history file is rotated first if the record would
+// make it exceed historyMaxSize.
+func appendHistory(path string, record historyRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), historyDirMode); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	data = append(data, '\n')
+
+	for {
+		f, err := lockedHistoryFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, syscall.LOCK_EX)
+		if err != nil {
+			return err
+		}
+
+		// The file may have been rotated while waiting for the
+		// lock.
+		current, err := isCurrentHistoryFile(path, f)
+		if err != nil || !current {
+			f.Close()
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		if info.Size() > 0 && info.Size()+int64(len(data)) > historyMaxSize {
+			err := os.Rename(path, path+historyRotatedSuffix)
+			f.Close()
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		_, err = f.Write(data)
+		f.Close()
+
+		return err
+	}
+}
+
+// isCurrentHistoryFile returns true if f is still the history file found
+// at path.
+func isCurrentHistoryFile(path string, f *os.File) (bool, error) {
+	pathInfo, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	return os.SameFile(pathInfo, info), nil
+}
+
+// readHistory returns the records of the history file and of its rotated
+// file matching the filter, oldest first.
+func readHistory(path string, filter historyFilter) ([]historyRecord, error) {
+	records, err := readHistoryFile(path+historyRotatedSuffix, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := readHistoryFile(path, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(records, current...), nil
+}
+
+// readHistoryFile returns the records of a history file matching the
+// filter, oldest first.
+func readHistoryFile(path string, filter historyFilter) ([]historyRecord, error) {
+	f, err := lockedHistoryFile(path, os.O_RDONLY, syscall.LOCK_SH)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []historyRecord{}, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []historyRecord{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record historyRecord
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// Ignore a partial line left by a runtime that
+			// was killed while recording.
+			ccLog.Warnf("Ignoring invalid history record %q: %v", scanner.Text(), err)
+			continue
+		}
+
+		if filter.match(record) {
+			records = append(records, record)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (f historyFilter) match(record historyRecord) bool {
+	if f.containerID != "" && !strings.HasPrefix(record.ContainerID, f.containerID) {
+		return false
+	}
+
+	if !f.since.IsZero() && record.Time.Before(f.since) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestHistoryAppendRead(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "history-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "subdir", "history.json")
+
+	records, err := readHistory(path, historyFilter{})
+	assert.NoError(err)
+	assert.Empty(records)
+
+	now := time.Now().UTC()
+
+	expected := []historyRecord{
+		{
+			Time:        now.Add(-2 * time.Hour),
+			Command:     "create",
+			ContainerID: "foo",
+			PodID:       "foo",
+			Outcome:     historyOutcomeSuccess,
+			Duration:    time.Second,
+		},
+		{
+			Time:        now.Add(-time.Hour),
+			Command:     "start",
+			ContainerID: "bar",
+			PodID:       "bar",
+			Outcome:     historyOutcomeFailure,
+			Error:       "failed",
+		},
+		{
+			Time:        now,
+			Command:     "delete",
+			ContainerID: "foo",
+			PodID:       "foo",
+			Outcome:     historyOutcomeSuccess,
+		},
+	}
+
+	for _, r := range expected {
+		assert.NoError(appendHistory(path, r))
+	}
+
+	records, err = readHistory(path, historyFilter{})
+	assert.NoError(err)
+	assert.Len(records, len(expected))
+
+	for i := range expected {
+		assert.True(expected[i].Time.Equal(records[i].Time))
+		assert.Equal(expected[i].Command, records[i].Command)
+		assert.Equal(expected[i].Error, records[i].Error)
+	}
+
+	records, err = readHistory(path, historyFilter{containerID: "f"})
+	assert.NoError(err)
+	assert.Len(records, 2)
+
+	records, err = readHistory(path, historyFilter{since: now.Add(-90 * time.Minute)})
+	assert.NoError(err)
+	assert.Len(records, 2)
+
+	records, err = readHistory(path, historyFilter{containerID: "foo", since: now.Add(-90 * time.Minute)})
+	assert.NoError(err)
+	assert.Len(records, 1)
+	assert.Equal("delete", records[0].Command)
+
+	// A truncated record must not prevent reading the others.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, historyFileMode)
+	assert.NoError(err)
+	_, err = f.WriteString(`{"time":`)
+	assert.NoError(err)
+	f.Close()
+
+	records, err = readHistory(path, historyFilter{})
+	assert.NoError(err)
+	assert.Len(records, len(expected))
+}
+
+func TestHistoryRotate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "history-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedHistoryMaxSize := historyMaxSize
+	historyMaxSize = 512
+	defer func() {
+		historyMaxSize = savedHistoryMaxSize
+	}()
+
+	path := filepath.Join(dir, "history.json")
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(appendHistory(path, historyRecord{
+			Command:     "start",
+			ContainerID: fmt.Sprintf("container-%d", i),
+		}))
+	}
+
+	for _, file := range []string{path, path + historyRotatedSuffix} {
+		info, err := os.Stat(file)
+		assert.NoError(err)
+		assert.True(info.Size() <= historyMaxSize, "%s is %d bytes", file, info.Size())
+	}
+
+	// The records of the rotated file come first, the oldest ones
+	// being dropped.
+	records, err := readHistory(path, historyFilter{})
+	assert.NoError(err)
+	assert.True(len(records) < 20)
+	assert.Equal("container-19", records[len(records)-1].ContainerID)
+
+	for i := 1; i < len(records); i++ {
+		var previous, current int
+		fmt.Sscanf(records[i-1].ContainerID, "container-%d", &previous)
+		fmt.Sscanf(records[i].ContainerID, "container-%d", &current)
+		assert.Equal(previous+1, current)
+	}
+}
+
+func TestHistoryParseSince(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+
+	since, err := parseSince("", now)
+	assert.NoError(err)
+	assert.True(since.IsZero())
+
+	since, err = parseSince("2h", now)
+	assert.NoError(err)
+	assert.True(since.Equal(now.Add(-2 * time.Hour)))
+
+	since, err = parseSince("2017-06-01T10:00:00Z", now)
+	assert.NoError(err)
+	assert.True(since.Equal(time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)))
+
+	_, err = parseSince("yesterday", now)
+	assert.Error(err)
+}
+
+func TestHistoryWriteTable(t *testing.T) {
+	assert := assert.New(t)
+
+	records := []historyRecord{
+		{
+			Time:        time.Now(),
+			Command:     "kill",
+			ContainerID: "foo",
+			PodID:       "bar",
+			UID:         1234,
+			Outcome:     historyOutcomeFailure,
+			Error:       "Container foo is not running",
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NoError(writeHistoryTable(records, buf))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(lines, 2)
+
+	for _, field := range []string{"TIME", "COMMAND", "CONTAINER", "POD", "UID", "OUTCOME", "DURATION", "ERROR"} {
+		assert.Contains(lines[0], field)
+	}
+
+	for _, field := range []string{"kill", "foo", "bar", "1234", historyOutcomeFailure, "is not running"} {
+		assert.Contains(lines[1], field)
+	}
+}
+
+func TestHistoryRecordCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "history-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedHistoryFilePath := historyFilePath
+	historyFilePath = filepath.Join(dir, "history.json")
+	defer func() {
+		historyFilePath = savedHistoryFilePath
+	}()
+
+	startErr := errors.New("start failed")
+	called := 0
+
+	pods := map[string]string{"foo-container": "foo-pod", "bar": "bar-pod"}
+
+	app := cli.NewApp()
+	app.Commands = recordHistory([]cli.Command{
+		{
+			Name: "start",
+			Action: func(context *cli.Context) error {
+				called++
+				return startErr
+			},
+		},
+		{
+			Name: "state",
+			Action: func(context *cli.Context) error {
+				called++
+				return nil
+			},
+		},
+		{
+			Name: "delete",
+			Action: func(context *cli.Context) error {
+				called++
+
+				// The command resolves the containers.
+				for id, podID := range pods {
+					noteHistoryContainer(id, podID)
+				}
+
+				return nil
+			},
+		},
+	})
+
+	err = app.Run([]string{name, "start", "foo"})
+	assert.Equal(startErr, err)
+
+	err = app.Run([]string{name, "state", "foo"})
+	assert.NoError(err)
+
+	err = app.Run([]string{name, "delete", "foo", "bar"})
+	assert.NoError(err)
+
+	assert.Equal(3, called)
+
+	records, err := readHistory(historyFilePath, historyFilter{})
+	assert.NoError(err)
+
+	// "state" is not a lifecycle command
+	assert.Len(records, 3)
+
+	// Each deleted container gets a record, with the IDs resolved by
+	// the command.
+	assert.Equal("foo-container", records[1].ContainerID)
+	assert.Equal("foo-pod", records[1].PodID)
+	assert.Equal("bar", records[2].ContainerID)
+	assert.Equal("bar-pod", records[2].PodID)
+	assert.Equal(historyOutcomeSuccess, records[2].Outcome)
+
+	r := records[0]
+	assert.Equal("start", r.Command)
+	assert.Equal("foo", r.ContainerID)
+	assert.Empty(r.PodID)
+	assert.Equal(os.Getuid(), r.UID)
+	assert.Equal(os.Getpid(), r.PID)
+	assert.Equal(historyOutcomeFailure, r.Outcome)
+	assert.Equal(startErr.Error(), r.Error)
+}
+
+func TestHistoryOutcome(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, d := range []struct {
+		err      error
+		outcome  string
+		exitCode int
+		message  string
+	}{
+		{nil, historyOutcomeSuccess, 0, ""},
+		{cli.NewExitError("", 0), historyOutcomeSuccess, 0, ""},
+		{cli.NewExitError("", 137), historyOutcomeFailure, 137, "workload exited with status 137"},
+		{errors.New("failed"), historyOutcomeFailure, 1, "failed"},
+	} {
+		outcome, exitCode, message := historyOutcome(d.err)
+		assert.Equal(d.outcome, outcome, "%v", d.err)
+		assert.Equal(d.exitCode, exitCode, "%v", d.err)
+		assert.Equal(d.message, message, "%v", d.err)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+)
+
+const (
+	// indexDirMode is the mode used to create the container index.
+	indexDirMode = os.FileMode(0750)
+
+	// indexFileMode is the mode used to create the index entries.
+	indexFileMode = os.FileMode(0640)
+)
+
+// containerIndexPath is the directory indexing the containers by ID. It
+// holds one file per container, named after the container ID and
+// containing the ID of its pod. Removing it makes the next command rebuild
+// it from all the pods. It is a variable to allow tests to modify it.
+var containerIndexPath = filepath.Join(defaultRuntimeLib, "containers")
+
+// containerIndexLock is the file locked while the index is modified: a
+// rebuild takes an exclusive lock, the updates of a single entry a shared
+// one.
+func containerIndexLock(how int) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(containerIndexPath), indexDirMode); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(containerIndexPath+".lock", os.O_CREATE|os.O_RDWR, indexFileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func containerIndexEntry(containerID string) string {
+	return filepath.Join(containerIndexPath, containerID)
+}
+
+// containerIndexExists returns true if the index has been built.
+func containerIndexExists() bool {
+	return fileExists(containerIndexPath)
+}
+
+// writeIndexEntry atomically creates the entry of the container in dir.
+func writeIndexEntry(dir, containerID, podID string) error {
+	if containerID == "" || strings.ContainsRune(containerID, os.PathSeparator) {
+		return fmt.Errorf("Invalid container ID %q", containerID)
+	}
+
+	f, err := ioutil.TempFile(dir, "."+containerID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(podID); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Chmod(indexFileMode); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(dir, containerID))
+}
+
+// addContainerIndex records the pod of the container in the index.
+func addContainerIndex(containerID, podID string) error {
+	lock, err := containerIndexLock(syscall.LOCK_SH)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := os.MkdirAll(containerIndexPath, indexDirMode); err != nil {
+		return err
+	}
+
+	return writeIndexEntry(containerIndexPath, containerID, podID)
+}
+
+// removeContainerIndex removes the container from the index. It is not an
+// error for the container not to be indexed.
+func removeContainerIndex(containerID string) error {
+	lock, err := containerIndexLock(syscall.LOCK_SH)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	err = os.Remove(containerIndexEntry(containerID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// lookupContainerIndex returns the indexed containers whose ID starts with
+// prefix, mapped to their pod ID. A container whose ID is exactly prefix is
+// returned alone.
+func lookupContainerIndex(prefix string) (map[string]string, error) {
+	matches := make(map[string]string)
+
+	// Such IDs cannot be indexed and would escape the index.
+	if prefix == "" || strings.HasPrefix(prefix, ".") || strings.ContainsRune(prefix, os.PathSeparator) {
+		return matches, nil
+	}
+
+	podID, err := ioutil.ReadFile(containerIndexEntry(prefix))
+	if err == nil {
+		matches[prefix] = string(podID)
+		return matches, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	dir, err := os.Open(containerIndexPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return matches, nil
+		}
+
+		return nil, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		// Ignore the temporary files of writeIndexEntry()
+		if strings.HasPrefix(name, ".") || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		podID, err := ioutil.ReadFile(containerIndexEntry(name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed since the directory was read.
+				continue
+			}
+
+			return nil, err
+		}
+
+		matches[name] = string(podID)
+	}
+
+	return matches, nil
+}
+
+// lookupContainerIndexExact returns the indexed container whose ID is
+// containerID, mapped to its pod ID.
+func lookupContainerIndexExact(containerID string) (map[string]string, error) {
+	matches := make(map[string]string)
+
+	if containerID == "" || strings.HasPrefix(containerID, ".") || strings.ContainsRune(containerID, os.PathSeparator) {
+		return matches, nil
+	}
+
+	podID, err := ioutil.ReadFile(containerIndexEntry(containerID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return matches, nil
+		}
+
+		return nil, err
+	}
+
+	matches[containerID] = string(podID)
+
+	return matches, nil
+}
+
+// rebuildContainerIndex creates the index from the list of all the pods.
+// The whole index is written under the exclusive lock of the index. A new
+// index is built aside and then moved into place so that a concurrent
+// lookup never sees it partially built, while the entries of an existing
+// index, possibly created by a container added meanwhile, are merged into
+// it.
+func rebuildContainerIndex(pods []vc.PodStatus) error {
+	lock, err := containerIndexLock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if containerIndexExists() {
+		return writeIndexEntries(containerIndexPath, pods)
+	}
+
+	parent := filepath.Dir(containerIndexPath)
+
+	tmpDir, err := ioutil.TempDir(parent, "."+filepath.Base(containerIndexPath))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := os.Chmod(tmpDir, indexDirMode); err != nil {
+		return err
+	}
+
+	if err := writeIndexEntries(tmpDir, pods); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpDir, containerIndexPath)
+}
+
+// resetContainerIndex removes the whole index, so that it is built again.
+func resetContainerIndex() error {
+	lock, err := containerIndexLock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	return os.RemoveAll(containerIndexPath)
+}
+
+// writeIndexEntries creates in dir the entries of all the containers of
+// the pods.
+func writeIndexEntries(dir string, pods []vc.PodStatus) error {
+	for _, pod := range pods {
+		for _, container := range pod.ContainersStatus {
+			if err := writeIndexEntry(dir, container.ID, pod.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
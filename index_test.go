@@ -0,0 +1,440 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+// withContainerIndex runs f with an empty index located in a temporary
+// directory.
+func withContainerIndex(t testing.TB, f func()) {
+	dir, err := ioutil.TempDir(testDir, "index-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	savedContainerIndexPath := containerIndexPath
+	containerIndexPath = filepath.Join(dir, "containers")
+	defer func() {
+		containerIndexPath = savedContainerIndexPath
+	}()
+
+	f()
+}
+
+func TestContainerIndex(t *testing.T) {
+	assert := assert.New(t)
+
+	withContainerIndex(t, func() {
+		assert.False(containerIndexExists())
+
+		matches, err := lookupContainerIndex("foo")
+		assert.NoError(err)
+		assert.Empty(matches)
+
+		assert.NoError(addContainerIndex("foo1", "pod1"))
+		assert.NoError(addContainerIndex("foo2", "pod1"))
+		assert.NoError(addContainerIndex("bar", "pod2"))
+		assert.True(containerIndexExists())
+
+		matches, err = lookupContainerIndex("bar")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"bar": "pod2"}, matches)
+
+		matches, err = lookupContainerIndex("ba")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"bar": "pod2"}, matches)
+
+		matches, err = lookupContainerIndex("foo")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"foo1": "pod1", "foo2": "pod1"}, matches)
+
+		// An exact match hides the other prefix matches.
+		matches, err = lookupContainerIndex("foo1")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"foo1": "pod1"}, matches)
+
+		for _, id := range []string{"", ".", "..", "../foo1", "a/b"} {
+			matches, err = lookupContainerIndex(id)
+			assert.NoError(err)
+			assert.Empty(matches, "%q", id)
+		}
+
+		assert.Error(addContainerIndex("", "pod"))
+		assert.Error(addContainerIndex("../foo", "pod"))
+
+		assert.NoError(removeContainerIndex("foo1"))
+		assert.NoError(removeContainerIndex("foo1"))
+
+		matches, err = lookupContainerIndex("foo")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"foo2": "pod1"}, matches)
+	})
+}
+
+func TestRebuildContainerIndex(t *testing.T) {
+	assert := assert.New(t)
+
+	withContainerIndex(t, func() {
+		pods := []vc.PodStatus{
+			{
+				ID: "pod1",
+				ContainersStatus: []vc.ContainerStatus{
+					{ID: "pod1"},
+					{ID: "container1"},
+				},
+			},
+			{
+				ID: "pod2",
+				ContainersStatus: []vc.ContainerStatus{
+					{ID: "pod2"},
+				},
+			},
+		}
+
+		assert.NoError(rebuildContainerIndex(pods))
+		assert.True(containerIndexExists())
+
+		matches, err := lookupContainerIndex("container1")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"container1": "pod1"}, matches)
+
+		matches, err = lookupContainerIndex("pod")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"pod1": "pod1", "pod2": "pod2"}, matches)
+
+		// An index built concurrently is kept.
+		assert.NoError(rebuildContainerIndex(nil))
+
+		matches, err = lookupContainerIndex("pod")
+		assert.NoError(err)
+		assert.Len(matches, 2)
+
+		// No temporary directory is left behind.
+		entries, err := ioutil.ReadDir(filepath.Dir(containerIndexPath))
+		assert.NoError(err)
+		for _, entry := range entries {
+			assert.False(entry.IsDir() && entry.Name() != filepath.Base(containerIndexPath), entry.Name())
+		}
+	})
+}
+
+func TestRebuildContainerIndexMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	withContainerIndex(t, func() {
+		// A container added while the pods were listed creates the
+		// index with a single entry.
+		assert.NoError(addContainerIndex("new", "new"))
+
+		assert.NoError(rebuildContainerIndex([]vc.PodStatus{
+			{
+				ID:               "pod1",
+				ContainersStatus: []vc.ContainerStatus{{ID: "pod1"}},
+			},
+		}))
+
+		for id, pod := range map[string]string{"new": "new", "pod1": "pod1"} {
+			matches, err := lookupContainerIndex(id)
+			assert.NoError(err)
+			assert.Equal(map[string]string{id: pod}, matches)
+		}
+	})
+}
+
+func TestGetContainerInfoStaleIndexEntry(t *testing.T) {
+	assert := assert.New(t)
+
+	withContainerIndex(t, func() {
+		assert.NoError(addContainerIndex("stale-container", "stale-pod"))
+
+		status, podID, err := getContainerInfo(context.Background(), "stale")
+		assert.NoError(err)
+		assert.Empty(status.ID)
+		assert.Empty(podID)
+
+		matches, err := lookupContainerIndex("stale")
+		assert.NoError(err)
+		assert.Empty(matches)
+	})
+}
+
+// withPods runs f with the virtcontainers calls looking the containers up
+// answering from pods. The number of pod scans is counted in listed.
+func withPods(pods []vc.PodStatus, listed *int, f func()) {
+	savedListPod, savedStatusContainer := vcListPod, vcStatusContainer
+	defer func() {
+		vcListPod, vcStatusContainer = savedListPod, savedStatusContainer
+	}()
+
+	vcListPod = func(ctx context.Context) ([]vc.PodStatus, error) {
+		*listed++
+		return pods, nil
+	}
+
+	vcStatusContainer = func(ctx context.Context, podID, containerID string) (vc.ContainerStatus, error) {
+		for _, pod := range pods {
+			if pod.ID != podID {
+				continue
+			}
+
+			for _, container := range pod.ContainersStatus {
+				if container.ID == containerID {
+					return container, nil
+				}
+			}
+		}
+
+		return vc.ContainerStatus{}, newRuntimeError(errCodeNotFound, containerID, podID, fmt.Errorf("not found"))
+	}
+
+	f()
+}
+
+// testPods returns count pods holding one container each, both named
+// container-<n>.
+func testPods(count int) []vc.PodStatus {
+	var pods []vc.PodStatus
+
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("container-%d", i)
+		pods = append(pods, vc.PodStatus{
+			ID:               id,
+			ContainersStatus: []vc.ContainerStatus{{ID: id}},
+		})
+	}
+
+	return pods
+}
+
+func TestGetContainerInfoBuildsMissingIndex(t *testing.T) {
+	assert := assert.New(t)
+	listed := 0
+
+	withContainerIndex(t, func() {
+		withPods(testPods(3), &listed, func() {
+			status, podID, err := getContainerInfo(context.Background(), "container-1")
+			assert.NoError(err)
+			assert.Equal("container-1", status.ID)
+			assert.Equal("container-1", podID)
+			assert.Equal(1, listed)
+			assert.True(containerIndexExists())
+
+			status, _, err = getContainerInfo(context.Background(), "container-2")
+			assert.NoError(err)
+			assert.Equal("container-2", status.ID)
+			assert.Equal(1, listed)
+		})
+	})
+}
+
+func TestGetContainerInfoIndexMissIsAuthoritative(t *testing.T) {
+	assert := assert.New(t)
+	listed := 0
+
+	withContainerIndex(t, func() {
+		// The pod is not indexed, as if it was created by a version
+		// of the runtime without the index.
+		withPods(testPods(1), &listed, func() {
+			assert.NoError(addContainerIndex("foo", "pod1"))
+			assert.NoError(removeContainerIndex("foo"))
+
+			status, podID, err := getContainerInfo(context.Background(), "container-0")
+			assert.NoError(err)
+			assert.Empty(status.ID)
+			assert.Empty(podID)
+			assert.Equal(0, listed)
+		})
+	})
+}
+
+func TestGetContainerInfoRebuildsUnreadableIndex(t *testing.T) {
+	assert := assert.New(t)
+	listed := 0
+
+	withContainerIndex(t, func() {
+		assert.NoError(ioutil.WriteFile(containerIndexPath, []byte("corrupted"), indexFileMode))
+
+		withPods(testPods(1), &listed, func() {
+			status, _, err := getContainerInfo(context.Background(), "container-0")
+			assert.NoError(err)
+			assert.Equal("container-0", status.ID)
+			assert.Equal(1, listed)
+		})
+	})
+}
+
+func TestGetExactContainerInfo(t *testing.T) {
+	assert := assert.New(t)
+	listed := 0
+
+	withContainerIndex(t, func() {
+		withPods(testPods(1), &listed, func() {
+			status, _, err := getExactContainerInfo(context.Background(), "container-0")
+			assert.NoError(err)
+			assert.Equal("container-0", status.ID)
+
+			// A prefix is not expanded.
+			status, _, err = getExactContainerInfo(context.Background(), "container")
+			assert.NoError(err)
+			assert.Empty(status.ID)
+		})
+	})
+}
+
+// BenchmarkGetContainerInfo shows that looking a container up from a
+// command does not scan the pods, whether the container exists or not.
+func BenchmarkGetContainerInfo(b *testing.B) {
+	type lookup func(context.Context, string) (vc.ContainerStatus, string, error)
+
+	cases := []struct {
+		name   string
+		id     func(count int) string
+		lookup lookup
+	}{
+		{"hit", func(count int) string { return fmt.Sprintf("container-%d", count/2) }, getContainerInfo},
+		{"miss", func(count int) string { return "missing" }, getContainerInfo},
+		// create looks a new container up.
+		{"create", func(count int) string { return "missing" }, getExactContainerInfo},
+	}
+
+	for _, count := range []int{10, 100, 1000} {
+		for _, c := range cases {
+			b.Run(fmt.Sprintf("pods-%d-%s", count, c.name), func(b *testing.B) {
+				listed := 0
+
+				withContainerIndex(b, func() {
+					withPods(testPods(count), &listed, func() {
+						containerID := c.id(count)
+
+						// Build the index.
+						if _, _, err := c.lookup(context.Background(), containerID); err != nil {
+							b.Fatal(err)
+						}
+
+						b.ResetTimer()
+
+						for i := 0; i < b.N; i++ {
+							if _, _, err := c.lookup(context.Background(), containerID); err != nil {
+								b.Fatal(err)
+							}
+						}
+
+						b.StopTimer()
+
+						if listed != 1 {
+							b.Fatalf("The pods were scanned %d times", listed)
+						}
+					})
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkLookupContainerIndex shows that looking a container up does not
+// depend on the number of containers.
+func BenchmarkLookupContainerIndex(b *testing.B) {
+	for _, count := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("containers-%d", count), func(b *testing.B) {
+			withContainerIndex(b, func() {
+				for i := 0; i < count; i++ {
+					id := fmt.Sprintf("container-%d", i)
+					if err := addContainerIndex(id, id); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				id := fmt.Sprintf("container-%d", count/2)
+
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					if _, err := lookupContainerIndex(id); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkLookupContainerIndexMiss measures the lookup of a prefix or of
+// a missing container, which reads the whole index.
+func BenchmarkLookupContainerIndexMiss(b *testing.B) {
+	for _, count := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("containers-%d", count), func(b *testing.B) {
+			withContainerIndex(b, func() {
+				for i := 0; i < count; i++ {
+					id := fmt.Sprintf("container-%d", i)
+					if err := addContainerIndex(id, id); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					if _, err := lookupContainerIndex("missing"); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkRebuildContainerIndex measures the creation of the index from
+// the list of the pods.
+func BenchmarkRebuildContainerIndex(b *testing.B) {
+	for _, count := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("containers-%d", count), func(b *testing.B) {
+			withContainerIndex(b, func() {
+				var pods []vc.PodStatus
+				for i := 0; i < count; i++ {
+					id := fmt.Sprintf("container-%d", i)
+					pods = append(pods, vc.PodStatus{
+						ID:               id,
+						ContainersStatus: []vc.ContainerStatus{{ID: id}},
+					})
+				}
+
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					if err := os.RemoveAll(containerIndexPath); err != nil {
+						b.Fatal(err)
+					}
+					b.StartTimer()
+
+					if err := rebuildContainerIndex(pods); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
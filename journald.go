@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// journaldSocketPath is the socket of the journald native protocol. It
+// is a variable to allow tests to modify it.
+var journaldSocketPath = "/run/systemd/journal/socket"
+
+// syslogPriorities maps the log levels to the syslog severities, which
+// journald uses too.
+var syslogPriorities = map[logrus.Level]int{
+	logrus.PanicLevel: 2, // LOG_CRIT
+	logrus.FatalLevel: 2, // LOG_CRIT
+	logrus.ErrorLevel: 3, // LOG_ERR
+	logrus.WarnLevel:  4, // LOG_WARNING
+	logrus.InfoLevel:  6, // LOG_INFO
+	logrus.DebugLevel: 7, // LOG_DEBUG
+}
+
+// journaldHook sends the log entries to journald as native structured
+// fields.
+type journaldHook struct {
+	conn *net.UnixConn
+}
+
+func newJournaldHook(socketPath string) (*journaldHook, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &journaldHook{conn: conn}, nil
+}
+
+// journaldFieldName converts the name of a log field to a journald field
+// name, made of uppercase letters, digits and underscores. For example,
+// "containerID" becomes "CONTAINER_ID".
+func journaldFieldName(key string) string {
+	var b bytes.Buffer
+
+	var prev rune
+	for _, r := range key {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			r = '_'
+		} else if unicode.IsUpper(r) && unicode.IsLower(prev) {
+			b.WriteByte('_')
+		}
+
+		b.WriteRune(unicode.ToUpper(r))
+		prev = r
+	}
+
+	// Fields starting with an underscore are reserved to journald.
+	return strings.TrimLeft(b.String(), "_")
+}
+
+// writeJournaldField appends a field to a journald datagram. Values
+// spanning several lines use the binary form of the protocol.
+func writeJournaldField(b *bytes.Buffer, key, value string) {
+	if !strings.ContainsRune(value, '\n') {
+		fmt.Fprintf(b, "%s=%s\n", key, value)
+		return
+	}
+
+	b.WriteString(key)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journaldMessage returns the datagram describing the entry.
+func journaldMessage(entry *logrus.Entry) []byte {
+	var b bytes.Buffer
+
+	writeJournaldField(&b, "MESSAGE", entry.Message)
+	writeJournaldField(&b, "PRIORITY", strconv.Itoa(syslogPriorities[entry.Level]))
+	writeJournaldField(&b, "SYSLOG_IDENTIFIER", name)
+	writeJournaldField(&b, "SYSLOG_PID", strconv.Itoa(os.Getpid()))
+
+	var keys []string
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := journaldFieldName(key)
+		if field == "" {
+			continue
+		}
+
+		writeJournaldField(&b, field, fmt.Sprint(entry.Data[key]))
+	}
+
+	return b.Bytes()
+}
+
+// Levels informs the logrus Logger which log levels this hook supports.
+func (hook *journaldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire is called by the logrus logger when data is available for the
+// hook.
+func (hook *journaldHook) Fire(entry *logrus.Entry) error {
+	_, err := hook.conn.Write(journaldMessage(entry))
+	return err
+}
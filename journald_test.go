@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// listenUnixgram returns a datagram socket standing for journald or the
+// syslog daemon.
+func listenUnixgram(t *testing.T, socketPath string) *net.UnixConn {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+// readDatagram returns the next datagram received by conn.
+func readDatagram(t *testing.T, conn *net.UnixConn) []byte {
+	buf := make([]byte, 65536)
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf[:n]
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	for key, expected := range map[string]string{
+		"containerID":  "CONTAINER_ID",
+		"podID":        "POD_ID",
+		"command":      "COMMAND",
+		"hook.path":    "HOOK_PATH",
+		"_private":     "PRIVATE",
+		"exit-code-42": "EXIT_CODE_42",
+		"":             "",
+	} {
+		if field := journaldFieldName(key); field != expected {
+			t.Fatalf("expected journald field %q for %q, got %q", expected, key, field)
+		}
+	}
+}
+
+func TestJournaldHook(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	defer resetLogFields()
+
+	socketPath := path.Join(tmpdir, "journal.sock")
+	journal := listenUnixgram(t, socketPath)
+	defer journal.Close()
+
+	hook, err := newJournaldHook(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Hooks.Add(ccLogFields)
+	logger.Hooks.Add(hook)
+
+	setLogField(logFieldContainerID, "foo")
+	setLogField(logFieldPodID, "bar")
+
+	logger.Error("journald entry")
+
+	expected := "MESSAGE=journald entry\n" +
+		"PRIORITY=3\n" +
+		"SYSLOG_IDENTIFIER=" + name + "\n" +
+		"SYSLOG_PID=" + strconv.Itoa(os.Getpid()) + "\n" +
+		"CONTAINER_ID=foo\n" +
+		"POD_ID=bar\n"
+
+	if datagram := string(readDatagram(t, journal)); datagram != expected {
+		t.Fatalf("expected journald datagram %q, got %q", expected, datagram)
+	}
+}
+
+func TestJournaldMultilineField(t *testing.T) {
+	var b bytes.Buffer
+
+	writeJournaldField(&b, "MESSAGE", "first\nsecond")
+
+	var expected bytes.Buffer
+	expected.WriteString("MESSAGE\n")
+	binary.Write(&expected, binary.LittleEndian, uint64(len("first\nsecond")))
+	expected.WriteString("first\nsecond\n")
+
+	if !bytes.Equal(b.Bytes(), expected.Bytes()) {
+		t.Fatalf("expected journald field %q, got %q", expected.Bytes(), b.Bytes())
+	}
+}
@@ -16,11 +16,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"syscall"
 
-	vc "github.com/containers/virtcontainers"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
 	"github.com/urfave/cli"
 )
 
@@ -46,7 +47,7 @@ EXAMPLE:
 	Action: func(context *cli.Context) error {
 		args := context.Args()
 		if args.Present() == false {
-			return fmt.Errorf("Missing container ID")
+			return newRuntimeError(errCodeUsage, "", "", fmt.Errorf("Missing container ID"))
 		}
 
 		// If signal is provided, it has to be the second argument.
@@ -55,7 +56,9 @@ EXAMPLE:
 			signal = "SIGTERM"
 		}
 
-		return kill(args.First(), signal, context.Bool("all"))
+		ctx, done := operationContext(context, "kill")
+
+		return done(kill(ctx, args.First(), signal, context.Bool("all")))
 	},
 }
 
@@ -97,9 +100,9 @@ var signals = map[string]syscall.Signal{
 	"SIGXFSZ":   syscall.SIGXFSZ,
 }
 
-func kill(containerID, signal string, all bool) error {
+func kill(ctx context.Context, containerID, signal string, all bool) error {
 	// Checks the MUST and MUST NOT from OCI runtime specification
-	status, podID, err := getExistingContainerInfo(containerID)
+	status, podID, err := getExistingContainerInfo(ctx, containerID)
 	if err != nil {
 		return err
 	}
@@ -108,20 +111,22 @@ func kill(containerID, signal string, all bool) error {
 
 	// container MUST be running
 	if status.State.State != vc.StateRunning {
-		return fmt.Errorf("Container %s is not running", containerID)
+		return newRuntimeError(errCodeInvalidState, containerID, podID,
+			fmt.Errorf("Container %s is not running", containerID))
 	}
 
 	// Check status of process
-	running, err := processRunning(status.PID)
+	running, err := containerProcessRunning(status)
 	if err != nil {
 		return err
 	}
 	if running == false {
-		if err := stopContainer(podID, status); err != nil {
+		if err := stopContainer(ctx, podID, status); err != nil {
 			return err
 		}
 
-		return fmt.Errorf("Process not running inside container %s", containerID)
+		return newRuntimeError(errCodeInvalidState, containerID, podID,
+			fmt.Errorf("Process not running inside container %s", containerID))
 	}
 
 	signum, err := processSignal(signal)
@@ -129,10 +134,16 @@ func kill(containerID, signal string, all bool) error {
 		return err
 	}
 
-	if err := vc.KillContainer(podID, containerID, signum, all); err != nil {
+	if err := vc.KillContainer(ctx, podID, containerID, signum, all); err != nil {
 		return err
 	}
 
+	// Without shim, no process exits when the workload is killed: the
+	// container has to be stopped explicitly.
+	if status.PID == 0 && signum == syscall.SIGKILL {
+		return stopContainer(ctx, podID, status)
+	}
+
 	return nil
 }
 
@@ -151,7 +162,8 @@ func processSignal(signal string) (syscall.Signal, error) {
 	// Support for numeric signals
 	s, err := strconv.Atoi(signal)
 	if err != nil {
-		return 0, fmt.Errorf("Failed to convert signal %s to int", signal)
+		return 0, newRuntimeError(errCodeUsage, "", "",
+			fmt.Errorf("Failed to convert signal %s to int", signal))
 	}
 
 	signum = syscall.Signal(s)
@@ -163,5 +175,5 @@ func processSignal(signal string) (syscall.Signal, error) {
 		}
 	}
 
-	return 0, fmt.Errorf("Signal %s is not supported", signal)
+	return 0, newRuntimeError(errCodeUsage, "", "", fmt.Errorf("Signal %s is not supported", signal))
 }
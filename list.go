@@ -16,9 +16,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"text/tabwriter"
@@ -26,8 +27,8 @@ import (
 
 	"github.com/urfave/cli"
 
-	vc "github.com/containers/virtcontainers"
-	oci "github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	oci "github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 )
 
 const formatOptions = `table or json`
@@ -53,6 +54,8 @@ type containerState struct {
 	Annotations map[string]string `json:"annotations,omitempty"`
 	// The owner of the state directory (the owner of the container).
 	Owner string `json:"owner"`
+	// Profile is the name of the configuration profile of the pod.
+	Profile string `json:"profile"`
 }
 
 // hypervisorDetails stores details of the hypervisor used to host
@@ -60,14 +63,31 @@ type containerState struct {
 type hypervisorDetails struct {
 	HypervisorPath string `json:"hypervisorPath"`
 	ImagePath      string `json:"imagePath"`
+	InitrdPath     string `json:"initrdPath"`
 	KernelPath     string `json:"kernelPath"`
 }
 
+// vmDetails stores the resources of the VM hosting the container.
+type vmDetails struct {
+	VCPUs uint `json:"vcpus"`
+	// Memory is in MiB.
+	Memory uint `json:"memory"`
+	// Balloon is the memory in MiB currently reclaimed from the guest.
+	Balloon uint `json:"balloon"`
+	// OverheadCPU is the CPU time in nanoseconds used on the host by
+	// the VM, accounted by the sandbox cgroups of the pod.
+	OverheadCPU uint64 `json:"overheadCPU"`
+	// OverheadMemory is the memory in MiB used on the host by the VM,
+	// accounted by the sandbox cgroups of the pod.
+	OverheadMemory uint `json:"overheadMemory"`
+}
+
 // fullContainerState specifies the core state plus the hypervisor
-// details
+// and VM details
 type fullContainerState struct {
 	containerState
 	hypervisorDetails `json:"hypervisor"`
+	vmDetails         `json:"vm"`
 }
 
 type formatState interface {
@@ -114,6 +134,10 @@ To list containers created using a non-default value for "--root":
 			return err
 		}
 
+		if err := reportQuarantinedPods(os.Stderr); err != nil {
+			return err
+		}
+
 		file := os.Stdout
 		showAll := context.Bool("all")
 
@@ -156,7 +180,7 @@ func (f *formatTabular) Write(state []fullContainerState, showAll bool, file *os
 	fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER")
 
 	if showAll {
-		fmt.Fprint(w, "\tHYPERVISOR\tKERNEL\tIMAGE\n")
+		fmt.Fprint(w, "\tPROFILE\tHYPERVISOR\tKERNEL\tIMAGE\tINITRD\tVCPUS\tMEMORY\tBALLOON\tOVERHEAD-CPU\tOVERHEAD-MEMORY\n")
 	} else {
 		fmt.Fprintf(w, "\n")
 	}
@@ -171,10 +195,17 @@ func (f *formatTabular) Write(state []fullContainerState, showAll bool, file *os
 			item.Owner)
 
 		if showAll {
-			fmt.Fprintf(w, "\t%s\t%s\t%s\n",
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t%s\t%d\t%dMiB\t%dMiB\t%s\t%dMiB\n",
+				item.Profile,
 				item.HypervisorPath,
 				item.KernelPath,
-				item.ImagePath)
+				item.ImagePath,
+				item.InitrdPath,
+				item.VCPUs,
+				item.Memory,
+				item.Balloon,
+				time.Duration(item.OverheadCPU),
+				item.OverheadMemory)
 		} else {
 			fmt.Fprintf(w, "\n")
 		}
@@ -189,18 +220,37 @@ func (f *formatJSON) Write(state []fullContainerState, showAll bool, file *os.Fi
 	return json.NewEncoder(file).Encode(state)
 }
 
-func getContainers(context *cli.Context) ([]fullContainerState, error) {
-	runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
-	if !ok {
-		return nil, errors.New("invalid runtime config")
+// reportQuarantinedPods warns about the pods which were quarantined because
+// their stored state is corrupted.
+func reportQuarantinedPods(file io.Writer) error {
+	pods, err := vc.ListQuarantinedPods()
+	if err != nil {
+		return err
 	}
 
-	hypervisorDetails, err := getHypervisorDetails(runtimeConfig)
-	if err != nil {
+	for _, pod := range pods {
+		fmt.Fprintf(file, "Warning: pod %s was quarantined to %s on %s: %s\n",
+			pod.ID, pod.ConfigPath, pod.Time.Format(time.RFC3339), pod.Reason)
+	}
+
+	return nil
+}
+
+func getContainers(context *cli.Context) ([]fullContainerState, error) {
+	ctx, done := operationContext(context, "list")
+
+	// The balloons of the running pods are queried within the
+	// operation too.
+	s, err := listContainers(ctx)
+	if err = done(err); err != nil {
 		return nil, err
 	}
 
-	podList, err := vc.ListPod()
+	return s, nil
+}
+
+func listContainers(ctx context.Context) ([]fullContainerState, error) {
+	podList, err := vc.ListPod(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -213,6 +263,25 @@ func getContainers(context *cli.Context) ([]fullContainerState, error) {
 			continue
 		}
 
+		// Each pod records the hypervisor of its profile.
+		hypervisorDetails, err := getHypervisorDetails(oci.RuntimeConfig{
+			HypervisorType:   pod.Hypervisor,
+			HypervisorConfig: pod.HypervisorConfig,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// The pods created before the profiles were introduced
+		// used the top-level sections of the configuration.
+		profile := pod.Annotations[profileAnnotation]
+		if profile == "" {
+			profile = defaultProfile
+		}
+
+		balloon := getPodBalloon(ctx, pod)
+		overheadCPU, overheadMemory := getPodOverhead(pod)
+
 		for _, container := range pod.ContainersStatus {
 			ociState, err := oci.StatusToOCIState(container)
 			if err != nil {
@@ -229,10 +298,18 @@ func getContainers(context *cli.Context) ([]fullContainerState, error) {
 					Rootfs:         container.RootFs,
 					Created:        container.StartTime,
 					Annotations:    ociState.Annotations,
+					Profile:        profile,
 
 					// FIXME: Owner,
 				},
 				hypervisorDetails: hypervisorDetails,
+				vmDetails: vmDetails{
+					VCPUs:          pod.Resources.VCPUs,
+					Memory:         pod.Resources.Memory,
+					Balloon:        balloon,
+					OverheadCPU:    overheadCPU,
+					OverheadMemory: overheadMemory,
+				},
 			})
 		}
 	}
@@ -240,11 +317,57 @@ func getContainers(context *cli.Context) ([]fullContainerState, error) {
 	return s, nil
 }
 
+// getPodBalloon returns the memory in MiB currently reclaimed from the
+// guest of the pod. Only the VM of a running pod has a balloon, and failing
+// to query it does not prevent the pod from being listed.
+func getPodBalloon(ctx context.Context, pod vc.PodStatus) uint {
+	if pod.State.State != vc.StateRunning {
+		return 0
+	}
+
+	status, err := vc.StatusPodBalloon(ctx, pod.ID)
+	if err != nil {
+		ccLog.Warnf("Failed to query the balloon of pod %s: %v", pod.ID, err)
+		return 0
+	}
+
+	return status.Size()
+}
+
+// getPodOverhead returns the CPU time in nanoseconds and the memory in MiB
+// used on the host by the VM of the pod, as accounted by its sandbox
+// cgroups. Only the pods created with a sandbox cgroup parent have any,
+// and failing to read them does not prevent the pod from being listed.
+func getPodOverhead(pod vc.PodStatus) (uint64, uint) {
+	parent := pod.Annotations[sandboxCgroupAnnotation]
+	if parent == "" {
+		return 0, 0
+	}
+
+	cpu, memory, err := sandboxCgroupUsage(parent, pod.ID)
+	if err != nil {
+		ccLog.Warnf("Failed to read the sandbox cgroups of pod %s: %v", pod.ID, err)
+		return 0, 0
+	}
+
+	return cpu, uint(memory >> 20)
+}
+
 // getHypervisorDetails returns details of the hypervisor used to host
 // the container.
 //
 // It ensures all paths are fully expanded.
 func getHypervisorDetails(runtimeConfig oci.RuntimeConfig) (hypervisorDetails, error) {
+	// The files of the mock hypervisor do not have to exist.
+	if runtimeConfig.HypervisorType == vc.MockHypervisor {
+		return hypervisorDetails{
+			HypervisorPath: runtimeConfig.HypervisorConfig.HypervisorPath,
+			KernelPath:     runtimeConfig.HypervisorConfig.KernelPath,
+			ImagePath:      runtimeConfig.HypervisorConfig.ImagePath,
+			InitrdPath:     runtimeConfig.HypervisorConfig.InitrdPath,
+		}, nil
+	}
+
 	hypervisorPath, err := filepath.EvalSymlinks(runtimeConfig.HypervisorConfig.HypervisorPath)
 	if err != nil {
 		return hypervisorDetails{}, err
@@ -255,7 +378,13 @@ func getHypervisorDetails(runtimeConfig oci.RuntimeConfig) (hypervisorDetails, e
 		return hypervisorDetails{}, err
 	}
 
-	imagePath, err := filepath.EvalSymlinks(runtimeConfig.HypervisorConfig.ImagePath)
+	// A guest booting from an initrd has no image, and conversely.
+	imagePath, err := resolveOptionalPath(runtimeConfig.HypervisorConfig.ImagePath)
+	if err != nil {
+		return hypervisorDetails{}, err
+	}
+
+	initrdPath, err := resolveOptionalPath(runtimeConfig.HypervisorConfig.InitrdPath)
 	if err != nil {
 		return hypervisorDetails{}, err
 	}
@@ -264,5 +393,16 @@ func getHypervisorDetails(runtimeConfig oci.RuntimeConfig) (hypervisorDetails, e
 		HypervisorPath: hypervisorPath,
 		KernelPath:     kernelPath,
 		ImagePath:      imagePath,
+		InitrdPath:     initrdPath,
 	}, nil
 }
+
+// resolveOptionalPath returns the fully expanded path, which is empty if
+// path is.
+func resolveOptionalPath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	return filepath.EvalSymlinks(path)
+}
@@ -26,8 +26,8 @@ import (
 	"testing"
 	"time"
 
-	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -51,12 +51,17 @@ var testStatuses = []fullContainerState{
 			Created:        time.Now().UTC(),
 			Annotations:    map[string]string(nil),
 			Owner:          "",
+			Profile:        "default",
 		},
 		hypervisorDetails: hypervisorDetails{
 			HypervisorPath: "/hypervisor/path",
 			ImagePath:      "/image/path",
 			KernelPath:     "/kernel/path",
 		},
+		vmDetails: vmDetails{
+			VCPUs:  2,
+			Memory: 2048,
+		},
 	},
 	{
 		containerState: containerState{
@@ -68,12 +73,20 @@ var testStatuses = []fullContainerState{
 			Created:        time.Now().UTC(),
 			Annotations:    map[string]string(nil),
 			Owner:          "",
+			Profile:        "batch",
 		},
 		hypervisorDetails: hypervisorDetails{
 			HypervisorPath: "/hypervisor/path2",
 			ImagePath:      "/image/path2",
 			KernelPath:     "/kernel/path2",
 		},
+		vmDetails: vmDetails{
+			VCPUs:          1,
+			Memory:         384,
+			Balloon:        128,
+			OverheadCPU:    1500000000,
+			OverheadMemory: 300,
+		},
 	},
 	{
 		containerState: containerState{
@@ -85,12 +98,17 @@ var testStatuses = []fullContainerState{
 			Created:        time.Now().UTC(),
 			Annotations:    map[string]string(nil),
 			Owner:          "",
+			Profile:        "default",
 		},
 		hypervisorDetails: hypervisorDetails{
 			HypervisorPath: "/hypervisor/path3",
-			ImagePath:      "/image/path3",
+			InitrdPath:     "/initrd/path3",
 			KernelPath:     "/kernel/path3",
 		},
+		vmDetails: vmDetails{
+			VCPUs:  4,
+			Memory: 8192,
+		},
 	},
 }
 
@@ -173,6 +191,20 @@ func TestGetHypervisorDetails(t *testing.T) {
 
 	assert.Equal(t, result, expected, "hypervisor configs")
 
+	// A guest booting from an initrd has no image.
+	runtimeConfig.HypervisorConfig.ImagePath = ""
+	runtimeConfig.HypervisorConfig.InitrdPath = imageLink
+
+	expected.ImagePath = ""
+	expected.InitrdPath = image
+
+	result, err = getHypervisorDetails(runtimeConfig)
+	if err != nil {
+		t.Error(err)
+	}
+
+	assert.Equal(t, result, expected, "hypervisor configs with initrd")
+
 	os.RemoveAll(tmpDir)
 }
 
@@ -244,7 +276,7 @@ func TestStateToTabular(t *testing.T) {
 	expectedLength := len(testStatuses) + 1
 
 	expectedDefaultHeaderPattern := `\AID\s+PID\s+STATUS\s+BUNDLE\s+CREATED\s+OWNER`
-	expectedExtendedHeaderPattern := `HYPERVISOR\s+KERNEL\s+IMAGE`
+	expectedExtendedHeaderPattern := `PROFILE\s+HYPERVISOR\s+KERNEL\s+IMAGE\s+INITRD\s+VCPUS\s+MEMORY\s+BALLOON\s+OVERHEAD-CPU\s+OVERHEAD-MEMORY`
 	endingPattern := `\s*\z`
 
 	lines, err := formatListDataAsString(&formatTabular{}, testStatuses, false)
@@ -326,16 +358,23 @@ func TestStateToTabular(t *testing.T) {
 		lineIndex := i + 1
 		line := lines[lineIndex]
 
-		expectedLinePattern := fmt.Sprintf(`\A%s\s+%d\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s*\z`,
+		expectedLinePattern := fmt.Sprintf(`\A%s\s+%d\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%d\s+%dMiB\s+%dMiB\s+%s\s+%dMiB\s*\z`,
 			regexp.QuoteMeta(status.ID),
 			status.InitProcessPid,
 			regexp.QuoteMeta(status.Status),
 			regexp.QuoteMeta(status.Bundle),
 			regexp.QuoteMeta(status.Created.Format(time.RFC3339Nano)),
 			regexp.QuoteMeta(status.Owner),
+			regexp.QuoteMeta(status.Profile),
 			regexp.QuoteMeta(status.hypervisorDetails.HypervisorPath),
 			regexp.QuoteMeta(status.hypervisorDetails.KernelPath),
-			regexp.QuoteMeta(status.hypervisorDetails.ImagePath))
+			regexp.QuoteMeta(status.hypervisorDetails.ImagePath),
+			regexp.QuoteMeta(status.hypervisorDetails.InitrdPath),
+			status.VCPUs,
+			status.Memory,
+			status.Balloon,
+			regexp.QuoteMeta(time.Duration(status.OverheadCPU).String()),
+			status.OverheadMemory)
 
 		expectedLineRE := regexp.MustCompile(expectedLinePattern)
 
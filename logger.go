@@ -20,6 +20,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 )
@@ -40,14 +43,207 @@ const (
 	globalLogDirMode = os.FileMode(0750)
 
 	// globalLogFlags are the flags used to open the global log
-	// file.
-	globalLogFlags = (os.O_CREATE | os.O_WRONLY | os.O_APPEND | os.O_SYNC)
+	// file. Each entry is appended with a single write, so the
+	// entries of concurrent runtimes do not interleave.
+	globalLogFlags = (os.O_CREATE | os.O_WRONLY | os.O_APPEND)
+
+	// Default rotation of the global log.
+	defaultGlobalLogMaxSize  = 10 // MiB
+	defaultGlobalLogMaxAge   = 7 * 24 * time.Hour
+	defaultGlobalLogMaxFiles = 5
+)
+
+// Names of the log sinks, which are the destinations of the log entries
+// on top of stderr or the --log file.
+const (
+	logSinkFile     = "file"
+	logSinkJournald = "journald"
+	logSinkSyslog   = "syslog"
+)
+
+// Fields attached to the log entries.
+const (
+	logFieldCommand     = "command"
+	logFieldContainerID = "containerID"
+	logFieldPodID       = "podID"
 )
 
 var (
 	errNeedGlobalLogPath = errors.New("Global log path cannot be empty")
 )
 
+// logFieldsHook attaches the fields describing the operation in progress
+// to every entry of the runtime and virtcontainers logs.
+type logFieldsHook struct {
+	sync.Mutex
+	fields logrus.Fields
+}
+
+// ccLogFields holds the fields attached to the entries of ccLog.
+var ccLogFields = &logFieldsHook{fields: logrus.Fields{}}
+
+func init() {
+	ccLog.Hooks.Add(ccLogFields)
+}
+
+// setLogField attaches the field to all the entries logged from now on.
+// Empty values are ignored.
+func setLogField(key, value string) {
+	if value == "" {
+		return
+	}
+
+	ccLogFields.Lock()
+	defer ccLogFields.Unlock()
+
+	ccLogFields.fields[key] = value
+}
+
+// Levels informs the logrus Logger which log levels this hook supports.
+func (hook *logFieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire adds the fields to the entry, unless the entry already sets them.
+func (hook *logFieldsHook) Fire(entry *logrus.Entry) error {
+	hook.Lock()
+	defer hook.Unlock()
+
+	if len(hook.fields) == 0 {
+		return nil
+	}
+
+	// The data of the entry may be shared with other entries: only
+	// modify a copy.
+	data := make(logrus.Fields, len(entry.Data)+len(hook.fields))
+	for k, v := range hook.fields {
+		data[k] = v
+	}
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+
+	entry.Data = data
+
+	return nil
+}
+
+// globalLogRotation bounds the disk space used by the global log. The
+// log is rotated, when the runtime starts, if it grew larger than maxSize
+// or was started more than maxAge ago. Only the maxFiles most recent
+// rotated logs are retained.
+type globalLogRotation struct {
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+}
+
+func newGlobalLogRotation(r runtime) (globalLogRotation, error) {
+	rotation := globalLogRotation{
+		maxSize:  defaultGlobalLogMaxSize << 20,
+		maxAge:   defaultGlobalLogMaxAge,
+		maxFiles: defaultGlobalLogMaxFiles,
+	}
+
+	if r.GlobalLogMaxSize < 0 {
+		return globalLogRotation{}, fmt.Errorf("Invalid global_log_max_size %d: must be positive", r.GlobalLogMaxSize)
+	} else if r.GlobalLogMaxSize > 0 {
+		rotation.maxSize = int64(r.GlobalLogMaxSize) << 20
+	}
+
+	if r.GlobalLogMaxAge != "" {
+		maxAge, err := time.ParseDuration(r.GlobalLogMaxAge)
+		if err != nil {
+			return globalLogRotation{}, fmt.Errorf("Invalid global_log_max_age %q: %v", r.GlobalLogMaxAge, err)
+		}
+
+		if maxAge <= 0 {
+			return globalLogRotation{}, fmt.Errorf("Invalid global_log_max_age %q: must be positive", r.GlobalLogMaxAge)
+		}
+
+		rotation.maxAge = maxAge
+	}
+
+	if r.GlobalLogMaxFiles < 0 {
+		return globalLogRotation{}, fmt.Errorf("Invalid global_log_max_files %d: must be positive", r.GlobalLogMaxFiles)
+	} else if r.GlobalLogMaxFiles > 0 {
+		rotation.maxFiles = r.GlobalLogMaxFiles
+	}
+
+	return rotation, nil
+}
+
+// logSinks selects the destinations of the log entries. The file sink is
+// the global log, which is only written when its path is set.
+type logSinks struct {
+	file         bool
+	journald     bool
+	syslog       bool
+	syslogSocket string
+}
+
+func newLogSinks(r runtime) (logSinks, error) {
+	sinks := logSinks{
+		syslogSocket: defaultSyslogSocket,
+	}
+
+	if r.SyslogSocket != "" {
+		sinks.syslogSocket = r.SyslogSocket
+	}
+
+	names := r.LogSinks
+	if names == nil {
+		names = []string{logSinkFile}
+	}
+
+	for _, name := range names {
+		switch name {
+		case logSinkFile:
+			sinks.file = true
+		case logSinkJournald:
+			sinks.journald = true
+		case logSinkSyslog:
+			sinks.syslog = true
+		default:
+			return logSinks{}, fmt.Errorf("Invalid log_sinks entry %q: must be one of %q, %q or %q",
+				name, logSinkFile, logSinkJournald, logSinkSyslog)
+		}
+	}
+
+	return sinks, nil
+}
+
+// handleLogSinks adds a hook to the runtime logger for each sink. Failing
+// to reach journald or the syslog daemon is not fatal, as the runtime
+// must keep working on hosts without them.
+func handleLogSinks(logfilePath string, sinks logSinks, rotation globalLogRotation) error {
+	if sinks.file {
+		if err := handleGlobalLog(logfilePath, rotation); err != nil {
+			return err
+		}
+	}
+
+	if sinks.journald {
+		hook, err := newJournaldHook(journaldSocketPath)
+		if err != nil {
+			ccLog.Warnf("Cannot log to journald: %v", err)
+		} else {
+			ccLog.Hooks.Add(hook)
+		}
+	}
+
+	if sinks.syslog {
+		hook, err := newSyslogHook(sinks.syslogSocket)
+		if err != nil {
+			ccLog.Warnf("Cannot log to syslog: %v", err)
+		} else {
+			ccLog.Hooks.Add(hook)
+		}
+	}
+
+	return nil
+}
+
 // GlobalLogHook represents a "global logfile" that is appended to by all
 // runtimes.
 //
@@ -60,20 +256,17 @@ var (
 type GlobalLogHook struct {
 	path string
 	file *os.File
+
+	textFormatter logrus.Formatter
+	jsonFormatter logrus.Formatter
 }
 
 // handleGlobalLog sets up the global logger.
 //
 // Note that the logfile path may be blank since this function also
 // checks the environment to see whether global logging is required.
-func handleGlobalLog(logfilePath string) error {
-
-	// the environment variable takes priority
-	path := os.Getenv(globalLogEnv)
-
-	if path == "" {
-		path = logfilePath
-	}
+func handleGlobalLog(logfilePath string, rotation globalLogRotation) error {
+	path := resolveGlobalLogPath(logfilePath)
 
 	if path == "" {
 		// global logging not required
@@ -84,14 +277,14 @@ func handleGlobalLog(logfilePath string) error {
 		return fmt.Errorf("Global log path must be absolute: %v", path)
 	}
 
-	dir := filepath.Dir(logfilePath)
+	dir := filepath.Dir(path)
 
 	err := os.MkdirAll(dir, globalLogDirMode)
 	if err != nil {
 		return err
 	}
 
-	hook, err := newGlobalLogHook(path)
+	hook, err := newGlobalLogHook(path, rotation)
 	if err != nil {
 		return err
 	}
@@ -101,14 +294,25 @@ func handleGlobalLog(logfilePath string) error {
 	return nil
 }
 
+// resolveGlobalLogPath returns the path of the global log that is
+// actually in use, which may be blank if global logging is disabled.
+func resolveGlobalLogPath(logfilePath string) string {
+	// the environment variable takes priority
+	if path := os.Getenv(globalLogEnv); path != "" {
+		return path
+	}
+
+	return logfilePath
+}
+
 // newGlobalLogHook creates a new hook that can be used by a logrus
 // logger.
-func newGlobalLogHook(logfilePath string) (*GlobalLogHook, error) {
+func newGlobalLogHook(logfilePath string, rotation globalLogRotation) (*GlobalLogHook, error) {
 	if logfilePath == "" {
 		return nil, errNeedGlobalLogPath
 	}
 
-	f, err := os.OpenFile(logfilePath, globalLogFlags, globalLogMode)
+	f, err := openGlobalLog(logfilePath, rotation)
 	if err != nil {
 		return nil, err
 	}
@@ -116,11 +320,80 @@ func newGlobalLogHook(logfilePath string) (*GlobalLogHook, error) {
 	hook := &GlobalLogHook{
 		path: logfilePath,
 		file: f,
+		textFormatter: &logrus.TextFormatter{
+			DisableColors: true,
+			FullTimestamp: true,
+		},
+		jsonFormatter: &logrus.JSONFormatter{},
 	}
 
 	return hook, nil
 }
 
+// openGlobalLog opens the global log, first rotating it if needed. The
+// runtimes serialize the rotations with a lock file, whose modification
+// time records when the current log was started.
+func openGlobalLog(path string, rotation globalLogRotation) (*os.File, error) {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, globalLogMode)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+
+	lockInfo, err := lock.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	logInfo, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	start := err != nil
+
+	if err == nil && (logInfo.Size() >= rotation.maxSize || time.Since(lockInfo.ModTime()) >= rotation.maxAge) {
+		if err := rotateGlobalLog(path, rotation.maxFiles); err != nil {
+			return nil, err
+		}
+
+		start = true
+	}
+
+	if start {
+		now := time.Now()
+		if err := os.Chtimes(lock.Name(), now, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return os.OpenFile(path, globalLogFlags, globalLogMode)
+}
+
+// rotateGlobalLog renames the global log to "<path>.1", after shifting
+// the previously rotated logs and removing the oldest one.
+func rotateGlobalLog(path string, maxFiles int) error {
+	rotated := func(i int) string {
+		return fmt.Sprintf("%s.%d", path, i)
+	}
+
+	if err := os.Remove(rotated(maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(rotated(i), rotated(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(path, rotated(1))
+}
+
 // Levels informs the logrus Logger which log levels this hook supports.
 func (hook *GlobalLogHook) Levels() []logrus.Level {
 	// Log at all levels
@@ -130,18 +403,36 @@ func (hook *GlobalLogHook) Levels() []logrus.Level {
 // Fire is called by the logrus logger when data is available for the
 // hook.
 func (hook *GlobalLogHook) Fire(entry *logrus.Entry) error {
+	// The global log is shared by all the runtimes: identify the
+	// process which logged the entry.
+	data := make(logrus.Fields, len(entry.Data)+2)
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+	data["pid"] = os.Getpid()
+	data["name"] = name
+
+	globalEntry := &logrus.Entry{
+		Logger:  entry.Logger,
+		Data:    data,
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Message: entry.Message,
+	}
 
-	// Ignore any formatter that has been used and log in a custom format
-	// to the global log.
-	_, err := hook.file.WriteString(fmt.Sprintf("%v:%d:%s:%s:%s\n",
-		entry.Time,
-		os.Getpid(),
-		name,
-		entry.Level,
-		entry.Message))
+	// Honour the format of the runtime log, without the colors it may
+	// use on a terminal.
+	formatter := hook.textFormatter
+	if _, ok := entry.Logger.Formatter.(*logrus.JSONFormatter); ok {
+		formatter = hook.jsonFormatter
+	}
+
+	serialized, err := formatter.Format(globalEntry)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = hook.file.Write(serialized)
+
+	return err
 }
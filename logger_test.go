@@ -15,6 +15,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -22,10 +23,17 @@ import (
 	"path"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 )
 
+var testGlobalLogRotation = globalLogRotation{
+	maxSize:  defaultGlobalLogMaxSize << 20,
+	maxAge:   defaultGlobalLogMaxAge,
+	maxFiles: defaultGlobalLogMaxFiles,
+}
+
 type testData struct {
 	path          string
 	expectFailure bool
@@ -75,7 +83,7 @@ func TestNewGlobalLogHook(t *testing.T) {
 	}
 
 	for _, d := range data {
-		hook, err := newGlobalLogHook(d.path)
+		hook, err := newGlobalLogHook(d.path, testGlobalLogRotation)
 		if d.expectFailure {
 			if err == nil {
 				t.Fatal(fmt.Sprintf("unexpected succes from newGlobalLogHook(path=%v)", d.path))
@@ -112,7 +120,7 @@ func TestHandleGlobalLog(t *testing.T) {
 	}
 
 	for _, d := range data {
-		err := handleGlobalLog(d.path)
+		err := handleGlobalLog(d.path, testGlobalLogRotation)
 		if d.expectFailure {
 			if err == nil {
 				t.Fatal(fmt.Sprintf("unexpected success from handleGlobalLog(path=%q)", d.path))
@@ -136,7 +144,7 @@ func TestHandleGlobalLog(t *testing.T) {
 		ccLog.Debug(str)
 
 		// Check that the string was logged
-		err = grep(fmt.Sprintf("debug:.*%s", str), d.path)
+		err = grep(fmt.Sprintf(`level=debug msg="%s"`, regexp.QuoteMeta(str)), d.path)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -170,7 +178,7 @@ func TestHandleGlobalLogEnvVar(t *testing.T) {
 	os.Setenv(envvar, tmpfile2)
 	defer os.Unsetenv(envvar)
 
-	err = handleGlobalLog(tmpfile)
+	err = handleGlobalLog(tmpfile, testGlobalLogRotation)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -189,8 +197,259 @@ func TestHandleGlobalLogEnvVar(t *testing.T) {
 	}
 
 	// Check that the string was logged
-	err = grep(fmt.Sprintf("debug:.*%s", str), tmpfile2)
+	err = grep(fmt.Sprintf(`level=debug msg="%s"`, regexp.QuoteMeta(str)), tmpfile2)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestGlobalLogger returns a logger only writing to the global log
+// at path.
+func newTestGlobalLogger(t *testing.T, path string, rotation globalLogRotation) *logrus.Logger {
+	hook, err := newGlobalLogHook(path, rotation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Hooks.Add(ccLogFields)
+	logger.Hooks.Add(hook)
+
+	return logger
+}
+
+func resetLogFields() {
+	ccLogFields.Lock()
+	defer ccLogFields.Unlock()
+
+	ccLogFields.fields = logrus.Fields{}
+}
+
+func TestGlobalLogFields(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	defer resetLogFields()
+
+	tmpfile := path.Join(tmpdir, "global.log")
+	logger := newTestGlobalLogger(t, tmpfile, testGlobalLogRotation)
+
+	setLogField(logFieldCommand, "start")
+	setLogField(logFieldContainerID, "foo")
+	setLogField(logFieldPodID, "")
+
+	logger.WithField("extra", "value").Info("fields")
+
+	for _, pattern := range []string{
+		`level=info msg=fields`,
+		`command=start`,
+		`containerID=foo`,
+		`extra=value`,
+		fmt.Sprintf(`pid=%d`, os.Getpid()),
+		`name=` + name,
+	} {
+		if err := grep(pattern, tmpfile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Empty values are not attached.
+	if err := grep(`podID`, tmpfile); err == nil {
+		t.Fatal("unexpected empty podID field")
+	}
+}
+
+func TestGlobalLogJSONFormat(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer os.RemoveAll(tmpdir)
+	defer resetLogFields()
+
+	tmpfile := path.Join(tmpdir, "global.log")
+	logger := newTestGlobalLogger(t, tmpfile, testGlobalLogRotation)
+	logger.Formatter = new(logrus.JSONFormatter)
+
+	setLogField(logFieldPodID, "bar")
+	logger.Warn("json entry")
+
+	data, err := ioutil.ReadFile(tmpfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("global log entry %q is not JSON: %v", data, err)
+	}
+
+	if entry["msg"] != "json entry" || entry["level"] != "warning" || entry["podID"] != "bar" {
+		t.Fatalf("unexpected global log entry %v", entry)
+	}
+}
+
+func TestNewGlobalLogRotation(t *testing.T) {
+	rotation, err := newGlobalLogRotation(runtime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rotation != testGlobalLogRotation {
+		t.Fatalf("expected default rotation %+v, got %+v", testGlobalLogRotation, rotation)
+	}
+
+	rotation, err = newGlobalLogRotation(runtime{
+		GlobalLogMaxSize:  1,
+		GlobalLogMaxAge:   "24h",
+		GlobalLogMaxFiles: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := globalLogRotation{maxSize: 1 << 20, maxAge: 24 * time.Hour, maxFiles: 2}
+	if rotation != expected {
+		t.Fatalf("expected rotation %+v, got %+v", expected, rotation)
+	}
+
+	for _, r := range []runtime{
+		{GlobalLogMaxSize: -1},
+		{GlobalLogMaxAge: "soon"},
+		{GlobalLogMaxAge: "-1h"},
+		{GlobalLogMaxFiles: -1},
+	} {
+		if _, err := newGlobalLogRotation(r); err == nil {
+			t.Fatalf("unexpected success from newGlobalLogRotation(%+v)", r)
+		}
+	}
+}
+
+func TestNewLogSinks(t *testing.T) {
+	sinks, err := newLogSinks(runtime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := logSinks{file: true, syslogSocket: defaultSyslogSocket}
+	if sinks != expected {
+		t.Fatalf("expected default sinks %+v, got %+v", expected, sinks)
+	}
+
+	sinks, err = newLogSinks(runtime{
+		LogSinks:     []string{"journald", "syslog", "journald"},
+		SyslogSocket: "/run/syslog.sock",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = logSinks{journald: true, syslog: true, syslogSocket: "/run/syslog.sock"}
+	if sinks != expected {
+		t.Fatalf("expected sinks %+v, got %+v", expected, sinks)
+	}
+
+	// An empty list disables all the sinks.
+	sinks, err = newLogSinks(runtime{LogSinks: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sinks.file || sinks.journald || sinks.syslog {
+		t.Fatalf("unexpected sinks %+v", sinks)
+	}
+
+	if _, err := newLogSinks(runtime{LogSinks: []string{"file", "console"}}); err == nil {
+		t.Fatal("unexpected success with an invalid sink")
+	}
+}
+
+func TestHandleLogSinksUnreachable(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	savedJournaldSocketPath := journaldSocketPath
+	journaldSocketPath = path.Join(tmpdir, "journal.sock")
+	defer func() {
+		journaldSocketPath = savedJournaldSocketPath
+	}()
+
+	sinks := logSinks{
+		journald:     true,
+		syslog:       true,
+		syslogSocket: path.Join(tmpdir, "syslog.sock"),
+	}
+
+	// The runtime must work on hosts without journald or syslog.
+	if err := handleLogSinks("", sinks, testGlobalLogRotation); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGlobalLogRotation(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	tmpfile := path.Join(tmpdir, "global.log")
+	rotation := globalLogRotation{maxSize: 10, maxAge: time.Hour, maxFiles: 2}
+
+	// Each run logs more than the maximum size, so the next one
+	// rotates the log.
+	for i := 0; i < 4; i++ {
+		logger := newTestGlobalLogger(t, tmpfile, rotation)
+		logger.Infof("run %d", i)
+	}
+
+	expected := map[string]string{
+		tmpfile:        "run 3",
+		tmpfile + ".1": "run 2",
+		tmpfile + ".2": "run 1",
+	}
+
+	for file, msg := range expected {
+		if err := grep(fmt.Sprintf(`msg="%s"`, msg), file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only maxFiles rotated logs are retained.
+	if fileExists(tmpfile + ".3") {
+		t.Fatal("unexpected third rotated log")
+	}
+
+	// A small log is rotated once it is too old.
+	rotation.maxSize = 1 << 20
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(tmpfile+".lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := newTestGlobalLogger(t, tmpfile, rotation)
+	logger.Info("new log")
+
+	if err := grep(`msg="run 3"`, tmpfile+".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := grep(`msg="run 3"`, tmpfile); err == nil {
+		t.Fatal("expected the old entries to be rotated")
+	}
+
+	// The rotation restarted the age of the log.
+	logger = newTestGlobalLogger(t, tmpfile, rotation)
+	logger.Info("same log")
+
+	if err := grep(`msg="new log"`, tmpfile); err != nil {
+		t.Fatal(err)
+	}
 }
@@ -20,9 +20,12 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
-	vc "github.com/containers/virtcontainers"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/hyperstart"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
 )
@@ -52,6 +55,9 @@ var defaultRootDirectory = "/run/clear-containers"
 
 var ccLog = logrus.New()
 
+// jsonErrors is set when fatal errors must be written as JSON objects.
+var jsonErrors = false
+
 func beforeSubcommands(context *cli.Context) error {
 	if userWantsUsage(context) || (context.NArg() == 1 && (context.Args()[0] == "cc-check")) {
 		// No setup required if the user just
@@ -77,12 +83,18 @@ func beforeSubcommands(context *cli.Context) error {
 		// retain logrus's default.
 	case "json":
 		ccLog.Formatter = new(logrus.JSONFormatter)
+		jsonErrors = true
 	default:
-		return fmt.Errorf("unknown log-format %q", context.GlobalString("log-format"))
+		return newRuntimeError(errCodeUsage, "", "",
+			fmt.Errorf("unknown log-format %q", context.GlobalString("log-format")))
 	}
 
-	// Set virtcontainers logger.
+	// Set the virtcontainers loggers.
 	vc.SetLogger(ccLog)
+	oci.SetLogger(ccLog)
+	hyperstart.SetLogger(ccLog)
+
+	setLogField(logFieldCommand, context.Args().First())
 
 	ignoreLogging := false
 	if context.NArg() == 1 && context.Args()[0] == "cc-env" {
@@ -90,18 +102,22 @@ func beforeSubcommands(context *cli.Context) error {
 		ignoreLogging = true
 	}
 
-	configFile, logfilePath, runtimeConfig, err := loadConfiguration(context.GlobalString("cc-config"), ignoreLogging)
+	start := time.Now()
+
+	configFile, logfilePath, runtimeConfig, settings, err := loadConfiguration(context.GlobalString("cc-config"), ignoreLogging)
 	if err != nil {
-		fatal(err)
+		fatal(newRuntimeError(errCodeConfig, "", "", err))
 	}
 
 	ccLog.Infof("%v (version %v, commit %v) called as: %v", name, version, commit, context.Args())
 
 	// make the data accessible to the sub-commands.
 	context.App.Metadata = map[string]interface{}{
-		"runtimeConfig": runtimeConfig,
-		"configFile":    configFile,
-		"logfilePath":   logfilePath,
+		"runtimeConfig":   runtimeConfig,
+		"runtimeSettings": settings,
+		"configFile":      configFile,
+		"logfilePath":     logfilePath,
+		"traceContext":    startTrace(context, start),
 	}
 
 	return nil
@@ -135,6 +151,14 @@ func main() {
 			Name:  "cc-config",
 			Usage: project + " config file path",
 		},
+		cli.DurationFlag{
+			Name:  "cc-timeout",
+			Usage: "maximum duration of the operation (for example 30s), overriding the timeouts of the config file",
+		},
+		cli.StringFlag{
+			Name:  "cc-trace",
+			Usage: "export a trace of the operation to a file, or to a Zipkin compatible collector given as an http:// or unix:// URL",
+		},
 		cli.BoolFlag{
 			Name:  "debug",
 			Usage: "enable debug output for logging",
@@ -156,9 +180,14 @@ func main() {
 		},
 	}
 
-	app.Commands = []cli.Command{
+	app.Commands = recordHistory(recordMetrics(traceCommands([]cli.Command{
 		ccCheckCommand,
+		ccCollectCommand,
 		ccEnvCommand,
+		ccHistoryCommand,
+		ccMetricsCommand,
+		ccReclaimCommand,
+		ccStateMigrateCommand,
 		createCommand,
 		deleteCommand,
 		execCommand,
@@ -170,7 +199,7 @@ func main() {
 		startCommand,
 		stateCommand,
 		versionCommand,
-	}
+	})))
 
 	app.Before = beforeSubcommands
 	// If the command returns an error, cli takes upon itself to print
@@ -202,11 +231,11 @@ func userWantsUsage(context *cli.Context) bool {
 	return false
 }
 
-// fatal prints the error's details exits the program.
+// fatal prints the error's details and exits the program with the exit
+// code corresponding to the error.
 func fatal(err error) {
 	ccLog.Error(err)
-	fmt.Fprintln(os.Stderr, err)
-	exit(1)
+	exit(writeError(os.Stderr, err, jsonErrors))
 }
 
 type fatalWriter struct {
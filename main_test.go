@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 
 	"github.com/dlespiau/covertool/pkg/cover"
@@ -44,6 +45,8 @@ func runUnitTests(m *testing.M) {
 		os.Exit(1)
 	}
 
+	containerIndexPath = filepath.Join(testDir, "containers")
+
 	ret := m.Run()
 
 	os.RemoveAll(testDir)
@@ -0,0 +1,413 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
+	"github.com/urfave/cli"
+)
+
+const (
+	// metricsFileMode is the mode used to create the metrics store.
+	metricsFileMode = os.FileMode(0640)
+
+	// metricsDirMode is the mode used to create the directory holding
+	// the metrics store.
+	metricsDirMode = os.FileMode(0750)
+
+	// metricsOutputMode is the mode of the file the metrics are
+	// exported to, which the node exporter must be able to read.
+	metricsOutputMode = os.FileMode(0644)
+
+	metricOperations     = "cc_runtime_operations_total"
+	metricFailures       = "cc_runtime_operation_failures_total"
+	metricDuration       = "cc_runtime_operation_duration_seconds"
+	metricVMBoot         = "cc_runtime_vm_boot_duration_seconds"
+	metricHookDuration   = "cc_runtime_hook_duration_seconds"
+	metricProxyRoundTrip = "cc_runtime_proxy_request_duration_seconds"
+)
+
+// metricsFilePath is the per-host store of the metrics. It is a variable
+// to allow tests to modify it.
+var metricsFilePath = filepath.Join(defaultRuntimeLib, "metrics.json")
+
+// metricsBuckets are the upper bounds, in seconds, of the buckets of the
+// latency histograms.
+var metricsBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metricDescription is the Prometheus type and help of a metric.
+type metricDescription struct {
+	kind string
+	help string
+}
+
+var metricDescriptions = map[string]metricDescription{
+	metricOperations:     {"counter", "Number of operations run, by command."},
+	metricFailures:       {"counter", "Number of operations which failed, by command and error code."},
+	metricDuration:       {"histogram", "Duration of the operations, by command."},
+	metricVMBoot:         {"histogram", "Time taken to start the VM of a pod."},
+	metricHookDuration:   {"histogram", "Duration of the OCI hooks, by stage."},
+	metricProxyRoundTrip: {"histogram", "Duration of the requests sent to the proxy, by request."},
+}
+
+// spanMetric is the histogram recording the duration of a span, labelled
+// with the value of one of its tags.
+type spanMetric struct {
+	metric string
+	label  string
+	tag    string
+}
+
+// spanMetrics lists the spans recorded by virtcontainers which are
+// exported as metrics, indexed by span name.
+var spanMetrics = map[string]spanMetric{
+	"startVM":      {metric: metricVMBoot},
+	"hook":         {metric: metricHookDuration, label: "stage", tag: "hook.stage"},
+	"proxyRequest": {metric: metricProxyRoundTrip, label: "request", tag: "proxy.request"},
+}
+
+// histogram counts observations in metricsBuckets. The buckets are not
+// cumulative: each one only counts the observations greater than the
+// bound of the previous bucket.
+type histogram struct {
+	Buckets []uint64 `json:"buckets"`
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`
+}
+
+func (h *histogram) observe(value float64) {
+	if len(h.Buckets) != len(metricsBuckets) {
+		// The buckets changed since the histogram was created.
+		*h = histogram{Buckets: make([]uint64, len(metricsBuckets))}
+	}
+
+	h.Count++
+	h.Sum += value
+
+	for i, bound := range metricsBuckets {
+		if value <= bound {
+			h.Buckets[i]++
+			break
+		}
+	}
+}
+
+// metricsStore holds the metrics of all the runtime processes of the
+// host. The series are indexed by their name followed by their labels,
+// as in `cc_runtime_operations_total{command="create"}`.
+type metricsStore struct {
+	Counters   map[string]uint64     `json:"counters"`
+	Histograms map[string]*histogram `json:"histograms"`
+}
+
+func newMetricsStore() *metricsStore {
+	return &metricsStore{
+		Counters:   make(map[string]uint64),
+		Histograms: make(map[string]*histogram),
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// seriesKey returns the key of the series of metric with the label
+// name/value pairs.
+func seriesKey(metric string, labels ...string) string {
+	var pairs []string
+
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelValueEscaper.Replace(labels[i+1])))
+	}
+
+	return metric + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// splitSeriesKey returns the metric name and the labels of a series key.
+func splitSeriesKey(key string) (string, string) {
+	i := strings.Index(key, "{")
+	if i < 0 {
+		return key, ""
+	}
+
+	return key[:i], strings.TrimSuffix(key[i+1:], "}")
+}
+
+func (s *metricsStore) inc(metric string, labels ...string) {
+	s.Counters[seriesKey(metric, labels...)]++
+}
+
+func (s *metricsStore) observe(value float64, metric string, labels ...string) {
+	key := seriesKey(metric, labels...)
+
+	h, ok := s.Histograms[key]
+	if !ok {
+		h = &histogram{}
+		s.Histograms[key] = h
+	}
+
+	h.observe(value)
+}
+
+// recordOperation updates the metrics with the outcome of the command
+// and with the duration of the spans it recorded.
+func (s *metricsStore) recordOperation(command string, err error, duration time.Duration, spans []trace.Span) {
+	s.inc(metricOperations, "command", command)
+
+	// "run" returns the exit code of the workload as an error without
+	// a message.
+	if err != nil && err.Error() != "" {
+		s.inc(metricFailures, "command", command, "error", string(classifyError(err).code))
+	}
+
+	for _, span := range spans {
+		if span.ParentID == "" {
+			// The root span also covers the loading of the
+			// configuration.
+			duration = time.Duration(span.Duration) * time.Microsecond
+			continue
+		}
+
+		m, ok := spanMetrics[span.Name]
+		if !ok {
+			continue
+		}
+
+		seconds := (time.Duration(span.Duration) * time.Microsecond).Seconds()
+
+		if m.label == "" {
+			s.observe(seconds, m.metric)
+		} else {
+			s.observe(seconds, m.metric, m.label, span.Tags[m.tag])
+		}
+	}
+
+	s.observe(duration.Seconds(), metricDuration, "command", command)
+}
+
+// recordMetrics wraps the action of the container operations so that
+// every invocation updates the metrics store, whatever its outcome.
+func recordMetrics(commands []cli.Command) []cli.Command {
+	for i, command := range commands {
+		if !timeoutOperations[command.Name] {
+			continue
+		}
+
+		action := command.Action
+		commandName := command.Name
+
+		commands[i].Action = func(context *cli.Context) error {
+			start := time.Now()
+
+			err := cli.HandleAction(action, context)
+
+			duration := time.Since(start)
+
+			var spans []trace.Span
+			if tracer := trace.TracerFromContext(traceContext(context)); tracer != nil {
+				spans = tracer.Spans()
+			}
+
+			metricsErr := updateMetrics(metricsFilePath, func(s *metricsStore) {
+				s.recordOperation(commandName, err, duration, spans)
+			})
+			if metricsErr != nil {
+				ccLog.Warnf("Failed to record the metrics of %q: %v", commandName, metricsErr)
+			}
+
+			return err
+		}
+	}
+
+	return commands
+}
+
+// readMetrics returns the metrics store, which is empty if it does not
+// exist yet.
+func readMetrics(path string) (*metricsStore, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newMetricsStore(), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	store := newMetricsStore()
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("corrupted metrics store %s: %v", path, err)
+	}
+
+	return store, nil
+}
+
+// writeFileAtomic replaces the content of path so that readers either
+// see its previous or its new content.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// updateMetrics applies update to the metrics store. The runtime
+// processes of the host serialize their updates with a lock file, and
+// the store is replaced atomically so that it can be read without lock.
+func updateMetrics(path string, update func(*metricsStore)) error {
+	if err := os.MkdirAll(filepath.Dir(path), metricsDirMode); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, metricsFileMode)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+
+	store, err := readMetrics(path)
+	if err != nil {
+		// Do not stop recording the metrics forever, the counters
+		// start over as after a reset.
+		ccLog.Warnf("Resetting the metrics: %v", err)
+		store = newMetricsStore()
+	}
+
+	update(store)
+
+	data, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, metricsFileMode)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatSeries returns the series of metric with the labels, to which
+// the extra label is appended if not empty.
+func formatSeries(metric, labels, extra string) string {
+	if extra != "" {
+		if labels != "" {
+			labels += ","
+		}
+		labels += extra
+	}
+
+	if labels == "" {
+		return metric
+	}
+
+	return metric + "{" + labels + "}"
+}
+
+// writeMetrics writes the metrics in the Prometheus text exposition
+// format.
+func writeMetrics(w io.Writer, store *metricsStore) error {
+	var b bytes.Buffer
+
+	families := make(map[string][]string)
+
+	for key := range store.Counters {
+		metric, _ := splitSeriesKey(key)
+		families[metric] = append(families[metric], key)
+	}
+
+	for key := range store.Histograms {
+		metric, _ := splitSeriesKey(key)
+		families[metric] = append(families[metric], key)
+	}
+
+	var metrics []string
+	for metric := range families {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	for _, metric := range metrics {
+		keys := families[metric]
+		sort.Strings(keys)
+
+		desc, ok := metricDescriptions[metric]
+		if !ok {
+			desc = metricDescription{kind: "untyped"}
+		}
+
+		if desc.help != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", metric, desc.help)
+		}
+		fmt.Fprintf(&b, "# TYPE %s %s\n", metric, desc.kind)
+
+		for _, key := range keys {
+			_, labels := splitSeriesKey(key)
+
+			if value, ok := store.Counters[key]; ok {
+				fmt.Fprintf(&b, "%s %d\n", formatSeries(metric, labels, ""), value)
+				continue
+			}
+
+			h := store.Histograms[key]
+
+			var cumulative uint64
+			for i, bound := range metricsBuckets {
+				if i < len(h.Buckets) {
+					cumulative += h.Buckets[i]
+				}
+
+				fmt.Fprintf(&b, "%s %d\n", formatSeries(metric+"_bucket", labels, `le="`+formatFloat(bound)+`"`), cumulative)
+			}
+
+			fmt.Fprintf(&b, "%s %d\n", formatSeries(metric+"_bucket", labels, `le="+Inf"`), h.Count)
+			fmt.Fprintf(&b, "%s %s\n", formatSeries(metric+"_sum", labels, ""), formatFloat(h.Sum))
+			fmt.Fprintf(&b, "%s %d\n", formatSeries(metric+"_count", labels, ""), h.Count)
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
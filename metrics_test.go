@@ -0,0 +1,320 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+// setTestMetricsFilePath makes the metrics store live in dir until the
+// returned function is called.
+func setTestMetricsFilePath(dir string) func() {
+	savedMetricsFilePath := metricsFilePath
+	metricsFilePath = filepath.Join(dir, "metrics.json")
+
+	return func() {
+		metricsFilePath = savedMetricsFilePath
+	}
+}
+
+func TestHistogramObserve(t *testing.T) {
+	assert := assert.New(t)
+
+	var h histogram
+
+	h.observe(0.01)
+	h.observe(0.3)
+	h.observe(0.4)
+	h.observe(120)
+
+	assert.Equal(uint64(4), h.Count)
+	assert.InDelta(120.71, h.Sum, 0.0001)
+	assert.Len(h.Buckets, len(metricsBuckets))
+
+	// The bounds are inclusive.
+	assert.Equal(uint64(1), h.Buckets[0])
+	assert.Equal(uint64(2), h.Buckets[5])
+
+	var total uint64
+	for _, count := range h.Buckets {
+		total += count
+	}
+
+	// Observations above the last bound are only counted by +Inf.
+	assert.Equal(uint64(3), total)
+}
+
+func TestSeriesKey(t *testing.T) {
+	assert := assert.New(t)
+
+	key := seriesKey(metricFailures, "command", "create", "error", `a"b\c`)
+	assert.Equal(`cc_runtime_operation_failures_total{command="create",error="a\"b\\c"}`, key)
+
+	metric, labels := splitSeriesKey(key)
+	assert.Equal(metricFailures, metric)
+	assert.Equal(`command="create",error="a\"b\\c"`, labels)
+
+	metric, labels = splitSeriesKey(seriesKey(metricVMBoot))
+	assert.Equal(metricVMBoot, metric)
+	assert.Empty(labels)
+}
+
+func TestRecordOperation(t *testing.T) {
+	assert := assert.New(t)
+
+	spans := []trace.Span{
+		{ID: "1", Name: "create", Duration: 3000000},
+		{ParentID: "1", Name: "startVM", Duration: 1500000},
+		{ParentID: "1", Name: "hook", Duration: 20000, Tags: map[string]string{"hook.stage": "prestart"}},
+		{ParentID: "1", Name: "proxyRequest", Duration: 5000, Tags: map[string]string{"proxy.request": "RegisterVM"}},
+		{ParentID: "1", Name: "getContainerInfo", Duration: 100},
+	}
+
+	store := newMetricsStore()
+	store.recordOperation("create", nil, time.Second, spans)
+
+	timeoutErr := newRuntimeError(errCodeTimeout, "", "", errors.New("timed out"))
+	store.recordOperation("create", timeoutErr, time.Second, nil)
+
+	// The exit code of the workload is not a failure.
+	store.recordOperation("run", cli.NewExitError("", 3), time.Second, nil)
+
+	assert.Equal(map[string]uint64{
+		`cc_runtime_operations_total{command="create"}`:                         2,
+		`cc_runtime_operations_total{command="run"}`:                            1,
+		`cc_runtime_operation_failures_total{command="create",error="timeout"}`: 1,
+	}, store.Counters)
+
+	duration := store.Histograms[`cc_runtime_operation_duration_seconds{command="create"}`]
+	assert.NotNil(duration)
+	assert.Equal(uint64(2), duration.Count)
+
+	// The duration of the root span takes priority over the measured
+	// one.
+	assert.InDelta(4, duration.Sum, 0.0001)
+
+	vmBoot := store.Histograms[`cc_runtime_vm_boot_duration_seconds{}`]
+	assert.NotNil(vmBoot)
+	assert.InDelta(1.5, vmBoot.Sum, 0.0001)
+
+	hook := store.Histograms[`cc_runtime_hook_duration_seconds{stage="prestart"}`]
+	assert.NotNil(hook)
+	assert.InDelta(0.02, hook.Sum, 0.0001)
+
+	proxy := store.Histograms[`cc_runtime_proxy_request_duration_seconds{request="RegisterVM"}`]
+	assert.NotNil(proxy)
+	assert.Equal(uint64(1), proxy.Count)
+
+	assert.Len(store.Histograms, 5)
+}
+
+func TestWriteMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newMetricsStore()
+	store.inc(metricOperations, "command", "start")
+	store.inc(metricOperations, "command", "create")
+	store.inc(metricOperations, "command", "create")
+	store.observe(0.3, metricVMBoot)
+	store.observe(0.02, metricDuration, "command", "create")
+	store.observe(100, metricDuration, "command", "create")
+
+	var b bytes.Buffer
+	assert.NoError(writeMetrics(&b, store))
+
+	expected := `# HELP cc_runtime_operation_duration_seconds Duration of the operations, by command.
+# TYPE cc_runtime_operation_duration_seconds histogram
+cc_runtime_operation_duration_seconds_bucket{command="create",le="0.01"} 0
+cc_runtime_operation_duration_seconds_bucket{command="create",le="0.025"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="0.05"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="0.1"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="0.25"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="0.5"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="1"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="2.5"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="5"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="10"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="30"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="60"} 1
+cc_runtime_operation_duration_seconds_bucket{command="create",le="+Inf"} 2
+cc_runtime_operation_duration_seconds_sum{command="create"} 100.02
+cc_runtime_operation_duration_seconds_count{command="create"} 2
+# HELP cc_runtime_operations_total Number of operations run, by command.
+# TYPE cc_runtime_operations_total counter
+cc_runtime_operations_total{command="create"} 2
+cc_runtime_operations_total{command="start"} 1
+# HELP cc_runtime_vm_boot_duration_seconds Time taken to start the VM of a pod.
+# TYPE cc_runtime_vm_boot_duration_seconds histogram
+cc_runtime_vm_boot_duration_seconds_bucket{le="0.01"} 0
+cc_runtime_vm_boot_duration_seconds_bucket{le="0.025"} 0
+cc_runtime_vm_boot_duration_seconds_bucket{le="0.05"} 0
+cc_runtime_vm_boot_duration_seconds_bucket{le="0.1"} 0
+cc_runtime_vm_boot_duration_seconds_bucket{le="0.25"} 0
+cc_runtime_vm_boot_duration_seconds_bucket{le="0.5"} 1
+cc_runtime_vm_boot_duration_seconds_bucket{le="1"} 1
+cc_runtime_vm_boot_duration_seconds_bucket{le="2.5"} 1
+cc_runtime_vm_boot_duration_seconds_bucket{le="5"} 1
+cc_runtime_vm_boot_duration_seconds_bucket{le="10"} 1
+cc_runtime_vm_boot_duration_seconds_bucket{le="30"} 1
+cc_runtime_vm_boot_duration_seconds_bucket{le="60"} 1
+cc_runtime_vm_boot_duration_seconds_bucket{le="+Inf"} 1
+cc_runtime_vm_boot_duration_seconds_sum 0.3
+cc_runtime_vm_boot_duration_seconds_count 1
+`
+
+	assert.Equal(expected, b.String())
+
+	b.Reset()
+	assert.NoError(writeMetrics(&b, newMetricsStore()))
+	assert.Empty(b.String())
+}
+
+func TestUpdateMetricsConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "metrics-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics", "metrics.json")
+
+	// Each update opens the lock file again, so the updates are
+	// serialized as if they were made by different processes.
+	const updates = 20
+
+	var wg sync.WaitGroup
+	for i := 0; i < updates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(updateMetrics(path, func(s *metricsStore) {
+				s.inc(metricOperations, "command", "start")
+			}))
+		}()
+	}
+	wg.Wait()
+
+	store, err := readMetrics(path)
+	assert.NoError(err)
+	assert.Equal(uint64(updates), store.Counters[seriesKey(metricOperations, "command", "start")])
+}
+
+func TestUpdateMetricsCorrupted(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "metrics-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics.json")
+	assert.NoError(ioutil.WriteFile(path, []byte("{"), metricsFileMode))
+
+	_, err = readMetrics(path)
+	assert.Error(err)
+
+	// The metrics start over rather than never being recorded again.
+	assert.NoError(updateMetrics(path, func(s *metricsStore) {
+		s.inc(metricOperations, "command", "start")
+	}))
+
+	store, err := readMetrics(path)
+	assert.NoError(err)
+	assert.Equal(map[string]uint64{`cc_runtime_operations_total{command="start"}`: 1}, store.Counters)
+}
+
+func TestRecordMetricsCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "metrics-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	defer setTestMetricsFilePath(dir)()
+
+	startErr := newRuntimeError(errCodeNotFound, "foo", "", errors.New("not found"))
+
+	app := cli.NewApp()
+	app.Commands = recordMetrics([]cli.Command{
+		{
+			Name: "start",
+			Action: func(context *cli.Context) error {
+				return startErr
+			},
+		},
+		{
+			Name: "cc-history",
+			Action: func(context *cli.Context) error {
+				return nil
+			},
+		},
+	})
+
+	assert.Equal(startErr, app.Run([]string{name, "start", "foo"}))
+	assert.NoError(app.Run([]string{name, "cc-history"}))
+
+	store, err := readMetrics(metricsFilePath)
+	assert.NoError(err)
+
+	// "cc-history" is not a container operation.
+	assert.Equal(map[string]uint64{
+		`cc_runtime_operations_total{command="start"}`:                           1,
+		`cc_runtime_operation_failures_total{command="start",error="not-found"}`: 1,
+	}, store.Counters)
+	assert.Len(store.Histograms, 1)
+}
+
+func TestCCMetricsCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "metrics-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	defer setTestMetricsFilePath(dir)()
+
+	assert.NoError(updateMetrics(metricsFilePath, func(s *metricsStore) {
+		s.inc(metricOperations, "command", "start")
+	}))
+
+	output := filepath.Join(dir, "cc-runtime.prom")
+
+	set := flag.NewFlagSet("", 0)
+	set.String("output", output, "")
+	ctx := cli.NewContext(cli.NewApp(), set, nil)
+
+	fn, ok := ccMetricsCommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+	assert.NoError(fn(ctx))
+
+	data, err := ioutil.ReadFile(output)
+	assert.NoError(err)
+	assert.Contains(string(data), fmt.Sprintf("%s{command=\"start\"} 1\n", metricOperations))
+
+	info, err := os.Stat(output)
+	assert.NoError(err)
+	assert.Equal(metricsOutputMode, info.Mode().Perm())
+}
@@ -15,15 +15,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"syscall"
 
-	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
@@ -38,6 +39,10 @@ const (
 	// Filesystem type corresponding to CGROUP_SUPER_MAGIC as listed
 	// here: http://man7.org/linux/man-pages/man2/statfs.2.html
 	cgroupFsType = 0x27e0eb
+
+	// Filesystem type corresponding to CGROUP2_SUPER_MAGIC, the
+	// unified hierarchy.
+	cgroup2FsType = 0x63677270
 )
 
 var (
@@ -47,92 +52,172 @@ var (
 
 var cgroupsDirPath = "/sys/fs/cgroup"
 
+// statfs is used to find the type of the cgroup filesystems.
+var statfs = syscall.Statfs
+
+// vcListPod and vcStatusContainer are the virtcontainers calls used to look
+// the containers up. They are variables to allow tests to modify them.
+var (
+	vcListPod         = vc.ListPod
+	vcStatusContainer = vc.StatusContainer
+)
+
 // getContainerInfo returns the container status and its pod ID.
 // It internally expands the container ID from the prefix provided.
 // An error is returned if >1 containers are found with the specified
 // prefix.
-func getContainerInfo(containerID string) (vc.ContainerStatus, string, error) {
+//
+// The container is looked up in the container index rather than among
+// all the pods. Once the index exists, a container it does not hold does
+// not exist: the pods are only scanned to build the index when it is
+// missing or cannot be read. The entries found in the index are checked
+// against the pod, and removed if the container does not exist anymore.
+func getContainerInfo(ctx context.Context, containerID string) (vc.ContainerStatus, string, error) {
+	return findContainer(ctx, containerID, lookupContainerIndex)
+}
+
+// getExactContainerInfo is getContainerInfo for a full container ID, which
+// is not expanded.
+func getExactContainerInfo(ctx context.Context, containerID string) (vc.ContainerStatus, string, error) {
+	return findContainer(ctx, containerID, lookupContainerIndexExact)
+}
+
+// findContainer looks the container up in the index with lookup.
+func findContainer(ctx context.Context, containerID string, lookup func(string) (map[string]string, error)) (vc.ContainerStatus, string, error) {
+	span, ctx := trace.StartSpan(ctx, "getContainerInfo")
+	span.SetTag(trace.TagContainerID, containerID)
+	defer span.Finish()
+
 	var cStatus vc.ContainerStatus
 	var podID string
 
 	// container ID MUST be provided.
 	if containerID == "" {
-		return vc.ContainerStatus{}, "", fmt.Errorf("Missing container ID")
+		return vc.ContainerStatus{}, "", newRuntimeError(errCodeUsage, "", "", fmt.Errorf("Missing container ID"))
 	}
 
-	podStatusList, err := vc.ListPod()
+	setLogField(logFieldContainerID, containerID)
+
+	matches, err := lookupIndexedContainers(ctx, containerID, lookup)
 	if err != nil {
 		return vc.ContainerStatus{}, "", err
 	}
 
 	matchFound := false
-	for _, podStatus := range podStatusList {
-		for _, containerStatus := range podStatus.ContainersStatus {
-			if containerStatus.ID == containerID {
-				return containerStatus, podStatus.ID, nil
+	for id, pod := range matches {
+		status, err := vcStatusContainer(ctx, pod, id)
+		if err != nil && classifyError(err).code != errCodeNotFound {
+			return vc.ContainerStatus{}, "", err
+		}
+
+		if err != nil || status.ID == "" {
+			// The container was removed without the runtime
+			// knowing about it.
+			ccLog.Warnf("Removing stale container index entry %q", id)
+			if err := removeContainerIndex(id); err != nil {
+				return vc.ContainerStatus{}, "", err
 			}
 
-			if strings.HasPrefix(containerStatus.ID, containerID) {
-				if matchFound {
-					return vc.ContainerStatus{}, "", errPrefixContIDNotUnique
-				}
+			continue
+		}
 
-				matchFound = true
-				cStatus = containerStatus
-				podID = podStatus.ID
-			}
+		if matchFound {
+			return vc.ContainerStatus{}, "", errPrefixContIDNotUnique
 		}
+
+		matchFound = true
+		cStatus = status
+		podID = pod
 	}
 
-	if matchFound {
-		return cStatus, podID, nil
+	if !matchFound {
+		return vc.ContainerStatus{}, "", nil
 	}
 
-	return vc.ContainerStatus{}, "", nil
+	setLogField(logFieldContainerID, cStatus.ID)
+	setLogField(logFieldPodID, podID)
+	noteHistoryContainer(cStatus.ID, podID)
+
+	return cStatus, podID, nil
+}
+
+// lookupIndexedContainers returns the indexed containers matching
+// containerID with lookup, mapped to their pod ID. The index is built from
+// the list of all the pods if it is missing, or rebuilt if it cannot be
+// read.
+func lookupIndexedContainers(ctx context.Context, containerID string, lookup func(string) (map[string]string, error)) (map[string]string, error) {
+	if containerIndexExists() {
+		matches, err := lookup(containerID)
+		if err == nil {
+			return matches, nil
+		}
+
+		ccLog.Warnf("Rebuilding the container index which cannot be read: %v", err)
+
+		if err := resetContainerIndex(); err != nil {
+			return nil, err
+		}
+	}
+
+	pods, err := vcListPod(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rebuildContainerIndex(pods); err != nil {
+		return nil, err
+	}
+
+	return lookup(containerID)
 }
 
-func getExistingContainerInfo(containerID string) (vc.ContainerStatus, string, error) {
-	cStatus, podID, err := getContainerInfo(containerID)
+func getExistingContainerInfo(ctx context.Context, containerID string) (vc.ContainerStatus, string, error) {
+	cStatus, podID, err := getContainerInfo(ctx, containerID)
 	if err != nil {
 		return vc.ContainerStatus{}, "", err
 	}
 
 	// container ID MUST exist.
 	if cStatus.ID == "" {
-		return vc.ContainerStatus{}, "", fmt.Errorf("Container ID does not exist")
+		return vc.ContainerStatus{}, "", newRuntimeError(errCodeNotFound, containerID, "",
+			fmt.Errorf("Container ID does not exist"))
 	}
 
 	return cStatus, podID, nil
 }
 
-func validCreateParams(containerID, bundlePath string) error {
+func validCreateParams(ctx context.Context, containerID, bundlePath string) error {
 	// container ID MUST be provided.
 	if containerID == "" {
-		return fmt.Errorf("Missing container ID")
+		return newRuntimeError(errCodeUsage, "", "", fmt.Errorf("Missing container ID"))
 	}
 
-	// container ID MUST be unique.
-	cStatus, _, err := getContainerInfo(containerID)
+	// container ID MUST be unique. It is not a prefix of the
+	// existing ones.
+	cStatus, _, err := getExactContainerInfo(ctx, containerID)
 	if err != nil {
 		return err
 	}
 
 	if cStatus.ID != "" {
-		return fmt.Errorf("ID already in use, unique ID should be provided")
+		return newRuntimeError(errCodeAlreadyExists, containerID, "",
+			fmt.Errorf("ID already in use, unique ID should be provided"))
 	}
 
 	// bundle path MUST be provided.
 	if bundlePath == "" {
-		return fmt.Errorf("Missing bundle path")
+		return newRuntimeError(errCodeUsage, containerID, "", fmt.Errorf("Missing bundle path"))
 	}
 
 	// bundle path MUST be valid.
 	fileInfo, err := os.Stat(bundlePath)
 	if err != nil {
-		return fmt.Errorf("Invalid bundle path '%s': %s", bundlePath, err)
+		return newRuntimeError(errCodeUsage, containerID, "",
+			fmt.Errorf("Invalid bundle path '%s': %s", bundlePath, err))
 	}
 	if fileInfo.IsDir() == false {
-		return fmt.Errorf("Invalid bundle path '%s', it should be a directory", bundlePath)
+		return newRuntimeError(errCodeUsage, containerID, "",
+			fmt.Errorf("Invalid bundle path '%s', it should be a directory", bundlePath))
 	}
 
 	return nil
@@ -151,7 +236,19 @@ func processRunning(pid int) (bool, error) {
 	return true, nil
 }
 
-func stopContainer(podID string, status vc.ContainerStatus) error {
+// containerProcessRunning returns true if the process standing for the
+// container on the host, its shim, is running. A container started with
+// the noop shim has no such process: its PID is zero and its stored state
+// is then the only one telling whether it runs.
+func containerProcessRunning(status vc.ContainerStatus) (bool, error) {
+	if status.PID == 0 {
+		return status.State.State == vc.StateRunning, nil
+	}
+
+	return processRunning(status.PID)
+}
+
+func stopContainer(ctx context.Context, podID string, status vc.ContainerStatus) error {
 	containerType, err := oci.GetContainerType(status.Annotations)
 	if err != nil {
 		return err
@@ -162,14 +259,14 @@ func stopContainer(podID string, status vc.ContainerStatus) error {
 		// Calling StopPod allows to make sure the pod is properly
 		// stopped. That way, containers/pod states are updated to
 		// the expected "stopped" state.
-		if _, err := vc.StopPod(podID); err != nil {
+		if _, err := vc.StopPod(ctx, podID); err != nil {
 			return err
 		}
 	case vc.PodContainer:
 		// Calling StopContainer allows to make sure the container is
 		// properly stopped and removed from the pod. That way, the
 		// container's state is updated to the expected "stopped" state.
-		if _, err := vc.StopContainer(podID, status.ID); err != nil {
+		if _, err := vc.StopContainer(ctx, podID, status.ID); err != nil {
 			return err
 		}
 	default:
@@ -183,61 +280,89 @@ func stopContainer(podID string, status vc.ContainerStatus) error {
 // OCI runtime specification. It returns a list of complete paths
 // that should be created and used for every specified resource.
 func processCgroupsPath(ociSpec oci.CompatOCISpec, isPod bool) ([]string, error) {
-	var cgroupsPathList []string
+	cgroups, err := processCgroups(ociSpec, isPod)
+	if err != nil {
+		return []string{}, err
+	}
+
+	cgroupsPathList := []string{}
+	for _, cgroup := range cgroups {
+		cgroupsPathList = append(cgroupsPathList, cgroup.path)
+	}
+
+	return cgroupsPathList, nil
+}
+
+// processCgroups returns the cgroups of the container, in the hierarchy of
+// each controller its resources use, or in the unified hierarchy.
+func processCgroups(ociSpec oci.CompatOCISpec, isPod bool) ([]cgroup, error) {
+	var cgroups []cgroup
 
 	if ociSpec.Linux.CgroupsPath == "" {
-		return []string{}, nil
+		return cgroups, nil
 	}
 
-	if ociSpec.Linux.Resources == nil {
-		return []string{}, nil
+	resources := ociSpec.Linux.Resources
+	if resources == nil {
+		return cgroups, nil
 	}
 
-	if ociSpec.Linux.Resources.Memory != nil {
-		memCgroupsPath, err := processCgroupsPathForResource(ociSpec, "memory", isPod)
+	// The unified hierarchy has a single directory for all the
+	// controllers.
+	if isCgroup2Mounted(cgroupsDirPath) {
+		cgroupsPath, err := processCgroupsPathForHierarchy(ociSpec, "", isPod)
 		if err != nil {
-			return []string{}, err
+			return nil, err
 		}
 
-		if memCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, memCgroupsPath)
+		if cgroupsPath != "" {
+			cgroups = append(cgroups, cgroup{path: cgroupsPath})
 		}
+
+		return cgroups, nil
 	}
 
-	if ociSpec.Linux.Resources.CPU != nil {
-		cpuCgroupsPath, err := processCgroupsPathForResource(ociSpec, "cpu", isPod)
+	for _, controller := range cgroupControllers(resources) {
+		cgroupsPath, err := processCgroupsPathForResource(ociSpec, controller, isPod)
 		if err != nil {
-			return []string{}, err
+			return nil, err
 		}
 
-		if cpuCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, cpuCgroupsPath)
+		if cgroupsPath != "" {
+			cgroups = append(cgroups, cgroup{controller, cgroupsPath})
 		}
 	}
 
-	if ociSpec.Linux.Resources.Pids != nil {
-		pidsCgroupsPath, err := processCgroupsPathForResource(ociSpec, "pids", isPod)
-		if err != nil {
-			return []string{}, err
-		}
+	return cgroups, nil
+}
 
-		if pidsCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, pidsCgroupsPath)
-		}
-	}
+// cgroupControllers returns the controllers, with one hierarchy per
+// controller, which resources use.
+func cgroupControllers(resources *specs.LinuxResources) []string {
+	var controllers []string
 
-	if ociSpec.Linux.Resources.BlockIO != nil {
-		blkIOCgroupsPath, err := processCgroupsPathForResource(ociSpec, "blkio", isPod)
-		if err != nil {
-			return []string{}, err
-		}
+	if resources == nil {
+		return controllers
+	}
 
-		if blkIOCgroupsPath != "" {
-			cgroupsPathList = append(cgroupsPathList, blkIOCgroupsPath)
+	for _, controller := range []struct {
+		name string
+		used bool
+	}{
+		{"memory", resources.Memory != nil},
+		{"cpu", resources.CPU != nil},
+		{"pids", resources.Pids != nil},
+		{"blkio", resources.BlockIO != nil},
+		{"cpuset", resources.CPU != nil && (resources.CPU.Cpus != "" || resources.CPU.Mems != "")},
+		{"hugetlb", len(resources.HugepageLimits) > 0},
+		{"devices", len(resources.Devices) > 0},
+	} {
+		if controller.used {
+			controllers = append(controllers, controller.name)
 		}
 	}
 
-	return cgroupsPathList, nil
+	return controllers
 }
 
 func processCgroupsPathForResource(ociSpec oci.CompatOCISpec, resource string, isPod bool) (string, error) {
@@ -245,6 +370,14 @@ func processCgroupsPathForResource(ociSpec oci.CompatOCISpec, resource string, i
 		return "", errNeedLinuxResource
 	}
 
+	return processCgroupsPathForHierarchy(ociSpec, resource, isPod)
+}
+
+// processCgroupsPathForHierarchy returns the cgroups path of the container
+// in the hierarchy mounted in the resource directory of the cgroup root,
+// or in the root itself for the unified hierarchy, whose resource is
+// empty.
+func processCgroupsPathForHierarchy(ociSpec oci.CompatOCISpec, resource string, isPod bool) (string, error) {
 	// Relative cgroups path provided.
 	if filepath.IsAbs(ociSpec.Linux.CgroupsPath) == false {
 		return filepath.Join(cgroupsDirPath, resource, ociSpec.Linux.CgroupsPath), nil
@@ -281,7 +414,12 @@ func processCgroupsPathForResource(ociSpec oci.CompatOCISpec, resource string, i
 	// It is not an error to have this cgroup not mounted. It is usually
 	// due to an old kernel version with missing support for specific
 	// cgroups.
-	if !isCgroupMounted(cgroupPath) {
+	mounted := isCgroupMounted(cgroupPath)
+	if resource == "" {
+		mounted = isCgroup2Mounted(cgroupPath)
+	}
+
+	if !mounted {
 		ccLog.Infof("cgroup path %s not mounted", cgroupPath)
 		return "", nil
 	}
@@ -292,15 +430,23 @@ func processCgroupsPathForResource(ociSpec oci.CompatOCISpec, resource string, i
 }
 
 func isCgroupMounted(cgroupPath string) bool {
-	var statFs syscall.Statfs_t
+	return cgroupFsTypeOf(cgroupPath) == cgroupFsType
+}
 
-	if err := syscall.Statfs(cgroupPath, &statFs); err != nil {
-		return false
-	}
+// isCgroup2Mounted returns true if the unified cgroup hierarchy is mounted
+// on cgroupPath.
+func isCgroup2Mounted(cgroupPath string) bool {
+	return cgroupFsTypeOf(cgroupPath) == cgroup2FsType
+}
+
+// cgroupFsTypeOf returns the type of the filesystem of cgroupPath, 0 if it
+// cannot be found.
+func cgroupFsTypeOf(cgroupPath string) int64 {
+	var statFs syscall.Statfs_t
 
-	if statFs.Type != int64(cgroupFsType) {
-		return false
+	if err := statfs(cgroupPath, &statFs); err != nil {
+		return 0
 	}
 
-	return true
+	return int64(statFs.Type)
 }
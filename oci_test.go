@@ -15,6 +15,7 @@
 package main
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -22,13 +23,13 @@ import (
 	"syscall"
 	"testing"
 
-	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
 func TestGetContainerInfoContainerIDEmptyFailure(t *testing.T) {
-	status, _, err := getContainerInfo("")
+	status, _, err := getContainerInfo(context.Background(), "")
 	if err == nil {
 		t.Fatalf("This test should fail because containerID is empty")
 	}
@@ -39,13 +40,13 @@ func TestGetContainerInfoContainerIDEmptyFailure(t *testing.T) {
 }
 
 func TestValidCreateParamsContainerIDEmptyFailure(t *testing.T) {
-	if err := validCreateParams("", ""); err == nil {
+	if err := validCreateParams(context.Background(), "", ""); err == nil {
 		t.Fatalf("This test should fail because containerID is empty")
 	}
 }
 
 func TestGetExistingContainerInfoContainerIDEmptyFailure(t *testing.T) {
-	status, _, err := getExistingContainerInfo("")
+	status, _, err := getExistingContainerInfo(context.Background(), "")
 
 	if err == nil {
 		t.Fatalf("This test should fail because containerID is empty")
@@ -76,8 +77,33 @@ func TestProcessRunningSuccessful(t *testing.T) {
 	testProcessRunning(t, pid, true)
 }
 
+func TestContainerProcessRunningNoShim(t *testing.T) {
+	type testData struct {
+		state    vc.State
+		expected bool
+	}
+
+	data := []testData{
+		{vc.State{State: vc.StateReady}, false},
+		{vc.State{State: vc.StateRunning}, true},
+		{vc.State{State: vc.StatePaused}, false},
+		{vc.State{State: vc.StateStopped}, false},
+	}
+
+	for _, d := range data {
+		running, err := containerProcessRunning(vc.ContainerStatus{State: d.state})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if running != d.expected {
+			t.Fatalf("Expecting a container without shim in state %q to be 'running == %v'", d.state.State, d.expected)
+		}
+	}
+}
+
 func TestStopContainerPodStatusEmptyFailure(t *testing.T) {
-	if err := stopContainer("", vc.ContainerStatus{}); err == nil {
+	if err := stopContainer(context.Background(), "", vc.ContainerStatus{}); err == nil {
 		t.Fatalf("This test should fail because PodStatus is empty")
 	}
 }
@@ -89,7 +115,7 @@ func TestStopContainerTooManyContainerStatusesFailure(t *testing.T) {
 		podStatus.ContainersStatus = append(podStatus.ContainersStatus, vc.ContainerStatus{})
 	}
 
-	if err := stopContainer("", vc.ContainerStatus{}); err == nil {
+	if err := stopContainer(context.Background(), "", vc.ContainerStatus{}); err == nil {
 		t.Fatalf("This test should fail because PodStatus has too many container statuses")
 	}
 }
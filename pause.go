@@ -16,7 +16,9 @@
 package main
 
 import (
-	vc "github.com/containers/virtcontainers"
+	"context"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
 	"github.com/urfave/cli"
 )
 
@@ -32,7 +34,9 @@ Where "<container-id>" is the container name to be paused.`,
 
 	` + noteText,
 	Action: func(context *cli.Context) error {
-		return toggleContainerPause(context.Args().First(), true)
+		ctx, done := operationContext(context, "pause")
+
+		return done(toggleContainerPause(ctx, context.Args().First(), true))
 	},
 }
 
@@ -46,21 +50,23 @@ Where "<container-id>" is the container name to be resumed.`,
 
 	` + noteText,
 	Action: func(context *cli.Context) error {
-		return toggleContainerPause(context.Args().First(), false)
+		ctx, done := operationContext(context, "resume")
+
+		return done(toggleContainerPause(ctx, context.Args().First(), false))
 	},
 }
 
-func toggleContainerPause(containerID string, pause bool) (err error) {
+func toggleContainerPause(ctx context.Context, containerID string, pause bool) (err error) {
 	// Checks the MUST and MUST NOT from OCI runtime specification
-	_, podID, err := getExistingContainerInfo(containerID)
+	_, podID, err := getExistingContainerInfo(ctx, containerID)
 	if err != nil {
 		return err
 	}
 
 	if pause {
-		_, err = vc.PausePod(podID)
+		_, err = vc.PausePod(ctx, podID)
 	} else {
-		_, err = vc.ResumePod(podID)
+		_, err = vc.ResumePod(ctx, podID)
 	}
 
 	return err
@@ -0,0 +1,166 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
+)
+
+const (
+	// defaultProfile names the profile made of the top-level sections
+	// of the configuration file.
+	defaultProfile = "default"
+
+	// profileAnnotation is the OCI annotation selecting the profile of
+	// a pod. It is also stored in the pod configuration.
+	profileAnnotation = "com.github.clearcontainers.runtime.profile"
+)
+
+// profile is a named set of hypervisor, proxy, shim and agent sections.
+// Each section of a profile replaces the top-level section of the same
+// kind, the others being inherited.
+type profile struct {
+	Hypervisor map[string]hypervisor
+	Proxy      map[string]proxy
+	Shim       map[string]shim
+	Agent      map[string]agent
+}
+
+// runtimeProfiles holds the runtime configuration of every profile.
+type runtimeProfiles struct {
+	configs     map[string]oci.RuntimeConfig
+	defaultName string
+
+	// assets holds the files the VMs of each profile are started
+	// from.
+	assets map[string]vmAssets
+}
+
+// profileTOMLConfig returns the configuration file as seen by a profile.
+func profileTOMLConfig(tomlConf tomlConfig, p profile) tomlConfig {
+	if len(p.Hypervisor) > 0 {
+		tomlConf.Hypervisor = p.Hypervisor
+	}
+
+	if len(p.Proxy) > 0 {
+		tomlConf.Proxy = p.Proxy
+	}
+
+	if len(p.Shim) > 0 {
+		tomlConf.Shim = p.Shim
+	}
+
+	if len(p.Agent) > 0 {
+		tomlConf.Agent = p.Agent
+	}
+
+	return tomlConf
+}
+
+// newRuntimeProfiles returns the runtime configuration of the default
+// profile and of each named profile, all starting from base.
+func newRuntimeProfiles(configPath string, tomlConf tomlConfig, base oci.RuntimeConfig) (runtimeProfiles, error) {
+	profiles := runtimeProfiles{
+		configs:     make(map[string]oci.RuntimeConfig),
+		defaultName: defaultProfile,
+		assets:      make(map[string]vmAssets),
+	}
+
+	if err := checkConfigParams(tomlConf); err != nil {
+		return runtimeProfiles{}, err
+	}
+
+	config := base
+	if err := updateRuntimeConfig(configPath, tomlConf, &config); err != nil {
+		return runtimeProfiles{}, err
+	}
+
+	assets, err := newVMAssets(tomlConf, config)
+	if err != nil {
+		return runtimeProfiles{}, fmt.Errorf("%v: %v", configPath, err)
+	}
+
+	profiles.configs[defaultProfile] = config
+	profiles.assets[defaultProfile] = assets
+
+	for name, p := range tomlConf.Profile {
+		if name == defaultProfile {
+			return runtimeProfiles{}, fmt.Errorf("%v: Profile name %q is reserved to the top-level sections", configPath, name)
+		}
+
+		profileConf := profileTOMLConfig(tomlConf, p)
+
+		if err := checkConfigParams(profileConf); err != nil {
+			return runtimeProfiles{}, fmt.Errorf("%v: profile %q: %v", configPath, name, err)
+		}
+
+		config := base
+		if err := updateRuntimeConfig(configPath, profileConf, &config); err != nil {
+			return runtimeProfiles{}, fmt.Errorf("profile %q: %v", name, err)
+		}
+
+		assets, err := newVMAssets(profileConf, config)
+		if err != nil {
+			return runtimeProfiles{}, fmt.Errorf("%v: profile %q: %v", configPath, name, err)
+		}
+
+		profiles.configs[name] = config
+		profiles.assets[name] = assets
+	}
+
+	if name := tomlConf.Runtime.DefaultProfile; name != "" {
+		if _, ok := profiles.configs[name]; !ok {
+			return runtimeProfiles{}, fmt.Errorf("%v: Unknown default_profile %q", configPath, name)
+		}
+
+		profiles.defaultName = name
+	}
+
+	return profiles, nil
+}
+
+// names returns the sorted names of the profiles.
+func (p runtimeProfiles) names() []string {
+	var names []string
+
+	for name := range p.configs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// selectProfile returns the name and runtime configuration of the profile
+// selected by the annotations of the spec, the default profile being used
+// when there is none.
+func (p runtimeProfiles) selectProfile(ociSpec oci.CompatOCISpec) (string, oci.RuntimeConfig, error) {
+	name := ociSpec.Annotations[profileAnnotation]
+	if name == "" {
+		name = p.defaultName
+	}
+
+	config, ok := p.configs[name]
+	if !ok {
+		return "", oci.RuntimeConfig{}, newRuntimeError(errCodeUsage, "", "",
+			fmt.Errorf("Unknown profile %q selected by annotation %s", name, profileAnnotation))
+	}
+
+	return name, config, nil
+}
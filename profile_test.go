@@ -0,0 +1,202 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testProfilesConfig = `
+	[hypervisor.mock]
+	kernel = "/default/kernel"
+
+	[agent.noop]
+
+	[proxy.noop]
+
+	[shim.noop]
+
+	[profile.batch.hypervisor.mock]
+	kernel = "/batch/kernel"
+	default_vcpus = 1
+	default_memory = 4096
+
+	[profile.fast-boot.hypervisor.mock]
+	kernel = "/fast-boot/kernel"
+	default_memory = 256
+`
+
+func TestRuntimeProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	configPath, err := createConfig("runtime.toml", testProfilesConfig)
+	assert.NoError(err)
+
+	_, _, config, settings, err := loadConfiguration(configPath, true)
+	assert.NoError(err)
+
+	profiles := settings.profiles
+	assert.Equal([]string{"batch", defaultProfile, "fast-boot"}, profiles.names())
+	assert.Equal(defaultProfile, profiles.defaultName)
+	assert.Equal(profiles.configs[defaultProfile], config)
+	assert.Equal("/default/kernel", config.HypervisorConfig.KernelPath)
+
+	batch := profiles.configs["batch"]
+	assert.Equal("/batch/kernel", batch.HypervisorConfig.KernelPath)
+	assert.Equal(vc.Resources{VCPUs: 1, Memory: 4096}, batch.VMConfig)
+
+	// The sections a profile does not have are inherited.
+	assert.Equal(vc.NoopAgentType, batch.AgentType)
+	assert.Equal(vc.NoopProxyType, batch.ProxyType)
+	assert.Equal(vc.NoopShimType, batch.ShimType)
+
+	configPath, err = createConfig("runtime.toml", testProfilesConfig+`
+	[runtime]
+	default_profile = "fast-boot"
+`)
+	assert.NoError(err)
+
+	_, _, config, settings, err = loadConfiguration(configPath, true)
+	assert.NoError(err)
+	assert.Equal("fast-boot", settings.profiles.defaultName)
+	assert.Equal("/fast-boot/kernel", config.HypervisorConfig.KernelPath)
+	assert.Equal(uint(256), config.VMConfig.Memory)
+}
+
+func TestRuntimeProfilesInvalid(t *testing.T) {
+	for _, configData := range []string{
+		// reserved name
+		testProfilesConfig + `
+	[profile.default.hypervisor.mock]
+`,
+		// unknown default profile
+		testProfilesConfig + `
+	[runtime]
+	default_profile = "interactive"
+`,
+		// too many sections in a profile
+		testProfilesConfig + `
+	[profile.batch.proxy.cc]
+
+	[profile.batch.proxy.noop]
+`,
+		// invalid setting in a profile
+		testProfilesConfig + `
+	[profile.small.hypervisor.mock]
+	default_memory = -1
+`,
+	} {
+		configPath, err := createConfig("runtime.toml", configData)
+		assert.NoError(t, err)
+
+		_, _, _, _, err = loadConfiguration(configPath, true)
+		assert.Error(t, err, "configuration %q", configData)
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	profiles := runtimeProfiles{
+		configs: map[string]oci.RuntimeConfig{
+			defaultProfile: {HypervisorType: vc.QemuHypervisor},
+			"batch":        {HypervisorType: vc.MockHypervisor},
+		},
+		defaultName: defaultProfile,
+	}
+
+	ociSpec := oci.CompatOCISpec{}
+
+	name, config, err := profiles.selectProfile(ociSpec)
+	assert.NoError(err)
+	assert.Equal(defaultProfile, name)
+	assert.Equal(vc.QemuHypervisor, config.HypervisorType)
+
+	ociSpec.Spec = specs.Spec{
+		Annotations: map[string]string{profileAnnotation: "batch"},
+	}
+
+	name, config, err = profiles.selectProfile(ociSpec)
+	assert.NoError(err)
+	assert.Equal("batch", name)
+	assert.Equal(vc.MockHypervisor, config.HypervisorType)
+
+	ociSpec.Annotations[profileAnnotation] = "interactive"
+
+	_, _, err = profiles.selectProfile(ociSpec)
+	assert.Error(err)
+	assert.Equal(errCodeUsage, classifyError(err).code)
+}
+
+func TestBundleShimType(t *testing.T) {
+	assert := assert.New(t)
+
+	profiles := runtimeProfiles{
+		configs: map[string]oci.RuntimeConfig{
+			defaultProfile: {ShimType: vc.CCShimType},
+			"batch":        {ShimType: vc.NoopShimType},
+		},
+		defaultName: defaultProfile,
+	}
+
+	bundlePath, err := ioutil.TempDir(testDir, "bundle-")
+	assert.NoError(err)
+	defer os.RemoveAll(bundlePath)
+
+	configPath := filepath.Join(bundlePath, specConfig)
+
+	for annotations, expected := range map[string]vc.ShimType{
+		`{}`:                                     vc.CCShimType,
+		`{"` + profileAnnotation + `": "batch"}`: vc.NoopShimType,
+	} {
+		data := []byte(`{"annotations": ` + annotations + `}`)
+		assert.NoError(ioutil.WriteFile(configPath, data, testFileMode))
+
+		shimType, err := bundleShimType(profiles, bundlePath)
+		assert.NoError(err)
+		assert.Equal(expected, shimType, annotations)
+	}
+
+	// A missing bundle is left to the creation of the container.
+	shimType, err := bundleShimType(profiles, "")
+	assert.NoError(err)
+	assert.Equal(vc.ShimType(""), shimType)
+}
+
+func TestGetProfileInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	configPath, err := createConfig("runtime.toml", testProfilesConfig)
+	assert.NoError(err)
+
+	_, _, _, settings, err := loadConfiguration(configPath, true)
+	assert.NoError(err)
+
+	info, err := getProfileInfo(settings.profiles.configs["batch"], settings.profiles.assets["batch"])
+	assert.NoError(err)
+
+	assert.Equal("/batch/kernel", info.Kernel.Path)
+	assert.Equal(uint(1), info.Hypervisor.DefaultVCPUs)
+	assert.Equal(uint(4096), info.Hypervisor.DefaultMemory)
+	assert.Equal(string(vc.NoopShimType), info.Shim.Type)
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+)
+
+// defaultReclaimIdlePeriod is how long a pod must have had no lifecycle
+// command run on it to be idle, unless configured otherwise.
+const defaultReclaimIdlePeriod = 10 * time.Minute
+
+// memoryReclaim configures how cc-reclaim shrinks the guests of the idle
+// pods.
+type memoryReclaim struct {
+	IdlePeriod string `toml:"idle_period"`
+}
+
+// reclaimPolicy decides which pods are idle. Only the pods which opted in
+// with a memory target annotation are shrunk, to that target: being idle
+// is a guess from the runtime invocations, which a busy workload running
+// on its own does not make.
+type reclaimPolicy struct {
+	// idlePeriod is how long a pod must have had no lifecycle command
+	// run on it to be idle.
+	idlePeriod time.Duration
+}
+
+func newReclaimPolicy(r runtime) (reclaimPolicy, error) {
+	reclaim := r.MemoryReclaim
+
+	policy := reclaimPolicy{
+		idlePeriod: defaultReclaimIdlePeriod,
+	}
+
+	if reclaim.IdlePeriod != "" {
+		idlePeriod, err := time.ParseDuration(reclaim.IdlePeriod)
+		if err != nil {
+			return reclaimPolicy{}, fmt.Errorf("Invalid memory_reclaim idle_period %q: %v", reclaim.IdlePeriod, err)
+		}
+
+		if idlePeriod <= 0 {
+			return reclaimPolicy{}, fmt.Errorf("Invalid memory_reclaim idle_period %q: must be positive", reclaim.IdlePeriod)
+		}
+
+		policy.idlePeriod = idlePeriod
+	}
+
+	return policy, nil
+}
+
+// podTarget returns the memory in MiB left to the guest of the pod when it
+// is idle, from its memory target annotation, 0 meaning its memory is not
+// reclaimed.
+func podTarget(pod vc.PodStatus) uint {
+	value := pod.Annotations[memoryTargetAnnotation]
+	if value == "" {
+		return 0
+	}
+
+	// The annotation was checked when the pod was created.
+	target, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0
+	}
+
+	return uint(target)
+}
+
+// guestMemory returns the memory in MiB the guest of the pod should be
+// left with: its target when it is idle, all the memory of its VM
+// otherwise.
+func (p reclaimPolicy) guestMemory(pod vc.PodStatus, balloon vc.BalloonStatus, idle bool) uint {
+	if !idle {
+		return balloon.Memory
+	}
+
+	target := podTarget(pod)
+	if target == 0 || target > balloon.Memory {
+		return balloon.Memory
+	}
+
+	return target
+}
+
+// activePods returns the IDs of the pods on which a lifecycle command was
+// run since the specified time.
+func activePods(since time.Time) (map[string]bool, error) {
+	records, err := readHistory(historyFilePath, historyFilter{since: since})
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[string]bool)
+	for _, record := range records {
+		if record.PodID != "" {
+			active[record.PodID] = true
+		}
+	}
+
+	return active, nil
+}
+
+// reclaimMemory shrinks the guests of the idle running pods to their
+// target, and gives back all their memory to the guests of the pods
+// which are active again.
+func reclaimMemory(ctx context.Context, policy reclaimPolicy, now time.Time) error {
+	active, err := activePods(now.Add(-policy.idlePeriod))
+	if err != nil {
+		return err
+	}
+
+	pods, err := vc.ListPod(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+
+	for _, pod := range pods {
+		if pod.State.State != vc.StateRunning {
+			continue
+		}
+
+		balloon, err := vc.StatusPodBalloon(ctx, pod.ID)
+		if err != nil {
+			ccLog.Warnf("Failed to query the balloon of pod %s: %v", pod.ID, err)
+			failed++
+			continue
+		}
+
+		memory := policy.guestMemory(pod, balloon, !active[pod.ID])
+		if memory == balloon.Actual {
+			continue
+		}
+
+		if err := vc.ResizePodBalloon(ctx, pod.ID, memory); err != nil {
+			ccLog.Warnf("Failed to resize the balloon of pod %s: %v", pod.ID, err)
+			failed++
+			continue
+		}
+
+		ccLog.Infof("Pod %s: guest memory resized from %dMiB to %dMiB", pod.ID, balloon.Actual, memory)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Failed to reclaim the memory of %d pods", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReclaimPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := newReclaimPolicy(runtime{})
+	assert.NoError(err)
+	assert.Equal(reclaimPolicy{idlePeriod: defaultReclaimIdlePeriod}, policy)
+
+	policy, err = newReclaimPolicy(runtime{
+		MemoryReclaim: memoryReclaim{IdlePeriod: "1h"},
+	})
+	assert.NoError(err)
+	assert.Equal(reclaimPolicy{idlePeriod: time.Hour}, policy)
+
+	for _, reclaim := range []memoryReclaim{
+		{IdlePeriod: "soon"},
+		{IdlePeriod: "0s"},
+		{IdlePeriod: "-1m"},
+	} {
+		_, err := newReclaimPolicy(runtime{MemoryReclaim: reclaim})
+		assert.Error(err, "%+v", reclaim)
+	}
+}
+
+func TestReclaimPolicyGuestMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := reclaimPolicy{idlePeriod: time.Hour}
+	balloon := vc.BalloonStatus{Memory: 2048, Actual: 2048}
+
+	pod := vc.PodStatus{}
+	annotatedPod := vc.PodStatus{
+		Annotations: map[string]string{memoryTargetAnnotation: "512"},
+	}
+	largeTargetPod := vc.PodStatus{
+		Annotations: map[string]string{memoryTargetAnnotation: "4096"},
+	}
+
+	type testData struct {
+		policy   reclaimPolicy
+		pod      vc.PodStatus
+		idle     bool
+		expected uint
+	}
+
+	for _, d := range []testData{
+		// an active pod gets all the memory of its VM back
+		{policy, pod, false, 2048},
+		{policy, annotatedPod, false, 2048},
+
+		// an idle pod is shrunk to its target, if it opted in
+		{policy, pod, true, 2048},
+		{policy, annotatedPod, true, 512},
+
+		// the guest is never given more than the memory of its VM
+		{policy, largeTargetPod, true, 2048},
+	} {
+		assert.Equal(d.expected, d.policy.guestMemory(d.pod, balloon, d.idle), "%+v", d)
+	}
+}
+
+func TestActivePods(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "history-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedHistoryFilePath := historyFilePath
+	historyFilePath = filepath.Join(dir, "history.json")
+	defer func() {
+		historyFilePath = savedHistoryFilePath
+	}()
+
+	now := time.Now().UTC()
+
+	// Without history, all the pods are idle.
+	active, err := activePods(now.Add(-time.Hour))
+	assert.NoError(err)
+	assert.Empty(active)
+
+	for _, record := range []historyRecord{
+		{Time: now.Add(-2 * time.Hour), Command: "create", PodID: "idle"},
+		{Time: now.Add(-2 * time.Hour), Command: "create", PodID: "active"},
+		{Time: now.Add(-time.Minute), Command: "exec", PodID: "active"},
+		{Time: now.Add(-time.Minute), Command: "create"},
+	} {
+		assert.NoError(appendHistory(historyFilePath, record))
+	}
+
+	active, err = activePods(now.Add(-time.Hour))
+	assert.NoError(err)
+	assert.Equal(map[string]bool{"active": true}, active)
+}
@@ -23,7 +23,8 @@ import (
 	"sync"
 	"syscall"
 
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	"github.com/docker/docker/pkg/term"
 	"github.com/urfave/cli"
 )
@@ -66,9 +67,24 @@ var runCommand = cli.Command{
 }
 
 func run(context *cli.Context) error {
-	runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+	settings, ok := context.App.Metadata["runtimeSettings"].(runtimeSettings)
 	if !ok {
-		return errors.New("invalid runtime config")
+		return errors.New("invalid runtime settings")
+	}
+
+	detach := context.Bool("detach")
+
+	// Without shim, there is no process to wait for.
+	if !detach {
+		shimType, err := bundleShimType(settings.profiles, context.String("bundle"))
+		if err != nil {
+			return err
+		}
+
+		if shimType == vc.NoopShimType {
+			return newRuntimeError(errCodeUsage, context.Args().First(), "",
+				errors.New("run requires --detach when the noop shim is configured"))
+		}
 	}
 
 	consolePath := context.String("console")
@@ -92,16 +108,16 @@ func run(context *cli.Context) error {
 		consolePath = console.Path()
 	}
 
-	if err = create(context.Args().First(),
+	ctx, done := operationContext(context, "run")
+
+	if err = create(ctx, context.Args().First(),
 		context.String("bundle"),
 		consolePath,
 		context.String("pid-file"),
-		runtimeConfig); err != nil {
-		return err
+		settings); err != nil {
+		return done(err)
 	}
 
-	detach := context.Bool("detach")
-
 	if !detach && isTerminal(os.Stdout.Fd()) {
 		wg.Add(1)
 		go io.Copy(console, os.Stdin)
@@ -113,43 +129,75 @@ func run(context *cli.Context) error {
 		// Save console state because it will be restored once container ends
 		consoleState, err = term.SetRawTerminal(os.Stdin.Fd())
 		if err != nil {
-			return err
+			return done(err)
 		}
 		defer term.RestoreTerminal(os.Stdin.Fd(), consoleState)
 	}
 
-	pod, err := start(context.Args().First())
+	pod, err := start(ctx, context.Args().First())
+	if err != nil {
+		if ctx.Err() != nil {
+			cleanupContainer(context.Args().First(), settings)
+		}
+
+		return done(err)
+	}
+
+	// The timeout bounds the creation and the start of the container,
+	// not the lifetime of its workload.
+	done(nil)
+
+	if detach {
+		return nil
+	}
+
+	containers := pod.GetAllContainers()
+	if len(containers) == 0 {
+		return fmt.Errorf("There are no containers running in the pod: %s", pod.ID())
+	}
+
+	p, err := os.FindProcess(containers[0].GetPid())
 	if err != nil {
 		return err
 	}
 
-	if !detach {
-		containers := pod.GetAllContainers()
-		if len(containers) == 0 {
-			return fmt.Errorf("There are no containers running in the pod: %s", pod.ID())
-		}
+	ps, err := p.Wait()
+	if err != nil {
+		return fmt.Errorf("Process state %s: %s", ps.String(), err)
+	}
 
-		p, err := os.FindProcess(containers[0].GetPid())
-		if err != nil {
-			return err
-		}
+	// delete container's resources
+	deleteCtx, deleteDone := operationContext(context, "delete")
+	if err = delete(deleteCtx, containers[0].ID(), true, settings); err != nil {
+		return deleteDone(err)
+	}
 
-		ps, err := p.Wait()
-		if err != nil {
-			return fmt.Errorf("Process state %s: %s", ps.String(), err)
-		}
+	deleteDone(nil)
 
-		// delete container's resources
-		if err = delete(containers[0].ID(), true); err != nil {
-			return err
-		}
+	// wait for routines
+	wg.Wait()
 
-		// wait for routines
-		wg.Wait()
+	//runtime should forward container exit code to the system
+	return cli.NewExitError("", ps.Sys().(syscall.WaitStatus).ExitStatus())
+}
 
-		//runtime should forward container exit code to the system
-		return cli.NewExitError("", ps.Sys().(syscall.WaitStatus).ExitStatus())
+// bundleShimType returns the shim type of the profile selected by the spec
+// of the bundle. A missing bundle is reported by the creation of the
+// container.
+func bundleShimType(profiles runtimeProfiles, bundlePath string) (vc.ShimType, error) {
+	if bundlePath == "" {
+		return "", nil
+	}
+
+	ociSpec, err := oci.ParseConfigJSON(bundlePath)
+	if err != nil {
+		return "", err
+	}
+
+	_, runtimeConfig, err := profiles.selectProfile(ociSpec)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	return runtimeConfig.ShimType, nil
 }
@@ -16,10 +16,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
-	vc "github.com/containers/virtcontainers"
-	"github.com/containers/virtcontainers/pkg/oci"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
 )
 
@@ -35,22 +36,25 @@ var startCommand = cli.Command{
 	Action: func(context *cli.Context) error {
 		args := context.Args()
 		if args.Present() == false {
-			return fmt.Errorf("Missing container ID, should at least provide one")
+			return newRuntimeError(errCodeUsage, "", "",
+				fmt.Errorf("Missing container ID, should at least provide one"))
 		}
 
+		ctx, done := operationContext(context, "start")
+
 		for _, cID := range []string(args) {
-			if _, err := start(cID); err != nil {
-				return err
+			if _, err := start(ctx, cID); err != nil {
+				return done(err)
 			}
 		}
 
-		return nil
+		return done(nil)
 	},
 }
 
-func start(containerID string) (*vc.Pod, error) {
+func start(ctx context.Context, containerID string) (*vc.Pod, error) {
 	// Checks the MUST and MUST NOT from OCI runtime specification
-	status, podID, err := getExistingContainerInfo(containerID)
+	status, podID, err := getExistingContainerInfo(ctx, containerID)
 	if err != nil {
 		return nil, err
 	}
@@ -63,10 +67,10 @@ func start(containerID string) (*vc.Pod, error) {
 	}
 
 	if containerType.IsPod() {
-		return vc.StartPod(podID)
+		return vc.StartPod(ctx, podID)
 	}
 
-	c, err := vc.StartContainer(podID, containerID)
+	c, err := vc.StartContainer(ctx, podID, containerID)
 	if err != nil {
 		return nil, err
 	}
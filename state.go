@@ -16,11 +16,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 
-	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
 )
 
@@ -35,16 +36,19 @@ instance of a container.`,
 	Action: func(context *cli.Context) error {
 		args := context.Args()
 		if len(args) != 1 {
-			return fmt.Errorf("Expecting only one container ID, got %d: %v", len(args), []string(args))
+			return newRuntimeError(errCodeUsage, "", "",
+				fmt.Errorf("Expecting only one container ID, got %d: %v", len(args), []string(args)))
 		}
 
-		return state(args.First())
+		ctx, done := operationContext(context, "state")
+
+		return done(state(ctx, args.First()))
 	},
 }
 
-func state(containerID string) error {
+func state(ctx context.Context, containerID string) error {
 	// Checks the MUST and MUST NOT from OCI runtime specification
-	status, podID, err := getExistingContainerInfo(containerID)
+	status, podID, err := getExistingContainerInfo(ctx, containerID)
 	if err != nil {
 		return err
 	}
@@ -56,7 +60,7 @@ func state(containerID string) error {
 	}
 
 	// Update status of process
-	running, err := processRunning(state.Pid)
+	running, err := containerProcessRunning(status)
 	if err != nil {
 		return err
 	}
@@ -64,7 +68,7 @@ func state(containerID string) error {
 	if running == false && state.Status == oci.StateRunning {
 		ccLog.Infof("Setting container state to %q as process %d is not running",
 			oci.StateStopped, state.Pid)
-		if err := stopContainer(podID, status); err != nil {
+		if err := stopContainer(ctx, podID, status); err != nil {
 			return err
 		}
 
@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// defaultSyslogSocket is the socket the syslog daemon usually
+	// listens on.
+	defaultSyslogSocket = "/dev/log"
+
+	// syslogFacility is the facility of the messages, LOG_DAEMON.
+	syslogFacility = 3
+
+	// syslogSDID identifies the structured data holding the log fields,
+	// 343 being the private enterprise number of Intel.
+	syslogSDID = name + "@343"
+
+	// syslogTimeFormat is the RFC5424 timestamp format, which allows
+	// at most microseconds.
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+	// syslogMaxNameLen is the maximum length of the RFC5424 names.
+	syslogMaxNameLen = 32
+)
+
+var syslogParamValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogHook sends the log entries to a syslog daemon, following
+// RFC5424.
+type syslogHook struct {
+	conn     *net.UnixConn
+	hostname string
+}
+
+func newSyslogHook(socketPath string) (*syslogHook, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &syslogHook{
+		conn:     conn,
+		hostname: hostname,
+	}, nil
+}
+
+// syslogName returns a valid RFC5424 name, made of at most 32 printable
+// ASCII characters other than '=', ' ', ']' and '"'.
+func syslogName(s string) string {
+	var b bytes.Buffer
+
+	for _, r := range s {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			r = '_'
+		}
+
+		b.WriteRune(r)
+	}
+
+	if b.Len() > syslogMaxNameLen {
+		b.Truncate(syslogMaxNameLen)
+	}
+
+	return b.String()
+}
+
+// syslogMessage returns the RFC5424 message describing the entry. The
+// fields of the entry are its structured data, and the command is its
+// message ID.
+func syslogMessage(entry *logrus.Entry, hostname string) []byte {
+	msgID := "-"
+	if command, ok := entry.Data[logFieldCommand].(string); ok && command != "" {
+		msgID = syslogName(command)
+	}
+
+	structuredData := "-"
+	if len(entry.Data) > 0 {
+		var keys []string
+		for key := range entry.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var b bytes.Buffer
+
+		b.WriteString("[" + syslogSDID)
+		for _, key := range keys {
+			value := syslogParamValueEscaper.Replace(fmt.Sprint(entry.Data[key]))
+			fmt.Fprintf(&b, ` %s="%s"`, syslogName(key), value)
+		}
+		b.WriteString("]")
+
+		structuredData = b.String()
+	}
+
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		syslogFacility*8+syslogPriorities[entry.Level],
+		entry.Time.Format(syslogTimeFormat),
+		hostname,
+		name,
+		os.Getpid(),
+		msgID,
+		structuredData,
+		entry.Message))
+}
+
+// Levels informs the logrus Logger which log levels this hook supports.
+func (hook *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire is called by the logrus logger when data is available for the
+// hook.
+func (hook *syslogHook) Fire(entry *logrus.Entry) error {
+	_, err := hook.conn.Write(syslogMessage(entry, hook.hostname))
+	return err
+}
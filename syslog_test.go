@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestSyslogName(t *testing.T) {
+	for s, expected := range map[string]string{
+		"containerID":                          "containerID",
+		"a=b c]d\"e":                           "a_b_c_d_e",
+		"abcdefghijklmnopqrstuvwxyz0123456789": "abcdefghijklmnopqrstuvwxyz012345",
+	} {
+		if n := syslogName(s); n != expected {
+			t.Fatalf("expected syslog name %q for %q, got %q", expected, s, n)
+		}
+	}
+}
+
+func TestSyslogMessage(t *testing.T) {
+	entry := &logrus.Entry{
+		Time:    time.Date(2017, 10, 18, 10, 2, 3, 4000, time.UTC),
+		Level:   logrus.WarnLevel,
+		Message: "syslog entry",
+		Data: logrus.Fields{
+			logFieldCommand:     "create",
+			logFieldContainerID: "foo",
+			"reason":            `a "quoted" \ value]`,
+		},
+	}
+
+	expected := fmt.Sprintf(`<28>1 2017-10-18T10:02:03.000004Z host %s %d create `+
+		`[%s command="create" containerID="foo" reason="a \"quoted\" \\ value\]"] syslog entry`,
+		name, os.Getpid(), syslogSDID)
+
+	if message := string(syslogMessage(entry, "host")); message != expected {
+		t.Fatalf("expected syslog message %q, got %q", expected, message)
+	}
+
+	// Without fields, the message ID and structured data are nil.
+	entry.Data = logrus.Fields{}
+
+	expected = fmt.Sprintf(`<28>1 2017-10-18T10:02:03.000004Z host %s %d - - syslog entry`, name, os.Getpid())
+
+	if message := string(syslogMessage(entry, "host")); message != expected {
+		t.Fatalf("expected syslog message %q, got %q", expected, message)
+	}
+}
+
+func TestSyslogHook(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	defer resetLogFields()
+
+	socketPath := path.Join(tmpdir, "syslog.sock")
+	syslogd := listenUnixgram(t, socketPath)
+	defer syslogd.Close()
+
+	sinks := logSinks{syslog: true, syslogSocket: socketPath}
+
+	savedLogger := ccLog
+	ccLog = logrus.New()
+	ccLog.Out = ioutil.Discard
+	ccLog.Hooks.Add(ccLogFields)
+	defer func() {
+		ccLog = savedLogger
+	}()
+
+	if err := handleLogSinks("", sinks, testGlobalLogRotation); err != nil {
+		t.Fatal(err)
+	}
+
+	setLogField(logFieldCommand, "start")
+	setLogField(logFieldPodID, "bar")
+
+	ccLog.Info("syslog entry")
+
+	pattern := fmt.Sprintf(`^<30>1 \S+ \S+ %s %d start \[%s command="start" podID="bar"\] syslog entry$`,
+		regexp.QuoteMeta(name), os.Getpid(), regexp.QuoteMeta(syslogSDID))
+
+	message := string(readDatagram(t, syslogd))
+	if !regexp.MustCompile(pattern).MatchString(message) {
+		t.Fatalf("syslog message %q does not match %q", message, pattern)
+	}
+}
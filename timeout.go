@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// cleanupTimeout bounds the removal of the state left behind by an
+// operation which timed out.
+const cleanupTimeout = 10 * time.Second
+
+// timeoutOperations lists the operations which can be given a timeout
+// in the configuration file.
+var timeoutOperations = map[string]bool{
+	"create": true,
+	"delete": true,
+	"exec":   true,
+	"kill":   true,
+	"list":   true,
+	"pause":  true,
+	"resume": true,
+	"run":    true,
+	"start":  true,
+	"state":  true,
+}
+
+// operationTimeout returns the maximum duration of the operation, zero
+// meaning it is not bounded. The "--cc-timeout" global option takes
+// priority over the timeouts of the configuration file.
+func operationTimeout(c *cli.Context, operation string) time.Duration {
+	if timeout := c.GlobalDuration("cc-timeout"); timeout > 0 {
+		return timeout
+	}
+
+	settings, ok := c.App.Metadata["runtimeSettings"].(runtimeSettings)
+	if !ok {
+		return 0
+	}
+
+	return settings.timeouts[operation]
+}
+
+// operationContext returns the context bounding the operation, along with
+// the function to call with the result of the operation. That function
+// releases the context and reports a timeout in the returned error.
+func operationContext(c *cli.Context, operation string) (context.Context, func(error) error) {
+	timeout := operationTimeout(c, operation)
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(traceContext(c), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(traceContext(c))
+	}
+
+	done := func(err error) error {
+		defer cancel()
+
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			e := classifyError(err)
+			return newRuntimeError(errCodeTimeout, e.containerID, e.podID,
+				fmt.Errorf("%s timed out after %v: %v", operation, timeout, err))
+		}
+
+		return err
+	}
+
+	return ctx, done
+}
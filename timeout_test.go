@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func newTimeoutContext(t *testing.T, globalTimeout string, timeouts map[string]time.Duration) *cli.Context {
+	app := cli.NewApp()
+	app.Metadata = map[string]interface{}{
+		"runtimeSettings": runtimeSettings{timeouts: timeouts},
+	}
+
+	set := flag.NewFlagSet("", 0)
+	set.Duration("cc-timeout", 0, "")
+	if globalTimeout != "" {
+		assert.NoError(t, set.Parse([]string{"--cc-timeout", globalTimeout}))
+	}
+
+	global := cli.NewContext(app, set, nil)
+
+	return cli.NewContext(app, flag.NewFlagSet("", 0), global)
+}
+
+func TestOperationTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	timeouts := map[string]time.Duration{
+		"create": time.Minute,
+	}
+
+	c := newTimeoutContext(t, "", timeouts)
+	assert.Equal(time.Minute, operationTimeout(c, "create"))
+	assert.Equal(time.Duration(0), operationTimeout(c, "start"))
+
+	// The global option takes priority over the configuration file.
+	c = newTimeoutContext(t, "5s", timeouts)
+	assert.Equal(5*time.Second, operationTimeout(c, "create"))
+	assert.Equal(5*time.Second, operationTimeout(c, "start"))
+
+	c = cli.NewContext(cli.NewApp(), flag.NewFlagSet("", 0), nil)
+	assert.Equal(time.Duration(0), operationTimeout(c, "create"))
+}
+
+func TestOperationContext(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTimeoutContext(t, "", nil)
+
+	ctx, done := operationContext(c, "start")
+	_, ok := ctx.Deadline()
+	assert.False(ok)
+
+	err := errors.New("failed")
+	assert.Equal(err, done(err))
+	assert.Error(ctx.Err(), "context must be released")
+
+	c = newTimeoutContext(t, "10ms", nil)
+
+	ctx, done = operationContext(c, "start")
+	_, ok = ctx.Deadline()
+	assert.True(ok)
+
+	<-ctx.Done()
+
+	err = done(ctx.Err())
+	assert.Error(err)
+	assert.Contains(err.Error(), "start timed out after 10ms")
+	assert.Equal(errCodeTimeout, classifyError(err).code)
+
+	assert.NoError(done(nil))
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
+	"github.com/urfave/cli"
+)
+
+const (
+	// traceFileMode is the mode used to create the trace file.
+	traceFileMode = os.FileMode(0640)
+
+	// traceExportTimeout bounds the delivery of a trace to a collector.
+	traceExportTimeout = 5 * time.Second
+
+	// zipkinSpansPath is the collector endpoint accepting Zipkin v2
+	// spans.
+	zipkinSpansPath = "/api/v2/spans"
+
+	// loadConfigurationSpan is the name of the span timing the parsing
+	// of the configuration file.
+	loadConfigurationSpan = "loadConfiguration"
+)
+
+// traceDestination returns where the traces are exported, an empty
+// string meaning tracing is disabled. The "--cc-trace" global option
+// takes priority over the configuration file.
+func traceDestination(c *cli.Context, settings runtimeSettings) string {
+	if destination := c.GlobalString("cc-trace"); destination != "" {
+		return destination
+	}
+
+	return settings.trace
+}
+
+// startTrace returns the context carrying the root span of the command.
+// The root span begins when the runtime started, start, and the
+// configuration was loaded since then. The spans are recorded even when
+// tracing is disabled as the metrics are derived from them.
+func startTrace(c *cli.Context, start time.Time) context.Context {
+	ctx := trace.ContextWithTracer(context.Background(), trace.NewTracer(name))
+
+	_, ctx = trace.StartSpanAt(ctx, c.Args().First(), start)
+
+	span, _ := trace.StartSpanAt(ctx, loadConfigurationSpan, start)
+	span.Finish()
+
+	return ctx
+}
+
+// traceContext returns the context carrying the root span of the
+// command, if any.
+func traceContext(c *cli.Context) context.Context {
+	if ctx, ok := c.App.Metadata["traceContext"].(context.Context); ok {
+		return ctx
+	}
+
+	return context.Background()
+}
+
+// traceCommands wraps the action of the commands so that the root span
+// is finished with the outcome of the command and, when tracing is
+// enabled, the trace is exported.
+func traceCommands(commands []cli.Command) []cli.Command {
+	for i, command := range commands {
+		action := command.Action
+		commandName := command.Name
+
+		commands[i].Action = func(context *cli.Context) error {
+			span := trace.SpanFromContext(traceContext(context))
+			if span == nil {
+				return cli.HandleAction(action, context)
+			}
+
+			span.SetTag(trace.TagContainerID, context.Args().First())
+
+			err := cli.HandleAction(action, context)
+
+			// "run" returns the exit code of the workload as an
+			// error without a message, which is not recorded.
+			span.SetError(err).Finish()
+
+			settings, _ := context.App.Metadata["runtimeSettings"].(runtimeSettings)
+
+			destination := traceDestination(context, settings)
+			if destination == "" {
+				return err
+			}
+
+			if traceErr := exportTrace(traceContext(context), destination); traceErr != nil {
+				ccLog.Warnf("Failed to export the trace of %q: %v", commandName, traceErr)
+			}
+
+			return err
+		}
+	}
+
+	return commands
+}
+
+// exportTrace sends the finished spans of the trace carried by ctx to
+// the destination, which is either the URL of a collector accepting
+// Zipkin v2 spans, "unix://" followed by the path of the socket of a
+// local collector, or a file path. A file receives one JSON array of
+// spans per command.
+func exportTrace(ctx context.Context, destination string) error {
+	tracer := trace.TracerFromContext(ctx)
+	if tracer == nil {
+		return nil
+	}
+
+	data, err := tracer.Export()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case strings.HasPrefix(destination, "http://"), strings.HasPrefix(destination, "https://"):
+		spansURL, err := collectorSpansURL(destination)
+		if err != nil {
+			return err
+		}
+
+		return postTrace(&http.Client{}, spansURL, data)
+	case strings.HasPrefix(destination, "unix://"):
+		spansURL, err := collectorSpansURL("http://localhost")
+		if err != nil {
+			return err
+		}
+
+		return postTrace(unixSocketClient(strings.TrimPrefix(destination, "unix://")), spansURL, data)
+	default:
+		return appendTrace(destination, data)
+	}
+}
+
+// collectorSpansURL returns the URL the spans are posted to for the
+// collector URL, the Zipkin v2 endpoint being used unless the collector
+// URL has a path.
+func collectorSpansURL(collector string) (string, error) {
+	u, err := url.Parse(collector)
+	if err != nil {
+		return "", fmt.Errorf("invalid trace collector %q: %v", collector, err)
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = zipkinSpansPath
+	}
+
+	return u.String(), nil
+}
+
+// unixSocketClient returns an HTTP client connecting to the unix socket
+// path whatever the host of the URL.
+func unixSocketClient(path string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+// postTrace sends the spans to the collector listening on url.
+func postTrace(client *http.Client, url string, data []byte) error {
+	client.Timeout = traceExportTimeout
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector %s replied %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+// appendTrace adds the spans to the trace file, one JSON array per
+// line. The file is locked as several runtime instances can trace
+// concurrently.
+func appendTrace(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, traceFileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(data, '\n'))
+
+	return err
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+// newTraceContext returns the context of the command invoked by args,
+// as set up by beforeSubcommands.
+func newTraceContext(t *testing.T, globalTrace string, settings runtimeSettings, args ...string) *cli.Context {
+	app := cli.NewApp()
+
+	set := flag.NewFlagSet("", 0)
+	set.String("cc-trace", "", "")
+
+	if globalTrace != "" {
+		args = append([]string{"--cc-trace", globalTrace}, args...)
+	}
+	assert.NoError(t, set.Parse(args))
+
+	global := cli.NewContext(app, set, nil)
+
+	app.Metadata = map[string]interface{}{
+		"runtimeSettings": settings,
+		"traceContext":    startTrace(global, time.Now()),
+	}
+
+	commandSet := flag.NewFlagSet("", 0)
+	assert.NoError(t, commandSet.Parse(set.Args()[1:]))
+
+	return cli.NewContext(app, commandSet, global)
+}
+
+// runTracedCommand runs the action through the tracing wrapper, the
+// action starting one span of its own.
+func runTracedCommand(c *cli.Context, name string, actionErr error) error {
+	commands := traceCommands([]cli.Command{
+		{
+			Name: name,
+			Action: func(context *cli.Context) error {
+				ctx, done := operationContext(context, name)
+
+				span, _ := trace.StartSpan(ctx, "action")
+				span.Finish()
+
+				return done(actionErr)
+			},
+		},
+	})
+
+	return commands[0].Action.(func(*cli.Context) error)(c)
+}
+
+func readTraceFile(t *testing.T, path string) [][]trace.Span {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+
+	var traces [][]trace.Span
+
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var spans []trace.Span
+		assert.NoError(t, json.Unmarshal([]byte(line), &spans))
+		traces = append(traces, spans)
+	}
+
+	return traces
+}
+
+func TestTraceDestination(t *testing.T) {
+	assert := assert.New(t)
+
+	settings := runtimeSettings{trace: "/config/trace"}
+
+	c := newTraceContext(t, "", runtimeSettings{}, "create", "foo")
+	assert.Equal("", traceDestination(c, runtimeSettings{}))
+
+	c = newTraceContext(t, "", settings, "create", "foo")
+	assert.Equal("/config/trace", traceDestination(c, settings))
+
+	// The global option takes priority over the configuration file.
+	c = newTraceContext(t, "/flag/trace", settings, "create", "foo")
+	assert.Equal("/flag/trace", traceDestination(c, settings))
+
+	c = cli.NewContext(cli.NewApp(), flag.NewFlagSet("", 0), nil)
+	assert.Equal(context.Background(), traceContext(c))
+}
+
+func TestTraceCommandsDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTraceContext(t, "", runtimeSettings{}, "create", "foo")
+	assert.NoError(runTracedCommand(c, "create", nil))
+
+	// The spans are recorded, for the metrics, even though they are
+	// not exported.
+	spans := trace.TracerFromContext(traceContext(c)).Spans()
+	assert.Len(spans, 3)
+	assert.Equal("create", spans[0].Name)
+}
+
+func TestTraceCommandsFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "trace")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "trace.json")
+
+	c := newTraceContext(t, path, runtimeSettings{}, "create", "foo")
+	assert.NoError(runTracedCommand(c, "create", nil))
+
+	c = newTraceContext(t, "", runtimeSettings{trace: path}, "delete", "bar")
+	actionErr := errors.New("failure")
+	assert.Equal(actionErr, runTracedCommand(c, "delete", actionErr))
+
+	traces := readTraceFile(t, path)
+	assert.Len(traces, 2)
+
+	for i, command := range []string{"create", "delete"} {
+		spans := traces[i]
+		assert.Len(spans, 3)
+
+		root := spans[0]
+		assert.Equal(command, root.Name)
+		assert.Empty(root.ParentID)
+		assert.Equal(name, root.LocalEndpoint.ServiceName)
+
+		assert.Equal(loadConfigurationSpan, spans[1].Name)
+		assert.Equal("action", spans[2].Name)
+
+		for _, span := range spans[1:] {
+			assert.Equal(root.TraceID, span.TraceID)
+			assert.Equal(root.ID, span.ParentID)
+		}
+	}
+
+	assert.Equal("foo", traces[0][0].Tags[trace.TagContainerID])
+	assert.Empty(traces[0][0].Tags[trace.TagError])
+	assert.Equal("bar", traces[1][0].Tags[trace.TagContainerID])
+	assert.Equal("failure", traces[1][0].Tags[trace.TagError])
+	assert.NotEqual(traces[0][0].TraceID, traces[1][0].TraceID)
+}
+
+func TestTraceCommandsExportFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	// Failing to export the trace must not fail the command.
+	c := newTraceContext(t, "/nonexistent/dir/trace.json", runtimeSettings{}, "create", "foo")
+	assert.NoError(runTracedCommand(c, "create", nil))
+}
+
+func TestExportTraceCollector(t *testing.T) {
+	assert := assert.New(t)
+
+	var received []trace.Span
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(zipkinSpansPath, r.URL.Path)
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+		assert.NoError(json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	ctx := trace.ContextWithTracer(context.Background(), trace.NewTracer(name))
+	span, ctx := trace.StartSpan(ctx, "create")
+	span.Finish()
+
+	// HTTP collector.
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	assert.NoError(exportTrace(ctx, server.URL+zipkinSpansPath))
+	assert.Len(received, 1)
+	assert.Equal("create", received[0].Name)
+
+	// A bare collector URL gets the Zipkin v2 endpoint.
+	for _, collector := range []string{server.URL, server.URL + "/"} {
+		received = nil
+		assert.NoError(exportTrace(ctx, collector))
+		assert.Len(received, 1, collector)
+	}
+
+	// Local collector socket.
+	dir, err := ioutil.TempDir("", "trace")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "collector.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(err)
+
+	unixServer := httptest.NewUnstartedServer(handler)
+	unixServer.Listener = listener
+	unixServer.Start()
+	defer unixServer.Close()
+
+	received = nil
+	assert.NoError(exportTrace(ctx, "unix://"+socket))
+	assert.Len(received, 1)
+
+	// Collector errors are reported.
+	failing := httptest.NewServer(http.NotFoundHandler())
+	defer failing.Close()
+
+	assert.Error(exportTrace(ctx, failing.URL+zipkinSpansPath))
+
+	// Nothing is exported without a tracer.
+	assert.NoError(exportTrace(context.Background(), failing.URL))
+}
@@ -139,4 +139,8 @@ type agent interface {
 	// container related to a Pod. If all is true, all processes in
 	// the container will be sent the signal.
 	killContainer(pod Pod, c Container, signal syscall.Signal, all bool) error
+
+	// onlineCPUMem will tell the agent to online the vCPUs and memory
+	// hotplugged to the VM.
+	onlineCPUMem() error
 }
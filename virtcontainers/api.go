@@ -17,11 +17,13 @@
 package virtcontainers
 
 import (
+	"context"
 	"os"
 	"runtime"
 	"syscall"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
 )
 
 func init() {
@@ -37,13 +39,42 @@ func SetLogger(logger logrus.FieldLogger) {
 
 // CreatePod is the virtcontainers pod creation entry point.
 // CreatePod creates a pod and its containers. It does not start them.
-func CreatePod(podConfig PodConfig) (*Pod, error) {
+// When it fails, including because ctx expired, the partially created
+// pod is removed.
+func CreatePod(ctx context.Context, podConfig PodConfig) (*Pod, error) {
+	span, ctx := trace.StartSpan(ctx, "CreatePod")
+	span.SetTag(trace.TagPodID, podConfig.ID)
+	defer span.Finish()
+
 	// Create the pod.
-	p, err := createPod(podConfig)
+	p, err := createPod(ctx, podConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pod resources exist from now on: hide the pod from the other
+	// processes until it is fully created.
+	lockFile, err := lockPod(ctx, p.id)
 	if err != nil {
+		p.storage.deletePodResources(p.id, nil)
+		return nil, err
+	}
+	defer unlockPod(lockFile)
+
+	if err = markPodCreating(p.id); err != nil {
+		p.storage.deletePodResources(p.id, nil)
 		return nil, err
 	}
 
+	var networkNS NetworkNamespace
+	var creation podCreation
+
+	defer func() {
+		if err != nil {
+			p.rollbackCreate(creation)
+		}
+	}()
+
 	// Store it.
 	err = p.storePod()
 	if err != nil {
@@ -51,24 +82,25 @@ func CreatePod(podConfig PodConfig) (*Pod, error) {
 	}
 
 	// Initialize the network.
-	netNsPath, netNsCreated, err := p.network.init(p.config.NetworkConfig)
+	creation.netNsPath, creation.netNsCreated, err = p.network.init(p.config.NetworkConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	// Execute prestart hooks inside netns
-	err = p.network.run(netNsPath, func() error {
-		return p.config.Hooks.preStartHooks()
+	err = p.network.run(creation.netNsPath, func() error {
+		return p.config.Hooks.preStartHooks(ctx)
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	// Add the network
-	networkNS, err := p.network.add(*p, p.config.NetworkConfig, netNsPath, netNsCreated)
+	networkNS, err = p.network.add(*p, p.config.NetworkConfig, creation.netNsPath, creation.netNsCreated)
 	if err != nil {
 		return nil, err
 	}
+	creation.networkNS = &networkNS
 
 	// Store the network
 	err = p.storage.storePodNetwork(p.id, networkNS)
@@ -77,34 +109,43 @@ func CreatePod(podConfig PodConfig) (*Pod, error) {
 	}
 
 	// Start the VM
-	err = p.startVM(netNsPath)
+	err = p.startVM(creation.netNsPath)
 	if err != nil {
 		return nil, err
 	}
+	creation.vmStarted = true
 
 	// Start shims
-	if err := p.startShims(); err != nil {
+	creation.shimsStarting = true
+	err = p.startShims()
+	if err != nil {
 		return nil, err
 	}
 
+	unmarkPodCreating(p.id)
+
 	return p, nil
 }
 
 // DeletePod is the virtcontainers pod deletion entry point.
 // DeletePod will stop an already running container and then delete it.
-func DeletePod(podID string) (*Pod, error) {
+func DeletePod(ctx context.Context, podID string) (*Pod, error) {
+	span, ctx := trace.StartSpan(ctx, "DeletePod")
+	span.SetTag(trace.TagPodID, podID)
+	defer span.Finish()
+
 	if podID == "" {
 		return nil, errNeedPodID
 	}
 
-	lockFile, err := lockPod(podID)
+	lockFile, err := lockPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
 	defer unlockPod(lockFile)
 
 	// Fetch the pod from storage and create it.
-	p, err := fetchPod(podID)
+	p, err := fetchPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
@@ -140,7 +181,7 @@ func DeletePod(podID string) (*Pod, error) {
 	}
 
 	// Execute poststop hooks.
-	if err := p.config.Hooks.postStopHooks(); err != nil {
+	if err := p.config.Hooks.postStopHooks(ctx); err != nil {
 		return nil, err
 	}
 
@@ -151,19 +192,23 @@ func DeletePod(podID string) (*Pod, error) {
 // StartPod will talk to the given hypervisor to start an existing
 // pod and all its containers.
 // It returns the pod ID.
-func StartPod(podID string) (*Pod, error) {
+func StartPod(ctx context.Context, podID string) (*Pod, error) {
+	span, ctx := trace.StartSpan(ctx, "StartPod")
+	span.SetTag(trace.TagPodID, podID)
+	defer span.Finish()
+
 	if podID == "" {
 		return nil, errNeedPodID
 	}
 
-	lockFile, err := lockPod(podID)
+	lockFile, err := lockPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
 	defer unlockPod(lockFile)
 
 	// Fetch the pod from storage and create it.
-	p, err := fetchPod(podID)
+	p, err := fetchPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
@@ -175,7 +220,7 @@ func StartPod(podID string) (*Pod, error) {
 	}
 
 	// Execute poststart hooks.
-	if err := p.config.Hooks.postStartHooks(); err != nil {
+	if err := p.config.Hooks.postStartHooks(ctx); err != nil {
 		return nil, err
 	}
 
@@ -184,19 +229,23 @@ func StartPod(podID string) (*Pod, error) {
 
 // StopPod is the virtcontainers pod stopping entry point.
 // StopPod will talk to the given agent to stop an existing pod and destroy all containers within that pod.
-func StopPod(podID string) (*Pod, error) {
+func StopPod(ctx context.Context, podID string) (*Pod, error) {
+	span, ctx := trace.StartSpan(ctx, "StopPod")
+	span.SetTag(trace.TagPodID, podID)
+	defer span.Finish()
+
 	if podID == "" {
 		return nil, errNeedPod
 	}
 
-	lockFile, err := lockPod(podID)
+	lockFile, err := lockPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
 	defer unlockPod(lockFile)
 
 	// Fetch the pod from storage and create it.
-	p, err := fetchPod(podID)
+	p, err := fetchPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
@@ -213,44 +262,69 @@ func StopPod(podID string) (*Pod, error) {
 
 // RunPod is the virtcontainers pod running entry point.
 // RunPod creates a pod and its containers and then it starts them.
-func RunPod(podConfig PodConfig) (*Pod, error) {
+// When it fails before the pod is started, including because ctx
+// expired, the partially created pod is removed.
+func RunPod(ctx context.Context, podConfig PodConfig) (*Pod, error) {
+	span, ctx := trace.StartSpan(ctx, "RunPod")
+	span.SetTag(trace.TagPodID, podConfig.ID)
+	defer span.Finish()
+
 	// Create the pod.
-	p, err := createPod(podConfig)
+	p, err := createPod(ctx, podConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	// Store it.
-	err = p.storePod()
+	// The pod resources exist from now on: hide the pod from the other
+	// processes until it is fully created.
+	lockFile, err := lockPod(ctx, p.id)
 	if err != nil {
+		p.storage.deletePodResources(p.id, nil)
+		return nil, err
+	}
+	defer unlockPod(lockFile)
+
+	if err = markPodCreating(p.id); err != nil {
+		p.storage.deletePodResources(p.id, nil)
 		return nil, err
 	}
 
-	lockFile, err := lockPod(p.id)
+	var networkNS NetworkNamespace
+	var creation podCreation
+	created := false
+
+	defer func() {
+		if err != nil && !created {
+			p.rollbackCreate(creation)
+		}
+	}()
+
+	// Store it.
+	err = p.storePod()
 	if err != nil {
 		return nil, err
 	}
-	defer unlockPod(lockFile)
 
 	// Initialize the network.
-	netNsPath, netNsCreated, err := p.network.init(p.config.NetworkConfig)
+	creation.netNsPath, creation.netNsCreated, err = p.network.init(p.config.NetworkConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	// Execute prestart hooks inside netns
-	err = p.network.run(netNsPath, func() error {
-		return p.config.Hooks.preStartHooks()
+	err = p.network.run(creation.netNsPath, func() error {
+		return p.config.Hooks.preStartHooks(ctx)
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	// Add the network
-	networkNS, err := p.network.add(*p, p.config.NetworkConfig, netNsPath, netNsCreated)
+	networkNS, err = p.network.add(*p, p.config.NetworkConfig, creation.netNsPath, creation.netNsCreated)
 	if err != nil {
 		return nil, err
 	}
+	creation.networkNS = &networkNS
 
 	// Store the network
 	err = p.storage.storePodNetwork(p.id, networkNS)
@@ -259,15 +333,20 @@ func RunPod(podConfig PodConfig) (*Pod, error) {
 	}
 
 	// Start the VM
-	err = p.startVM(netNsPath)
+	err = p.startVM(creation.netNsPath)
 	if err != nil {
 		return nil, err
 	}
+	creation.vmStarted = true
 
 	// Start shims
-	if err := p.startShims(); err != nil {
+	creation.shimsStarting = true
+	err = p.startShims()
+	if err != nil {
 		return nil, err
 	}
+	created = true
+	unmarkPodCreating(p.id)
 
 	// Start the pod
 	err = p.start()
@@ -278,7 +357,7 @@ func RunPod(podConfig PodConfig) (*Pod, error) {
 
 	// Execute poststart hooks inside netns
 	err = p.network.run(networkNS.NetNsPath, func() error {
-		return p.config.Hooks.postStartHooks()
+		return p.config.Hooks.postStartHooks(ctx)
 	})
 	if err != nil {
 		return nil, err
@@ -288,7 +367,10 @@ func RunPod(podConfig PodConfig) (*Pod, error) {
 }
 
 // ListPod is the virtcontainers pod listing entry point.
-func ListPod() ([]PodStatus, error) {
+func ListPod(ctx context.Context) ([]PodStatus, error) {
+	span, ctx := trace.StartSpan(ctx, "ListPod")
+	defer span.Finish()
+
 	dir, err := os.Open(configStoragePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -308,8 +390,21 @@ func ListPod() ([]PodStatus, error) {
 	var podStatusList []PodStatus
 
 	for _, podID := range podsID {
-		podStatus, err := StatusPod(podID)
+		// The pods being created do not exist yet for the
+		// callers.
+		if isPodBeingCreated(podID) {
+			continue
+		}
+
+		podStatus, err := StatusPod(ctx, podID)
 		if err != nil {
+			// Listing is read-only: a pod whose resources cannot
+			// be decoded is only reported, QuarantinePod() is
+			// meant to move it away.
+			if isCorruptResource(err) {
+				virtLog.Warnf("Skipping corrupted pod %s: %s", podID, err)
+			}
+
 			continue
 		}
 
@@ -320,12 +415,22 @@ func ListPod() ([]PodStatus, error) {
 }
 
 // StatusPod is the virtcontainers pod status entry point.
-func StatusPod(podID string) (PodStatus, error) {
+func StatusPod(ctx context.Context, podID string) (PodStatus, error) {
+	span, ctx := trace.StartSpan(ctx, "StatusPod")
+	span.SetTag(trace.TagPodID, podID)
+	defer span.Finish()
+
 	if podID == "" {
 		return PodStatus{}, errNeedPodID
 	}
 
-	pod, err := fetchPod(podID)
+	lockFile, err := rLockPod(ctx, podID)
+	if err != nil {
+		return PodStatus{}, err
+	}
+	defer unlockPod(lockFile)
+
+	pod, err := fetchPod(ctx, podID)
 	if err != nil {
 		return PodStatus{}, err
 	}
@@ -345,6 +450,8 @@ func StatusPod(podID string) (PodStatus, error) {
 		State:            pod.state,
 		Hypervisor:       pod.config.HypervisorType,
 		HypervisorConfig: pod.config.HypervisorConfig,
+		VMConfig:         pod.config.VMConfig,
+		Resources:        pod.vmResources(),
 		Agent:            pod.config.AgentType,
 		ContainersStatus: contStatusList,
 		Annotations:      pod.config.Annotations,
@@ -353,20 +460,90 @@ func StatusPod(podID string) (PodStatus, error) {
 	return podStatus, nil
 }
 
+// ResizePodBalloon is the virtcontainers entry point resizing the memory
+// balloon of a running pod, so that its guest is left with memory MiB.
+func ResizePodBalloon(ctx context.Context, podID string, memory uint) error {
+	span, ctx := trace.StartSpan(ctx, "ResizePodBalloon")
+	span.SetTag(trace.TagPodID, podID)
+	defer span.Finish()
+
+	if podID == "" {
+		return errNeedPodID
+	}
+
+	lockFile, err := lockPod(ctx, podID)
+	if err != nil {
+		return err
+	}
+	defer unlockPod(lockFile)
+
+	pod, err := fetchPod(ctx, podID)
+	if err != nil {
+		return err
+	}
+
+	return pod.resizeBalloon(memory)
+}
+
+// StatusPodBalloon is the virtcontainers entry point returning the state
+// of the memory balloon of a running pod.
+func StatusPodBalloon(ctx context.Context, podID string) (BalloonStatus, error) {
+	span, ctx := trace.StartSpan(ctx, "StatusPodBalloon")
+	span.SetTag(trace.TagPodID, podID)
+	defer span.Finish()
+
+	if podID == "" {
+		return BalloonStatus{}, errNeedPodID
+	}
+
+	lockFile, err := rLockPod(ctx, podID)
+	if err != nil {
+		return BalloonStatus{}, err
+	}
+	defer unlockPod(lockFile)
+
+	pod, err := fetchPod(ctx, podID)
+	if err != nil {
+		return BalloonStatus{}, err
+	}
+
+	return pod.balloonStatus()
+}
+
 // CreateContainer is the virtcontainers container creation entry point.
 // CreateContainer creates a container on a given pod.
-func CreateContainer(podID string, containerConfig ContainerConfig) (*Pod, *Container, error) {
+func CreateContainer(ctx context.Context, podID string, containerConfig ContainerConfig) (*Pod, *Container, error) {
+	span, ctx := trace.StartSpan(ctx, "CreateContainer")
+	span.SetTag(trace.TagPodID, podID)
+	span.SetTag(trace.TagContainerID, containerConfig.ID)
+	defer span.Finish()
+
 	if podID == "" {
 		return nil, nil, errNeedPodID
 	}
 
-	lockFile, err := lockPod(podID)
+	lockFile, err := lockPod(ctx, podID)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer unlockPod(lockFile)
 
-	p, err := fetchPod(podID)
+	p, err := fetchPod(ctx, podID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Shrink the VM back if the container cannot be added.
+	defer func() {
+		if err != nil {
+			if unplugErr := p.removeContainerResources(containerConfig.ID); unplugErr != nil {
+				virtLog.Warnf("Could not unplug the resources of container %s: %v", containerConfig.ID, unplugErr)
+			}
+		}
+	}()
+
+	// Grow the VM with the resources the container needs.
+	err = p.addContainerResources(containerConfig)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -396,7 +573,12 @@ func CreateContainer(podID string, containerConfig ContainerConfig) (*Pod, *Cont
 // DeleteContainer is the virtcontainers container deletion entry point.
 // DeleteContainer deletes a Container from a Pod. If the container is running,
 // it needs to be stopped first.
-func DeleteContainer(podID, containerID string) (*Container, error) {
+func DeleteContainer(ctx context.Context, podID, containerID string) (*Container, error) {
+	span, ctx := trace.StartSpan(ctx, "DeleteContainer")
+	span.SetTag(trace.TagPodID, podID)
+	span.SetTag(trace.TagContainerID, containerID)
+	defer span.Finish()
+
 	if podID == "" {
 		return nil, errNeedPodID
 	}
@@ -405,13 +587,13 @@ func DeleteContainer(podID, containerID string) (*Container, error) {
 		return nil, errNeedContainerID
 	}
 
-	lockFile, err := lockPod(podID)
+	lockFile, err := lockPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
 	defer unlockPod(lockFile)
 
-	p, err := fetchPod(podID)
+	p, err := fetchPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
@@ -428,6 +610,12 @@ func DeleteContainer(podID, containerID string) (*Container, error) {
 		return nil, err
 	}
 
+	// Shrink the VM.
+	err = p.removeContainerResources(containerID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Update pod config
 	for idx, contConfig := range p.config.Containers {
 		if contConfig.ID == containerID {
@@ -445,7 +633,12 @@ func DeleteContainer(podID, containerID string) (*Container, error) {
 
 // StartContainer is the virtcontainers container starting entry point.
 // StartContainer starts an already created container.
-func StartContainer(podID, containerID string) (*Container, error) {
+func StartContainer(ctx context.Context, podID, containerID string) (*Container, error) {
+	span, ctx := trace.StartSpan(ctx, "StartContainer")
+	span.SetTag(trace.TagPodID, podID)
+	span.SetTag(trace.TagContainerID, containerID)
+	defer span.Finish()
+
 	if podID == "" {
 		return nil, errNeedPodID
 	}
@@ -454,13 +647,13 @@ func StartContainer(podID, containerID string) (*Container, error) {
 		return nil, errNeedContainerID
 	}
 
-	lockFile, err := lockPod(podID)
+	lockFile, err := lockPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
 	defer unlockPod(lockFile)
 
-	p, err := fetchPod(podID)
+	p, err := fetchPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
@@ -483,7 +676,12 @@ func StartContainer(podID, containerID string) (*Container, error) {
 
 // StopContainer is the virtcontainers container stopping entry point.
 // StopContainer stops an already running container.
-func StopContainer(podID, containerID string) (*Container, error) {
+func StopContainer(ctx context.Context, podID, containerID string) (*Container, error) {
+	span, ctx := trace.StartSpan(ctx, "StopContainer")
+	span.SetTag(trace.TagPodID, podID)
+	span.SetTag(trace.TagContainerID, containerID)
+	defer span.Finish()
+
 	if podID == "" {
 		return nil, errNeedPodID
 	}
@@ -492,13 +690,13 @@ func StopContainer(podID, containerID string) (*Container, error) {
 		return nil, errNeedContainerID
 	}
 
-	lockFile, err := lockPod(podID)
+	lockFile, err := lockPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
 	defer unlockPod(lockFile)
 
-	p, err := fetchPod(podID)
+	p, err := fetchPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
@@ -521,7 +719,12 @@ func StopContainer(podID, containerID string) (*Container, error) {
 
 // EnterContainer is the virtcontainers container command execution entry point.
 // EnterContainer enters an already running container and runs a given command.
-func EnterContainer(podID, containerID string, cmd Cmd) (*Pod, *Container, *Process, error) {
+func EnterContainer(ctx context.Context, podID, containerID string, cmd Cmd) (*Pod, *Container, *Process, error) {
+	span, ctx := trace.StartSpan(ctx, "EnterContainer")
+	span.SetTag(trace.TagPodID, podID)
+	span.SetTag(trace.TagContainerID, containerID)
+	defer span.Finish()
+
 	if podID == "" {
 		return nil, nil, nil, errNeedPodID
 	}
@@ -530,13 +733,13 @@ func EnterContainer(podID, containerID string, cmd Cmd) (*Pod, *Container, *Proc
 		return nil, nil, nil, errNeedContainerID
 	}
 
-	lockFile, err := lockPod(podID)
+	lockFile, err := lockPod(ctx, podID)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 	defer unlockPod(lockFile)
 
-	p, err := fetchPod(podID)
+	p, err := fetchPod(ctx, podID)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -558,7 +761,12 @@ func EnterContainer(podID, containerID string, cmd Cmd) (*Pod, *Container, *Proc
 
 // StatusContainer is the virtcontainers container status entry point.
 // StatusContainer returns a detailed container status.
-func StatusContainer(podID, containerID string) (ContainerStatus, error) {
+func StatusContainer(ctx context.Context, podID, containerID string) (ContainerStatus, error) {
+	span, ctx := trace.StartSpan(ctx, "StatusContainer")
+	span.SetTag(trace.TagPodID, podID)
+	span.SetTag(trace.TagContainerID, containerID)
+	defer span.Finish()
+
 	if podID == "" {
 		return ContainerStatus{}, errNeedPodID
 	}
@@ -567,7 +775,13 @@ func StatusContainer(podID, containerID string) (ContainerStatus, error) {
 		return ContainerStatus{}, errNeedContainerID
 	}
 
-	pod, err := fetchPod(podID)
+	lockFile, err := rLockPod(ctx, podID)
+	if err != nil {
+		return ContainerStatus{}, err
+	}
+	defer unlockPod(lockFile)
+
+	pod, err := fetchPod(ctx, podID)
 	if err != nil {
 		return ContainerStatus{}, err
 	}
@@ -596,7 +810,12 @@ func statusContainer(pod *Pod, containerID string) (ContainerStatus, error) {
 // KillContainer is the virtcontainers entry point to send a signal
 // to a container running inside a pod. If all is true, all processes in
 // the container will be sent the signal.
-func KillContainer(podID, containerID string, signal syscall.Signal, all bool) error {
+func KillContainer(ctx context.Context, podID, containerID string, signal syscall.Signal, all bool) error {
+	span, ctx := trace.StartSpan(ctx, "KillContainer")
+	span.SetTag(trace.TagPodID, podID)
+	span.SetTag(trace.TagContainerID, containerID)
+	defer span.Finish()
+
 	if podID == "" {
 		return errNeedPodID
 	}
@@ -605,13 +824,13 @@ func KillContainer(podID, containerID string, signal syscall.Signal, all bool) e
 		return errNeedContainerID
 	}
 
-	lockFile, err := lockPod(podID)
+	lockFile, err := lockPod(ctx, podID)
 	if err != nil {
 		return err
 	}
 	defer unlockPod(lockFile)
 
-	p, err := fetchPod(podID)
+	p, err := fetchPod(ctx, podID)
 	if err != nil {
 		return err
 	}
@@ -633,12 +852,12 @@ func KillContainer(podID, containerID string, signal syscall.Signal, all bool) e
 
 // PausePod is the virtcontainers pausing entry point which pauses an
 // already running pod.
-func PausePod(podID string) (*Pod, error) {
-	return togglePausePod(podID, true)
+func PausePod(ctx context.Context, podID string) (*Pod, error) {
+	return togglePausePod(ctx, podID, true)
 }
 
 // ResumePod is the virtcontainers resuming entry point which resumes
 // (or unpauses) and already paused pod.
-func ResumePod(podID string) (*Pod, error) {
-	return togglePausePod(podID, false)
+func ResumePod(ctx context.Context, podID string) (*Pod, error) {
+	return togglePausePod(ctx, podID, false)
 }
@@ -17,12 +17,17 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -240,7 +245,7 @@ func TestCreatePodNoopAgentSuccessful(t *testing.T) {
 
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -257,7 +262,7 @@ func TestCreatePodHyperstartAgentSuccessful(t *testing.T) {
 
 	config := newTestPodConfigHyperstartAgent()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -274,18 +279,55 @@ func TestCreatePodFailing(t *testing.T) {
 
 	config := PodConfig{}
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p != nil || err == nil {
 		t.Fatal()
 	}
 }
 
+func TestCreatePodFailingHookRemovesNetNS(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip(testDisabledAsNonRoot)
+	}
+
+	cleanUp()
+
+	netNSDir := "/var/run/netns"
+	before, _ := ioutil.ReadDir(netNSDir)
+
+	config := newTestPodConfigNoop()
+	config.NetworkModel = CNMNetworkModel
+	config.Hooks = Hooks{
+		PreStartHooks: []Hook{
+			{
+				// The mock hook fails with unexpected arguments.
+				Path: getMockHookBinPath(),
+				Args: []string{"wrong"},
+			},
+		},
+	}
+
+	p, err := CreatePod(context.Background(), config)
+	if p != nil || err == nil {
+		t.Fatal()
+	}
+
+	after, _ := ioutil.ReadDir(netNSDir)
+	if len(after) != len(before) {
+		t.Fatalf("The network namespace of the pod was left behind in %s", netNSDir)
+	}
+
+	if _, err := os.Stat(filepath.Join(configStoragePath, testPodID)); !os.IsNotExist(err) {
+		t.Fatalf("The pod resources were left behind: %v", err)
+	}
+}
+
 func TestDeletePodNoopAgentSuccessful(t *testing.T) {
 	cleanUp()
 
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -296,7 +338,7 @@ func TestDeletePodNoopAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	p, err = DeletePod(p.id)
+	p, err = DeletePod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -312,7 +354,7 @@ func TestDeletePodHyperstartAgentSuccessful(t *testing.T) {
 
 	config := newTestPodConfigHyperstartAgent()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -323,7 +365,7 @@ func TestDeletePodHyperstartAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	p, err = DeletePod(p.id)
+	p, err = DeletePod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -340,7 +382,7 @@ func TestDeletePodFailing(t *testing.T) {
 	podDir := filepath.Join(configStoragePath, testPodID)
 	os.Remove(podDir)
 
-	p, err := DeletePod(testPodID)
+	p, err := DeletePod(context.Background(), testPodID)
 	if p != nil || err == nil {
 		t.Fatal()
 	}
@@ -395,7 +437,7 @@ func TestStartPodFailing(t *testing.T) {
 	podDir := filepath.Join(configStoragePath, testPodID)
 	os.Remove(podDir)
 
-	p, err := StartPod(testPodID)
+	p, err := StartPod(context.Background(), testPodID)
 	if p != nil || err == nil {
 		t.Fatal()
 	}
@@ -411,7 +453,7 @@ func TestStopPodNoopAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	p, err = StopPod(p.id)
+	p, err = StopPod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -430,12 +472,12 @@ func TestPauseThenResumePodNoopAgentSuccessful(t *testing.T) {
 	contID := "100"
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
 
-	p, err = PausePod(p.id)
+	p, err = PausePod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -449,7 +491,7 @@ func TestPauseThenResumePodNoopAgentSuccessful(t *testing.T) {
 			fmt.Sprintf("paused container %d has unexpected state", i))
 	}
 
-	p, err = ResumePod(p.id)
+	p, err = ResumePod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -488,7 +530,7 @@ func TestStopPodHyperstartAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	p, err = StopPod(p.id)
+	p, err = StopPod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -505,7 +547,7 @@ func TestStopPodFailing(t *testing.T) {
 	podDir := filepath.Join(configStoragePath, testPodID)
 	os.Remove(podDir)
 
-	p, err := StopPod(testPodID)
+	p, err := StopPod(context.Background(), testPodID)
 	if p != nil || err == nil {
 		t.Fatal()
 	}
@@ -516,7 +558,7 @@ func TestRunPodNoopAgentSuccessful(t *testing.T) {
 
 	config := newTestPodConfigNoop()
 
-	p, err := RunPod(config)
+	p, err := RunPod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -547,7 +589,7 @@ func TestRunPodHyperstartAgentSuccessful(t *testing.T) {
 	hyperConfig.PauseBinPath = pauseBinPath
 	config.AgentConfig = hyperConfig
 
-	p, err := RunPod(config)
+	p, err := RunPod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -571,7 +613,7 @@ func TestRunPodFailing(t *testing.T) {
 
 	config := PodConfig{}
 
-	p, err := RunPod(config)
+	p, err := RunPod(context.Background(), config)
 	if p != nil || err == nil {
 		t.Fatal()
 	}
@@ -584,12 +626,12 @@ func TestListPodSuccessful(t *testing.T) {
 
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = ListPod()
+	_, err = ListPod(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -600,12 +642,77 @@ func TestListPodNoPodDirectory(t *testing.T) {
 
 	os.RemoveAll(configStoragePath)
 
-	_, err := ListPod()
+	_, err := ListPod(context.Background())
 	if err != nil {
 		t.Fatal(fmt.Sprintf("unexpected ListPod error from non-existent pod directory: %v", err))
 	}
 }
 
+func TestStatusPodLockedTimeout(t *testing.T) {
+	cleanUp()
+	defer cleanUp()
+
+	if _, err := CreatePod(context.Background(), newTestPodConfigNoop()); err != nil {
+		t.Fatal(err)
+	}
+
+	lockFile, err := lockPod(context.Background(), testPodID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlockPod(lockFile)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := StatusPod(ctx, testPodID); err != context.DeadlineExceeded {
+		t.Fatalf("Got %v, expecting the lock wait to time out", err)
+	}
+}
+
+func TestListPodSkipsPodBeingCreated(t *testing.T) {
+	cleanUp()
+	defer cleanUp()
+
+	if _, err := CreatePod(context.Background(), newTestPodConfigNoop()); err != nil {
+		t.Fatal(err)
+	}
+
+	lockFile, err := lockPod(context.Background(), testPodID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := markPodCreating(testPodID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The listing does not wait for the creation to complete.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	pods, err := ListPod(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pods) != 0 {
+		t.Fatalf("Unexpected pods %+v", pods)
+	}
+
+	// The mark of a creation which did not complete is ignored.
+	unlockPod(lockFile)
+
+	pods, err = ListPod(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pods) != 1 {
+		t.Fatalf("Unexpected pods %+v", pods)
+	}
+}
+
 func TestStatusPodSuccessful(t *testing.T) {
 	cleanUp()
 
@@ -624,8 +731,12 @@ func TestStatusPodSuccessful(t *testing.T) {
 		},
 		Hypervisor:       MockHypervisor,
 		HypervisorConfig: hypervisorConfig,
-		Agent:            NoopAgentType,
-		Annotations:      podAnnotations,
+		Resources: Resources{
+			VCPUs:  uint(runtime.NumCPU()),
+			Memory: defaultVMMemory,
+		},
+		Agent:       NoopAgentType,
+		Annotations: podAnnotations,
 		ContainersStatus: []ContainerStatus{
 			{
 				ID: containerID,
@@ -640,12 +751,12 @@ func TestStatusPodSuccessful(t *testing.T) {
 		},
 	}
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
 
-	status, err := StatusPod(p.id)
+	status, err := StatusPod(context.Background(), p.id)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -664,7 +775,7 @@ func TestStatusPodFailingFetchPodConfig(t *testing.T) {
 
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -672,7 +783,7 @@ func TestStatusPodFailingFetchPodConfig(t *testing.T) {
 	path := filepath.Join(configStoragePath, p.id)
 	os.RemoveAll(path)
 
-	_, err = StatusPod(p.id)
+	_, err = StatusPod(context.Background(), p.id)
 	if err == nil {
 		t.Fatal()
 	}
@@ -683,19 +794,80 @@ func TestStatusPodPodFailingFetchPodState(t *testing.T) {
 
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
 
 	os.RemoveAll(p.configPath)
 
-	_, err = StatusPod(p.id)
+	_, err = StatusPod(context.Background(), p.id)
 	if err == nil {
 		t.Fatal()
 	}
 }
 
+func TestPodBalloonSuccessful(t *testing.T) {
+	cleanUp()
+	defer cleanUp()
+
+	config := newTestPodConfigNoop()
+	config.VMConfig.Memory = 512
+
+	p, err := CreatePod(context.Background(), config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	// The VM of a pod which is not running has no balloon.
+	if err := ResizePodBalloon(context.Background(), p.id, 256); err == nil {
+		t.Fatal("Expected resizing the balloon of a ready pod to fail")
+	}
+
+	if _, err := StatusPodBalloon(context.Background(), p.id); err == nil {
+		t.Fatal("Expected querying the balloon of a ready pod to fail")
+	}
+
+	if _, err := StartPod(context.Background(), p.id); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, memory := range []uint{0, 1024} {
+		if err := ResizePodBalloon(context.Background(), p.id, memory); err == nil {
+			t.Fatalf("Expected resizing the balloon to %dMiB to fail", memory)
+		}
+	}
+
+	if err := ResizePodBalloon(context.Background(), p.id, 256); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := StatusPodBalloon(context.Background(), p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := BalloonStatus{Memory: 512, Actual: 256}
+	if status != expected {
+		t.Fatalf("Got %+v\nExpecting %+v", status, expected)
+	}
+}
+
+func TestBalloonStatusSize(t *testing.T) {
+	for _, d := range []struct {
+		status BalloonStatus
+		size   uint
+	}{
+		{BalloonStatus{Memory: 512, Actual: 512}, 0},
+		{BalloonStatus{Memory: 512, Actual: 128}, 384},
+		{BalloonStatus{Memory: 512, Actual: 1024}, 0},
+	} {
+		if size := d.status.Size(); size != d.size {
+			t.Errorf("Expected a %dMiB balloon for %+v, got %dMiB", d.size, d.status, size)
+		}
+	}
+}
+
 func newTestContainerConfigNoop(contID string) ContainerConfig {
 	// Define the container command and bundle.
 	container := ContainerConfig{
@@ -714,7 +886,7 @@ func TestCreateContainerSuccessful(t *testing.T) {
 	contID := "100"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -727,7 +899,7 @@ func TestCreateContainerSuccessful(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -745,12 +917,12 @@ func TestCreateContainerFailingNoPod(t *testing.T) {
 	contID := "100"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
 
-	p, err = DeletePod(p.id)
+	p, err = DeletePod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -763,7 +935,7 @@ func TestCreateContainerFailingNoPod(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c != nil || err == nil {
 		t.Fatal(err)
 	}
@@ -775,7 +947,7 @@ func TestDeleteContainerSuccessful(t *testing.T) {
 	contID := "100"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -788,7 +960,7 @@ func TestDeleteContainerSuccessful(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -799,7 +971,7 @@ func TestDeleteContainerSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, err = DeleteContainer(p.id, contID)
+	c, err = DeleteContainer(context.Background(), p.id, contID)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -817,7 +989,7 @@ func TestDeleteContainerFailingNoPod(t *testing.T) {
 	contID := "100"
 	os.RemoveAll(podDir)
 
-	c, err := DeleteContainer(testPodID, contID)
+	c, err := DeleteContainer(context.Background(), testPodID, contID)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -829,7 +1001,7 @@ func TestDeleteContainerFailingNoContainer(t *testing.T) {
 	contID := "100"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -840,7 +1012,7 @@ func TestDeleteContainerFailingNoContainer(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, err := DeleteContainer(p.id, contID)
+	c, err := DeleteContainer(context.Background(), p.id, contID)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -858,7 +1030,7 @@ func TestStartContainerNoopAgentSuccessful(t *testing.T) {
 	}
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -869,7 +1041,7 @@ func TestStartContainerNoopAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, err = StartContainer(p.id, contID)
+	c, err = StartContainer(context.Background(), p.id, contID)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -882,7 +1054,7 @@ func TestStartContainerFailingNoPod(t *testing.T) {
 	contID := "100"
 	os.RemoveAll(podDir)
 
-	c, err := StartContainer(testPodID, contID)
+	c, err := StartContainer(context.Background(), testPodID, contID)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -894,7 +1066,7 @@ func TestStartContainerFailingNoContainer(t *testing.T) {
 	contID := "100"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -905,7 +1077,7 @@ func TestStartContainerFailingNoContainer(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, err := StartContainer(p.id, contID)
+	c, err := StartContainer(context.Background(), p.id, contID)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -917,7 +1089,7 @@ func TestStartContainerFailingPodNotStarted(t *testing.T) {
 	contID := "100"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -930,7 +1102,7 @@ func TestStartContainerFailingPodNotStarted(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -941,7 +1113,7 @@ func TestStartContainerFailingPodNotStarted(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, err = StartContainer(p.id, contID)
+	c, err = StartContainer(context.Background(), p.id, contID)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -960,7 +1132,7 @@ func TestStopContainerNoopAgentSuccessful(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -971,12 +1143,12 @@ func TestStopContainerNoopAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, err = StartContainer(p.id, contID)
+	c, err = StartContainer(context.Background(), p.id, contID)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
 
-	c, err = StopContainer(p.id, contID)
+	c, err = StopContainer(context.Background(), p.id, contID)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1009,7 +1181,7 @@ func TestStartStopContainerHyperstartAgentSuccessful(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1020,12 +1192,12 @@ func TestStartStopContainerHyperstartAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, err = StartContainer(p.id, contID)
+	c, err = StartContainer(context.Background(), p.id, contID)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
 
-	c, err = StopContainer(p.id, contID)
+	c, err = StopContainer(context.Background(), p.id, contID)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1062,12 +1234,12 @@ func TestStartStopPodHyperstartAgentSuccessfulWithCNINetwork(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	p, err = StopPod(p.id)
+	p, err = StopPod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
 
-	p, err = DeletePod(p.id)
+	p, err = DeletePod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1100,12 +1272,12 @@ func TestStartStopPodHyperstartAgentSuccessfulWithCNMNetwork(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	p, err = StopPod(p.id)
+	p, err = StopPod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
 
-	p, err = DeletePod(p.id)
+	p, err = DeletePod(context.Background(), p.id)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1123,7 +1295,7 @@ func TestStopContainerFailingNoPod(t *testing.T) {
 	contID := "100"
 	os.RemoveAll(podDir)
 
-	c, err := StopContainer(testPodID, contID)
+	c, err := StopContainer(context.Background(), testPodID, contID)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -1135,7 +1307,7 @@ func TestStopContainerFailingNoContainer(t *testing.T) {
 	contID := "100"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1146,7 +1318,7 @@ func TestStopContainerFailingNoContainer(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, err := StopContainer(p.id, contID)
+	c, err := StopContainer(context.Background(), p.id, contID)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -1165,7 +1337,7 @@ func TestStopContainerFailingContNotStarted(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1176,7 +1348,7 @@ func TestStopContainerFailingContNotStarted(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, err = StopContainer(p.id, contID)
+	c, err = StopContainer(context.Background(), p.id, contID)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -1195,7 +1367,7 @@ func TestEnterContainerNoopAgentSuccessful(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1206,14 +1378,14 @@ func TestEnterContainerNoopAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c, err = StartContainer(p.id, contID)
+	c, err = StartContainer(context.Background(), p.id, contID)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
 
 	cmd := newBasicTestCmd()
 
-	_, c, _, err = EnterContainer(p.id, contID, cmd)
+	_, c, _, err = EnterContainer(context.Background(), p.id, contID, cmd)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1246,7 +1418,7 @@ func TestEnterContainerHyperstartAgentSuccessful(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, _, err = CreateContainer(p.id, contConfig)
+	_, _, err = CreateContainer(context.Background(), p.id, contConfig)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1257,19 +1429,19 @@ func TestEnterContainerHyperstartAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = StartContainer(p.id, contID)
+	_, err = StartContainer(context.Background(), p.id, contID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	cmd := newBasicTestCmd()
 
-	_, _, _, err = EnterContainer(p.id, contID, cmd)
+	_, _, _, err = EnterContainer(context.Background(), p.id, contID, cmd)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = StopContainer(p.id, contID)
+	_, err = StopContainer(context.Background(), p.id, contID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1291,7 +1463,7 @@ func TestEnterContainerFailingNoPod(t *testing.T) {
 
 	cmd := newBasicTestCmd()
 
-	_, c, _, err := EnterContainer(testPodID, contID, cmd)
+	_, c, _, err := EnterContainer(context.Background(), testPodID, contID, cmd)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -1303,7 +1475,7 @@ func TestEnterContainerFailingNoContainer(t *testing.T) {
 	contID := "100"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1316,7 +1488,7 @@ func TestEnterContainerFailingNoContainer(t *testing.T) {
 
 	cmd := newBasicTestCmd()
 
-	_, c, _, err := EnterContainer(p.id, contID, cmd)
+	_, c, _, err := EnterContainer(context.Background(), p.id, contID, cmd)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -1335,7 +1507,7 @@ func TestEnterContainerFailingContNotStarted(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1348,7 +1520,7 @@ func TestEnterContainerFailingContNotStarted(t *testing.T) {
 
 	cmd := newBasicTestCmd()
 
-	_, c, _, err = EnterContainer(p.id, contID, cmd)
+	_, c, _, err = EnterContainer(context.Background(), p.id, contID, cmd)
 	if c != nil || err == nil {
 		t.Fatal()
 	}
@@ -1360,7 +1532,7 @@ func TestStatusContainerSuccessful(t *testing.T) {
 	contID := "100"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1373,7 +1545,7 @@ func TestStatusContainerSuccessful(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1384,7 +1556,7 @@ func TestStatusContainerSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	status, err := StatusContainer(p.id, contID)
+	status, err := StatusContainer(context.Background(), p.id, contID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1405,7 +1577,7 @@ func TestStatusContainer(t *testing.T) {
 	contID := "101"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1418,7 +1590,7 @@ func TestStatusContainer(t *testing.T) {
 
 	contConfig := newTestContainerConfigNoop(contID)
 
-	_, c, err := CreateContainer(p.id, contConfig)
+	_, c, err := CreateContainer(context.Background(), p.id, contConfig)
 	if c == nil || err != nil {
 		t.Fatal(err)
 	}
@@ -1430,7 +1602,7 @@ func TestStatusContainer(t *testing.T) {
 	}
 
 	// fresh lookup
-	p2, err := fetchPod(p.id)
+	p2, err := fetchPod(context.Background(), p.id)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1466,14 +1638,14 @@ func TestStatusContainerFailing(t *testing.T) {
 	contID := "100"
 	config := newTestPodConfigNoop()
 
-	p, err := CreatePod(config)
+	p, err := CreatePod(context.Background(), config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
 
 	os.RemoveAll(p.configPath)
 
-	_, err = StatusContainer(p.id, contID)
+	_, err = StatusContainer(context.Background(), p.id, contID)
 	if err == nil {
 		t.Fatal()
 	}
@@ -1544,7 +1716,7 @@ func createAndStartPod(config PodConfig) (pod *Pod, podDir string,
 	err error) {
 
 	// Create pod
-	pod, err = CreatePod(config)
+	pod, err = CreatePod(context.Background(), config)
 	if pod == nil || err != nil {
 		return nil, "", err
 	}
@@ -1556,7 +1728,7 @@ func createAndStartPod(config PodConfig) (pod *Pod, podDir string,
 	}
 
 	// Start pod
-	pod, err = StartPod(pod.id)
+	pod, err = StartPod(context.Background(), pod.id)
 	if pod == nil || err != nil {
 		return nil, "", err
 	}
@@ -1571,13 +1743,13 @@ func createStartStopDeletePod(b *testing.B, podConfig PodConfig) {
 	}
 
 	// Stop pod
-	_, err = StopPod(p.id)
+	_, err = StopPod(context.Background(), p.id)
 	if err != nil {
 		b.Fatalf("Could not stop pod: %s", err)
 	}
 
 	// Delete pod
-	_, err = DeletePod(p.id)
+	_, err = DeletePod(context.Background(), p.id)
 	if err != nil {
 		b.Fatalf("Could not delete pod: %s", err)
 	}
@@ -1585,20 +1757,20 @@ func createStartStopDeletePod(b *testing.B, podConfig PodConfig) {
 
 func createStartStopDeleteContainers(b *testing.B, podConfig PodConfig, contConfigs []ContainerConfig) {
 	// Create pod
-	p, err := CreatePod(podConfig)
+	p, err := CreatePod(context.Background(), podConfig)
 	if err != nil {
 		b.Fatalf("Could not create pod: %s", err)
 	}
 
 	// Start pod
-	_, err = StartPod(p.id)
+	_, err = StartPod(context.Background(), p.id)
 	if err != nil {
 		b.Fatalf("Could not start pod: %s", err)
 	}
 
 	// Create containers
 	for _, contConfig := range contConfigs {
-		_, _, err := CreateContainer(p.id, contConfig)
+		_, _, err := CreateContainer(context.Background(), p.id, contConfig)
 		if err != nil {
 			b.Fatalf("Could not create container %s: %s", contConfig.ID, err)
 		}
@@ -1606,7 +1778,7 @@ func createStartStopDeleteContainers(b *testing.B, podConfig PodConfig, contConf
 
 	// Start containers
 	for _, contConfig := range contConfigs {
-		_, err := StartContainer(p.id, contConfig.ID)
+		_, err := StartContainer(context.Background(), p.id, contConfig.ID)
 		if err != nil {
 			b.Fatalf("Could not start container %s: %s", contConfig.ID, err)
 		}
@@ -1614,7 +1786,7 @@ func createStartStopDeleteContainers(b *testing.B, podConfig PodConfig, contConf
 
 	// Stop containers
 	for _, contConfig := range contConfigs {
-		_, err := StopContainer(p.id, contConfig.ID)
+		_, err := StopContainer(context.Background(), p.id, contConfig.ID)
 		if err != nil {
 			b.Fatalf("Could not stop container %s: %s", contConfig.ID, err)
 		}
@@ -1622,20 +1794,20 @@ func createStartStopDeleteContainers(b *testing.B, podConfig PodConfig, contConf
 
 	// Delete containers
 	for _, contConfig := range contConfigs {
-		_, err := DeleteContainer(p.id, contConfig.ID)
+		_, err := DeleteContainer(context.Background(), p.id, contConfig.ID)
 		if err != nil {
 			b.Fatalf("Could not delete container %s: %s", contConfig.ID, err)
 		}
 	}
 
 	// Stop pod
-	_, err = StopPod(p.id)
+	_, err = StopPod(context.Background(), p.id)
 	if err != nil {
 		b.Fatalf("Could not stop pod: %s", err)
 	}
 
 	// Delete pod
-	_, err = DeletePod(p.id)
+	_, err = DeletePod(context.Background(), p.id)
 	if err != nil {
 		b.Fatalf("Could not delete pod: %s", err)
 	}
@@ -1695,3 +1867,130 @@ func BenchmarkStartStop10ContainerQemuHypervisorHyperstartAgentNetworkNoop(b *te
 		createStartStopDeleteContainers(b, podConfig, contConfigs)
 	}
 }
+
+// checkPodStatus returns an error if the pod status read concurrently with
+// lifecycle operations is not consistent. The pod and its container being
+// created, started, stopped and deleted together, they must always be in
+// the same state.
+func checkPodStatus(status PodStatus) error {
+	if !status.State.valid() {
+		return fmt.Errorf("Invalid pod state %q", status.State.State)
+	}
+
+	if len(status.ContainersStatus) != 1 {
+		return fmt.Errorf("Expected 1 container, got %d", len(status.ContainersStatus))
+	}
+
+	if status.ContainersStatus[0].State.State != status.State.State {
+		return fmt.Errorf("Container state %q does not match pod state %q",
+			status.ContainersStatus[0].State.State, status.State.State)
+	}
+
+	return nil
+}
+
+func TestConcurrentPodOperations(t *testing.T) {
+	cleanUp()
+
+	const iterations = 20
+	const readers = 4
+
+	ctx := context.Background()
+	config := newTestPodConfigNoop()
+
+	done := make(chan struct{})
+	errCh := make(chan error, readers+1)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+
+		go func(list bool) {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				var pods []PodStatus
+
+				if list {
+					var err error
+					pods, err = ListPod(ctx)
+					if err != nil {
+						errCh <- err
+						return
+					}
+				} else {
+					status, err := StatusPod(ctx, testPodID)
+					if err != nil {
+						if e, ok := err.(*Error); ok && e.Code == ErrCodePodNotFound {
+							continue
+						}
+
+						errCh <- err
+						return
+					}
+
+					pods = append(pods, status)
+				}
+
+				for _, status := range pods {
+					if err := checkPodStatus(status); err != nil {
+						errCh <- err
+						return
+					}
+				}
+			}
+		}(i == 0)
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		defer close(done)
+
+		for i := 0; i < iterations; i++ {
+			if _, err := CreatePod(ctx, config); err != nil {
+				errCh <- err
+				return
+			}
+
+			if _, err := StartPod(ctx, testPodID); err != nil {
+				errCh <- err
+				return
+			}
+
+			if _, err := StopPod(ctx, testPodID); err != nil {
+				errCh <- err
+				return
+			}
+
+			if _, err := DeletePod(ctx, testPodID); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		t.Error(err)
+	}
+
+	pods, err := ListQuarantinedPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pods) != 0 {
+		t.Fatalf("Unexpected quarantined pods %+v", pods)
+	}
+}
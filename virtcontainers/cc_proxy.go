@@ -17,17 +17,29 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/url"
 
 	"github.com/clearcontainers/proxy/client"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
 )
 
 var defaultCCProxyURL = "unix:///run/cc-oci-runtime/proxy.sock"
 
+// Span and tag recording the requests sent to the proxy.
+const (
+	proxyRequestSpan = "proxyRequest"
+	proxyRequestTag  = "proxy.request"
+)
+
 type ccProxy struct {
 	client *client.Client
+
+	// ctx is the context of the operation the client is connected
+	// for, used to trace the requests sent to the proxy.
+	ctx context.Context
 }
 
 // CCProxyConfig is a structure storing information needed for
@@ -36,7 +48,11 @@ type CCProxyConfig struct {
 	URL string
 }
 
-func (p *ccProxy) connectProxy(proxyURL string) (*client.Client, error) {
+func (p *ccProxy) connectProxy(ctx context.Context, proxyURL string) (*client.Client, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	if proxyURL == "" {
 		proxyURL = defaultCCProxyURL
 	}
@@ -59,11 +75,22 @@ func (p *ccProxy) connectProxy(proxyURL string) (*client.Client, error) {
 		address = u.Path
 	}
 
-	conn, err := net.Dial(u.Scheme, address)
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, u.Scheme, address)
 	if err != nil {
 		return nil, err
 	}
 
+	// The proxy could stop answering, bound every exchange by the
+	// deadline of the operation.
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
 	return client.NewClient(conn), nil
 }
 
@@ -77,10 +104,11 @@ func (p *ccProxy) register(pod Pod) ([]ProxyInfo, string, error) {
 		return []ProxyInfo{}, "", fmt.Errorf("Wrong proxy config type, should be CCProxyConfig type")
 	}
 
-	p.client, err = p.connectProxy(ccConfig.URL)
+	p.client, err = p.connectProxy(pod.ctx, ccConfig.URL)
 	if err != nil {
-		return []ProxyInfo{}, "", err
+		return []ProxyInfo{}, "", newPodError(ErrCodeProxyUnreachable, pod.id, err)
 	}
+	p.ctx = pod.ctx
 
 	hyperConfig, ok := newAgentConfig(*(pod.config)).(HyperConfig)
 	if !ok {
@@ -92,8 +120,10 @@ func (p *ccProxy) register(pod Pod) ([]ProxyInfo, string, error) {
 		NumIOStreams: len(pod.containers),
 	}
 
+	span := p.startRequestSpan("RegisterVM", pod.id)
 	registerVMReturn, err := p.client.RegisterVM(pod.id, hyperConfig.SockCtlName,
 		hyperConfig.SockTtyName, registerVMOptions)
+	span.SetError(err).Finish()
 	if err != nil {
 		return []ProxyInfo{}, "", err
 	}
@@ -126,7 +156,11 @@ func (p *ccProxy) unregister(pod Pod) error {
 		return fmt.Errorf("unregister: Client is nil, we can't interact with cc-proxy")
 	}
 
-	return p.client.UnregisterVM(pod.id)
+	span := p.startRequestSpan("UnregisterVM", pod.id)
+	err := p.client.UnregisterVM(pod.id)
+	span.SetError(err).Finish()
+
+	return err
 }
 
 // connect is the proxy connect implementation for ccProxy.
@@ -138,10 +172,11 @@ func (p *ccProxy) connect(pod Pod, createToken bool) (ProxyInfo, string, error)
 		return ProxyInfo{}, "", fmt.Errorf("Wrong proxy config type, should be CCProxyConfig type")
 	}
 
-	p.client, err = p.connectProxy(ccConfig.URL)
+	p.client, err = p.connectProxy(pod.ctx, ccConfig.URL)
 	if err != nil {
-		return ProxyInfo{}, "", err
+		return ProxyInfo{}, "", newPodError(ErrCodeProxyUnreachable, pod.id, err)
 	}
+	p.ctx = pod.ctx
 
 	// In case we are asked to create a token, this means the caller
 	// expects only one token to be generated.
@@ -154,7 +189,9 @@ func (p *ccProxy) connect(pod Pod, createToken bool) (ProxyInfo, string, error)
 		NumIOStreams: numTokens,
 	}
 
+	span := p.startRequestSpan("AttachVM", pod.id)
 	attachVMReturn, err := p.client.AttachVM(pod.id, attachVMOptions)
+	span.SetError(err).Finish()
 	if err != nil {
 		return ProxyInfo{}, "", err
 	}
@@ -207,5 +244,20 @@ func (p *ccProxy) sendCmd(cmd interface{}) (interface{}, error) {
 		tokens = append(tokens, proxyCmd.token)
 	}
 
-	return nil, p.client.HyperWithTokens(proxyCmd.cmd, tokens, proxyCmd.message)
+	span := p.startRequestSpan("Hyper", "")
+	span.SetTag("hyperstart.command", proxyCmd.cmd)
+
+	err := p.client.HyperWithTokens(proxyCmd.cmd, tokens, proxyCmd.message)
+	span.SetError(err).Finish()
+
+	return nil, err
+}
+
+// startRequestSpan starts the span timing a request sent to the proxy.
+func (p *ccProxy) startRequestSpan(request, podID string) *trace.Span {
+	span, _ := trace.StartSpan(p.ctx, proxyRequestSpan)
+	span.SetTag(proxyRequestTag, request)
+	span.SetTag(trace.TagPodID, podID)
+
+	return span
 }
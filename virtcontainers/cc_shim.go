@@ -80,9 +80,10 @@ func (s *ccShim) start(pod Pod, params ShimParams) (int, error) {
 			// Create Session
 			Setsid: true,
 
-			// Set Controlling terminal to Ctty
+			// Set Controlling terminal to Ctty, a descriptor in
+			// the child, here its stdin.
 			Setctty: true,
-			Ctty:    int(f.Fd()),
+			Ctty:    0,
 		}
 
 	}
@@ -23,7 +23,7 @@ import (
 	"testing"
 	"unsafe"
 
-	. "github.com/containers/virtcontainers/pkg/mock"
+	. "github.com/clearcontainers/runtime/virtcontainers/pkg/mock"
 )
 
 var testShimPath = "/usr/bin/virtcontainers/bin/test/shim"
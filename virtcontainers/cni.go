@@ -17,7 +17,7 @@
 package virtcontainers
 
 import (
-	cniPlugin "github.com/containers/virtcontainers/pkg/cni"
+	cniPlugin "github.com/clearcontainers/runtime/virtcontainers/pkg/cni"
 )
 
 // cni is a network implementation for the CNI plugin.
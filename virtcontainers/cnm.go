@@ -17,10 +17,12 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"net"
 
 	"github.com/01org/ciao/ssntp/uuid"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
 	cniTypes "github.com/containernetworking/cni/pkg/types"
 	types "github.com/containernetworking/cni/pkg/types/current"
 	"github.com/vishvananda/netlink"
@@ -115,7 +117,10 @@ func (n *cnm) createResult(iface net.Interface, addrs []net.Addr, routes []netli
 	return res, nil
 }
 
-func (n *cnm) createEndpointsFromScan(networkNSPath string) ([]Endpoint, error) {
+func (n *cnm) createEndpointsFromScan(ctx context.Context, networkNSPath string) ([]Endpoint, error) {
+	span, _ := trace.StartSpan(ctx, "createEndpointsFromScan")
+	defer span.Finish()
+
 	var endpoints []Endpoint
 
 	netIfaces, err := getIfacesFromNetNs(networkNSPath)
@@ -168,7 +173,7 @@ func (n *cnm) run(networkNSPath string, cb func() error) error {
 
 // add adds all needed interfaces inside the network namespace for the CNM network.
 func (n *cnm) add(pod Pod, config NetworkConfig, netNsPath string, netNsCreated bool) (NetworkNamespace, error) {
-	endpoints, err := n.createEndpointsFromScan(netNsPath)
+	endpoints, err := n.createEndpointsFromScan(pod.ctx, netNsPath)
 	if err != nil {
 		return NetworkNamespace{}, err
 	}
@@ -22,6 +22,8 @@ import (
 	"path/filepath"
 	"syscall"
 	"time"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
 )
 
 // Process gathers data related to a container process.
@@ -79,6 +81,11 @@ type ContainerConfig struct {
 	Annotations map[string]string
 
 	Mounts []Mount
+
+	// Resources are the vCPUs and memory the container workload needs.
+	// They are hotplugged to the VM when the container is added to a
+	// pod whose VM already runs.
+	Resources Resources
 }
 
 // valid checks that the container configuration is valid.
@@ -296,16 +303,22 @@ func createContainers(pod *Pod, contConfigs []ContainerConfig) ([]*Container, er
 		state, err := c.pod.storage.fetchContainerState(c.podID, c.id)
 		if err == nil {
 			c.state.State = state.State
+		} else if isCorruptResource(err) {
+			return nil, err
 		}
 
 		process, err := c.pod.storage.fetchContainerProcess(c.podID, c.id)
 		if err == nil {
 			c.process = process
+		} else if isCorruptResource(err) {
+			return nil, err
 		}
 
 		mounts, err := c.fetchMounts()
 		if err == nil {
 			c.mounts = mounts
+		} else if isCorruptResource(err) {
+			return nil, err
 		}
 
 		containers = append(containers, c)
@@ -381,7 +394,8 @@ func (c *Container) delete() error {
 	}
 
 	if state.State != StateReady && state.State != StateStopped {
-		return fmt.Errorf("Container not ready or stopped, impossible to delete")
+		return newContainerError(ErrCodeInvalidState, c.podID, c.id,
+			fmt.Errorf("Container not ready or stopped, impossible to delete"))
 	}
 
 	if err := stopShim(c.process.Pid); err != nil {
@@ -412,7 +426,8 @@ func (c *Container) fetchState(cmd string) (State, error) {
 	}
 
 	if state.State != StateRunning {
-		return State{}, fmt.Errorf("Pod not running, impossible to %s the container", cmd)
+		return State{}, newContainerError(ErrCodeInvalidState, c.podID, c.id,
+			fmt.Errorf("Pod not running, impossible to %s the container", cmd))
 	}
 
 	state, err = c.pod.storage.fetchContainerState(c.podID, c.id)
@@ -430,7 +445,8 @@ func (c *Container) start() error {
 	}
 
 	if state.State != StateReady && state.State != StateStopped {
-		return fmt.Errorf("Container not ready or stopped, impossible to start")
+		return newContainerError(ErrCodeInvalidState, c.podID, c.id,
+			fmt.Errorf("Container not ready or stopped, impossible to start"))
 	}
 
 	err = state.validTransition(StateReady, StateRunning)
@@ -449,7 +465,7 @@ func (c *Container) start() error {
 	err = c.pod.agent.startContainer(*(c.pod), *c)
 	if err != nil {
 		c.stop()
-		return err
+		return newContainerError(ErrCodeAgent, c.podID, c.id, err)
 	}
 
 	c.storeMounts()
@@ -469,7 +485,8 @@ func (c *Container) stop() error {
 	}
 
 	if state.State != StateRunning {
-		return fmt.Errorf("Container not running, impossible to stop")
+		return newContainerError(ErrCodeInvalidState, c.podID, c.id,
+			fmt.Errorf("Container not running, impossible to stop"))
 	}
 
 	err = state.validTransition(StateRunning, StateStopped)
@@ -484,12 +501,12 @@ func (c *Container) stop() error {
 
 	err = c.pod.agent.killContainer(*(c.pod), *c, syscall.SIGTERM, true)
 	if err != nil {
-		return err
+		return newContainerError(ErrCodeAgent, c.podID, c.id, err)
 	}
 
 	err = c.pod.agent.stopContainer(*(c.pod), *c)
 	if err != nil {
-		return err
+		return newContainerError(ErrCodeAgent, c.podID, c.id, err)
 	}
 
 	err = c.setContainerState(StateStopped)
@@ -507,7 +524,8 @@ func (c *Container) enter(cmd Cmd) (*Process, error) {
 	}
 
 	if state.State != StateRunning {
-		return nil, fmt.Errorf("Container not running, impossible to enter")
+		return nil, newContainerError(ErrCodeInvalidState, c.podID, c.id,
+			fmt.Errorf("Container not running, impossible to enter"))
 	}
 
 	proxyInfo, url, err := c.pod.proxy.connect(*(c.pod), true)
@@ -522,7 +540,7 @@ func (c *Container) enter(cmd Cmd) (*Process, error) {
 	}
 
 	if err := c.pod.agent.exec(c.pod, *c, *process, cmd); err != nil {
-		return nil, err
+		return nil, newContainerError(ErrCodeAgent, c.podID, c.id, err)
 	}
 
 	return process, nil
@@ -535,7 +553,8 @@ func (c *Container) kill(signal syscall.Signal, all bool) error {
 	}
 
 	if state.State != StateRunning {
-		return fmt.Errorf("Container not running, impossible to signal the container")
+		return newContainerError(ErrCodeInvalidState, c.podID, c.id,
+			fmt.Errorf("Container not running, impossible to signal the container"))
 	}
 
 	if _, _, err := c.pod.proxy.connect(*(c.pod), false); err != nil {
@@ -545,7 +564,7 @@ func (c *Container) kill(signal syscall.Signal, all bool) error {
 
 	err = c.pod.agent.killContainer(*(c.pod), *c, signal, all)
 	if err != nil {
-		return err
+		return newContainerError(ErrCodeAgent, c.podID, c.id, err)
 	}
 
 	return nil
@@ -562,7 +581,11 @@ func (c *Container) createShimProcess(token, url, console string) (*Process, err
 		Console: console,
 	}
 
+	span, _ := trace.StartSpan(c.pod.ctx, "startShim")
+	span.SetTag(trace.TagContainerID, c.id)
+
 	pid, err := c.pod.shim.start(*(c.pod), shimParams)
+	span.SetError(err).Finish()
 	if err != nil {
 		return &Process{}, err
 	}
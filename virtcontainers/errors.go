@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"errors"
+)
+
+// common error objects used for argument checking
+var (
+	errNeedPod         = errors.New("Pod must be specified")
+	errNeedPodID       = errors.New("Pod ID cannot be empty")
+	errNeedContainerID = errors.New("Container ID cannot be empty")
+	errNeedFile        = errors.New("File cannot be empty")
+	errNeedState       = errors.New("State cannot be empty")
+)
+
+// ErrorCode identifies the category of a failure, so that callers do not
+// have to rely on error messages.
+type ErrorCode string
+
+const (
+	// ErrCodePodNotFound is used when the pod does not exist.
+	ErrCodePodNotFound ErrorCode = "pod-not-found"
+
+	// ErrCodeContainerNotFound is used when the container does not
+	// belong to the pod.
+	ErrCodeContainerNotFound ErrorCode = "container-not-found"
+
+	// ErrCodeInvalidState is used when the pod or the container is
+	// not in a state allowing the operation.
+	ErrCodeInvalidState ErrorCode = "invalid-state"
+
+	// ErrCodeProxyUnreachable is used when the proxy cannot be reached.
+	ErrCodeProxyUnreachable ErrorCode = "proxy-unreachable"
+
+	// ErrCodeHypervisor is used when the hypervisor failed to start or
+	// to stop the VM.
+	ErrCodeHypervisor ErrorCode = "hypervisor-failure"
+
+	// ErrCodeAgent is used when the agent failed to run a command.
+	ErrCodeAgent ErrorCode = "agent-failure"
+
+	// ErrCodeCorruptState is used when a stored resource of the pod
+	// cannot be decoded.
+	ErrCodeCorruptState ErrorCode = "corrupt-state"
+)
+
+// Error is the error returned for the failures belonging to a known
+// category. Its message is the one of the error causing the failure.
+type Error struct {
+	Code        ErrorCode
+	PodID       string
+	ContainerID string
+	Err         error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func newPodError(code ErrorCode, podID string, err error) error {
+	return &Error{
+		Code:  code,
+		PodID: podID,
+		Err:   err,
+	}
+}
+
+func newContainerError(code ErrorCode, podID, containerID string, err error) error {
+	return &Error{
+		Code:        code,
+		PodID:       podID,
+		ContainerID: containerID,
+		Err:         err,
+	}
+}
+
+// setErrorPodID sets the pod ID of err when it was not known where the
+// error was created.
+func setErrorPodID(err error, podID string) error {
+	if e, ok := err.(*Error); ok && e.PodID == "" {
+		e.PodID = podID
+	}
+
+	return err
+}
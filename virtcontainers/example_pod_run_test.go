@@ -17,10 +17,11 @@
 package virtcontainers_test
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
-	vc "github.com/containers/virtcontainers"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
 )
 
 const containerRootfs = "/var/lib/container/bundle/"
@@ -80,7 +81,7 @@ func Example_createAndStartPod() {
 		Containers: []vc.ContainerConfig{container},
 	}
 
-	_, err := vc.RunPod(podConfig)
+	_, err := vc.RunPod(context.Background(), podConfig)
 	if err != nil {
 		fmt.Printf("Could not run pod: %s", err)
 	}
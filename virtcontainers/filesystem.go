@@ -65,6 +65,10 @@ const processFile = "process.json"
 // lockFile is the file name locking the usage of a pod.
 const lockFileName = "lock"
 
+// creatingFile is the file name marking a pod whose creation is in
+// progress.
+const creatingFile = "creating"
+
 const mountsFile = "mounts.json"
 
 // dirMode is the permission bits used for creating a directory
@@ -155,24 +159,63 @@ func (fs *filesystem) createAllResources(pod Pod) (err error) {
 	return nil
 }
 
+// storeFile atomically replaces file with the JSON encoding of data: the
+// data is written to a temporary file which is synced and then renamed.
+// That way, a process killed while storing a resource can never leave a
+// truncated file behind.
 func (fs *filesystem) storeFile(file string, data interface{}) error {
 	if file == "" {
 		return errNeedFile
 	}
 
-	f, err := os.Create(file)
+	jsonOut, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("Could not marshall data: %s", err)
+	}
+
+	dir := filepath.Dir(file)
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(file))
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	jsonOut, err := json.Marshal(data)
+	tmpFile := f.Name()
+
+	if _, err := f.Write(jsonOut); err != nil {
+		f.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	if err := os.Rename(tmpFile, file); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir makes the changes of the directory entries durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
 	if err != nil {
-		return fmt.Errorf("Could not marshall data: %s", err)
+		return err
 	}
-	f.Write(jsonOut)
+	defer d.Close()
 
-	return nil
+	return d.Sync()
 }
 
 func (fs *filesystem) fetchFile(file string, data interface{}) error {
@@ -187,12 +230,21 @@ func (fs *filesystem) fetchFile(file string, data interface{}) error {
 
 	err = json.Unmarshal([]byte(string(fileData)), data)
 	if err != nil {
-		return err
+		return newPodError(ErrCodeCorruptState, "",
+			fmt.Errorf("Corrupted file %s: %s", file, err))
 	}
 
 	return nil
 }
 
+// isCorruptResource returns true if err reports a resource which could
+// not be decoded.
+func isCorruptResource(err error) bool {
+	e, ok := err.(*Error)
+
+	return ok && e.Code == ErrCodeCorruptState
+}
+
 // resourceNeedsContainerID determines if the specified
 // podResource needs a containerID. Since some podResources can
 // be used for both pods and containers, it is necessary to specify
@@ -323,7 +375,7 @@ func (fs *filesystem) storeResource(podSpecific bool, podID, containerID string,
 			return err
 		}
 
-		return fs.storeFile(configFile, file)
+		return fs.storeResourceFile(configFile, file)
 
 	case State:
 		if resource != stateFileType {
@@ -335,7 +387,7 @@ func (fs *filesystem) storeResource(podSpecific bool, podID, containerID string,
 			return err
 		}
 
-		return fs.storeFile(stateFile, file)
+		return fs.storeResourceFile(stateFile, file)
 
 	case NetworkNamespace:
 		if resource != networkFileType {
@@ -348,7 +400,7 @@ func (fs *filesystem) storeResource(podSpecific bool, podID, containerID string,
 			return err
 		}
 
-		return fs.storeFile(networkFile, file)
+		return fs.storeResourceFile(networkFile, file)
 
 	case Process:
 		if resource != processFileType {
@@ -360,7 +412,7 @@ func (fs *filesystem) storeResource(podSpecific bool, podID, containerID string,
 			return err
 		}
 
-		return fs.storeFile(processFile, file)
+		return fs.storeResourceFile(processFile, file)
 	case []Mount:
 		if resource != mountsFileType {
 			return fmt.Errorf("Invalid pod resource")
@@ -371,7 +423,7 @@ func (fs *filesystem) storeResource(podSpecific bool, podID, containerID string,
 			return err
 		}
 
-		return fs.storeFile(mountsFile, file)
+		return fs.storeResourceFile(mountsFile, file)
 
 	default:
 		return fmt.Errorf("Invalid resource data type")
@@ -388,11 +440,16 @@ func (fs *filesystem) fetchResource(podSpecific bool, podID, containerID string,
 		return nil, err
 	}
 
+	kind, err := resourceKindOf(containerID, resource)
+	if err != nil {
+		return nil, err
+	}
+
 	switch resource {
 	case configFileType:
 		if containerID == "" {
 			config := PodConfig{}
-			err = fs.fetchFile(path, &config)
+			err = fs.fetchResourceFile(path, kind, &config)
 			if err != nil {
 				return nil, err
 			}
@@ -401,7 +458,7 @@ func (fs *filesystem) fetchResource(podSpecific bool, podID, containerID string,
 		}
 
 		config := ContainerConfig{}
-		err = fs.fetchFile(path, &config)
+		err = fs.fetchResourceFile(path, kind, &config)
 		if err != nil {
 			return nil, err
 		}
@@ -410,7 +467,7 @@ func (fs *filesystem) fetchResource(podSpecific bool, podID, containerID string,
 
 	case stateFileType:
 		state := State{}
-		err = fs.fetchFile(path, &state)
+		err = fs.fetchResourceFile(path, kind, &state)
 		if err != nil {
 			return nil, err
 		}
@@ -419,7 +476,7 @@ func (fs *filesystem) fetchResource(podSpecific bool, podID, containerID string,
 
 	case networkFileType:
 		networkNS := NetworkNamespace{}
-		err = fs.fetchFile(path, &networkNS)
+		err = fs.fetchResourceFile(path, kind, &networkNS)
 		if err != nil {
 			return nil, err
 		}
@@ -428,7 +485,7 @@ func (fs *filesystem) fetchResource(podSpecific bool, podID, containerID string,
 
 	case processFileType:
 		process := Process{}
-		err = fs.fetchFile(path, &process)
+		err = fs.fetchResourceFile(path, kind, &process)
 		if err != nil {
 			return nil, err
 		}
@@ -437,7 +494,7 @@ func (fs *filesystem) fetchResource(podSpecific bool, podID, containerID string,
 
 	case mountsFileType:
 		mounts := []Mount{}
-		err = fs.fetchFile(path, &mounts)
+		err = fs.fetchResourceFile(path, kind, &mounts)
 		if err != nil {
 			return nil, err
 		}
@@ -266,6 +266,38 @@ func TestFilesystemFetchFileFailingUnMarshalling(t *testing.T) {
 	if err == nil {
 		t.Fatal()
 	}
+
+	if !isCorruptResource(err) {
+		t.Fatalf("Expected a corrupt state error, got %v", err)
+	}
+}
+
+func TestFilesystemStoreFileNoTemporaryFileLeft(t *testing.T) {
+	fs := &filesystem{}
+	data := TestNoopStructure{}
+
+	dir, err := ioutil.TempDir(testDir, "storeFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "testFilesystem")
+
+	for i := 0; i < 2; i++ {
+		if err := fs.storeFile(path, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "testFilesystem" {
+		t.Fatalf("Unexpected directory content %v", entries)
+	}
 }
 
 func TestFilesystemFetchContainerConfigSuccessful(t *testing.T) {
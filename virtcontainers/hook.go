@@ -18,15 +18,24 @@ package virtcontainers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"time"
 
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
+// Span and tags recording the run of the hooks.
+const (
+	hookSpan     = "hook"
+	hookStageTag = "hook.stage"
+	hookPathTag  = "hook.path"
+)
+
 // Hook represents an OCI hook, including its required parameters.
 type Hook struct {
 	Path    string
@@ -48,7 +57,7 @@ func buildHookState(processID int) specs.State {
 	}
 }
 
-func (h *Hook) runHook() error {
+func (h *Hook) runHook(ctx context.Context) error {
 	state := buildHookState(os.Getpid())
 	stateJSON, err := json.Marshal(state)
 	if err != nil {
@@ -70,36 +79,56 @@ func (h *Hook) runHook() error {
 		return err
 	}
 
-	if h.Timeout == 0 {
-		err = cmd.Wait()
+	// A hook without timeout is only bounded by the context.
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(h.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
 		if err != nil {
 			return fmt.Errorf("%s: stdout: %s, stderr: %s", err, stdout.String(), stderr.String())
 		}
-	} else {
-		done := make(chan error)
-
-		go func() { done <- cmd.Wait() }()
+	case <-ctx.Done():
+		// Do not leave the hook running behind us.
+		cmd.Process.Kill()
+		<-done
 
-		select {
-		case err := <-done:
-			if err != nil {
-				return fmt.Errorf("%s: stdout: %s, stderr: %s", err, stdout.String(), stderr.String())
-			}
-		case <-time.After(time.Duration(h.Timeout) * time.Second):
+		if ctx.Err() == context.DeadlineExceeded {
 			return fmt.Errorf("Hook timeout")
 		}
+
+		return ctx.Err()
 	}
 
 	return nil
 }
 
-func (h *Hooks) preStartHooks() error {
+// startHookSpan starts the span timing the run of the hook at stage.
+func startHookSpan(ctx context.Context, hook Hook, stage string) *trace.Span {
+	span, _ := trace.StartSpan(ctx, hookSpan)
+	span.SetTag(hookStageTag, stage)
+	span.SetTag(hookPathTag, hook.Path)
+
+	return span
+}
+
+func (h *Hooks) preStartHooks(ctx context.Context) error {
 	if len(h.PreStartHooks) == 0 {
 		return nil
 	}
 
 	for _, hook := range h.PreStartHooks {
-		err := hook.runHook()
+		span := startHookSpan(ctx, hook, "prestart")
+
+		err := hook.runHook(ctx)
+		span.SetError(err).Finish()
 		if err != nil {
 			virtLog.Errorf("PreStartHook error: %s", err)
 			return err
@@ -109,13 +138,16 @@ func (h *Hooks) preStartHooks() error {
 	return nil
 }
 
-func (h *Hooks) postStartHooks() error {
+func (h *Hooks) postStartHooks(ctx context.Context) error {
 	if len(h.PostStartHooks) == 0 {
 		return nil
 	}
 
 	for _, hook := range h.PostStartHooks {
-		err := hook.runHook()
+		span := startHookSpan(ctx, hook, "poststart")
+
+		err := hook.runHook(ctx)
+		span.SetError(err).Finish()
 		if err != nil {
 			// In case of post start hook, the error is not fatal,
 			// just need to be logged.
@@ -126,13 +158,16 @@ func (h *Hooks) postStartHooks() error {
 	return nil
 }
 
-func (h *Hooks) postStopHooks() error {
+func (h *Hooks) postStopHooks(ctx context.Context) error {
 	if len(h.PostStopHooks) == 0 {
 		return nil
 	}
 
 	for _, hook := range h.PostStopHooks {
-		err := hook.runHook()
+		span := startHookSpan(ctx, hook, "poststop")
+
+		err := hook.runHook(ctx)
+		span.SetError(err).Finish()
 		if err != nil {
 			// In case of post stop hook, the error is not fatal,
 			// just need to be logged.
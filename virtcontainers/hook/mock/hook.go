@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// The mock hook checks it is run with the arguments of the virtcontainers
+// hook tests and with the state of a process on its standard input. An
+// extra argument makes it sleep for that many seconds first.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// The arguments the hook tests run the hook with.
+var expectedArgs = []string{"test-key", "test-container-id", "test-controller-id"}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	args := os.Args
+
+	if len(args) < len(expectedArgs) {
+		fail("Expected %d arguments, got %v", len(expectedArgs), args)
+	}
+
+	for i, arg := range expectedArgs {
+		if args[i] != arg {
+			fail("Expected argument %d to be %q, got %q", i, arg, args[i])
+		}
+	}
+
+	if len(args) > len(expectedArgs) {
+		seconds, err := strconv.Atoi(args[len(expectedArgs)])
+		if err != nil {
+			fail("Invalid sleep duration %q: %v", args[len(expectedArgs)], err)
+		}
+
+		time.Sleep(time.Duration(seconds) * time.Second)
+	}
+
+	var state specs.State
+	if err := json.NewDecoder(os.Stdin).Decode(&state); err != nil {
+		fail("Could not decode the state: %v", err)
+	}
+
+	if state.Pid <= 0 {
+		fail("Invalid PID %d in the state", state.Pid)
+	}
+}
@@ -17,11 +17,12 @@
 package virtcontainers
 
 import (
+	"context"
 	"os"
 	"reflect"
 	"testing"
 
-	. "github.com/containers/virtcontainers/pkg/mock"
+	. "github.com/clearcontainers/runtime/virtcontainers/pkg/mock"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
@@ -72,7 +73,7 @@ func createWrongHook() *Hook {
 func testRunHook(t *testing.T, timeout int) {
 	hook := createHook(timeout)
 
-	err := hook.runHook()
+	err := hook.runHook(context.Background())
 	if err != nil {
 		t.Fatal()
 	}
@@ -91,7 +92,7 @@ func TestRunHookTimeout(t *testing.T) {
 func TestRunHookExitFailure(t *testing.T) {
 	hook := createWrongHook()
 
-	err := hook.runHook()
+	err := hook.runHook(context.Background())
 	if err == nil {
 		t.Fatal()
 	}
@@ -102,7 +103,7 @@ func TestRunHookTimeoutFailure(t *testing.T) {
 
 	hook.Args = append(hook.Args, "2")
 
-	err := hook.runHook()
+	err := hook.runHook(context.Background())
 	if err == nil {
 		t.Fatal()
 	}
@@ -115,17 +116,17 @@ func testHooks(t *testing.T, hook *Hook) {
 		PostStopHooks:  []Hook{*hook},
 	}
 
-	err := hooks.preStartHooks()
+	err := hooks.preStartHooks(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStartHooks()
+	err = hooks.postStartHooks(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStopHooks()
+	err = hooks.postStopHooks(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -138,17 +139,17 @@ func testFailingHooks(t *testing.T, hook *Hook) {
 		PostStopHooks:  []Hook{*hook},
 	}
 
-	err := hooks.preStartHooks()
+	err := hooks.preStartHooks(context.Background())
 	if err == nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStartHooks()
+	err = hooks.postStartHooks(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStopHooks()
+	err = hooks.postStopHooks(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -169,17 +170,17 @@ func TestFailingHooks(t *testing.T) {
 func TestEmptyHooks(t *testing.T) {
 	hooks := &Hooks{}
 
-	err := hooks.preStartHooks()
+	err := hooks.preStartHooks(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStartHooks()
+	err = hooks.postStartHooks(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStopHooks()
+	err = hooks.postStopHooks(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -23,7 +23,7 @@ import (
 	"path/filepath"
 	"syscall"
 
-	"github.com/containers/virtcontainers/pkg/hyperstart"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/hyperstart"
 )
 
 var defaultSockPathTemplates = []string{"/tmp/hyper-pod-%s.sock", "/tmp/tty-pod%s.sock"}
@@ -594,6 +594,18 @@ func (h *hyper) killContainer(pod Pod, c Container, signal syscall.Signal, all b
 	return h.killOneContainer(c.id, signal, all)
 }
 
+// onlineCPUMem is the agent vCPUs and memory onlining implementation for
+// hyperstart.
+func (h *hyper) onlineCPUMem() error {
+	proxyCmd := hyperstartProxyCmd{
+		cmd:     hyperstart.OnlineCPUMem,
+		message: nil,
+	}
+
+	_, err := h.proxy.sendCmd(proxyCmd)
+	return err
+}
+
 func (h *hyper) killOneContainer(cID string, signal syscall.Signal, all bool) error {
 	killCmd := hyperstart.KillCommand{
 		Container:    cID,
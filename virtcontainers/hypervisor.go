@@ -17,6 +17,7 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -97,8 +98,8 @@ func newHypervisor(hType HypervisorType) (hypervisor, error) {
 
 // Param is a key/value representation for hypervisor and kernel parameters.
 type Param struct {
-	parameter string
-	value     string
+	Key   string
+	Value string
 }
 
 // HypervisorConfig is the hypervisor configuration.
@@ -109,6 +110,10 @@ type HypervisorConfig struct {
 	// ImagePath is the guest image host path.
 	ImagePath string
 
+	// InitrdPath is the guest initrd host path. When set, the guest
+	// boots from the initrd instead of the image.
+	InitrdPath string
+
 	// HypervisorPath is the hypervisor executable host path.
 	HypervisorPath string
 
@@ -125,6 +130,20 @@ type HypervisorConfig struct {
 	// Debug changes the default hypervisor and kernel parameters to
 	// enable debug output where available.
 	Debug bool
+
+	// HugePages backs the guest memory with the huge pages of the host.
+	HugePages bool
+
+	// MemPrealloc allocates all the guest memory when the VM starts.
+	MemPrealloc bool
+
+	// NUMANodes are the host NUMA nodes the guest memory and vCPU
+	// threads are bound to, none meaning they are not bound.
+	NUMANodes []uint
+
+	// CPUModel is the model of the vCPUs, the host CPU model being
+	// used by default.
+	CPUModel string
 }
 
 func (conf *HypervisorConfig) valid() (bool, error) {
@@ -132,8 +151,8 @@ func (conf *HypervisorConfig) valid() (bool, error) {
 		return false, fmt.Errorf("Missing kernel path")
 	}
 
-	if conf.ImagePath == "" {
-		return false, fmt.Errorf("Missing image path")
+	if conf.ImagePath == "" && conf.InitrdPath == "" {
+		return false, fmt.Errorf("Missing image or initrd path")
 	}
 
 	return true, nil
@@ -147,17 +166,17 @@ func serializeParams(params []Param, delim string) []string {
 	var parameters []string
 
 	for _, p := range params {
-		if p.parameter == "" && p.value == "" {
+		if p.Key == "" && p.Value == "" {
 			continue
-		} else if p.parameter == "" {
-			parameters = append(parameters, fmt.Sprintf("%s", p.value))
-		} else if p.value == "" {
-			parameters = append(parameters, fmt.Sprintf("%s", p.parameter))
+		} else if p.Key == "" {
+			parameters = append(parameters, fmt.Sprintf("%s", p.Value))
+		} else if p.Value == "" {
+			parameters = append(parameters, fmt.Sprintf("%s", p.Key))
 		} else if delim == "" {
-			parameters = append(parameters, fmt.Sprintf("%s", p.parameter))
-			parameters = append(parameters, fmt.Sprintf("%s", p.value))
+			parameters = append(parameters, fmt.Sprintf("%s", p.Key))
+			parameters = append(parameters, fmt.Sprintf("%s", p.Value))
 		} else {
-			parameters = append(parameters, fmt.Sprintf("%s%s%s", p.parameter, delim, p.value))
+			parameters = append(parameters, fmt.Sprintf("%s%s%s", p.Key, delim, p.Value))
 		}
 	}
 
@@ -169,10 +188,31 @@ func serializeParams(params []Param, delim string) []string {
 type hypervisor interface {
 	init(config HypervisorConfig) error
 	createPod(podConfig PodConfig) error
-	startPod(startCh, stopCh chan struct{}) error
-	stopPod() error
-	pausePod() error
-	resumePod() error
+	startPod(ctx context.Context, startCh, stopCh chan struct{}) error
+	stopPod(ctx context.Context) error
+	pausePod(ctx context.Context) error
+	resumePod(ctx context.Context) error
 	addDevice(devInfo interface{}, devType deviceType) error
 	getPodConsole(podID string) string
+
+	// resizeBalloon inflates or deflates the memory balloon of the VM
+	// so that the guest is left with memory MiB.
+	resizeBalloon(ctx context.Context, memory uint) error
+
+	// guestMemory returns the memory in MiB the balloon currently
+	// leaves to the guest.
+	guestMemory(ctx context.Context) (uint, error)
+
+	// hotplugResources adds vCPUs and memory to the running VM, within
+	// the maximum reserved when it was started, and returns what was
+	// actually added.
+	hotplugResources(ctx context.Context, resources Resources) (Resources, error)
+
+	// hotunplugResources removes hotplugged vCPUs and memory from the
+	// running VM and returns what was actually removed.
+	hotunplugResources(ctx context.Context, resources Resources) (Resources, error)
+
+	// pid returns the PID of the process running the VM, 0 when
+	// there is none.
+	pid() (int, error)
 }
@@ -142,6 +142,16 @@ func TestHypervisorConfigNoImagePath(t *testing.T) {
 	testHypervisorConfigValid(t, hypervisorConfig, false)
 }
 
+func TestHypervisorConfigInitrdPath(t *testing.T) {
+	hypervisorConfig := &HypervisorConfig{
+		KernelPath:     fmt.Sprintf("%s/%s", testDir, testKernel),
+		InitrdPath:     fmt.Sprintf("%s/%s", testDir, testInitrd),
+		HypervisorPath: fmt.Sprintf("%s/%s", testDir, testHypervisor),
+	}
+
+	testHypervisorConfigValid(t, hypervisorConfig, true)
+}
+
 func TestHypervisorConfigNoHypervisorPath(t *testing.T) {
 	hypervisorConfig := &HypervisorConfig{
 		KernelPath:     fmt.Sprintf("%s/%s", testDir, testKernel),
@@ -165,19 +175,19 @@ func TestHypervisorConfigIsValid(t *testing.T) {
 func TestAppendParams(t *testing.T) {
 	paramList := []Param{
 		{
-			parameter: "param1",
-			value:     "value1",
+			Key:   "param1",
+			Value: "value1",
 		},
 	}
 
 	expectedParams := []Param{
 		{
-			parameter: "param1",
-			value:     "value1",
+			Key:   "param1",
+			Value: "value1",
 		},
 		{
-			parameter: "param2",
-			value:     "value2",
+			Key:   "param2",
+			Value: "value2",
 		},
 	}
 
@@ -197,8 +207,8 @@ func testSerializeParams(t *testing.T, params []Param, delim string, expected []
 func TestSerializeParamsNoParamNoValue(t *testing.T) {
 	params := []Param{
 		{
-			parameter: "",
-			value:     "",
+			Key:   "",
+			Value: "",
 		},
 	}
 	var expected []string
@@ -209,7 +219,7 @@ func TestSerializeParamsNoParamNoValue(t *testing.T) {
 func TestSerializeParamsNoParam(t *testing.T) {
 	params := []Param{
 		{
-			value: "value1",
+			Value: "value1",
 		},
 	}
 
@@ -221,7 +231,7 @@ func TestSerializeParamsNoParam(t *testing.T) {
 func TestSerializeParamsNoValue(t *testing.T) {
 	params := []Param{
 		{
-			parameter: "param1",
+			Key: "param1",
 		},
 	}
 
@@ -233,8 +243,8 @@ func TestSerializeParamsNoValue(t *testing.T) {
 func TestSerializeParamsNoDelim(t *testing.T) {
 	params := []Param{
 		{
-			parameter: "param1",
-			value:     "value1",
+			Key:   "param1",
+			Value: "value1",
 		},
 	}
 
@@ -246,8 +256,8 @@ func TestSerializeParamsNoDelim(t *testing.T) {
 func TestSerializeParams(t *testing.T) {
 	params := []Param{
 		{
-			parameter: "param1",
-			value:     "value1",
+			Key:   "param1",
+			Value: "value1",
 		},
 	}
 
@@ -0,0 +1,352 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// schemaVersion is the version of the format of the pod and container
+// resources stored by this version of virtcontainers. It has to be
+// increased whenever one of the stored structures changes in a way older
+// files cannot be decoded as is, along with the registration of the
+// migrations upgrading those files. It is a variable to allow tests to
+// modify it.
+//
+// Version 0 is the format of the files stored before the resources were
+// versioned: the bare JSON data, without any envelope.
+var schemaVersion = 1
+
+// versionedResource is the envelope of every stored resource.
+type versionedResource struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	Data          interface{} `json:"data"`
+}
+
+// resourceKind identifies the structure stored in a resource file.
+type resourceKind string
+
+const (
+	podConfigKind       resourceKind = "PodConfig"
+	containerConfigKind resourceKind = "ContainerConfig"
+	stateKind           resourceKind = "State"
+	networkKind         resourceKind = "NetworkNamespace"
+	processKind         resourceKind = "Process"
+	mountsKind          resourceKind = "Mounts"
+)
+
+func resourceKindOf(containerID string, resource podResource) (resourceKind, error) {
+	switch resource {
+	case configFileType:
+		if containerID == "" {
+			return podConfigKind, nil
+		}
+
+		return containerConfigKind, nil
+	case stateFileType:
+		return stateKind, nil
+	case networkFileType:
+		return networkKind, nil
+	case processFileType:
+		return processKind, nil
+	case mountsFileType:
+		return mountsKind, nil
+	}
+
+	return "", fmt.Errorf("Invalid pod resource")
+}
+
+// migrationFunc upgrades the data of a resource from a schema version to
+// the next one.
+type migrationFunc func(data json.RawMessage) (json.RawMessage, error)
+
+// migrations holds, for each kind of resource, the functions upgrading its
+// data from a schema version to the next one. A version which did not
+// change the format of a resource does not need any function.
+var migrations = make(map[resourceKind]map[int]migrationFunc)
+
+func init() {
+	for _, kind := range []resourceKind{podConfigKind, containerConfigKind, stateKind,
+		networkKind, processKind, mountsKind} {
+		registerMigration(kind, 0, migrateUnversioned)
+	}
+}
+
+// registerMigration registers f as the function upgrading the resources
+// of the given kind from the schema version from to the next one.
+func registerMigration(kind resourceKind, from int, f migrationFunc) {
+	if migrations[kind] == nil {
+		migrations[kind] = make(map[int]migrationFunc)
+	}
+
+	migrations[kind][from] = f
+}
+
+// migrateUnversioned upgrades a resource stored before the resources were
+// versioned: its bare JSON data becomes, unchanged, the data of the
+// envelope of version 1.
+func migrateUnversioned(data json.RawMessage) (json.RawMessage, error) {
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("Invalid JSON data")
+	}
+
+	return data, nil
+}
+
+// decodeVersionedResource returns the schema version and the data of the
+// content of a resource file.
+func decodeVersionedResource(content []byte) (int, json.RawMessage) {
+	var fields map[string]json.RawMessage
+
+	// Anything else than an object made of the envelope fields is an
+	// unversioned resource.
+	if err := json.Unmarshal(content, &fields); err != nil || len(fields) != 2 {
+		return 0, content
+	}
+
+	data, ok := fields["data"]
+	if !ok {
+		return 0, content
+	}
+
+	var version int
+	if err := json.Unmarshal(fields["schemaVersion"], &version); err != nil {
+		return 0, content
+	}
+
+	return version, data
+}
+
+// upgradeResource returns the data of the content of a resource file,
+// upgraded to the current schema version, along with the version it was
+// stored with. A resource its migrations cannot upgrade is corrupted.
+func upgradeResource(kind resourceKind, content []byte) (int, json.RawMessage, error) {
+	version, data := decodeVersionedResource(content)
+
+	if version > schemaVersion {
+		return version, nil, fmt.Errorf("%s stored with schema version %d, newer than the supported version %d",
+			kind, version, schemaVersion)
+	}
+
+	for v := version; v < schemaVersion; v++ {
+		migrate, ok := migrations[kind][v]
+		if !ok {
+			continue
+		}
+
+		var err error
+		data, err = migrate(data)
+		if err != nil {
+			return version, nil, newPodError(ErrCodeCorruptState, "",
+				fmt.Errorf("Could not migrate %s from schema version %d: %s", kind, v, err))
+		}
+	}
+
+	return version, data, nil
+}
+
+// resourceFileError prefixes the error of a resource with its file, a
+// corrupted resource staying one.
+func resourceFileError(file string, err error) error {
+	fileErr := fmt.Errorf("%s: %s", file, err)
+	if isCorruptResource(err) {
+		return newPodError(ErrCodeCorruptState, "", fileErr)
+	}
+
+	return fileErr
+}
+
+// storeResourceFile stores data in its envelope.
+func (fs *filesystem) storeResourceFile(file string, data interface{}) error {
+	return fs.storeFile(file, versionedResource{
+		SchemaVersion: schemaVersion,
+		Data:          data,
+	})
+}
+
+// fetchResourceFile decodes into data the resource stored in file,
+// upgrading it to the current schema version if needed. The file itself is
+// only rewritten the next time the resource is stored.
+func (fs *filesystem) fetchResourceFile(file string, kind resourceKind, data interface{}) error {
+	if file == "" {
+		return errNeedFile
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	_, upgraded, err := upgradeResource(kind, content)
+	if err != nil {
+		return resourceFileError(file, err)
+	}
+
+	if err := json.Unmarshal(upgraded, data); err != nil {
+		return newPodError(ErrCodeCorruptState, "",
+			fmt.Errorf("Corrupted file %s: %s", file, err))
+	}
+
+	return nil
+}
+
+// migrateResource rewrites the resource with the current schema version,
+// returning true if it was stored with an older one.
+func (fs *filesystem) migrateResource(podSpecific bool, podID, containerID string, resource podResource) (bool, error) {
+	kind, err := resourceKindOf(containerID, resource)
+	if err != nil {
+		return false, err
+	}
+
+	file, _, err := fs.resourceURI(podSpecific, podID, containerID, resource)
+	if err != nil {
+		return false, err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	version, data, err := upgradeResource(kind, content)
+	if err != nil {
+		return false, resourceFileError(file, err)
+	}
+
+	if version == schemaVersion {
+		return false, nil
+	}
+
+	if err := fs.storeFile(file, versionedResource{SchemaVersion: schemaVersion, Data: data}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PodMigration reports the migration of the resources of a pod.
+type PodMigration struct {
+	ID string
+
+	// Upgraded is the number of resource files which were rewritten.
+	Upgraded int
+
+	// Quarantined is set when the pod could not be migrated because
+	// its resources are corrupted, and was moved away.
+	Quarantined *QuarantinedPod
+
+	Err error
+}
+
+// migratePod upgrades all the resources of the pod to the current schema
+// version.
+func migratePod(ctx context.Context, podID string) (int, error) {
+	lockFile, err := lockPod(ctx, podID)
+	if err != nil {
+		return 0, err
+	}
+	defer unlockPod(lockFile)
+
+	fs := filesystem{}
+	upgraded := 0
+
+	migrate := func(podSpecific bool, containerID string, resources ...podResource) error {
+		for _, resource := range resources {
+			done, err := fs.migrateResource(podSpecific, podID, containerID, resource)
+			if err != nil {
+				return err
+			}
+
+			if done {
+				upgraded++
+			}
+		}
+
+		return nil
+	}
+
+	if err := migrate(true, "", configFileType, stateFileType, networkFileType); err != nil {
+		return upgraded, err
+	}
+
+	config, err := fs.fetchPodConfig(podID)
+	if err != nil {
+		return upgraded, err
+	}
+
+	for _, container := range config.Containers {
+		if err := migrate(false, container.ID, configFileType, stateFileType, processFileType, mountsFileType); err != nil {
+			return upgraded, err
+		}
+	}
+
+	return upgraded, nil
+}
+
+// MigratePods is the virtcontainers entry point upgrading the stored
+// resources of all the pods to the current schema version. It is meant to
+// be run after an upgrade, the resources of older versions being otherwise
+// upgraded in memory every time they are read. The pods whose resources are
+// corrupted are quarantined, killing their VM.
+func MigratePods(ctx context.Context) ([]PodMigration, error) {
+	dir, err := os.Open(configStoragePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []PodMigration{}, nil
+		}
+
+		return []PodMigration{}, err
+	}
+	defer dir.Close()
+
+	podsID, err := dir.Readdirnames(0)
+	if err != nil {
+		return []PodMigration{}, err
+	}
+
+	result := []PodMigration{}
+
+	for _, podID := range podsID {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		migration := PodMigration{ID: podID}
+		migration.Upgraded, migration.Err = migratePod(ctx, podID)
+
+		if isCorruptResource(migration.Err) {
+			q, err := QuarantinePod(ctx, podID)
+			if err != nil {
+				virtLog.Warnf("Could not quarantine corrupted pod %s: %s", podID, err)
+			} else {
+				migration.Quarantined = &q
+			}
+		}
+
+		result = append(result, migration)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,350 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// unversionedPodDir holds the resources of the test pod, created and
+// started with a noop agent, as stored by virtcontainers before the
+// resources were versioned. It has a directory per storage path.
+var unversionedPodDir = filepath.Join("testdata", "unversioned-pod")
+
+// writeUnversionedPod stores the resources of the unversioned test pod and
+// returns the paths of its resource files.
+func writeUnversionedPod(t *testing.T) []string {
+	cleanUp()
+
+	var files []string
+
+	for dir, storagePath := range map[string]string{
+		"config": configStoragePath,
+		"run":    runStoragePath,
+	} {
+		src := filepath.Join(unversionedPodDir, dir)
+
+		err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			dest := filepath.Join(storagePath, rel)
+			if err := os.MkdirAll(filepath.Dir(dest), dirMode); err != nil {
+				return err
+			}
+
+			if err := ioutil.WriteFile(dest, content, 0640); err != nil {
+				return err
+			}
+
+			// The lock file is no resource.
+			if filepath.Ext(dest) == ".json" {
+				files = append(files, dest)
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return files
+}
+
+func TestFilesystemFetchUnversionedResources(t *testing.T) {
+	writeUnversionedPod(t)
+	defer cleanUp()
+
+	fs := &filesystem{}
+
+	config, err := fs.fetchPodConfig(testPodID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ID != testPodID || config.HypervisorType != MockHypervisor || config.AgentType != NoopAgentType ||
+		len(config.Containers) != 1 || config.Containers[0].ID != containerID {
+		t.Fatalf("Unexpected pod config %+v", config)
+	}
+
+	state, err := fs.fetchPodState(testPodID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.State != StateRunning || state.URL != "noopProxyURL" {
+		t.Fatalf("Unexpected pod state %+v", state)
+	}
+
+	if _, err := fs.fetchPodNetwork(testPodID); err != nil {
+		t.Fatal(err)
+	}
+
+	contConfig, err := fs.fetchContainerConfig(testPodID, containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contConfig.ID != containerID || !reflect.DeepEqual(contConfig.Cmd.Args, []string{"/bin/sh"}) {
+		t.Fatalf("Unexpected container config %+v", contConfig)
+	}
+
+	contState, err := fs.fetchContainerState(testPodID, containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contState.State != StateRunning {
+		t.Fatalf("Unexpected container state %+v", contState)
+	}
+
+	process, err := fs.fetchContainerProcess(testPodID, containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if process.StartTime.IsZero() {
+		t.Fatalf("Unexpected process %+v", process)
+	}
+
+	mounts, err := fs.fetchContainerMounts(testPodID, containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mounts) != 0 {
+		t.Fatalf("Unexpected mounts %+v", mounts)
+	}
+}
+
+func TestFilesystemStoreVersionedResource(t *testing.T) {
+	cleanUp()
+	defer cleanUp()
+
+	fs := &filesystem{}
+	state := State{State: StateReady}
+
+	path := filepath.Join(runStoragePath, testPodID, stateFile)
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.storePodResource(testPodID, stateFileType, state); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf(`{"schemaVersion":%d,"data":{"state":"ready"}}`, schemaVersion)
+	if string(content) != expected {
+		t.Fatalf("Got %s, expecting %s", content, expected)
+	}
+
+	fetched, err := fs.fetchPodState(testPodID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fetched, state) {
+		t.Fatalf("Got %+v, expecting %+v", fetched, state)
+	}
+}
+
+// withMigration runs f with a schema version 2 upgrading the states stored
+// with version 1, in which the state was named "status".
+func withMigration(f func()) {
+	savedSchemaVersion := schemaVersion
+	savedMigrations := migrations
+
+	defer func() {
+		schemaVersion = savedSchemaVersion
+		migrations = savedMigrations
+	}()
+
+	schemaVersion = 2
+	migrations = make(map[resourceKind]map[int]migrationFunc)
+
+	for kind, kindMigrations := range savedMigrations {
+		for from, f := range kindMigrations {
+			registerMigration(kind, from, f)
+		}
+	}
+
+	registerMigration(stateKind, 1, func(data json.RawMessage) (json.RawMessage, error) {
+		var old struct {
+			Status string `json:"status"`
+		}
+
+		if err := json.Unmarshal(data, &old); err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(State{State: stateString(old.Status)})
+	})
+
+	f()
+}
+
+func TestUpgradeResource(t *testing.T) {
+	withMigration(func() {
+		type testData struct {
+			content  string
+			version  int
+			expected State
+		}
+
+		data := []testData{
+			{`{"status":"ready"}`, 0, State{State: StateReady}},
+			{`{"schemaVersion":1,"data":{"status":"paused"}}`, 1, State{State: StatePaused}},
+			{`{"schemaVersion":2,"data":{"state":"stopped"}}`, 2, State{State: StateStopped}},
+		}
+
+		for _, d := range data {
+			version, upgraded, err := upgradeResource(stateKind, []byte(d.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if version != d.version {
+				t.Fatalf("%s: got version %d, expecting %d", d.content, version, d.version)
+			}
+
+			var state State
+			if err := json.Unmarshal(upgraded, &state); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(state, d.expected) {
+				t.Fatalf("%s: got %+v, expecting %+v", d.content, state, d.expected)
+			}
+		}
+	})
+}
+
+func TestUpgradeResourceNewerVersion(t *testing.T) {
+	content := fmt.Sprintf(`{"schemaVersion":%d,"data":{"state":"ready"}}`, schemaVersion+1)
+
+	_, _, err := upgradeResource(stateKind, []byte(content))
+	if err == nil {
+		t.Fatal()
+	}
+
+	// A resource stored by a newer version must not be quarantined.
+	if isCorruptResource(err) {
+		t.Fatalf("Unexpected corrupt state error %v", err)
+	}
+}
+
+func TestUpgradeResourceUnversioned(t *testing.T) {
+	for _, kind := range []resourceKind{podConfigKind, containerConfigKind, stateKind,
+		networkKind, processKind, mountsKind} {
+		if migrations[kind][0] == nil {
+			t.Fatalf("No migration registered for unversioned %s", kind)
+		}
+	}
+
+	version, upgraded, err := upgradeResource(stateKind, []byte(`{"state":"ready"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != 0 || string(upgraded) != `{"state":"ready"}` {
+		t.Fatalf("Got version %d and %s", version, upgraded)
+	}
+
+	// An unversioned resource which is not JSON cannot be migrated.
+	if _, _, err := upgradeResource(stateKind, []byte("{")); !isCorruptResource(err) {
+		t.Fatalf("Expected a corrupt state error, got %v", err)
+	}
+}
+
+func TestMigratePods(t *testing.T) {
+	files := writeUnversionedPod(t)
+	defer cleanUp()
+
+	result, err := MigratePods(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []PodMigration{{ID: testPodID, Upgraded: len(files)}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Got %+v, expecting %+v", result, expected)
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if version, _ := decodeVersionedResource(content); version != schemaVersion {
+			t.Fatalf("%s: got version %d, expecting %d", file, version, schemaVersion)
+		}
+	}
+
+	// The resources are up to date.
+	result, err = MigratePods(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []PodMigration{{ID: testPodID}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Got %+v, expecting %+v", result, expected)
+	}
+}
+
+func TestMigratePodsQuarantinesCorruptedPod(t *testing.T) {
+	writeCorruptedPod(t)
+	defer cleanUp()
+
+	result, err := MigratePods(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != 1 || result[0].Quarantined == nil || !isCorruptResource(result[0].Err) {
+		t.Fatalf("Unexpected migration %+v", result)
+	}
+
+	if _, err := os.Stat(filepath.Join(configStoragePath, testPodID)); !os.IsNotExist(err) {
+		t.Fatalf("The pod should have been moved: %v", err)
+	}
+}
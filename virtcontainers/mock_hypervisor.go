@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"sync"
+)
+
+// mockBalloons records the guest memory left by the balloon of each
+// pod, as every fetch of a pod creates a new mock hypervisor.
+var mockBalloons = struct {
+	sync.Mutex
+	memory map[string]uint
+}{memory: make(map[string]uint)}
+
+type mockHypervisor struct {
+	podID  string
+	memory uint
+}
+
+func (m *mockHypervisor) init(config HypervisorConfig) error {
+	valid, err := config.valid()
+	if valid == false || err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *mockHypervisor) createPod(podConfig PodConfig) error {
+	m.podID = podConfig.ID
+	m.memory = podConfig.VMConfig.Memory
+	return nil
+}
+
+func (m *mockHypervisor) startPod(ctx context.Context, startCh, stopCh chan struct{}) error {
+	var msg struct{}
+	startCh <- msg
+	return nil
+}
+
+func (m *mockHypervisor) stopPod(ctx context.Context) error {
+	mockBalloons.Lock()
+	defer mockBalloons.Unlock()
+
+	delete(mockBalloons.memory, m.podID)
+	return nil
+}
+
+func (m *mockHypervisor) pausePod(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockHypervisor) resumePod(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockHypervisor) addDevice(devInfo interface{}, devType deviceType) error {
+	return nil
+}
+
+func (m *mockHypervisor) getPodConsole(podID string) string {
+	return ""
+}
+
+func (m *mockHypervisor) resizeBalloon(ctx context.Context, memory uint) error {
+	mockBalloons.Lock()
+	defer mockBalloons.Unlock()
+
+	mockBalloons.memory[m.podID] = memory
+	return nil
+}
+
+// guestMemory reports the memory last requested through resizeBalloon,
+// or all the memory of the VM when its balloon was never resized.
+func (m *mockHypervisor) guestMemory(ctx context.Context) (uint, error) {
+	mockBalloons.Lock()
+	defer mockBalloons.Unlock()
+
+	if memory, ok := mockBalloons.memory[m.podID]; ok {
+		return memory, nil
+	}
+
+	return m.memory, nil
+}
+
+func (m *mockHypervisor) hotplugResources(ctx context.Context, resources Resources) (Resources, error) {
+	return resources, nil
+}
+
+func (m *mockHypervisor) hotunplugResources(ctx context.Context, resources Resources) (Resources, error) {
+	return resources, nil
+}
+
+// pid returns 0 as the mock hypervisor runs no process.
+func (m *mockHypervisor) pid() (int, error) {
+	return 0, nil
+}
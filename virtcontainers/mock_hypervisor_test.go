@@ -17,6 +17,7 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -49,7 +50,7 @@ func TestMockHypervisorInit(t *testing.T) {
 }
 
 func TestMockHypervisorCreatePod(t *testing.T) {
-	var m *mockHypervisor
+	m := &mockHypervisor{}
 
 	config := PodConfig{}
 
@@ -59,13 +60,40 @@ func TestMockHypervisorCreatePod(t *testing.T) {
 	}
 }
 
+func TestMockHypervisorBalloon(t *testing.T) {
+	m := &mockHypervisor{}
+
+	config := PodConfig{
+		ID:       testPodID,
+		VMConfig: Resources{Memory: 512},
+	}
+
+	if err := m.createPod(config); err != nil {
+		t.Fatal(err)
+	}
+	defer m.stopPod(context.Background())
+
+	if err := m.resizeBalloon(context.Background(), 256); err != nil {
+		t.Fatal(err)
+	}
+
+	memory, err := m.guestMemory(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if memory != 256 {
+		t.Fatalf("Expected 256MiB of guest memory, got %dMiB", memory)
+	}
+}
+
 func TestMockHypervisorStartPod(t *testing.T) {
 	var m *mockHypervisor
 
 	startCh := make(chan struct{})
 	stopCh := make(chan struct{})
 
-	go m.startPod(startCh, stopCh)
+	go m.startPod(context.Background(), startCh, stopCh)
 
 	select {
 	case <-startCh:
@@ -76,9 +104,9 @@ func TestMockHypervisorStartPod(t *testing.T) {
 }
 
 func TestMockHypervisorStopPod(t *testing.T) {
-	var m *mockHypervisor
+	m := &mockHypervisor{}
 
-	err := m.stopPod()
+	err := m.stopPod(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -102,3 +130,16 @@ func TestMockHypervisorGetPodConsole(t *testing.T) {
 		t.Fatalf("Got %s\nExpecting %s", result, expected)
 	}
 }
+
+func TestMockHypervisorPID(t *testing.T) {
+	var m *mockHypervisor
+
+	pid, err := m.pid()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pid != 0 {
+		t.Fatalf("Expected no PID, got %d", pid)
+	}
+}
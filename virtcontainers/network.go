@@ -24,6 +24,7 @@ import (
 	"runtime"
 
 	"github.com/01org/ciao/ssntp/uuid"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
 	"github.com/containernetworking/cni/pkg/ns"
 	types "github.com/containernetworking/cni/pkg/types/current"
 	"github.com/vishvananda/netlink"
@@ -153,7 +154,14 @@ func runNetworkCommon(networkNSPath string, cb func() error) error {
 func addNetworkCommon(pod Pod, networkNS *NetworkNamespace) error {
 	err := doNetNS(networkNS.NetNsPath, func(_ ns.NetNS) error {
 		for idx := range networkNS.Endpoints {
-			if err := bridgeNetworkPair(&(networkNS.Endpoints[idx].NetPair)); err != nil {
+			netPair := &(networkNS.Endpoints[idx].NetPair)
+
+			span, _ := trace.StartSpan(pod.ctx, "bridgeNetworkPair")
+			span.SetTag("network.interface", netPair.VirtIface.Name)
+
+			err := bridgeNetworkPair(netPair)
+			span.SetError(err).Finish()
+			if err != nil {
 				return err
 			}
 		}
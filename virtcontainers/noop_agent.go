@@ -64,3 +64,8 @@ func (n *noopAgent) stopContainer(pod Pod, c Container) error {
 func (n *noopAgent) killContainer(pod Pod, c Container, signal syscall.Signal, all bool) error {
 	return nil
 }
+
+// onlineCPUMem is the Noop agent vCPUs and memory onlining implementation. It does nothing.
+func (n *noopAgent) onlineCPUMem() error {
+	return nil
+}
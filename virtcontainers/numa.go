@@ -0,0 +1,181 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// sysNodePath is where the host NUMA nodes are described. It is a
+// variable to allow tests to modify it.
+var sysNodePath = "/sys/devices/system/node"
+
+// procPath is where the processes are described. It is a variable to
+// allow tests to modify it.
+var procPath = "/proc"
+
+// vcpuThreadRegexp matches the name qemu gives to the vCPU threads when
+// started with debug-threads=on.
+var vcpuThreadRegexp = regexp.MustCompile(`^CPU \d+/KVM$`)
+
+// parseCPUList returns the CPUs of a list such as "0-3,8", as found in
+// sysfs.
+func parseCPUList(list string) ([]uint, error) {
+	var cpus []uint
+
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return cpus, nil
+	}
+
+	for _, r := range strings.Split(list, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+
+		first, err := strconv.ParseUint(bounds[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CPU list %q", list)
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.ParseUint(bounds[1], 10, 32)
+			if err != nil || last < first {
+				return nil, fmt.Errorf("Invalid CPU list %q", list)
+			}
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, uint(cpu))
+		}
+	}
+
+	return cpus, nil
+}
+
+// numaNodesCPUs returns the host CPUs of the NUMA nodes.
+func numaNodesCPUs(nodes []uint) ([]uint, error) {
+	var cpus []uint
+
+	for _, node := range nodes {
+		path := filepath.Join(sysNodePath, fmt.Sprintf("node%d", node), "cpulist")
+
+		list, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Unknown host NUMA node %d: %v", node, err)
+		}
+
+		nodeCPUs, err := parseCPUList(string(list))
+		if err != nil {
+			return nil, err
+		}
+
+		cpus = append(cpus, nodeCPUs...)
+	}
+
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("No CPU on host NUMA nodes %v", nodes)
+	}
+
+	return cpus, nil
+}
+
+// vcpuThreads returns the IDs of the vCPU threads of a qemu process.
+func vcpuThreads(pid int) ([]int, error) {
+	taskPath := filepath.Join(procPath, strconv.Itoa(pid), "task")
+
+	tasks, err := ioutil.ReadDir(taskPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var tids []int
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+
+		comm, err := ioutil.ReadFile(filepath.Join(taskPath, task.Name(), "comm"))
+		if err != nil {
+			// The thread has exited.
+			continue
+		}
+
+		if vcpuThreadRegexp.MatchString(strings.TrimSpace(string(comm))) {
+			tids = append(tids, tid)
+		}
+	}
+
+	return tids, nil
+}
+
+// setThreadAffinity restricts a thread to the CPUs.
+func setThreadAffinity(tid int, cpus []uint) error {
+	var mask [16]uint64
+
+	for _, cpu := range cpus {
+		if cpu >= uint(len(mask)*64) {
+			return fmt.Errorf("CPU %d is out of the affinity mask", cpu)
+		}
+
+		mask[cpu/64] |= 1 << (cpu % 64)
+	}
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid),
+		uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// pinVCPUThreads binds the vCPU threads of a qemu process to the CPUs of
+// the host NUMA nodes.
+func pinVCPUThreads(pid int, nodes []uint) error {
+	cpus, err := numaNodesCPUs(nodes)
+	if err != nil {
+		return err
+	}
+
+	tids, err := vcpuThreads(pid)
+	if err != nil {
+		return err
+	}
+
+	if len(tids) == 0 {
+		return fmt.Errorf("No vCPU thread found in qemu process %d", pid)
+	}
+
+	for _, tid := range tids {
+		if err := setThreadAffinity(tid, cpus); err != nil {
+			return fmt.Errorf("Could not pin vCPU thread %d: %v", tid, err)
+		}
+	}
+
+	virtLog.Infof("Pinned %d vCPU threads to host NUMA nodes %v", len(tids), nodes)
+
+	return nil
+}
@@ -0,0 +1,149 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	type testData struct {
+		list     string
+		expected []uint
+	}
+
+	for _, d := range []testData{
+		{"", nil},
+		{"0", []uint{0}},
+		{"0-3\n", []uint{0, 1, 2, 3}},
+		{"0-1,8,10-11", []uint{0, 1, 8, 10, 11}},
+	} {
+		cpus, err := parseCPUList(d.list)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reflect.DeepEqual(cpus, d.expected) == false {
+			t.Fatalf("Got %v\nExpecting %v for %q", cpus, d.expected, d.list)
+		}
+	}
+
+	for _, list := range []string{"a", "1-", "3-1", "1,,2"} {
+		if _, err := parseCPUList(list); err == nil {
+			t.Fatalf("Expected CPU list %q to be invalid", list)
+		}
+	}
+}
+
+func TestNumaNodesCPUs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sys-node-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	savedSysNodePath := sysNodePath
+	sysNodePath = dir
+	defer func() {
+		sysNodePath = savedSysNodePath
+	}()
+
+	for node, list := range []string{"0-1\n", "2-3\n", "\n"} {
+		nodeDir := filepath.Join(dir, "node"+strconv.Itoa(node))
+		if err := os.MkdirAll(nodeDir, dirMode); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(nodeDir, "cpulist"), []byte(list), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cpus, err := numaNodesCPUs([]uint{1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []uint{2, 3, 0, 1}
+	if reflect.DeepEqual(cpus, expected) == false {
+		t.Fatalf("Got %v\nExpecting %v", cpus, expected)
+	}
+
+	// Node 2 has no CPU and node 3 does not exist.
+	for _, nodes := range [][]uint{{2}, {3}} {
+		if _, err := numaNodesCPUs(nodes); err == nil {
+			t.Fatalf("Expected NUMA nodes %v to be invalid", nodes)
+		}
+	}
+}
+
+func TestVCPUThreads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proc-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	savedProcPath := procPath
+	procPath = dir
+	defer func() {
+		procPath = savedProcPath
+	}()
+
+	const pid = 1234
+
+	for tid, comm := range map[int]string{
+		pid:  "qemu-lite-syste\n",
+		1235: "CPU 0/KVM\n",
+		1236: "CPU 1/KVM\n",
+		1237: "worker\n",
+	} {
+		taskDir := filepath.Join(dir, strconv.Itoa(pid), "task", strconv.Itoa(tid))
+		if err := os.MkdirAll(taskDir, dirMode); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(taskDir, "comm"), []byte(comm), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tids, err := vcpuThreads(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{1235, 1236}
+	if reflect.DeepEqual(tids, expected) == false {
+		t.Fatalf("Got %v\nExpecting %v", tids, expected)
+	}
+
+	if _, err := vcpuThreads(pid + 1); err == nil {
+		t.Fatal("Expected a missing process to fail")
+	}
+}
+
+func TestSetThreadAffinityOutOfMask(t *testing.T) {
+	if err := setThreadAffinity(os.Getpid(), []uint{4096}); err == nil {
+		t.Fatal("Expected a CPU out of the affinity mask to fail")
+	}
+}
@@ -17,6 +17,7 @@
 package hyperstart
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -450,6 +451,12 @@ func (h *Hyperstart) CheckReturnedCode(recvCode, expectedCode uint32) error {
 
 // WaitForReady waits for a READY message on CTL channel.
 func (h *Hyperstart) WaitForReady() error {
+	return h.WaitForReadyWithContext(context.Background())
+}
+
+// WaitForReadyWithContext waits for a READY message on CTL channel,
+// giving up when ctx is done.
+func (h *Hyperstart) WaitForReadyWithContext(ctx context.Context) error {
 	if h.ctlMulticast == nil {
 		return fmt.Errorf("No multicast available for CTL channel")
 	}
@@ -459,7 +466,16 @@ func (h *Hyperstart) WaitForReady() error {
 		return err
 	}
 
-	msg := <-channel
+	var msg *DecodedMessage
+
+	select {
+	case msg = <-channel:
+	case <-ctx.Done():
+		// The multicaster would block for ever sending the
+		// reply to a channel nobody listens to anymore.
+		go func() { <-channel }()
+		return ctx.Err()
+	}
 
 	err = h.CheckReturnedCode(msg.Code, ReadyCode)
 	if err != nil {
@@ -0,0 +1,230 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package mock provides a fake hyperstart, listening on the control and
+// I/O sockets a VM would expose, for the hyperstart client tests.
+package mock
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/hyperstart"
+)
+
+// Hyperstart is a fake hyperstart acknowledging every command it
+// receives on its control socket.
+type Hyperstart struct {
+	t   *testing.T
+	dir string
+
+	ctlSocketPath, ioSocketPath string
+	ctlListener, ioListener     net.Listener
+
+	// ctl and io are set once the client is connected, which
+	// ctlConnected and ioConnected tell.
+	ctl, io                   net.Conn
+	ctlConnected, ioConnected chan struct{}
+
+	// ctlMutex serializes the writes to the control socket.
+	ctlMutex sync.Mutex
+
+	wg sync.WaitGroup
+
+	sync.Mutex
+	lastMessages []hyperstart.DecodedMessage
+}
+
+// NewHyperstart returns a fake hyperstart whose sockets live in a new
+// temporary directory.
+func NewHyperstart(t *testing.T) *Hyperstart {
+	dir, err := ioutil.TempDir("", "hyperstart-mock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Hyperstart{
+		t:             t,
+		dir:           dir,
+		ctlSocketPath: filepath.Join(dir, "control.sock"),
+		ioSocketPath:  filepath.Join(dir, "io.sock"),
+		ctlConnected:  make(chan struct{}),
+		ioConnected:   make(chan struct{}),
+	}
+}
+
+// GetSocketPaths returns the paths of the control and I/O sockets.
+func (h *Hyperstart) GetSocketPaths() (string, string) {
+	return h.ctlSocketPath, h.ioSocketPath
+}
+
+// Start listens on the control and I/O sockets. The client is accepted in
+// the background.
+func (h *Hyperstart) Start() {
+	var err error
+
+	h.ctlListener, err = net.Listen("unix", h.ctlSocketPath)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	h.ioListener, err = net.Listen("unix", h.ioSocketPath)
+	if err != nil {
+		h.ctlListener.Close()
+		h.t.Fatal(err)
+	}
+
+	h.wg.Add(2)
+
+	go func() {
+		defer h.wg.Done()
+
+		conn, err := h.ctlListener.Accept()
+		if err != nil {
+			return
+		}
+
+		h.ctl = conn
+		close(h.ctlConnected)
+
+		h.serveCtl()
+	}()
+
+	go func() {
+		defer h.wg.Done()
+
+		conn, err := h.ioListener.Accept()
+		if err != nil {
+			return
+		}
+
+		h.io = conn
+		close(h.ioConnected)
+	}()
+}
+
+// serveCtl records the commands received on the control socket and
+// acknowledges them, until the connection is closed.
+func (h *Hyperstart) serveCtl() {
+	for {
+		msg, err := hyperstart.ReadCtlMessage(h.ctl)
+		if err != nil {
+			return
+		}
+
+		h.Lock()
+		h.lastMessages = append(h.lastMessages, *msg)
+		h.Unlock()
+
+		if err := h.writeCtl(hyperstart.AckCode, nil); err != nil {
+			return
+		}
+	}
+}
+
+// writeCtl writes a message to the control socket.
+func (h *Hyperstart) writeCtl(code uint32, data []byte) error {
+	msg := make([]byte, hyperstart.CtlHdrSize+len(data))
+	binary.BigEndian.PutUint32(msg, code)
+	binary.BigEndian.PutUint32(msg[hyperstart.CtlHdrLenOffset:], uint32(len(msg)))
+	copy(msg[hyperstart.CtlHdrSize:], data)
+
+	h.ctlMutex.Lock()
+	defer h.ctlMutex.Unlock()
+
+	_, err := h.ctl.Write(msg)
+	return err
+}
+
+// Stop closes the sockets and removes them.
+func (h *Hyperstart) Stop() {
+	h.ctlListener.Close()
+	h.ioListener.Close()
+
+	select {
+	case <-h.ctlConnected:
+		h.ctl.Close()
+	default:
+	}
+
+	select {
+	case <-h.ioConnected:
+		h.io.Close()
+	default:
+	}
+
+	h.wg.Wait()
+
+	os.RemoveAll(h.dir)
+}
+
+// GetLastMessages returns the commands received since the last call.
+func (h *Hyperstart) GetLastMessages() []hyperstart.DecodedMessage {
+	h.Lock()
+	defer h.Unlock()
+
+	msgs := h.lastMessages
+	h.lastMessages = nil
+
+	return msgs
+}
+
+// SendMessage sends a message on the control socket, once the client is
+// connected.
+func (h *Hyperstart) SendMessage(code int, data []byte) {
+	<-h.ctlConnected
+
+	if err := h.writeCtl(uint32(code), data); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// SendIo sends data for the session seq on the I/O socket, once the
+// client is connected.
+func (h *Hyperstart) SendIo(seq uint64, data []byte) {
+	<-h.ioConnected
+
+	msg := &hyperstart.TtyMessage{
+		Session: seq,
+		Message: data,
+	}
+
+	if err := hyperstart.SendIoMessageWithConn(h.io, msg); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// ReadIo reads a message of the I/O socket into buf and returns its length,
+// header included, and its session.
+func (h *Hyperstart) ReadIo(buf []byte) (int, uint64) {
+	<-h.ioConnected
+
+	n, err := h.io.Read(buf)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	if n < hyperstart.TtyHdrSize {
+		h.t.Fatalf("Short I/O message of %d bytes", n)
+	}
+
+	return n, binary.BigEndian.Uint64(buf[:hyperstart.TtyHdrLenOffset])
+}
@@ -0,0 +1,27 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package mock holds the paths of the mock binaries the virtcontainers
+// tests run in place of a real shim and hook.
+package mock
+
+// DefaultMockCCShimBinPath is the path of the mock shim, either set at
+// link time or built by the tests.
+var DefaultMockCCShimBinPath string
+
+// DefaultMockHookBinPath is the path of the mock hook, either set at link
+// time or built by the tests.
+var DefaultMockHookBinPath string
@@ -19,12 +19,13 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/Sirupsen/logrus"
-	vc "github.com/containers/virtcontainers"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
 	"github.com/kubernetes-incubator/cri-o/pkg/annotations"
 	spec "github.com/opencontainers/runtime-spec/specs-go"
 )
@@ -83,9 +84,30 @@ type CompatOCISpec struct {
 	Process *CompatOCIProcess `json:"process,omitempty"`
 }
 
+// VMSizing bounds the resources of a VM derived from the resource limits
+// of its container.
+type VMSizing struct {
+	// MemoryOverhead is the memory in MiB added to the memory limit of
+	// the container, for the guest kernel and agent.
+	MemoryOverhead uint
+
+	// MinVCPUs and MaxVCPUs bound the number of vCPUs, 0 meaning no
+	// bound.
+	MinVCPUs uint
+	MaxVCPUs uint
+
+	// MinMemory and MaxMemory bound the memory in MiB, 0 meaning no
+	// bound.
+	MinMemory uint
+	MaxMemory uint
+}
+
 // RuntimeConfig aggregates all runtime specific settings
 type RuntimeConfig struct {
+	// VMConfig is the size of the VMs whose container has no resource
+	// limits.
 	VMConfig vc.Resources
+	VMSizing VMSizing
 
 	HypervisorType   vc.HypervisorType
 	HypervisorConfig vc.HypervisorConfig
@@ -99,6 +121,9 @@ type RuntimeConfig struct {
 	ShimType   vc.ShimType
 	ShimConfig interface{}
 
+	// NetworkModel defaults to the CNM network model.
+	NetworkModel vc.NetworkModel
+
 	Console string
 }
 
@@ -295,12 +320,22 @@ func PodConfig(ocispec CompatOCISpec, runtime RuntimeConfig, bundlePath, cid, co
 		return vc.PodConfig{}, err
 	}
 
+	networkModel := runtime.NetworkModel
+	if networkModel == "" {
+		networkModel = vc.CNMNetworkModel
+	}
+
+	vmConfig, err := VMConfig(ocispec, runtime)
+	if err != nil {
+		return vc.PodConfig{}, err
+	}
+
 	podConfig := vc.PodConfig{
 		ID: cid,
 
 		Hooks: containerHooks(ocispec),
 
-		VMConfig: runtime.VMConfig,
+		VMConfig: vmConfig,
 
 		HypervisorType:   runtime.HypervisorType,
 		HypervisorConfig: runtime.HypervisorConfig,
@@ -314,7 +349,7 @@ func PodConfig(ocispec CompatOCISpec, runtime RuntimeConfig, bundlePath, cid, co
 		ShimType:   runtime.ShimType,
 		ShimConfig: runtime.ShimConfig,
 
-		NetworkModel:  vc.CNMNetworkModel,
+		NetworkModel:  networkModel,
 		NetworkConfig: networkConfig,
 
 		Containers: []vc.ContainerConfig{containerConfig},
@@ -328,6 +363,131 @@ func PodConfig(ocispec CompatOCISpec, runtime RuntimeConfig, bundlePath, cid, co
 	return podConfig, nil
 }
 
+// VMConfig returns the resources of the VM of a pod, derived from the CPU
+// and memory limits of its container. The resources of the runtime
+// configuration are used when the container is not limited.
+func VMConfig(ocispec CompatOCISpec, runtime RuntimeConfig) (vc.Resources, error) {
+	resources := runtime.VMConfig
+	sizing := runtime.VMSizing
+
+	needs, err := containerResources(ocispec)
+	if err != nil {
+		return vc.Resources{}, err
+	}
+
+	if needs.VCPUs > 0 {
+		resources.VCPUs = boundResource(needs.VCPUs, sizing.MinVCPUs, sizing.MaxVCPUs)
+	}
+
+	if needs.Memory > 0 {
+		resources.Memory = boundResource(needs.Memory+sizing.MemoryOverhead,
+			sizing.MinMemory, sizing.MaxMemory)
+	}
+
+	return resources, nil
+}
+
+// containerResources returns the vCPUs and memory in MiB a container
+// workload needs, derived from its CPU and memory limits. A resource is 0
+// when the container is not limited.
+func containerResources(ocispec CompatOCISpec) (vc.Resources, error) {
+	var resources vc.Resources
+
+	if ocispec.Linux == nil || ocispec.Linux.Resources == nil {
+		return resources, nil
+	}
+
+	limits := ocispec.Linux.Resources
+
+	if limits.CPU != nil {
+		vcpus, err := cpuLimit(*limits.CPU)
+		if err != nil {
+			return vc.Resources{}, err
+		}
+
+		resources.VCPUs = vcpus
+	}
+
+	if limits.Memory != nil && limits.Memory.Limit != nil && *limits.Memory.Limit > 0 {
+		// The limit is rounded up to the next MiB. A limit too
+		// large to be a VM size means the container is not limited.
+		memory := *limits.Memory.Limit >> 20
+		if *limits.Memory.Limit&(1<<20-1) != 0 {
+			memory++
+		}
+
+		if memory <= math.MaxUint32 {
+			resources.Memory = uint(memory)
+		}
+	}
+
+	return resources, nil
+}
+
+// cpuLimit returns the number of CPUs a container can use at once, 0
+// meaning it is not limited. Both a CFS quota and a cpuset limit it.
+func cpuLimit(cpu spec.LinuxCPU) (uint, error) {
+	var vcpus uint
+
+	if cpu.Quota != nil && *cpu.Quota > 0 && cpu.Period != nil && *cpu.Period > 0 {
+		quota := uint64(*cpu.Quota)
+		vcpus = uint((quota + *cpu.Period - 1) / *cpu.Period)
+	}
+
+	if cpu.Cpus != "" {
+		cpus, err := cpusetSize(cpu.Cpus)
+		if err != nil {
+			return 0, err
+		}
+
+		if vcpus == 0 || cpus < vcpus {
+			vcpus = cpus
+		}
+	}
+
+	return vcpus, nil
+}
+
+// cpusetSize returns the number of CPUs of a cpuset such as "0-3,8".
+func cpusetSize(cpuset string) (uint, error) {
+	var size uint
+
+	for _, cpus := range strings.Split(cpuset, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(cpus), "-", 2)
+
+		first, err := strconv.ParseUint(bounds[0], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid cpuset %q", cpuset)
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.ParseUint(bounds[1], 10, 32)
+			if err != nil || last < first {
+				return 0, fmt.Errorf("Invalid cpuset %q", cpuset)
+			}
+		}
+
+		size += uint(last - first + 1)
+	}
+
+	return size, nil
+}
+
+// boundResource returns value within min and max, a bound of 0 meaning
+// there is none.
+func boundResource(value, min, max uint) uint {
+	if value < min {
+		value = min
+	}
+
+	if max > 0 && value > max {
+		value = max
+	}
+
+	return value
+}
+
 // ContainerConfig converts an OCI compatible runtime configuration
 // file to a virtcontainers container configuration structure.
 func ContainerConfig(ocispec CompatOCISpec, bundlePath, cid, console string) (vc.ContainerConfig, error) {
@@ -371,6 +531,11 @@ func ContainerConfig(ocispec CompatOCISpec, bundlePath, cid, console string) (vc
 		return vc.ContainerConfig{}, err
 	}
 
+	containerConfig.Resources, err = containerResources(ocispec)
+	if err != nil {
+		return vc.ContainerConfig{}, err
+	}
+
 	containerConfig.Annotations[ContainerTypeKey] = string(cType)
 
 	return containerConfig, nil
@@ -19,13 +19,14 @@ package oci
 import (
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
 	"testing"
 
-	vc "github.com/containers/virtcontainers"
+	vc "github.com/clearcontainers/runtime/virtcontainers"
 	"github.com/kubernetes-incubator/cri-o/pkg/annotations"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
@@ -172,6 +173,122 @@ func testStatusToOCIStateSuccessful(t *testing.T, cStatus vc.ContainerStatus, ex
 	}
 }
 
+func TestVMConfig(t *testing.T) {
+	runtimeConfig := RuntimeConfig{
+		VMConfig: vc.Resources{VCPUs: 4, Memory: 2048},
+		VMSizing: VMSizing{
+			MemoryOverhead: 128,
+			MinMemory:      256,
+			MaxVCPUs:       8,
+			MaxMemory:      8192,
+		},
+	}
+
+	int64Ptr := func(i int64) *int64 { return &i }
+	uint64Ptr := func(i uint64) *uint64 { return &i }
+
+	type testData struct {
+		resources *specs.LinuxResources
+		expected  vc.Resources
+	}
+
+	for _, d := range []testData{
+		// Without limits, the default resources are used.
+		{nil, vc.Resources{VCPUs: 4, Memory: 2048}},
+		{&specs.LinuxResources{}, vc.Resources{VCPUs: 4, Memory: 2048}},
+		// Half a CPU and 256MB.
+		{&specs.LinuxResources{
+			CPU:    &specs.LinuxCPU{Quota: int64Ptr(50000), Period: uint64Ptr(100000)},
+			Memory: &specs.LinuxMemory{Limit: uint64Ptr(256 << 20)},
+		}, vc.Resources{VCPUs: 1, Memory: 384}},
+		{&specs.LinuxResources{
+			CPU: &specs.LinuxCPU{Quota: int64Ptr(250000), Period: uint64Ptr(100000)},
+		}, vc.Resources{VCPUs: 3, Memory: 2048}},
+		// The cpuset limits the number of CPUs too.
+		{&specs.LinuxResources{
+			CPU: &specs.LinuxCPU{Cpus: "0-1,4"},
+		}, vc.Resources{VCPUs: 3, Memory: 2048}},
+		{&specs.LinuxResources{
+			CPU: &specs.LinuxCPU{Quota: int64Ptr(250000), Period: uint64Ptr(100000), Cpus: "2"},
+		}, vc.Resources{VCPUs: 1, Memory: 2048}},
+		// A negative quota means no limit.
+		{&specs.LinuxResources{
+			CPU: &specs.LinuxCPU{Quota: int64Ptr(-1), Period: uint64Ptr(100000)},
+		}, vc.Resources{VCPUs: 4, Memory: 2048}},
+		// The bounds apply.
+		{&specs.LinuxResources{
+			CPU:    &specs.LinuxCPU{Cpus: "0-15"},
+			Memory: &specs.LinuxMemory{Limit: uint64Ptr(16 << 30)},
+		}, vc.Resources{VCPUs: 8, Memory: 8192}},
+		{&specs.LinuxResources{
+			Memory: &specs.LinuxMemory{Limit: uint64Ptr(4 << 20)},
+		}, vc.Resources{VCPUs: 4, Memory: 256}},
+		// A limit larger than any VM means no limit.
+		{&specs.LinuxResources{
+			Memory: &specs.LinuxMemory{Limit: uint64Ptr(math.MaxUint64)},
+		}, vc.Resources{VCPUs: 4, Memory: 2048}},
+	} {
+		ocispec := CompatOCISpec{}
+		if d.resources != nil {
+			ocispec.Linux = &specs.Linux{Resources: d.resources}
+		}
+
+		resources, err := VMConfig(ocispec, runtimeConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resources != d.expected {
+			t.Fatalf("Got %+v, expecting %+v for %+v", resources, d.expected, d.resources)
+		}
+	}
+
+	for _, cpuset := range []string{"a", "1-", "3-1", "1,,2"} {
+		ocispec := CompatOCISpec{}
+		ocispec.Linux = &specs.Linux{
+			Resources: &specs.LinuxResources{CPU: &specs.LinuxCPU{Cpus: cpuset}},
+		}
+
+		if _, err := VMConfig(ocispec, runtimeConfig); err == nil {
+			t.Fatalf("Expected invalid cpuset %q to fail", cpuset)
+		}
+	}
+}
+
+func TestContainerResources(t *testing.T) {
+	int64Ptr := func(i int64) *int64 { return &i }
+	uint64Ptr := func(i uint64) *uint64 { return &i }
+
+	ocispec := CompatOCISpec{}
+	resources, err := containerResources(ocispec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resources != (vc.Resources{}) {
+		t.Fatalf("Got %+v, expecting no resources for an unlimited container", resources)
+	}
+
+	// Neither the sizing bounds nor the memory overhead apply to the
+	// resources of the workload.
+	ocispec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			CPU:    &specs.LinuxCPU{Quota: int64Ptr(150000), Period: uint64Ptr(100000)},
+			Memory: &specs.LinuxMemory{Limit: uint64Ptr(100<<20 + 1)},
+		},
+	}
+
+	resources, err = containerResources(ocispec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := vc.Resources{VCPUs: 2, Memory: 101}
+	if resources != expected {
+		t.Fatalf("Got %+v, expecting %+v", resources, expected)
+	}
+}
+
 func TestStatusToOCIStateSuccessfulWithReadyState(t *testing.T) {
 	configPath, err := createConfig("config.json", minimalConfig)
 	if err != nil {
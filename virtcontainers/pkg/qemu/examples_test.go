@@ -21,7 +21,7 @@ import (
 
 	"context"
 
-	"github.com/01org/ciao/qemu"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/qemu"
 )
 
 func Example() {
@@ -669,6 +669,11 @@ type SMP struct {
 
 	// Sockets is the number of sockets made available to qemu.
 	Sockets uint32
+
+	// MaxCPUs is the maximum number of VCPUs that a VM can have.
+	// This value, if non-zero, MUST BE equal to or greater than CPUs.
+	// VCPUs can be hotplugged up to this number.
+	MaxCPUs uint32
 }
 
 // Memory is the guest memory configuration structure.
@@ -887,6 +892,10 @@ func (config *Config) appendCPUs() {
 			SMPParams = append(SMPParams, fmt.Sprintf(",sockets=%d", config.SMP.Sockets))
 		}
 
+		if config.SMP.MaxCPUs > 0 {
+			SMPParams = append(SMPParams, fmt.Sprintf(",maxcpus=%d", config.SMP.MaxCPUs))
+		}
+
 		config.qemuParams = append(config.qemuParams, "-smp")
 		config.qemuParams = append(config.qemuParams, strings.Join(SMPParams, ""))
 	}
@@ -21,8 +21,6 @@ import (
 	"os"
 	"strings"
 	"testing"
-
-	"github.com/01org/ciao/testutil"
 )
 
 func testAppend(structure interface{}, expected string, t *testing.T) {
@@ -277,6 +275,20 @@ func TestAppendCPUs(t *testing.T) {
 	testAppend(smp, cpusString, t)
 }
 
+var cpusMaxString = "-smp 2,cores=4,threads=1,sockets=1,maxcpus=4"
+
+func TestAppendCPUsMaxCPUs(t *testing.T) {
+	smp := SMP{
+		CPUs:    2,
+		Sockets: 1,
+		Cores:   4,
+		Threads: 1,
+		MaxCPUs: 4,
+	}
+
+	testAppend(smp, cpusMaxString, t)
+}
+
 var qmpSingleSocketServerString = "-qmp unix:cc-qmp,server,nowait"
 var qmpSingleSocketString = "-qmp unix:cc-qmp"
 
@@ -322,13 +334,19 @@ func TestAppendQMPSocketServer(t *testing.T) {
 	testAppend(qmp, qmpSocketServerString, t)
 }
 
-var qemuString = "-name cc-qemu -cpu host -uuid " + testutil.AgentUUID
+// agentUUID and volumeUUID identify the test instance and volume.
+const (
+	agentUUID  = "4cb19522-1e18-439a-883a-f9b2a3a95f5e"
+	volumeUUID = "67d86208-b46c-4465-9018-fe14087d415f"
+)
+
+var qemuString = "-name cc-qemu -cpu host -uuid " + agentUUID
 
 func TestAppendStrings(t *testing.T) {
 	config := Config{
 		Path:     "qemu",
 		Name:     "cc-qemu",
-		UUID:     testutil.AgentUUID,
+		UUID:     agentUUID,
 		CPUModel: "host",
 	}
 
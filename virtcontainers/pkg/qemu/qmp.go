@@ -108,7 +108,7 @@ type QMPEvent struct {
 
 type qmpResult struct {
 	err  error
-	data map[string]interface{}
+	data interface{}
 }
 
 type qmpCommand struct {
@@ -118,6 +118,7 @@ type qmpCommand struct {
 	args           map[string]interface{}
 	filter         *qmpEventFilter
 	resultReceived bool
+	response       interface{}
 }
 
 // QMP is a structure that contains the internal state used by startQMPLoop and
@@ -130,6 +131,46 @@ type QMP struct {
 	disconnectedCh chan struct{}
 }
 
+// CPUProperties contains the properties to be used for hotplugging a CPU
+// instance.
+type CPUProperties struct {
+	Node   int `json:"node-id"`
+	Socket int `json:"socket-id"`
+	Core   int `json:"core-id"`
+	Thread int `json:"thread-id"`
+}
+
+// HotpluggableCPU represents a hotpluggable CPU, as returned by the
+// query-hotpluggable-cpus command.
+type HotpluggableCPU struct {
+	Type       string        `json:"type"`
+	VcpusCount int           `json:"vcpus-count"`
+	Properties CPUProperties `json:"props"`
+
+	// QOMPath is the path of the CPU object, empty when the CPU is
+	// not plugged.
+	QOMPath string `json:"qom-path"`
+}
+
+// MemoryDevice represents a memory device, as returned by the
+// query-memory-devices command.
+type MemoryDevice struct {
+	Type string           `json:"type"`
+	Data MemoryDeviceData `json:"data"`
+}
+
+// MemoryDeviceData contains the description of a memory device.
+type MemoryDeviceData struct {
+	ID           string `json:"id"`
+	Addr         uint64 `json:"addr"`
+	Size         uint64 `json:"size"`
+	Slot         int    `json:"slot"`
+	Node         int    `json:"node"`
+	Memdev       string `json:"memdev"`
+	Hotplugged   bool   `json:"hotplugged"`
+	Hotpluggable bool   `json:"hotpluggable"`
+}
+
 // QMPVersion contains the version number and the capabailities of a QEMU
 // instance, as reported in the QMP greeting message.
 type QMPVersion struct {
@@ -210,7 +251,7 @@ func (q *QMP) finaliseCommand(cmdEl *list.Element, cmdQueue *list.List, succeede
 	case <-cmd.ctx.Done():
 	default:
 		if succeeded {
-			cmd.res <- qmpResult{}
+			cmd.res <- qmpResult{data: cmd.response}
 		} else {
 			cmd.res <- qmpResult{err: fmt.Errorf("QMP command failed")}
 		}
@@ -233,7 +274,7 @@ func (q *QMP) processQMPInput(line []byte, cmdQueue *list.List) {
 		return
 	}
 
-	_, succeeded := vmData["return"]
+	response, succeeded := vmData["return"]
 	_, failed := vmData["error"]
 
 	if !succeeded && !failed {
@@ -247,6 +288,7 @@ func (q *QMP) processQMPInput(line []byte, cmdQueue *list.List) {
 		return
 	}
 	cmd := cmdEl.Value.(*qmpCommand)
+	cmd.response = response
 	if failed || cmd.filter == nil {
 		q.finaliseCommand(cmdEl, cmdQueue, succeeded)
 	} else {
@@ -465,7 +507,16 @@ func startQMPLoop(conn io.ReadWriteCloser, cfg QMPConfig,
 
 func (q *QMP) executeCommand(ctx context.Context, name string, args map[string]interface{},
 	filter *qmpEventFilter) error {
+	_, err := q.executeCommandWithResponse(ctx, name, args, filter)
+	return err
+}
+
+// executeCommandWithResponse is like executeCommand but also returns the
+// contents of the "return" member of the QMP response.
+func (q *QMP) executeCommandWithResponse(ctx context.Context, name string, args map[string]interface{},
+	filter *qmpEventFilter) (interface{}, error) {
 	var err error
+	var response interface{}
 	resCh := make(chan qmpResult)
 	select {
 	case <-q.disconnectedCh:
@@ -480,17 +531,18 @@ func (q *QMP) executeCommand(ctx context.Context, name string, args map[string]i
 	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	select {
 	case res := <-resCh:
 		err = res.err
+		response = res.data
 	case <-ctx.Done():
 		err = ctx.Err()
 	}
 
-	return err
+	return response, err
 }
 
 // QMPStart connects to a unix domain socket maintained by a QMP instance.  It
@@ -660,3 +712,192 @@ func (q *QMP) ExecuteDeviceDel(ctx context.Context, devID string) error {
 	}
 	return q.executeCommand(ctx, "device_del", args, filter)
 }
+
+// ExecuteBalloon sets the logical size of the guest memory to bytes by
+// sending a balloon command.  The balloon device of the instance is
+// inflated or deflated to reach that size, which requires the cooperation
+// of the guest, so this function returns before the size is reached.
+func (q *QMP) ExecuteBalloon(ctx context.Context, bytes uint64) error {
+	args := map[string]interface{}{
+		"value": bytes,
+	}
+	return q.executeCommand(ctx, "balloon", args, nil)
+}
+
+// ExecuteQueryBalloon returns the logical size of the guest memory in bytes,
+// as reported by the balloon device of the instance in response to a
+// query-balloon command.
+func (q *QMP) ExecuteQueryBalloon(ctx context.Context) (uint64, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-balloon", nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	info, _ := response.(map[string]interface{})
+	actual, ok := info["actual"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("Invalid query-balloon response: %v", response)
+	}
+
+	return uint64(actual), nil
+}
+
+// decodeResponse converts the response of a QMP command into the value
+// pointed to by v.
+func decodeResponse(name string, response interface{}, v interface{}) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("Unable to encode %s response: %v", name, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("Invalid %s response: %v", name, err)
+	}
+
+	return nil
+}
+
+// ExecuteQueryHotpluggableCPUs returns the slots of the CPUs of the
+// instance, whether plugged or not, by sending a query-hotpluggable-cpus
+// command.
+func (q *QMP) ExecuteQueryHotpluggableCPUs(ctx context.Context) ([]HotpluggableCPU, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-hotpluggable-cpus", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var cpus []HotpluggableCPU
+	if err := decodeResponse("query-hotpluggable-cpus", response, &cpus); err != nil {
+		return nil, err
+	}
+
+	return cpus, nil
+}
+
+// ExecuteCPUDeviceAdd hotplugs a CPU using the device_add command.  driver
+// is the CPU type, as returned by ExecuteQueryHotpluggableCPUs, and cpuID
+// is the id of the device to add, which must be a valid QMP identifier.
+// socketID, coreID and threadID identify the slot of the CPU.
+func (q *QMP) ExecuteCPUDeviceAdd(ctx context.Context, driver, cpuID string, socketID, coreID, threadID int) error {
+	args := map[string]interface{}{
+		"driver":    driver,
+		"id":        cpuID,
+		"socket-id": socketID,
+		"core-id":   coreID,
+		"thread-id": threadID,
+	}
+	return q.executeCommand(ctx, "device_add", args, nil)
+}
+
+// ExecuteQueryMemoryDevices returns the memory devices of the instance, such
+// as the hotplugged pc-dimm devices, by sending a query-memory-devices
+// command.
+func (q *QMP) ExecuteQueryMemoryDevices(ctx context.Context) ([]MemoryDevice, error) {
+	response, err := q.executeCommandWithResponse(ctx, "query-memory-devices", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []MemoryDevice
+	if err := decodeResponse("query-memory-devices", response, &devices); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// MemoryBackend describes the host memory backing a hotplugged pc-dimm
+// device.
+type MemoryBackend struct {
+	// Type is the QOM type of the backend object, memory-backend-ram
+	// when empty.
+	Type string
+
+	// MemPath is the file backing a memory-backend-file object, such as
+	// a hugetlbfs mount point.
+	MemPath string
+
+	// Share maps the memory shared with the other processes mapping
+	// the same file.
+	Share bool
+
+	// Prealloc preallocates the memory.
+	Prealloc bool
+
+	// HostNodes are the host NUMA nodes the memory is allocated from,
+	// following Policy.
+	HostNodes []uint
+
+	// Policy is the NUMA policy of the memory, such as bind.
+	Policy string
+}
+
+// objectArgs returns the arguments of the object-add command creating the
+// backend, identified by id, for size bytes of memory.
+func (b MemoryBackend) objectArgs(id string, size uint64) map[string]interface{} {
+	qomType := b.Type
+	if qomType == "" {
+		qomType = "memory-backend-ram"
+	}
+
+	props := map[string]interface{}{
+		"size": size,
+	}
+	if b.MemPath != "" {
+		props["mem-path"] = b.MemPath
+	}
+	if b.Share {
+		props["share"] = true
+	}
+	if b.Prealloc {
+		props["prealloc"] = true
+	}
+	if len(b.HostNodes) > 0 {
+		props["host-nodes"] = b.HostNodes
+	}
+	if b.Policy != "" {
+		props["policy"] = b.Policy
+	}
+
+	return map[string]interface{}{
+		"qom-type": qomType,
+		"id":       id,
+		"props":    props,
+	}
+}
+
+// ExecuteHotplugMemory hotplugs size bytes of memory by sending an
+// object-add command creating the backend object identified by memID,
+// followed by a device_add command plugging a pc-dimm device identified
+// by devID and backed by this object.  Both identifiers must be valid QMP
+// identifiers.
+func (q *QMP) ExecuteHotplugMemory(ctx context.Context, memID, devID string, size uint64,
+	backend MemoryBackend) error {
+	args := backend.objectArgs(memID, size)
+	if err := q.executeCommand(ctx, "object-add", args, nil); err != nil {
+		return err
+	}
+
+	args = map[string]interface{}{
+		"driver": "pc-dimm",
+		"id":     devID,
+		"memdev": memID,
+	}
+	if err := q.executeCommand(ctx, "device_add", args, nil); err != nil {
+		// The backend is useless without the device.
+		q.ExecuteObjectDel(ctx, memID)
+		return err
+	}
+
+	return nil
+}
+
+// ExecuteObjectDel deletes the object identified by id, such as the backend
+// of a pc-dimm device once the device is deleted, by sending an object-del
+// command.
+func (q *QMP) ExecuteObjectDel(ctx context.Context, id string) error {
+	args := map[string]interface{}{
+		"id": id,
+	}
+	return q.executeCommand(ctx, "object-del", args, nil)
+}
@@ -22,13 +22,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
 
 	"context"
-
-	"github.com/01org/ciao/testutil"
 )
 
 const (
@@ -56,11 +55,11 @@ func (l qmpTestLogger) Infof(format string, v ...interface{}) {
 }
 
 func (l qmpTestLogger) Warningf(format string, v ...interface{}) {
-	l.Infof(format, v)
+	l.Infof(format, v...)
 }
 
 func (l qmpTestLogger) Errorf(format string, v ...interface{}) {
-	l.Infof(format, v)
+	l.Infof(format, v...)
 }
 
 type qmpTestCommand struct {
@@ -77,7 +76,7 @@ type qmpTestEvent struct {
 
 type qmpTestResult struct {
 	result string
-	data   map[string]interface{}
+	data   interface{}
 }
 
 type qmpTestCommandBuffer struct {
@@ -134,7 +133,7 @@ func (b *qmpTestCommandBuffer) startEventLoop(wg *sync.WaitGroup) {
 }
 
 func (b *qmpTestCommandBuffer) AddCommand(name string, args map[string]interface{},
-	result string, data map[string]interface{}) {
+	result string, data interface{}) {
 	b.cmds = append(b.cmds, qmpTestCommand{name, args})
 	if data == nil {
 		data = make(map[string]interface{})
@@ -360,7 +359,7 @@ func TestQMPBlockdevAdd(t *testing.T) {
 	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
 	checkVersion(t, connectedCh)
 	err := q.ExecuteBlockdevAdd(context.Background(), "/dev/rbd0",
-		fmt.Sprintf("drive_%s", testutil.VolumeUUID))
+		fmt.Sprintf("drive_%s", volumeUUID))
 	if err != nil {
 		t.Fatalf("Unexpected error %v", err)
 	}
@@ -382,8 +381,8 @@ func TestQMPDeviceAdd(t *testing.T) {
 	cfg := QMPConfig{Logger: qmpTestLogger{}}
 	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
 	checkVersion(t, connectedCh)
-	blockdevID := fmt.Sprintf("drive_%s", testutil.VolumeUUID)
-	devID := fmt.Sprintf("device_%s", testutil.VolumeUUID)
+	blockdevID := fmt.Sprintf("drive_%s", volumeUUID)
+	devID := fmt.Sprintf("device_%s", volumeUUID)
 	err := q.ExecuteDeviceAdd(context.Background(), blockdevID, devID,
 		"virtio-blk-pci", "")
 	if err != nil {
@@ -408,7 +407,7 @@ func TestQMPXBlockdevDel(t *testing.T) {
 	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
 	checkVersion(t, connectedCh)
 	err := q.ExecuteXBlockdevDel(context.Background(),
-		fmt.Sprintf("drive_%s", testutil.VolumeUUID))
+		fmt.Sprintf("drive_%s", volumeUUID))
 	if err != nil {
 		t.Fatalf("Unexpected error %v", err)
 	}
@@ -429,7 +428,7 @@ func TestQMPDeviceDel(t *testing.T) {
 		seconds         = 1352167040730
 		microsecondsEv1 = 123456
 		microsecondsEv2 = 123556
-		device          = "device_" + testutil.VolumeUUID
+		device          = "device_" + volumeUUID
 		path            = "/dev/rbd0"
 	)
 
@@ -472,7 +471,7 @@ func TestQMPDeviceDel(t *testing.T) {
 	checkVersion(t, connectedCh)
 	buf.startEventLoop(&wg)
 	err := q.ExecuteDeviceDel(context.Background(),
-		fmt.Sprintf("device_%s", testutil.VolumeUUID))
+		fmt.Sprintf("device_%s", volumeUUID))
 	if err != nil {
 		t.Fatalf("Unexpected error %v", err)
 	}
@@ -494,7 +493,7 @@ func TestQMPDeviceDelTimeout(t *testing.T) {
 	const (
 		seconds         = 1352167040730
 		microsecondsEv1 = 123456
-		device          = "device_" + testutil.VolumeUUID
+		device          = "device_" + volumeUUID
 		path            = "/dev/rbd0"
 	)
 
@@ -508,7 +507,7 @@ func TestQMPDeviceDelTimeout(t *testing.T) {
 	checkVersion(t, connectedCh)
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	err := q.ExecuteDeviceDel(ctx,
-		fmt.Sprintf("device_%s", testutil.VolumeUUID))
+		fmt.Sprintf("device_%s", volumeUUID))
 	cancel()
 	if err != context.DeadlineExceeded {
 		t.Fatalf("Timeout expected found %v", err)
@@ -692,7 +691,7 @@ func TestQMPEvents(t *testing.T) {
 		seconds         = 1352167040730
 		microsecondsEv1 = 123456
 		microsecondsEv2 = 123556
-		device          = "device_" + testutil.VolumeUUID
+		device          = "device_" + volumeUUID
 		path            = "/dev/rbd0"
 	)
 	var wg sync.WaitGroup
@@ -730,7 +729,7 @@ func TestQMPEvents(t *testing.T) {
 	deviceName := ev.Data["device"].(string)
 	if deviceName != device {
 		t.Errorf("Unexpected device field.  Expected %s, found %s",
-			"device_"+testutil.VolumeUUID, device)
+			"device_"+volumeUUID, device)
 	}
 	pathName := ev.Data["path"].(string)
 	if pathName != path {
@@ -792,3 +791,283 @@ func TestQMPLostLoop(t *testing.T) {
 		t.Error("Expected executeQMPCapabilities to fail")
 	}
 }
+
+// Checks that the balloon command is correctly sent.
+//
+// We start a QMPLoop, send the balloon command and stop the
+// loop.
+//
+// The balloon command should be correctly sent and the QMP loop
+// should exit gracefully.
+func TestQMPBalloon(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("balloon", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteBalloon(context.Background(), 512<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the query-balloon command is correctly sent and its
+// response decoded.
+//
+// We start a QMPLoop, send the query-balloon command and stop the
+// loop.
+//
+// The logical size of the guest memory returned by QEMU should be
+// returned and the QMP loop should exit gracefully.
+func TestQMPQueryBalloon(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("query-balloon", nil, "return",
+		map[string]interface{}{
+			"actual": 512 << 20,
+		})
+	buf.AddCommand("query-balloon", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	actual, err := q.ExecuteQueryBalloon(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if actual != 512<<20 {
+		t.Errorf("Expected %d bytes, got %d", 512<<20, actual)
+	}
+	_, err = q.ExecuteQueryBalloon(context.Background())
+	if err == nil {
+		t.Error("Expected an invalid response to fail")
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the query-hotpluggable-cpus command is correctly sent and
+// its response decoded.
+//
+// We start a QMPLoop, send the query-hotpluggable-cpus command and stop
+// the loop.
+//
+// The CPU slots returned by QEMU should be returned and the QMP loop
+// should exit gracefully.
+func TestQMPQueryHotpluggableCPUs(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("query-hotpluggable-cpus", nil, "return",
+		[]interface{}{
+			map[string]interface{}{
+				"type":        "host-x86_64-cpu",
+				"vcpus-count": 1,
+				"props": map[string]interface{}{
+					"socket-id": 0,
+					"core-id":   1,
+					"thread-id": 0,
+				},
+			},
+			map[string]interface{}{
+				"type":        "host-x86_64-cpu",
+				"vcpus-count": 1,
+				"props": map[string]interface{}{
+					"socket-id": 0,
+					"core-id":   0,
+					"thread-id": 0,
+				},
+				"qom-path": "/machine/unattached/device[0]",
+			},
+		})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	cpus, err := q.ExecuteQueryHotpluggableCPUs(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []HotpluggableCPU{
+		{
+			Type:       "host-x86_64-cpu",
+			VcpusCount: 1,
+			Properties: CPUProperties{Core: 1},
+		},
+		{
+			Type:       "host-x86_64-cpu",
+			VcpusCount: 1,
+			QOMPath:    "/machine/unattached/device[0]",
+		},
+	}
+	if !reflect.DeepEqual(cpus, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, cpus)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that a CPU is correctly hotplugged.
+//
+// We start a QMPLoop, send the device_add command and stop the loop.
+//
+// The device_add command should be correctly sent and the QMP loop
+// should exit gracefully.
+func TestQMPCPUDeviceAdd(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("device_add", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteCPUDeviceAdd(context.Background(), "host-x86_64-cpu", "cpu-0-1-0", 0, 1, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the query-memory-devices command is correctly sent and its
+// response decoded.
+//
+// We start a QMPLoop, send the query-memory-devices command and stop the
+// loop.
+//
+// The memory devices returned by QEMU should be returned and the QMP loop
+// should exit gracefully.
+func TestQMPQueryMemoryDevices(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("query-memory-devices", nil, "return",
+		[]interface{}{
+			map[string]interface{}{
+				"type": "dimm",
+				"data": map[string]interface{}{
+					"id":         "dimm0",
+					"size":       128 << 20,
+					"slot":       0,
+					"memdev":     "/objects/mem-dimm0",
+					"hotplugged": true,
+				},
+			},
+		})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	devices, err := q.ExecuteQueryMemoryDevices(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []MemoryDevice{
+		{
+			Type: "dimm",
+			Data: MemoryDeviceData{
+				ID:         "dimm0",
+				Size:       128 << 20,
+				Memdev:     "/objects/mem-dimm0",
+				Hotplugged: true,
+			},
+		},
+	}
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, devices)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that memory is correctly hotplugged.
+//
+// We start a QMPLoop, send the object-add and device_add commands and
+// stop the loop.
+//
+// Both commands should be correctly sent and the QMP loop should exit
+// gracefully.
+func TestQMPHotplugMemory(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("object-add", nil, "return", nil)
+	buf.AddCommand("device_add", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteHotplugMemory(context.Background(), "mem-dimm0", "dimm0", 128<<20, MemoryBackend{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the backend of hotplugged memory is created with its
+// options, a memory-backend-ram object by default.
+func TestQMPMemoryBackendObjectArgs(t *testing.T) {
+	args := MemoryBackend{}.objectArgs("mem-dimm0", 128<<20)
+	expected := map[string]interface{}{
+		"qom-type": "memory-backend-ram",
+		"id":       "mem-dimm0",
+		"props": map[string]interface{}{
+			"size": uint64(128 << 20),
+		},
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Got %v, expecting %v", args, expected)
+	}
+
+	backend := MemoryBackend{
+		Type:      "memory-backend-file",
+		MemPath:   "/dev/hugepages",
+		Share:     true,
+		Prealloc:  true,
+		HostNodes: []uint{0, 2},
+		Policy:    "bind",
+	}
+	args = backend.objectArgs("mem-dimm0", 128<<20)
+	expected = map[string]interface{}{
+		"qom-type": "memory-backend-file",
+		"id":       "mem-dimm0",
+		"props": map[string]interface{}{
+			"size":       uint64(128 << 20),
+			"mem-path":   "/dev/hugepages",
+			"share":      true,
+			"prealloc":   true,
+			"host-nodes": []uint{0, 2},
+			"policy":     "bind",
+		},
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Got %v, expecting %v", args, expected)
+	}
+}
+
+// Checks that the backend of the memory is deleted when its device
+// cannot be added.
+//
+// We start a QMPLoop, send the object-add command, fail the device_add
+// command and stop the loop.
+//
+// The object-del command should be sent and the hotplug should fail.
+func TestQMPHotplugMemoryFailure(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommand("object-add", nil, "return", nil)
+	buf.AddCommand("device_add", nil, "error", nil)
+	buf.AddCommand("object-del", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteHotplugMemory(context.Background(), "mem-dimm0", "dimm0", 128<<20, MemoryBackend{})
+	if err == nil {
+		t.Fatal("Expected the hotplug to fail")
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trace records the duration of the operations performed on
+// behalf of a request as a tree of spans. The spans are carried by a
+// context.Context and are exported using the Zipkin v2 JSON format, which
+// Zipkin, Jaeger and the OpenTelemetry collector all accept.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Tags commonly set on the spans.
+const (
+	TagPodID       = "pod.id"
+	TagContainerID = "container.id"
+	TagError       = "error"
+)
+
+type contextKey int
+
+const (
+	tracerKey contextKey = iota
+	spanKey
+)
+
+// Endpoint identifies the service which recorded a span.
+type Endpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// Span is a timed operation. Spans are created by StartSpan and are only
+// exported once finished. All the methods of Span can be called on a nil
+// span, which is what StartSpan returns when tracing is disabled.
+type Span struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint Endpoint          `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+
+	tracer   *Tracer
+	start    time.Time
+	finished bool
+}
+
+// Tracer collects the spans of a single trace.
+type Tracer struct {
+	sync.Mutex
+
+	traceID string
+	service string
+	spans   []*Span
+}
+
+// NewTracer returns a tracer recording spans on behalf of service.
+func NewTracer(service string) *Tracer {
+	return &Tracer{
+		traceID: newID(16),
+		service: service,
+	}
+}
+
+// ContextWithTracer returns a copy of ctx in which the spans are recorded
+// by t.
+func ContextWithTracer(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey, t)
+}
+
+// TracerFromContext returns the tracer recording the spans of ctx, if
+// any.
+func TracerFromContext(ctx context.Context) *Tracer {
+	if ctx == nil {
+		return nil
+	}
+
+	t, _ := ctx.Value(tracerKey).(*Tracer)
+	return t
+}
+
+// StartSpan starts a span named after the operation. The span is a child
+// of the span carried by ctx, if any. The returned context carries the
+// new span. When ctx has no tracer, StartSpan returns a nil span and ctx.
+func StartSpan(ctx context.Context, operation string) (*Span, context.Context) {
+	return StartSpanAt(ctx, operation, time.Now())
+}
+
+// StartSpanAt is like StartSpan but for an operation which began at start.
+func StartSpanAt(ctx context.Context, operation string, start time.Time) (*Span, context.Context) {
+	t := TracerFromContext(ctx)
+	if t == nil {
+		return nil, ctx
+	}
+
+	span := &Span{
+		TraceID:       t.traceID,
+		ID:            newID(8),
+		Name:          operation,
+		Timestamp:     start.UnixNano() / int64(time.Microsecond),
+		LocalEndpoint: Endpoint{ServiceName: t.service},
+		Tags:          make(map[string]string),
+		tracer:        t,
+		start:         start,
+	}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.ParentID = parent.ID
+	}
+
+	t.Lock()
+	t.spans = append(t.spans, span)
+	t.Unlock()
+
+	return span, context.WithValue(ctx, spanKey, span)
+}
+
+// SpanFromContext returns the span carried by ctx, if any.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// SetTag annotates the span with a key/value pair.
+func (s *Span) SetTag(key, value string) *Span {
+	if s == nil || value == "" {
+		return s
+	}
+
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+
+	if !s.finished {
+		s.Tags[key] = value
+	}
+
+	return s
+}
+
+// SetError marks the span as failed when err is not nil.
+func (s *Span) SetError(err error) *Span {
+	if err == nil {
+		return s
+	}
+
+	return s.SetTag(TagError, err.Error())
+}
+
+// Finish records the end of the span. Calling it more than once has no
+// effect.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+
+	if s.finished {
+		return
+	}
+
+	s.finished = true
+
+	// Zipkin rejects spans lasting less than a microsecond.
+	s.Duration = int64(time.Since(s.start) / time.Microsecond)
+	if s.Duration < 1 {
+		s.Duration = 1
+	}
+}
+
+// Spans returns a copy of the finished spans, in the order they were
+// started.
+func (t *Tracer) Spans() []Span {
+	t.Lock()
+	defer t.Unlock()
+
+	spans := []Span{}
+
+	for _, s := range t.spans {
+		if !s.finished {
+			continue
+		}
+
+		span := *s
+		span.Tags = make(map[string]string, len(s.Tags))
+		for k, v := range s.Tags {
+			span.Tags[k] = v
+		}
+
+		spans = append(spans, span)
+	}
+
+	return spans
+}
+
+// Export returns the finished spans as a Zipkin v2 JSON array.
+func (t *Tracer) Export() ([]byte, error) {
+	return json.Marshal(t.Spans())
+}
+
+// newID returns a random identifier of size bytes, hex encoded.
+func newID(size int) string {
+	id := make([]byte, size)
+
+	if _, err := rand.Read(id); err != nil {
+		binary.LittleEndian.PutUint64(id, uint64(time.Now().UnixNano()))
+	}
+
+	return hex.EncodeToString(id)
+}
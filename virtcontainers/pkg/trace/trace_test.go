@@ -0,0 +1,178 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartSpanWithoutTracer(t *testing.T) {
+	ctx := context.Background()
+
+	span, spanCtx := StartSpan(ctx, "op")
+	if span != nil {
+		t.Fatalf("Expected no span without a tracer, got %+v", span)
+	}
+
+	if spanCtx != ctx {
+		t.Fatal("Expected the context to be returned unchanged")
+	}
+
+	// A nil span must be usable.
+	span.SetTag(TagPodID, "pod").SetError(errors.New("failure")).Finish()
+}
+
+func TestSpanHierarchy(t *testing.T) {
+	tracer := NewTracer("test")
+	ctx := ContextWithTracer(context.Background(), tracer)
+
+	rootSpan, rootCtx := StartSpan(ctx, "root")
+	rootSpan.SetTag(TagPodID, "pod")
+
+	childSpan, _ := StartSpan(rootCtx, "child")
+	childSpan.SetTag(TagContainerID, "container")
+	childSpan.SetError(errors.New("failure"))
+	childSpan.Finish()
+
+	sibling, _ := StartSpan(rootCtx, "sibling")
+
+	rootSpan.Finish()
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected the 2 finished spans, got %d", len(spans))
+	}
+
+	root, child := spans[0], spans[1]
+
+	if root.Name != "root" || child.Name != "child" {
+		t.Fatalf("Unexpected span order: %q, %q", root.Name, child.Name)
+	}
+
+	if root.ParentID != "" || child.ParentID != root.ID {
+		t.Fatalf("Unexpected parents: %q, %q", root.ParentID, child.ParentID)
+	}
+
+	if root.TraceID != child.TraceID || len(root.TraceID) != 32 {
+		t.Fatalf("Unexpected trace IDs: %q, %q", root.TraceID, child.TraceID)
+	}
+
+	if child.Tags[TagContainerID] != "container" || child.Tags[TagError] != "failure" {
+		t.Fatalf("Unexpected child tags: %v", child.Tags)
+	}
+
+	if root.Tags[TagPodID] != "pod" || root.LocalEndpoint.ServiceName != "test" {
+		t.Fatalf("Unexpected root span: %+v", root)
+	}
+
+	sibling.Finish()
+	if len(tracer.Spans()) != 3 {
+		t.Fatal("Expected the sibling span to be exported once finished")
+	}
+}
+
+func TestSpanFinish(t *testing.T) {
+	tracer := NewTracer("test")
+	ctx := ContextWithTracer(context.Background(), tracer)
+
+	start := time.Now().Add(-time.Second)
+	span, spanCtx := StartSpanAt(ctx, "op", start)
+
+	if SpanFromContext(spanCtx) != span {
+		t.Fatal("Expected the context to carry the span")
+	}
+
+	span.Finish()
+	duration := span.Duration
+
+	span.SetTag(TagPodID, "pod")
+	span.Finish()
+
+	if span.Duration != duration {
+		t.Fatal("Finishing a span twice must not change its duration")
+	}
+
+	if duration < int64(time.Second/time.Microsecond) {
+		t.Fatalf("Expected the duration to include the start time, got %dus", duration)
+	}
+
+	if span.Timestamp != start.UnixNano()/int64(time.Microsecond) {
+		t.Fatalf("Unexpected timestamp %d", span.Timestamp)
+	}
+
+	if _, ok := span.Tags[TagPodID]; ok {
+		t.Fatal("Tags set after the end of the span must be ignored")
+	}
+}
+
+func TestConcurrentSpans(t *testing.T) {
+	tracer := NewTracer("test")
+	ctx := ContextWithTracer(context.Background(), tracer)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			span, _ := StartSpan(ctx, "op")
+			span.SetTag(TagPodID, "pod")
+			span.Finish()
+		}()
+	}
+	wg.Wait()
+
+	if len(tracer.Spans()) != 10 {
+		t.Fatalf("Expected 10 spans, got %d", len(tracer.Spans()))
+	}
+}
+
+func TestExport(t *testing.T) {
+	tracer := NewTracer("test")
+	ctx := ContextWithTracer(context.Background(), tracer)
+
+	span, _ := StartSpan(ctx, "op")
+	span.SetTag(TagPodID, "pod")
+	span.Finish()
+
+	data, err := tracer.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spans []map[string]interface{}
+	if err := json.Unmarshal(data, &spans); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(spans) != 1 {
+		t.Fatalf("Expected one span, got %d", len(spans))
+	}
+
+	for _, field := range []string{"traceId", "id", "name", "timestamp", "duration", "localEndpoint", "tags"} {
+		if _, ok := spans[0][field]; !ok {
+			t.Fatalf("Missing Zipkin field %q in %s", field, data)
+		}
+	}
+
+	if _, ok := spans[0]["parentId"]; ok {
+		t.Fatalf("A root span must not have a parentId: %s", data)
+	}
+}
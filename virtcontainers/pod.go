@@ -17,13 +17,18 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
 )
 
 // controlSocket is the pod control socket.
@@ -37,6 +42,13 @@ const controlSocket = "ctrl.sock"
 // to understand if the VM is still alive or not.
 const monitorSocket = "monitor.sock"
 
+// rollbackTimeout bounds the removal of a partially created pod. The
+// context of the failed operation cannot be used as it may have expired.
+const rollbackTimeout = 10 * time.Second
+
+// flockRetryInterval is the delay between two attempts to lock a pod.
+const flockRetryInterval = 10 * time.Millisecond
+
 // stateString is a string representing a pod state.
 type stateString string
 
@@ -58,6 +70,10 @@ const (
 type State struct {
 	State stateString `json:"state"`
 	URL   string      `json:"url,omitempty"`
+
+	// Hotplugged holds, per container ID, the vCPUs and memory
+	// hotplugged to the pod VM for the container.
+	Hotplugged map[string]Resources `json:"hotplugged,omitempty"`
 }
 
 // valid checks that the pod state is valid.
@@ -256,7 +272,13 @@ type PodStatus struct {
 	State            State
 	Hypervisor       HypervisorType
 	HypervisorConfig HypervisorConfig
+	VMConfig         Resources
 	Agent            AgentType
+
+	// Resources is the current size of the VM: VMConfig plus the
+	// resources hotplugged for the containers.
+	Resources Resources
+
 	ContainersStatus []ContainerStatus
 
 	// Annotations allow clients to store arbitrary values,
@@ -265,6 +287,25 @@ type PodStatus struct {
 	Annotations map[string]string
 }
 
+// BalloonStatus describes the memory balloon of a pod VM.
+type BalloonStatus struct {
+	// Memory is the memory in MiB the VM was started with.
+	Memory uint
+
+	// Actual is the memory in MiB the balloon currently leaves to
+	// the guest.
+	Actual uint
+}
+
+// Size returns the memory in MiB held by the balloon.
+func (b BalloonStatus) Size() uint {
+	if b.Actual >= b.Memory {
+		return 0
+	}
+
+	return b.Memory - b.Actual
+}
+
 // PodConfig is a Pod configuration.
 type PodConfig struct {
 	ID string
@@ -316,8 +357,44 @@ func (podConfig *PodConfig) valid() bool {
 	return true
 }
 
-// lock locks any pod to prevent it from being accessed by other processes.
-func lockPod(podID string) (*os.File, error) {
+// Pods are protected by a flock(2) taken on their lock file:
+//
+// - The entry points reading a pod (StatusPod, StatusContainer and thus
+//   ListPod) take a shared lock, so that they never see a pod being
+//   modified while still running concurrently with each other.
+// - The entry points modifying a pod take an exclusive lock for the whole
+//   operation. CreatePod and RunPod take it as soon as the pod resources
+//   exist.
+//
+// Linux does not give precedence to a process waiting for an exclusive
+// flock over the ones asking for a shared one. To prevent a steady flow of
+// readers from starving a writer, the lock is only requested while holding
+// an exclusive lock on the pod run directory: a waiting writer keeps new
+// readers out until the current ones are done.
+//
+// A lock is requested without blocking, until it is granted or the context
+// of the entry point is done, so that the operation timeout bounds the wait.
+// A pod being created is marked as such: ListPod skips it while it is
+// locked, rather than waiting for its VM to boot.
+//
+// An entry point never holds more than one pod lock at a time: ListPod
+// releases the lock of a pod before looking at the next one. An operation
+// which would need to lock several pods must lock them in ascending pod ID
+// order, so that it cannot deadlock with another one.
+
+// lockPod takes an exclusive lock on the pod, preventing it from being
+// accessed by other processes.
+func lockPod(ctx context.Context, podID string) (*os.File, error) {
+	return lockPodFile(ctx, podID, syscall.LOCK_EX)
+}
+
+// rLockPod takes a shared lock on the pod, preventing it from being
+// modified by other processes while it is read.
+func rLockPod(ctx context.Context, podID string) (*os.File, error) {
+	return lockPodFile(ctx, podID, syscall.LOCK_SH)
+}
+
+func lockPodFile(ctx context.Context, podID string, how int) (*os.File, error) {
 	if podID == "" {
 		return nil, errNeedPodID
 	}
@@ -328,19 +405,83 @@ func lockPod(podID string) (*os.File, error) {
 		return nil, err
 	}
 
+	for {
+		lockFile, err := flockPodFile(ctx, podID, podlockFile, how)
+		if err != nil {
+			return nil, err
+		}
+
+		// The pod may have been deleted, and maybe created again,
+		// while waiting for the lock: it is then held on a lock file
+		// nobody else uses anymore.
+		current, err := os.Stat(podlockFile)
+		if err == nil {
+			locked, err := lockFile.Stat()
+			if err == nil && os.SameFile(current, locked) {
+				return lockFile, nil
+			}
+		}
+
+		unlockPod(lockFile)
+	}
+}
+
+// flockPodFile locks podlockFile while holding the exclusive lock of the
+// pod run directory.
+func flockPodFile(ctx context.Context, podID, podlockFile string, how int) (*os.File, error) {
+	gate, err := os.Open(filepath.Dir(podlockFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, newPodError(ErrCodePodNotFound, podID, err)
+		}
+
+		return nil, err
+	}
+	defer gate.Close()
+
 	lockFile, err := os.Open(podlockFile)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, newPodError(ErrCodePodNotFound, podID, err)
+		}
+
 		return nil, err
 	}
 
-	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX)
+	err = flock(ctx, int(gate.Fd()), syscall.LOCK_EX)
 	if err != nil {
+		lockFile.Close()
+		return nil, err
+	}
+	defer syscall.Flock(int(gate.Fd()), syscall.LOCK_UN)
+
+	err = flock(ctx, int(lockFile.Fd()), how)
+	if err != nil {
+		lockFile.Close()
 		return nil, err
 	}
 
 	return lockFile, nil
 }
 
+// flock takes the flock(2) lock how on fd. flock(2) cannot be interrupted,
+// so the lock is requested without blocking until it is granted or ctx is
+// done.
+func flock(ctx context.Context, fd int, how int) error {
+	for {
+		err := syscall.Flock(fd, how|syscall.LOCK_NB)
+		if err != syscall.EWOULDBLOCK {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(flockRetryInterval):
+		}
+	}
+}
+
 // unlock unlocks any pod to allow it being accessed by other processes.
 func unlockPod(lockFile *os.File) error {
 	if lockFile == nil {
@@ -357,6 +498,44 @@ func unlockPod(lockFile *os.File) error {
 	return nil
 }
 
+// markPodCreating marks the pod as being created, until unmarkPodCreating
+// is called.
+func markPodCreating(podID string) error {
+	return ioutil.WriteFile(filepath.Join(runStoragePath, podID, creatingFile), nil, 0640)
+}
+
+func unmarkPodCreating(podID string) {
+	if err := os.Remove(filepath.Join(runStoragePath, podID, creatingFile)); err != nil {
+		virtLog.Warnf("Could not unmark pod %s as being created: %s", podID, err)
+	}
+}
+
+// isPodBeingCreated returns true if the pod is marked as being created and
+// locked. The mark left by a process which died while creating the pod is
+// ignored, the pod being unlocked then.
+func isPodBeingCreated(podID string) bool {
+	podDir := filepath.Join(runStoragePath, podID)
+
+	if _, err := os.Stat(filepath.Join(podDir, creatingFile)); err != nil {
+		return false
+	}
+
+	lockFile, err := os.Open(filepath.Join(podDir, lockFileName))
+	if err != nil {
+		return false
+	}
+	defer lockFile.Close()
+
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if err != nil {
+		return err == syscall.EWOULDBLOCK
+	}
+
+	syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	return false
+}
+
 // Pod is composed of a set of containers and a runtime environment.
 // A Pod can be created, deleted, started, paused, stopped, listed, entered, and restored.
 type Pod struct {
@@ -383,6 +562,10 @@ type Pod struct {
 	lockFile *os.File
 
 	annotationsLock *sync.RWMutex
+
+	// ctx bounds every blocking operation performed on behalf of
+	// the API call that created this Pod instance.
+	ctx context.Context
 }
 
 // ID returns the pod identifier string.
@@ -430,6 +613,18 @@ func (p *Pod) URL() string {
 	return p.state.URL
 }
 
+// HypervisorPID returns the PID of the process running the VM of the
+// pod, 0 when the hypervisor runs no host process.
+func (p *Pod) HypervisorPID() (int, error) {
+	return p.hypervisor.pid()
+}
+
+// HotpluggedResources returns the vCPUs and memory hotplugged to the VM
+// of the pod for the container containerID.
+func (p *Pod) HotpluggedResources(containerID string) Resources {
+	return p.state.Hotplugged[containerID]
+}
+
 // GetAllContainers returns all containers.
 func (p *Pod) GetAllContainers() []*Container {
 	return p.containers
@@ -449,7 +644,8 @@ func (p *Pod) createSetStates() error {
 	podState := State{
 		State: StateReady,
 		// retain existing URL value
-		URL: p.state.URL,
+		URL:        p.state.URL,
+		Hotplugged: p.state.Hotplugged,
 	}
 
 	err := p.setPodState(podState)
@@ -470,7 +666,7 @@ func (p *Pod) createSetStates() error {
 // It will create and store the pod structure, and then ask the hypervisor
 // to physically create that pod i.e. starts a VM for that pod to eventually
 // be started.
-func createPod(podConfig PodConfig) (*Pod, error) {
+func createPod(ctx context.Context, podConfig PodConfig) (*Pod, error) {
 	if podConfig.valid() == false {
 		return nil, fmt.Errorf("Invalid pod configuration")
 	}
@@ -512,6 +708,7 @@ func createPod(podConfig PodConfig) (*Pod, error) {
 		configPath:      filepath.Join(configStoragePath, podConfig.ID),
 		state:           State{},
 		annotationsLock: &sync.RWMutex{},
+		ctx:             ctx,
 	}
 
 	containers, err := createContainers(p, podConfig.Containers)
@@ -542,6 +739,11 @@ func createPod(podConfig PodConfig) (*Pod, error) {
 		return p, nil
 	}
 
+	// Resetting the state of an existing pod would hide the corruption.
+	if isCorruptResource(err) {
+		return nil, err
+	}
+
 	if err := p.createSetStates(); err != nil {
 		p.storage.deletePodResources(p.id, nil)
 		return nil, err
@@ -550,6 +752,61 @@ func createPod(podConfig PodConfig) (*Pod, error) {
 	return p, nil
 }
 
+// podCreation tracks what a pod creation has set up, so that
+// rollbackCreate undoes it.
+type podCreation struct {
+	// netNsPath and netNsCreated are known once the network is
+	// initialized, networkNS once it is added.
+	netNsPath    string
+	netNsCreated bool
+	networkNS    *NetworkNamespace
+
+	vmStarted bool
+
+	// shimsStarting is set before the shims are started, the
+	// containers holding the PID of those which were.
+	shimsStarting bool
+}
+
+// rollbackCreate removes what a failed pod creation left behind: the shims
+// and the VM if they were started, the network and its namespace if they
+// were created and the pod resources.
+// Errors are only logged since the creation error is the relevant one.
+func (p *Pod) rollbackCreate(creation podCreation) {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	p.ctx = ctx
+
+	if creation.shimsStarting {
+		if err := p.stopShims(); err != nil {
+			virtLog.Warnf("Could not stop the shims of pod %s: %s", p.id, err)
+		}
+	}
+
+	if creation.vmStarted {
+		if err := p.hypervisor.stopPod(ctx); err != nil {
+			virtLog.Warnf("Could not stop the VM of pod %s: %s", p.id, err)
+		}
+	}
+
+	if creation.networkNS != nil && creation.networkNS.NetNsCreated {
+		if err := p.network.remove(*p, *creation.networkNS); err != nil {
+			virtLog.Warnf("Could not remove the network of pod %s: %s", p.id, err)
+		}
+	} else if creation.netNsCreated {
+		// The network was not added, or only partly: removing its
+		// namespace removes the interfaces created in it.
+		if err := deleteNetNS(creation.netNsPath, true); err != nil {
+			virtLog.Warnf("Could not remove the network namespace of pod %s: %s", p.id, err)
+		}
+	}
+
+	if err := p.storage.deletePodResources(p.id, nil); err != nil {
+		virtLog.Warnf("Could not remove the resources of pod %s: %s", p.id, err)
+	}
+}
+
 // storePod stores a pod config.
 func (p *Pod) storePod() error {
 	err := p.storage.storePodResource(p.id, configFileType, *(p.config))
@@ -568,7 +825,7 @@ func (p *Pod) storePod() error {
 }
 
 // fetchPod fetches a pod config from a pod ID and returns a pod.
-func fetchPod(podID string) (*Pod, error) {
+func fetchPod(ctx context.Context, podID string) (*Pod, error) {
 	if podID == "" {
 		return nil, errNeedPodID
 	}
@@ -576,12 +833,21 @@ func fetchPod(podID string) (*Pod, error) {
 	fs := filesystem{}
 	config, err := fs.fetchPodConfig(podID)
 	if err != nil {
-		return nil, err
+		if os.IsNotExist(err) {
+			return nil, newPodError(ErrCodePodNotFound, podID, err)
+		}
+
+		return nil, setErrorPodID(err, podID)
 	}
 
 	virtLog.Infof("Info structure: %+v", config)
 
-	return createPod(config)
+	p, err := createPod(ctx, config)
+	if err != nil {
+		return nil, setErrorPodID(err, podID)
+	}
+
+	return p, nil
 }
 
 // delete deletes an already created pod.
@@ -593,7 +859,8 @@ func (p *Pod) delete() error {
 	}
 
 	if state.State != StateReady && state.State != StatePaused && state.State != StateStopped {
-		return fmt.Errorf("Pod not ready, paused or stopped, impossible to delete")
+		return newPodError(ErrCodeInvalidState, p.id,
+			fmt.Errorf("Pod not ready, paused or stopped, impossible to delete"))
 	}
 
 	err = p.storage.deletePodResources(p.id, nil)
@@ -633,7 +900,8 @@ func (p *Pod) startSetStates() error {
 	podState := State{
 		State: StateRunning,
 		// retain existing URL value
-		URL: p.state.URL,
+		URL:        p.state.URL,
+		Hotplugged: p.state.Hotplugged,
 	}
 
 	err := p.setPodState(podState)
@@ -652,12 +920,15 @@ func (p *Pod) startSetStates() error {
 // startVM starts the VM, ensuring it is started before it returns or issuing
 // an error in case of timeout. Then it connects to the agent inside the VM.
 func (p *Pod) startVM(netNsPath string) error {
+	span, ctx := trace.StartSpan(p.ctx, "startVM")
+	defer span.Finish()
+
 	vmStartedCh := make(chan struct{})
 	vmStoppedCh := make(chan struct{})
 
 	go func() {
 		p.network.run(netNsPath, func() error {
-			err := p.hypervisor.startPod(vmStartedCh, vmStoppedCh)
+			err := p.hypervisor.startPod(ctx, vmStartedCh, vmStoppedCh)
 			return err
 		})
 	}()
@@ -667,7 +938,10 @@ func (p *Pod) startVM(netNsPath string) error {
 	case <-vmStartedCh:
 		break
 	case <-time.After(time.Second):
-		return fmt.Errorf("Did not receive the pod started notification")
+		return newPodError(ErrCodeHypervisor, p.id,
+			fmt.Errorf("Did not receive the pod started notification"))
+	case <-p.ctx.Done():
+		return p.ctx.Err()
 	}
 
 	virtLog.Infof("VM started")
@@ -678,7 +952,12 @@ func (p *Pod) startVM(netNsPath string) error {
 // startShims registers all containers to the proxy and starts one
 // shim per container.
 func (p *Pod) startShims() error {
+	span, ctx := trace.StartSpan(p.ctx, "startShims")
+	defer span.Finish()
+
+	registerSpan, _ := trace.StartSpan(ctx, "registerProxy")
 	proxyInfos, url, err := p.proxy.register(*p)
+	registerSpan.SetError(err).Finish()
 	if err != nil {
 		return err
 	}
@@ -703,7 +982,11 @@ func (p *Pod) startShims() error {
 			Console: p.containers[idx].config.Cmd.Console,
 		}
 
+		shimSpan, _ := trace.StartSpan(ctx, "startShim")
+		shimSpan.SetTag(trace.TagContainerID, p.containers[idx].id)
+
 		pid, err := p.shim.start(*p, shimParams)
+		shimSpan.SetError(err).Finish()
 		if err != nil {
 			return err
 		}
@@ -732,8 +1015,11 @@ func (p *Pod) start() error {
 	}
 	defer p.proxy.disconnect()
 
-	if err := p.agent.startPod(*p); err != nil {
-		return err
+	span, _ := trace.StartSpan(p.ctx, "startAgentPod")
+	err := p.agent.startPod(*p)
+	span.SetError(err).Finish()
+	if err != nil {
+		return newPodError(ErrCodeAgent, p.id, err)
 	}
 
 	for _, c := range p.containers {
@@ -799,8 +1085,9 @@ func (p *Pod) stopShims() error {
 
 func (p *Pod) pauseSetStates() error {
 	state := State{
-		State: StatePaused,
-		URL:   p.state.URL,
+		State:      StatePaused,
+		URL:        p.state.URL,
+		Hotplugged: p.state.Hotplugged,
 	}
 
 	// XXX: When a pod is paused, all its containers are forcibly
@@ -821,8 +1108,9 @@ func (p *Pod) pauseSetStates() error {
 
 func (p *Pod) resumeSetStates() error {
 	state := State{
-		State: StateRunning,
-		URL:   p.state.URL,
+		State:      StateRunning,
+		URL:        p.state.URL,
+		Hotplugged: p.state.Hotplugged,
 	}
 
 	// XXX: Resuming a paused pod puts all containers back into the
@@ -854,8 +1142,8 @@ func (p *Pod) stopVM() error {
 		return err
 	}
 
-	if err := p.hypervisor.stopPod(); err != nil {
-		return err
+	if err := p.hypervisor.stopPod(p.ctx); err != nil {
+		return newPodError(ErrCodeHypervisor, p.id, err)
 	}
 
 	return nil
@@ -874,7 +1162,7 @@ func (p *Pod) stop() error {
 	defer p.proxy.disconnect()
 
 	if err := p.agent.stopPod(*p); err != nil {
-		return err
+		return newPodError(ErrCodeAgent, p.id, err)
 	}
 
 	if err := p.stopSetStates(); err != nil {
@@ -885,7 +1173,7 @@ func (p *Pod) stop() error {
 }
 
 func (p *Pod) pause() error {
-	if err := p.hypervisor.pausePod(); err != nil {
+	if err := p.hypervisor.pausePod(p.ctx); err != nil {
 		return err
 	}
 
@@ -897,7 +1185,7 @@ func (p *Pod) pause() error {
 }
 
 func (p *Pod) resume() error {
-	if err := p.hypervisor.resumePod(); err != nil {
+	if err := p.hypervisor.resumePod(p.ctx); err != nil {
 		return err
 	}
 
@@ -908,6 +1196,156 @@ func (p *Pod) resume() error {
 	return nil
 }
 
+// defaultVMMemory is the memory in MiB of a VM started without a memory
+// size, see defaultMemSize.
+const defaultVMMemory uint = 2048
+
+// vmMemory returns the memory in MiB of the VM, including the memory
+// hotplugged for the containers.
+func (p *Pod) vmMemory() uint {
+	return p.vmResources().Memory
+}
+
+// vmResources returns the current size of the VM: the resources it was
+// started with plus those hotplugged for the containers.
+func (p *Pod) vmResources() Resources {
+	resources := p.config.VMConfig
+	if resources.VCPUs == 0 {
+		resources.VCPUs = uint(runtime.NumCPU())
+	}
+
+	if resources.Memory == 0 {
+		resources.Memory = defaultVMMemory
+	}
+
+	for _, hotplugged := range p.state.Hotplugged {
+		resources.VCPUs += hotplugged.VCPUs
+		resources.Memory += hotplugged.Memory
+	}
+
+	return resources
+}
+
+// vmRunning returns true when the VM of the pod runs, resources can then
+// be hotplugged to it.
+func (p *Pod) vmRunning() bool {
+	return p.state.State == StateReady || p.state.State == StateRunning
+}
+
+// addContainerResources hotplugs the vCPUs and memory the container needs
+// to the VM, within the maximum reserved when the VM was started, and asks
+// the guest to online them. What got hotplugged is recorded in the pod
+// state so that it is unplugged with the container.
+func (p *Pod) addContainerResources(contConfig ContainerConfig) error {
+	if contConfig.Resources == (Resources{}) || !p.vmRunning() {
+		return nil
+	}
+
+	added, err := p.hypervisor.hotplugResources(p.ctx, contConfig.Resources)
+	if added != (Resources{}) {
+		if stateErr := p.setHotplugged(contConfig.ID, added); stateErr != nil {
+			return stateErr
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if added == (Resources{}) {
+		return nil
+	}
+
+	if _, _, err := p.proxy.connect(*p, false); err != nil {
+		return err
+	}
+	defer p.proxy.disconnect()
+
+	return p.agent.onlineCPUMem()
+}
+
+// removeContainerResources unplugs the vCPUs and memory hotplugged for the
+// container. Whatever the guest refuses to release stays recorded in the
+// pod state: failing to shrink the VM is only logged.
+func (p *Pod) removeContainerResources(containerID string) error {
+	hotplugged, ok := p.state.Hotplugged[containerID]
+	if !ok {
+		return nil
+	}
+
+	// The resources went away with the VM.
+	if !p.vmRunning() {
+		return p.setHotplugged(containerID, Resources{})
+	}
+
+	removed, err := p.hypervisor.hotunplugResources(p.ctx, hotplugged)
+	if err != nil {
+		virtLog.Warnf("Could not unplug all the resources of container %s: %v", containerID, err)
+	}
+
+	return p.setHotplugged(containerID, Resources{
+		VCPUs:  hotplugged.VCPUs - removed.VCPUs,
+		Memory: hotplugged.Memory - removed.Memory,
+	})
+}
+
+// setHotplugged records the resources hotplugged for the container in the
+// pod state, dropping the container when there are none.
+func (p *Pod) setHotplugged(containerID string, resources Resources) error {
+	state := p.state
+	state.Hotplugged = make(map[string]Resources)
+
+	for id, hotplugged := range p.state.Hotplugged {
+		if id != containerID {
+			state.Hotplugged[id] = hotplugged
+		}
+	}
+
+	if resources != (Resources{}) {
+		state.Hotplugged[containerID] = resources
+	}
+
+	if len(state.Hotplugged) == 0 {
+		state.Hotplugged = nil
+	}
+
+	return p.setPodState(state)
+}
+
+// resizeBalloon leaves memory MiB to the guest, the balloon holding the
+// rest of the memory of the VM.
+func (p *Pod) resizeBalloon(memory uint) error {
+	if p.state.State != StateRunning {
+		return newPodError(ErrCodeInvalidState, p.id,
+			fmt.Errorf("Pod not running, impossible to resize its balloon"))
+	}
+
+	if memory == 0 || memory > p.vmMemory() {
+		return fmt.Errorf("Invalid guest memory %dMiB: must be between 1 and %dMiB", memory, p.vmMemory())
+	}
+
+	return p.hypervisor.resizeBalloon(p.ctx, memory)
+}
+
+// balloonStatus returns the current state of the balloon of the running
+// pod.
+func (p *Pod) balloonStatus() (BalloonStatus, error) {
+	if p.state.State != StateRunning {
+		return BalloonStatus{}, newPodError(ErrCodeInvalidState, p.id,
+			fmt.Errorf("Pod not running, impossible to query its balloon"))
+	}
+
+	actual, err := p.hypervisor.guestMemory(p.ctx)
+	if err != nil {
+		return BalloonStatus{}, err
+	}
+
+	return BalloonStatus{
+		Memory: p.vmMemory(),
+		Actual: actual,
+	}, nil
+}
+
 // list lists all pod running on the host.
 func (p *Pod) list() ([]Pod, error) {
 	return nil, nil
@@ -944,7 +1382,8 @@ func (p *Pod) getContainer(containerID string) (*Container, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("pod %v has no container with ID %v", p.ID(), containerID)
+	return nil, newContainerError(ErrCodeContainerNotFound, p.id, containerID,
+		fmt.Errorf("pod %v has no container with ID %v", p.ID(), containerID))
 }
 
 func (p *Pod) setContainerState(containerID string, state stateString) error {
@@ -1027,7 +1466,8 @@ func (p *Pod) checkContainerState(containerID string, expectedState stateString)
 	}
 
 	if state.State != expectedState {
-		return fmt.Errorf("Container %s not %s", containerID, expectedState)
+		return newContainerError(ErrCodeInvalidState, p.id, containerID,
+			fmt.Errorf("Container %s not %s", containerID, expectedState))
 	}
 
 	return nil
@@ -1050,19 +1490,28 @@ func (p *Pod) checkContainersState(state stateString) error {
 
 // togglePausePod pauses a pod if pause is set to true, else it resumes
 // it.
-func togglePausePod(podID string, pause bool) (*Pod, error) {
+func togglePausePod(ctx context.Context, podID string, pause bool) (*Pod, error) {
+	operation := "ResumePod"
+	if pause {
+		operation = "PausePod"
+	}
+
+	span, ctx := trace.StartSpan(ctx, operation)
+	span.SetTag(trace.TagPodID, podID)
+	defer span.Finish()
+
 	if podID == "" {
 		return nil, errNeedPod
 	}
 
-	lockFile, err := lockPod(podID)
+	lockFile, err := lockPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
 	defer unlockPod(lockFile)
 
 	// Fetch the pod from storage and create it.
-	p, err := fetchPod(podID)
+	p, err := fetchPod(ctx, podID)
 	if err != nil {
 		return nil, err
 	}
@@ -17,11 +17,14 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
 	"sync"
+	"syscall"
 	"testing"
 )
 
@@ -52,7 +55,7 @@ func testCreatePod(t *testing.T, id string,
 		Containers:       containers,
 	}
 
-	pod, err := createPod(config)
+	pod, err := createPod(context.Background(), config)
 	if err != nil {
 		return nil, fmt.Errorf("Could not create pod: %s", err)
 	}
@@ -551,7 +554,7 @@ func TestPodSetPodAndContainerState(t *testing.T) {
 	}
 
 	// force state to be read from disk
-	p2, err := fetchPod(p.ID())
+	p2, err := fetchPod(context.Background(), p.ID())
 	if err != nil {
 		t.Fatalf("Failed to fetch pod %v: %v", p.ID(), err)
 	}
@@ -997,3 +1000,92 @@ func TestPodGetContainer(t *testing.T) {
 		t.Fatalf("Failed to find container %v", contID)
 	}
 }
+
+func TestPodHotplugContainerResources(t *testing.T) {
+	config := PodConfig{
+		ID:               testPodID,
+		HypervisorType:   MockHypervisor,
+		HypervisorConfig: newHypervisorConfig(nil, nil),
+		AgentType:        NoopAgentType,
+		VMConfig:         Resources{VCPUs: 2, Memory: 1024},
+	}
+
+	p, err := createPod(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanUp()
+
+	contConfig := newTestContainerConfigNoop("100")
+	contConfig.Resources = Resources{VCPUs: 1, Memory: 256}
+
+	if err := p.addContainerResources(contConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Resources{VCPUs: 3, Memory: 1280}
+	if resources := p.vmResources(); resources != expected {
+		t.Fatalf("Got %+v, expecting %+v", resources, expected)
+	}
+
+	// The hotplugged resources are part of the stored pod state.
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Hotplugged[contConfig.ID] != contConfig.Resources {
+		t.Fatalf("Got %+v, expecting %+v", state.Hotplugged, contConfig.Resources)
+	}
+
+	if hotplugged := p.HotpluggedResources(contConfig.ID); hotplugged != contConfig.Resources {
+		t.Fatalf("Got %+v, expecting %+v", hotplugged, contConfig.Resources)
+	}
+
+	if err := p.removeContainerResources(contConfig.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if resources := p.vmResources(); resources != config.VMConfig {
+		t.Fatalf("Got %+v, expecting %+v", resources, config.VMConfig)
+	}
+
+	if p.state.Hotplugged != nil {
+		t.Fatalf("Expected no hotplugged resources, got %+v", p.state.Hotplugged)
+	}
+}
+
+func TestPodRollbackCreateStopsShims(t *testing.T) {
+	cleanUp()
+	defer cleanUp()
+
+	// The shim of the first container was started, not the one of the
+	// second.
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	// Reap the killed process, which stays a zombie otherwise.
+	done := make(chan error)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	p := &Pod{
+		id:         testPodID,
+		hypervisor: &mockHypervisor{},
+		storage:    &filesystem{},
+		containers: []*Container{
+			{id: "started", process: Process{Pid: cmd.Process.Pid}},
+			{id: "not-started"},
+		},
+	}
+
+	p.rollbackCreate(podCreation{shimsStarting: true})
+
+	if err := <-done; err == nil || cmd.ProcessState.Sys().(syscall.WaitStatus).Signal() != syscall.SIGKILL {
+		t.Fatalf("The shim was not killed: %v", err)
+	}
+}
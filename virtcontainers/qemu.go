@@ -19,16 +19,20 @@ package virtcontainers
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	ciaoQemu "github.com/01org/ciao/qemu"
 	"github.com/01org/ciao/ssntp/uuid"
+	ciaoQemu "github.com/clearcontainers/runtime/virtcontainers/pkg/qemu"
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
 )
 
 type qmpChannel struct {
@@ -50,7 +54,14 @@ type qemu struct {
 	qmpMonitorCh qmpChannel
 	qmpControlCh qmpChannel
 
+	// pidFile is where qemu writes its PID.
+	pidFile string
+
 	qemuConfig ciaoQemu.Config
+
+	// hotplugMemory is the memory in MiB that can be hotplugged to the
+	// VM, within its maximum memory.
+	hotplugMemory uint
 }
 
 const defaultQemuPath = "/usr/bin/qemu-system-x86_64"
@@ -91,10 +102,37 @@ const (
 	defaultMemSize        = "2G"
 	defaultMemMax         = "3G"
 	defaultMemSlots uint8 = 2
+
+	// defaultMemHotplug is the memory in MiB between defaultMemSize
+	// and defaultMemMax.
+	defaultMemHotplug uint = 1024
+
+	// memBlockSize is the granularity in MiB at which the guest kernel
+	// onlines memory, hotplugged memory is a multiple of it.
+	memBlockSize uint = 128
 )
 
 const (
 	defaultConsole = "console.sock"
+	qemuPidFile    = "qemu.pid"
+)
+
+const (
+	defaultCPUModel = "host"
+
+	// hugePagesPath is where hugetlbfs is mounted on the host.
+	hugePagesPath = "/dev/hugepages"
+
+	// memoryBackendID identifies the object backing the guest memory.
+	memoryBackendID = "mem-ram"
+
+	// balloonDeviceID identifies the virtio-balloon device through
+	// which the guest memory is reclaimed.
+	balloonDeviceID = "balloon0"
+
+	// qomPeripheralPath is the QOM path under which qemu puts the
+	// devices added with an id, such as the hotplugged CPUs.
+	qomPeripheralPath = "/machine/peripheral/"
 )
 
 const (
@@ -123,10 +161,16 @@ func (l qmpLogger) Errorf(format string, v ...interface{}) {
 	virtLog.Errorf(format, v...)
 }
 
-var kernelDefaultParams = []Param{
+// kernelRootParams is a list of the kernel parameters mounting the
+// guest image as the root filesystem. They are not used when booting
+// from an initrd.
+var kernelRootParams = []Param{
 	{"root", "/dev/pmem0p1"},
 	{"rootflags", "dax,data=ordered,errors=remount-ro rw"},
 	{"rootfstype", "ext4"},
+}
+
+var kernelDefaultParams = []Param{
 	{"tsc", "reliable"},
 	{"no_timer_check", ""},
 	{"rcupdate.rcu_expedited", "1"},
@@ -165,8 +209,27 @@ var kernelDefaultParamsDebug = []Param{
 	{"systemd.log_level", "debug"},
 }
 
+// qemuExtraParams holds the hypervisor parameters of the configuration.
+// It is passed to ciaoQemu as a device, which is the only way to add
+// arbitrary arguments to the qemu command line.
+type qemuExtraParams []string
+
+func (p qemuExtraParams) Valid() bool {
+	return len(p) > 0
+}
+
+func (p qemuExtraParams) QemuParams(config *ciaoQemu.Config) []string {
+	return p
+}
+
 func (q *qemu) buildKernelParams(config HypervisorConfig) error {
-	params := kernelDefaultParams
+	var params []Param
+
+	if config.InitrdPath == "" {
+		params = append(params, kernelRootParams...)
+	}
+
+	params = append(params, kernelDefaultParams...)
 
 	if config.Debug == true {
 		params = append(params, kernelDefaultParamsDebug...)
@@ -406,9 +469,13 @@ func (q *qemu) qmpMonitor(connectedCh chan struct{}) {
 		q.qmpMonitorCh.wg.Done()
 	}(q)
 
+	span, _ := trace.StartSpan(q.qmpMonitorCh.ctx, "QMPConnect")
+	defer span.Finish()
+
 	cfg := ciaoQemu.QMPConfig{Logger: qmpLogger{}}
 	qmp, ver, err := ciaoQemu.QMPStart(q.qmpMonitorCh.ctx, q.qmpMonitorCh.path, cfg, q.qmpMonitorCh.disconnectCh)
 	if err != nil {
+		span.SetError(err)
 		virtLog.Errorf("Failed to connect to QEMU instance %v", err)
 		return
 	}
@@ -420,6 +487,7 @@ func (q *qemu) qmpMonitor(connectedCh chan struct{}) {
 
 	err = q.qmpMonitorCh.qmp.ExecuteQMPCapabilities(q.qmpMonitorCh.ctx)
 	if err != nil {
+		span.SetError(err)
 		virtLog.Errorf("Unable to send qmp_capabilities command: %v", err)
 		return
 	}
@@ -433,11 +501,18 @@ func (q *qemu) setCPUResources(podConfig PodConfig) ciaoQemu.SMP {
 		vcpus = podConfig.VMConfig.VCPUs
 	}
 
+	// vCPUs can be hotplugged up to the number of host CPUs.
+	maxVCPUs := uint(runtime.NumCPU())
+	if maxVCPUs < vcpus {
+		maxVCPUs = vcpus
+	}
+
 	smp := ciaoQemu.SMP{
 		CPUs:    uint32(vcpus),
-		Cores:   uint32(vcpus),
+		Cores:   uint32(maxVCPUs),
 		Sockets: defaultSockets,
 		Threads: defaultThreads,
+		MaxCPUs: uint32(maxVCPUs),
 	}
 
 	return smp
@@ -461,6 +536,81 @@ func (q *qemu) setMemoryResources(podConfig PodConfig) ciaoQemu.Memory {
 	return memory
 }
 
+// maxHotplugMemory returns the memory in MiB that can be hotplugged to the
+// VM: the difference between its maximum and initial memory.
+func (q *qemu) maxHotplugMemory(podConfig PodConfig) uint {
+	if podConfig.VMConfig.Memory == 0 {
+		return defaultMemHotplug
+	}
+
+	return uint(float64(podConfig.VMConfig.Memory)*1.5) - podConfig.VMConfig.Memory
+}
+
+// guestMemoryBackend returns the backend of the guest memory: huge pages,
+// preallocation and binding to host NUMA nodes, as configured. The memory
+// the VM is started with and the memory hotplugged to it share it, so
+// that all the guest memory gets the same backing.
+func (q *qemu) guestMemoryBackend() ciaoQemu.MemoryBackend {
+	config := q.config
+
+	backend := ciaoQemu.MemoryBackend{
+		Type:     "memory-backend-ram",
+		Prealloc: config.MemPrealloc,
+	}
+
+	if config.HugePages {
+		backend.Type = "memory-backend-file"
+		backend.MemPath = hugePagesPath
+		backend.Share = true
+	}
+
+	if len(config.NUMANodes) > 0 {
+		backend.HostNodes = config.NUMANodes
+		backend.Policy = "bind"
+	}
+
+	return backend
+}
+
+// memoryBackend returns the qemu parameters backing the guest memory with
+// huge pages, preallocating it or binding it to host NUMA nodes. No
+// parameters are returned when none of these is configured.
+func (q *qemu) memoryBackend(memory ciaoQemu.Memory) qemuExtraParams {
+	config := q.config
+
+	if !config.HugePages && !config.MemPrealloc && len(config.NUMANodes) == 0 {
+		return nil
+	}
+
+	backend := q.guestMemoryBackend()
+	options := []string{"id=" + memoryBackendID, "size=" + memory.Size}
+
+	if backend.MemPath != "" {
+		options = append(options, "mem-path="+backend.MemPath)
+	}
+
+	if backend.Share {
+		options = append(options, "share=on")
+	}
+
+	if backend.Prealloc {
+		options = append(options, "prealloc=on")
+	}
+
+	for _, node := range backend.HostNodes {
+		options = append(options, fmt.Sprintf("host-nodes=%d", node))
+	}
+
+	if backend.Policy != "" {
+		options = append(options, "policy="+backend.Policy)
+	}
+
+	return qemuExtraParams{
+		"-object", backend.Type + "," + strings.Join(options, ","),
+		"-numa", "node,memdev=" + memoryBackendID,
+	}
+}
+
 // createPod is the Hypervisor pod creation implementation for ciaoQemu.
 func (q *qemu) createPod(podConfig PodConfig) error {
 	var devices []ciaoQemu.Device
@@ -479,6 +629,8 @@ func (q *qemu) createPod(podConfig PodConfig) error {
 
 	memory := q.setMemoryResources(podConfig)
 
+	q.hotplugMemory = q.maxHotplugMemory(podConfig)
+
 	knobs := ciaoQemu.Knobs{
 		NoUserConfig: true,
 		NoDefaults:   true,
@@ -523,13 +675,45 @@ func (q *qemu) createPod(podConfig PodConfig) error {
 
 	devices = q.appendFSDevices(devices, podConfig)
 	devices = q.appendConsoles(devices, podConfig)
-	devices, err = q.appendImage(devices, podConfig)
-	if err != nil {
-		return err
+
+	if q.config.InitrdPath != "" {
+		// The initrd holds the root filesystem, so there is no
+		// image to plug.
+		devices = append(devices, qemuExtraParams{"-initrd", q.config.InitrdPath})
+	} else {
+		devices, err = q.appendImage(devices, podConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	devices = append(devices, q.memoryBackend(memory))
+
+	// The balloon lets the host reclaim the memory of idle guests.
+	devices = append(devices, qemuExtraParams{"-device", "virtio-balloon-pci,id=" + balloonDeviceID + ",deflate-on-oom=on"})
+
+	name := fmt.Sprintf("pod-%s", podConfig.ID)
+
+	q.pidFile = filepath.Join(runStoragePath, podConfig.ID, qemuPidFile)
+	devices = append(devices, qemuExtraParams{"-pidfile", q.pidFile})
+
+	if len(q.config.NUMANodes) > 0 {
+		// The vCPU threads are found by their name, once qemu
+		// has started.
+		name += ",debug-threads=on"
 	}
 
+	cpuModel := q.config.CPUModel
+	if cpuModel == "" {
+		cpuModel = defaultCPUModel
+	}
+
+	// The hypervisor parameters come last so that they can override
+	// the defaults.
+	devices = append(devices, qemuExtraParams(serializeParams(q.config.HypervisorParams, "")))
+
 	qemuConfig := ciaoQemu.Config{
-		Name:        fmt.Sprintf("pod-%s", podConfig.ID),
+		Name:        name,
 		UUID:        q.forceUUIDFormat(podConfig.ID),
 		Path:        q.path,
 		Ctx:         q.qmpMonitorCh.ctx,
@@ -537,7 +721,7 @@ func (q *qemu) createPod(podConfig PodConfig) error {
 		SMP:         smp,
 		Memory:      memory,
 		Devices:     devices,
-		CPUModel:    "host",
+		CPUModel:    cpuModel,
 		Kernel:      kernel,
 		RTC:         rtc,
 		QMPSockets:  qmpSockets,
@@ -552,10 +736,29 @@ func (q *qemu) createPod(podConfig PodConfig) error {
 }
 
 // startPod will start the Pod's VM.
-func (q *qemu) startPod(startCh, stopCh chan struct{}) error {
+func (q *qemu) startPod(ctx context.Context, startCh, stopCh chan struct{}) error {
+	q.qemuConfig.Ctx = ctx
+	q.qmpMonitorCh.ctx = ctx
+
+	span, _ := trace.StartSpan(ctx, "LaunchQemu")
 	strErr, err := ciaoQemu.LaunchQemu(q.qemuConfig, qmpLogger{})
 	if err != nil {
-		return fmt.Errorf("%s", strErr)
+		err = fmt.Errorf("%s", strErr)
+	}
+	span.SetError(err).Finish()
+	if err != nil {
+		return err
+	}
+
+	if len(q.config.NUMANodes) > 0 {
+		if err := q.pinVCPUThreads(); err != nil {
+			// The VM must not run unbound to its NUMA nodes.
+			if stopErr := q.stopPod(ctx); stopErr != nil {
+				virtLog.Errorf("Could not stop the VM: %v", stopErr)
+			}
+
+			return err
+		}
 	}
 
 	// Start the QMP monitoring thread
@@ -566,9 +769,36 @@ func (q *qemu) startPod(startCh, stopCh chan struct{}) error {
 	return nil
 }
 
+// pinVCPUThreads binds the vCPU threads of the running qemu to the host
+// NUMA nodes of the configuration.
+func (q *qemu) pinVCPUThreads() error {
+	pid, err := q.pid()
+	if err != nil {
+		return err
+	}
+
+	return pinVCPUThreads(pid, q.config.NUMANodes)
+}
+
+// pid returns the PID of the running qemu, read from its PID file.
+func (q *qemu) pid() (int, error) {
+	data, err := ioutil.ReadFile(q.pidFile)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid qemu PID file %s: %v", q.pidFile, err)
+	}
+
+	return pid, nil
+}
+
 // stopPod will stop the Pod's VM.
-func (q *qemu) stopPod() error {
+func (q *qemu) stopPod(ctx context.Context) error {
 	cfg := ciaoQemu.QMPConfig{Logger: qmpLogger{}}
+	q.qmpControlCh.ctx = ctx
 	q.qmpControlCh.disconnectCh = make(chan struct{})
 
 	qmp, _, err := ciaoQemu.QMPStart(q.qmpControlCh.ctx, q.qmpControlCh.path, cfg, q.qmpControlCh.disconnectCh)
@@ -577,13 +807,13 @@ func (q *qemu) stopPod() error {
 		return err
 	}
 
-	err = qmp.ExecuteQMPCapabilities(q.qmpMonitorCh.ctx)
+	err = qmp.ExecuteQMPCapabilities(q.qmpControlCh.ctx)
 	if err != nil {
 		virtLog.Errorf("Failed to negotiate capabilities with QEMU %v", err)
 		return err
 	}
 
-	if err := qmp.ExecuteQuit(q.qmpMonitorCh.ctx); err != nil {
+	if err := qmp.ExecuteQuit(q.qmpControlCh.ctx); err != nil {
 		return err
 	}
 
@@ -593,12 +823,14 @@ func (q *qemu) stopPod() error {
 		break
 	case <-time.After(time.Second):
 		return fmt.Errorf("Did not receive the VM disconnection notification")
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 
 	return nil
 }
 
-func (q *qemu) togglePausePod(pause bool) error {
+func (q *qemu) togglePausePod(ctx context.Context, pause bool) error {
 	defer func(qemu *qemu) {
 		if q.qmpMonitorCh.qmp != nil {
 			q.qmpMonitorCh.qmp.Shutdown()
@@ -606,6 +838,8 @@ func (q *qemu) togglePausePod(pause bool) error {
 	}(q)
 
 	cfg := ciaoQemu.QMPConfig{Logger: qmpLogger{}}
+	q.qmpControlCh.ctx = ctx
+	q.qmpMonitorCh.ctx = ctx
 
 	// Auto-closed by QMPStart().
 	disconnectCh := make(chan struct{})
@@ -637,12 +871,12 @@ func (q *qemu) togglePausePod(pause bool) error {
 	return nil
 }
 
-func (q *qemu) pausePod() error {
-	return q.togglePausePod(true)
+func (q *qemu) pausePod(ctx context.Context) error {
+	return q.togglePausePod(ctx, true)
 }
 
-func (q *qemu) resumePod() error {
-	return q.togglePausePod(false)
+func (q *qemu) resumePod(ctx context.Context) error {
+	return q.togglePausePod(ctx, false)
 }
 
 // addDevice will add extra devices to Qemu command line.
@@ -664,6 +898,275 @@ func (q *qemu) addDevice(devInfo interface{}, devType deviceType) error {
 	return nil
 }
 
+// controlQMP connects to the control socket of the running VM and
+// negotiates the QMP capabilities. The caller must shut the returned QMP
+// down.
+func (q *qemu) controlQMP(ctx context.Context) (*ciaoQemu.QMP, error) {
+	cfg := ciaoQemu.QMPConfig{Logger: qmpLogger{}}
+
+	// Auto-closed by QMPStart().
+	disconnectCh := make(chan struct{})
+
+	qmp, _, err := ciaoQemu.QMPStart(ctx, q.qmpControlCh.path, cfg, disconnectCh)
+	if err != nil {
+		virtLog.Errorf("Failed to connect to QEMU instance %v", err)
+		return nil, err
+	}
+
+	if err := qmp.ExecuteQMPCapabilities(ctx); err != nil {
+		virtLog.Errorf("Failed to negotiate capabilities with QEMU %v", err)
+		qmp.Shutdown()
+		return nil, err
+	}
+
+	return qmp, nil
+}
+
+// resizeBalloon sets the logical size of the guest memory, the balloon
+// holding the rest of the memory the VM was started with.
+func (q *qemu) resizeBalloon(ctx context.Context, memory uint) error {
+	qmp, err := q.controlQMP(ctx)
+	if err != nil {
+		return err
+	}
+	defer qmp.Shutdown()
+
+	return qmp.ExecuteBalloon(ctx, uint64(memory)<<20)
+}
+
+// guestMemory returns the logical size of the guest memory in MiB.
+func (q *qemu) guestMemory(ctx context.Context) (uint, error) {
+	qmp, err := q.controlQMP(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer qmp.Shutdown()
+
+	actual, err := qmp.ExecuteQueryBalloon(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(actual >> 20), nil
+}
+
+// hotplugResources hotplugs vCPUs and pc-dimm memory to the VM, within the
+// CPUs, memory and memory slots reserved when it was started.
+func (q *qemu) hotplugResources(ctx context.Context, resources Resources) (Resources, error) {
+	var added Resources
+
+	qmp, err := q.controlQMP(ctx)
+	if err != nil {
+		return added, err
+	}
+	defer qmp.Shutdown()
+
+	if resources.VCPUs > 0 {
+		added.VCPUs, err = q.hotplugCPUs(ctx, qmp, resources.VCPUs)
+		if err != nil {
+			return added, err
+		}
+	}
+
+	if resources.Memory > 0 {
+		added.Memory, err = q.hotplugMemoryDevice(ctx, qmp, resources.Memory)
+		if err != nil {
+			return added, err
+		}
+	}
+
+	if added != resources {
+		virtLog.Warnf("Only %d vCPUs and %d MiB out of %d vCPUs and %d MiB could be hotplugged",
+			added.VCPUs, added.Memory, resources.VCPUs, resources.Memory)
+	}
+
+	return added, nil
+}
+
+// hotunplugResources unplugs hotplugged vCPUs and pc-dimm memory from the
+// VM. Unplugging requires the cooperation of the guest.
+func (q *qemu) hotunplugResources(ctx context.Context, resources Resources) (Resources, error) {
+	var removed Resources
+
+	qmp, err := q.controlQMP(ctx)
+	if err != nil {
+		return removed, err
+	}
+	defer qmp.Shutdown()
+
+	if resources.VCPUs > 0 {
+		removed.VCPUs, err = q.hotunplugCPUs(ctx, qmp, resources.VCPUs)
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	if resources.Memory > 0 {
+		removed.Memory, err = q.hotunplugMemoryDevices(ctx, qmp, resources.Memory)
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// hotplugCPUs plugs up to vcpus vCPUs into the free CPU slots of the VM and
+// returns how many were plugged.
+func (q *qemu) hotplugCPUs(ctx context.Context, qmp *ciaoQemu.QMP, vcpus uint) (uint, error) {
+	cpus, err := qmp.ExecuteQueryHotpluggableCPUs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var added uint
+	for _, cpu := range cpus {
+		if added == vcpus {
+			break
+		}
+
+		// Plugged already.
+		if cpu.QOMPath != "" {
+			continue
+		}
+
+		props := cpu.Properties
+		cpuID := fmt.Sprintf("cpu-%d-%d-%d", props.Socket, props.Core, props.Thread)
+		if err := qmp.ExecuteCPUDeviceAdd(ctx, cpu.Type, cpuID, props.Socket, props.Core, props.Thread); err != nil {
+			return added, err
+		}
+
+		added++
+	}
+
+	return added, nil
+}
+
+// hotunplugCPUs unplugs up to vcpus hotplugged vCPUs, the last plugged
+// first, and returns how many were unplugged.
+func (q *qemu) hotunplugCPUs(ctx context.Context, qmp *ciaoQemu.QMP, vcpus uint) (uint, error) {
+	cpus, err := qmp.ExecuteQueryHotpluggableCPUs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed uint
+	for i := len(cpus) - 1; i >= 0 && removed < vcpus; i-- {
+		// Only the CPUs added through device_add have an id, the
+		// CPUs the VM was started with cannot be unplugged.
+		if !strings.HasPrefix(cpus[i].QOMPath, qomPeripheralPath) {
+			continue
+		}
+
+		if err := qmp.ExecuteDeviceDel(ctx, path.Base(cpus[i].QOMPath)); err != nil {
+			return removed, err
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// hotplugMemoryDevice plugs a pc-dimm device of up to memory MiB, rounded
+// up to memBlockSize, into a free memory slot of the VM and returns the
+// size of the device. Nothing is plugged when all the slots or the maximum
+// memory of the VM are used.
+func (q *qemu) hotplugMemoryDevice(ctx context.Context, qmp *ciaoQemu.QMP, memory uint) (uint, error) {
+	devices, err := qmp.ExecuteQueryMemoryDevices(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(devices) >= int(defaultMemSlots) {
+		return 0, nil
+	}
+
+	ids := make(map[string]bool)
+	var used uint
+	for _, device := range devices {
+		ids[device.Data.ID] = true
+		used += uint(device.Data.Size >> 20)
+	}
+
+	var free uint
+	if q.hotplugMemory > used {
+		free = (q.hotplugMemory - used) / memBlockSize * memBlockSize
+	}
+
+	size := (memory + memBlockSize - 1) / memBlockSize * memBlockSize
+	if size > free {
+		size = free
+	}
+
+	if size == 0 {
+		return 0, nil
+	}
+
+	var devID string
+	for i := 0; ; i++ {
+		devID = fmt.Sprintf("dimm%d", i)
+		if !ids[devID] {
+			break
+		}
+	}
+
+	// The device gets the backing of the memory the VM was started
+	// with, or part of the guest memory would lose its huge pages or
+	// NUMA binding.
+	backend := q.guestMemoryBackend()
+	if err := qmp.ExecuteHotplugMemory(ctx, "mem-"+devID, devID, uint64(size)<<20, backend); err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// hotunplugMemoryDevices unplugs hotplugged pc-dimm devices adding up to at
+// most memory MiB, preferring a device of exactly that size, and returns
+// the memory unplugged.
+func (q *qemu) hotunplugMemoryDevices(ctx context.Context, qmp *ciaoQemu.QMP, memory uint) (uint, error) {
+	devices, err := qmp.ExecuteQueryMemoryDevices(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var candidates []ciaoQemu.MemoryDeviceData
+	for _, device := range devices {
+		if !device.Data.Hotplugged {
+			continue
+		}
+
+		if uint(device.Data.Size>>20) == memory {
+			candidates = []ciaoQemu.MemoryDeviceData{device.Data}
+			break
+		}
+
+		candidates = append(candidates, device.Data)
+	}
+
+	var removed uint
+	for _, device := range candidates {
+		size := uint(device.Size >> 20)
+		if removed+size > memory {
+			continue
+		}
+
+		if err := qmp.ExecuteDeviceDel(ctx, device.ID); err != nil {
+			return removed, err
+		}
+
+		removed += size
+
+		// The backend is only freed once its device is gone.
+		if err := qmp.ExecuteObjectDel(ctx, path.Base(device.Memdev)); err != nil {
+			virtLog.Warnf("Could not delete the backend of memory device %s: %v", device.ID, err)
+		}
+	}
+
+	return removed, nil
+}
+
 // getPodConsole builds the path of the console where we can read
 // logs coming from the pod.
 func (q *qemu) getPodConsole(podID string) string {
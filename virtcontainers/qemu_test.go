@@ -18,13 +18,15 @@ package virtcontainers
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 
-	ciaoQemu "github.com/01org/ciao/qemu"
+	ciaoQemu "github.com/clearcontainers/runtime/virtcontainers/pkg/qemu"
 )
 
 func newQemuConfig() HypervisorConfig {
@@ -64,12 +66,12 @@ func TestQemuBuildKernelParamsFoo(t *testing.T) {
 	suffixStr := "foo=foo bar=bar"
 	suffixParams := []Param{
 		{
-			parameter: "foo",
-			value:     "foo",
+			Key:   "foo",
+			Value: "foo",
 		},
 		{
-			parameter: "bar",
-			value:     "bar",
+			Key:   "bar",
+			Value: "bar",
 		},
 	}
 
@@ -96,6 +98,28 @@ func TestQemuBuildKernelParamsFoo(t *testing.T) {
 	}
 }
 
+func TestQemuBuildKernelParamsInitrd(t *testing.T) {
+	qemuConfig := newQemuConfig()
+	qemuConfig.ImagePath = ""
+	qemuConfig.InitrdPath = testQemuInitrdPath
+
+	q := &qemu{}
+
+	err := q.buildKernelParams(qemuConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The root filesystem is in the initrd, not on the image.
+	expected := strings.TrimPrefix(testQemuKernelParamsBase,
+		"root=/dev/pmem0p1 rootflags=dax,data=ordered,errors=remount-ro rw rootfstype=ext4 ")
+	expected += " " + testQemuKernelParamsNonDebug
+
+	if out := strings.Join(q.kernelParams, " "); out != expected {
+		t.Fatalf("Got %q\nExpecting %q", out, expected)
+	}
+}
+
 func testQemuAppend(t *testing.T, structure interface{}, expected []ciaoQemu.Device, devType deviceType) {
 	var devices []ciaoQemu.Device
 	q := &qemu{}
@@ -339,11 +363,15 @@ func TestQemuSetCPUResources(t *testing.T) {
 
 	q := &qemu{}
 
+	// vCPUs can be hotplugged up to the number of host CPUs.
+	maxVCPUs := runtime.NumCPU()
+
 	expectedOut := ciaoQemu.SMP{
 		CPUs:    uint32(vcpus),
-		Cores:   uint32(vcpus),
+		Cores:   uint32(maxVCPUs),
 		Sockets: uint32(1),
 		Threads: uint32(1),
+		MaxCPUs: uint32(maxVCPUs),
 	}
 
 	vmConfig := Resources{
@@ -387,6 +415,84 @@ func TestQemuSetMemoryResources(t *testing.T) {
 	}
 }
 
+func TestQemuExtraParams(t *testing.T) {
+	params := []Param{
+		{Key: "-no-reboot"},
+		{Key: "-object", Value: "rng-random,id=rng0,filename=/dev/urandom"},
+	}
+
+	expectedOut := []string{"-no-reboot", "-object", "rng-random,id=rng0,filename=/dev/urandom"}
+
+	extraParams := qemuExtraParams(serializeParams(params, ""))
+
+	if extraParams.Valid() == false {
+		t.Fatalf("Unexpected invalid parameters %v", extraParams)
+	}
+
+	out := extraParams.QemuParams(&ciaoQemu.Config{})
+
+	if reflect.DeepEqual(out, expectedOut) == false {
+		t.Fatalf("Got %v\nExpecting %v", out, expectedOut)
+	}
+
+	if qemuExtraParams(nil).Valid() == true {
+		t.Fatal("Unexpected valid empty parameters")
+	}
+}
+
+func TestQemuMemoryBackend(t *testing.T) {
+	memory := ciaoQemu.Memory{Size: "2048M"}
+
+	type testData struct {
+		config   HypervisorConfig
+		expected qemuExtraParams
+	}
+
+	for _, d := range []testData{
+		{HypervisorConfig{}, nil},
+		{HypervisorConfig{HugePages: true}, qemuExtraParams{
+			"-object", "memory-backend-file,id=mem-ram,size=2048M,mem-path=/dev/hugepages,share=on",
+			"-numa", "node,memdev=mem-ram",
+		}},
+		{HypervisorConfig{MemPrealloc: true, NUMANodes: []uint{0, 2}}, qemuExtraParams{
+			"-object", "memory-backend-ram,id=mem-ram,size=2048M,prealloc=on,host-nodes=0,host-nodes=2,policy=bind",
+			"-numa", "node,memdev=mem-ram",
+		}},
+	} {
+		q := &qemu{config: d.config}
+
+		out := q.memoryBackend(memory)
+		if reflect.DeepEqual(out, d.expected) == false {
+			t.Fatalf("Got %v\nExpecting %v", out, d.expected)
+		}
+	}
+}
+
+func TestQemuGuestMemoryBackend(t *testing.T) {
+	q := &qemu{}
+
+	expected := ciaoQemu.MemoryBackend{Type: "memory-backend-ram"}
+	if backend := q.guestMemoryBackend(); !reflect.DeepEqual(backend, expected) {
+		t.Fatalf("Got %+v\nExpecting %+v", backend, expected)
+	}
+
+	// The hotplugged memory keeps the huge pages and NUMA binding of
+	// the memory the VM is started with.
+	q.config = HypervisorConfig{HugePages: true, MemPrealloc: true, NUMANodes: []uint{1}}
+
+	expected = ciaoQemu.MemoryBackend{
+		Type:      "memory-backend-file",
+		MemPath:   hugePagesPath,
+		Share:     true,
+		Prealloc:  true,
+		HostNodes: []uint{1},
+		Policy:    "bind",
+	}
+	if backend := q.guestMemoryBackend(); !reflect.DeepEqual(backend, expected) {
+		t.Fatalf("Got %+v\nExpecting %+v", backend, expected)
+	}
+}
+
 func testQemuAddDevice(t *testing.T, devInfo interface{}, devType deviceType, expected []ciaoQemu.Device) {
 	q := &qemu{}
 
@@ -501,3 +607,27 @@ func TestQemuMachineTypes(t *testing.T) {
 		}
 	}
 }
+
+func TestQemuPID(t *testing.T) {
+	q := &qemu{
+		pidFile: filepath.Join(testDir, qemuPidFile),
+	}
+
+	if _, err := q.pid(); err == nil {
+		t.Fatal("Expected an error without a PID file")
+	}
+
+	if err := ioutil.WriteFile(q.pidFile, []byte("1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(q.pidFile)
+
+	pid, err := q.pid()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pid != 1234 {
+		t.Fatalf("Got PID %d, expecting 1234", pid)
+	}
+}
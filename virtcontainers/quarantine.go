@@ -0,0 +1,238 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/trace"
+)
+
+// quarantineDirName is the directory, next to the pods storage
+// directories, where the pods whose resources are corrupted are moved.
+const quarantineDirName = "quarantine"
+
+// quarantineReasonFile is the file holding the reason of a quarantine.
+const quarantineReasonFile = "reason.json"
+
+// vmKillTimeout bounds the wait for the VM of a quarantined pod to exit.
+const vmKillTimeout = 5 * time.Second
+
+// QuarantinedPod describes a pod which was moved out of the pods storage
+// because some of its resources could not be decoded.
+type QuarantinedPod struct {
+	ID     string
+	Time   time.Time
+	Reason string
+
+	// ConfigPath and RunPath are the directories the pod resources
+	// were moved to.
+	ConfigPath string
+	RunPath    string
+}
+
+// quarantinePath returns the quarantine directory of the pods storage
+// directory. It is named after the storage directory so that the config
+// and run storages do not clash when they share the same parent.
+func quarantinePath(storagePath string) string {
+	return filepath.Join(filepath.Dir(storagePath), quarantineDirName, filepath.Base(storagePath))
+}
+
+// quarantinePod moves the resources of the pod out of the pods storage,
+// so that a corrupted pod does not prevent the others from being used.
+// Its VM is killed first, as its resources are needed to stop it.
+// The pods storage and its quarantine directory being on the same
+// filesystem, the pod resources are moved atomically.
+func quarantinePod(podID string, reason error) (QuarantinedPod, error) {
+	if podID == "" {
+		return QuarantinedPod{}, errNeedPodID
+	}
+
+	// Nothing could stop the VM of the pod once its resources are
+	// moved. The shims of the pod exit once the proxy loses the VM.
+	if err := killPodVM(podID); err != nil {
+		return QuarantinedPod{}, err
+	}
+
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%d", podID, now.UnixNano())
+
+	q := QuarantinedPod{
+		ID:         podID,
+		Time:       now,
+		Reason:     reason.Error(),
+		ConfigPath: filepath.Join(quarantinePath(configStoragePath), name),
+		RunPath:    filepath.Join(quarantinePath(runStoragePath), name),
+	}
+
+	moves := []struct {
+		from string
+		to   string
+	}{
+		{filepath.Join(configStoragePath, podID), q.ConfigPath},
+		{filepath.Join(runStoragePath, podID), q.RunPath},
+	}
+
+	for _, m := range moves {
+		if err := os.MkdirAll(filepath.Dir(m.to), dirMode); err != nil {
+			return QuarantinedPod{}, err
+		}
+
+		if err := os.Rename(m.from, m.to); err != nil && !os.IsNotExist(err) {
+			return QuarantinedPod{}, err
+		}
+	}
+
+	// Make sure the reason can be stored even if the configuration
+	// directory was missing.
+	if err := os.MkdirAll(q.ConfigPath, dirMode); err != nil {
+		return QuarantinedPod{}, err
+	}
+
+	fs := filesystem{}
+	if err := fs.storeFile(filepath.Join(q.ConfigPath, quarantineReasonFile), q); err != nil {
+		return QuarantinedPod{}, err
+	}
+
+	virtLog.Warnf("Pod %s quarantined to %s: %s", podID, q.ConfigPath, q.Reason)
+
+	return q, nil
+}
+
+// killPodVM kills the qemu process of the pod, found from the PID file it
+// writes in the run storage of the pod, and waits for it to exit. The
+// process is only killed if its command line names that PID file, so that
+// a PID reused since is left alone.
+func killPodVM(podID string) error {
+	pidFile := filepath.Join(runStoragePath, podID, qemuPidFile)
+
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		virtLog.Warnf("Ignoring invalid qemu PID file %s of pod %s", pidFile, podID)
+		return nil
+	}
+
+	cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil || !strings.Contains(string(cmdline), pidFile) {
+		// The VM is not running anymore.
+		return nil
+	}
+
+	virtLog.Warnf("Killing the VM of pod %s (qemu PID %d)", podID, pid)
+
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return err
+	}
+
+	deadline := time.Now().Add(vmKillTimeout)
+	for syscall.Kill(pid, 0) != syscall.ESRCH {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("qemu process %d of pod %s did not exit", pid, podID)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// QuarantinePod is the virtcontainers entry point moving a pod whose
+// resources cannot be decoded out of the pods storage. The VM of the pod
+// is killed, so it is only meant to be called by an explicit
+// administrative operation, never while reading the pods. A pod which can
+// be read is not quarantined.
+func QuarantinePod(ctx context.Context, podID string) (QuarantinedPod, error) {
+	span, ctx := trace.StartSpan(ctx, "QuarantinePod")
+	span.SetTag(trace.TagPodID, podID)
+	defer span.Finish()
+
+	if podID == "" {
+		return QuarantinedPod{}, errNeedPodID
+	}
+
+	lockFile, err := lockPod(ctx, podID)
+	if err != nil {
+		return QuarantinedPod{}, err
+	}
+	defer unlockPod(lockFile)
+
+	// Check the corruption again while holding the lock, the pod may
+	// have been caught while being written.
+	_, err = fetchPod(ctx, podID)
+	if err == nil {
+		return QuarantinedPod{}, fmt.Errorf("Pod %s is not corrupted", podID)
+	}
+
+	if !isCorruptResource(err) {
+		return QuarantinedPod{}, err
+	}
+
+	return quarantinePod(podID, err)
+}
+
+// ListQuarantinedPods is the virtcontainers entry point listing the pods
+// moved out of the pods storage because their resources were corrupted.
+func ListQuarantinedPods() ([]QuarantinedPod, error) {
+	dir := quarantinePath(configStoragePath)
+
+	d, err := os.Open(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []QuarantinedPod{}, nil
+		}
+
+		return []QuarantinedPod{}, err
+	}
+	defer d.Close()
+
+	names, err := d.Readdirnames(0)
+	if err != nil {
+		return []QuarantinedPod{}, err
+	}
+
+	fs := filesystem{}
+	pods := []QuarantinedPod{}
+
+	for _, name := range names {
+		var q QuarantinedPod
+
+		if err := fs.fetchFile(filepath.Join(dir, name, quarantineReasonFile), &q); err != nil {
+			continue
+		}
+
+		pods = append(pods, q)
+	}
+
+	return pods, nil
+}
@@ -0,0 +1,219 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestQuarantinePodFailingPodIDEmpty(t *testing.T) {
+	if _, err := quarantinePod("", fmt.Errorf("corrupted")); err == nil {
+		t.Fatal()
+	}
+}
+
+func TestQuarantinePodSuccessful(t *testing.T) {
+	cleanUp()
+
+	configPath := filepath.Join(configStoragePath, testPodID)
+	runPath := filepath.Join(runStoragePath, testPodID)
+
+	for _, dir := range []string{configPath, runPath} {
+		if err := os.MkdirAll(dir, dirMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(runPath, stateFile), []byte("{"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := quarantinePod(testPodID, fmt.Errorf("corrupted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{configPath, runPath} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Fatalf("%s should have been moved: %v", dir, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(q.RunPath, stateFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	pods, err := ListQuarantinedPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pods) != 1 || pods[0].ID != testPodID || pods[0].Reason != "corrupted" {
+		t.Fatalf("Unexpected quarantined pods %+v", pods)
+	}
+}
+
+func TestQuarantinePodKillsVM(t *testing.T) {
+	cleanUp()
+	defer cleanUp()
+
+	runPath := filepath.Join(runStoragePath, testPodID)
+	if err := os.MkdirAll(runPath, dirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	// The shell stays alive with the PID file in its command line, as
+	// qemu does.
+	pidFile := filepath.Join(runPath, qemuPidFile)
+	cmd := exec.Command("sh", "-c", "sleep 60; :", pidFile)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	// Reap the killed process, which stays a zombie otherwise.
+	go cmd.Wait()
+
+	if err := ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", cmd.Process.Pid)), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := quarantinePod(testPodID, fmt.Errorf("corrupted")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Kill(cmd.Process.Pid, 0); err != syscall.ESRCH {
+		t.Fatalf("The VM of the pod is still running: %v", err)
+	}
+}
+
+func TestQuarantinePodStaleVMPIDFile(t *testing.T) {
+	cleanUp()
+	defer cleanUp()
+
+	runPath := filepath.Join(runStoragePath, testPodID)
+	if err := os.MkdirAll(runPath, dirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	// The PID of the test process was not used by the VM.
+	pid := fmt.Sprintf("%d", os.Getpid())
+	if err := ioutil.WriteFile(filepath.Join(runPath, qemuPidFile), []byte(pid), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := quarantinePod(testPodID, fmt.Errorf("corrupted")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListQuarantinedPodsEmpty(t *testing.T) {
+	cleanUp()
+
+	pods, err := ListQuarantinedPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pods) != 0 {
+		t.Fatalf("Unexpected quarantined pods %+v", pods)
+	}
+}
+
+// writeCorruptedPod stores the resources of a pod whose state cannot be
+// decoded.
+func writeCorruptedPod(t *testing.T) {
+	cleanUp()
+
+	if _, err := CreatePod(context.Background(), newTestPodConfigNoop()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(runStoragePath, testPodID, stateFile), []byte("{"), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListPodSkipsCorruptedPod(t *testing.T) {
+	writeCorruptedPod(t)
+	defer cleanUp()
+
+	pods, err := ListPod(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pods) != 0 {
+		t.Fatalf("Unexpected pods %+v", pods)
+	}
+
+	// Listing must leave the pod alone.
+	if _, err := os.Stat(filepath.Join(configStoragePath, testPodID)); err != nil {
+		t.Fatal(err)
+	}
+
+	quarantined, err := ListQuarantinedPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(quarantined) != 0 {
+		t.Fatalf("Unexpected quarantined pods %+v", quarantined)
+	}
+}
+
+func TestQuarantinePodNotCorrupted(t *testing.T) {
+	cleanUp()
+	defer cleanUp()
+
+	if _, err := CreatePod(context.Background(), newTestPodConfigNoop()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := QuarantinePod(context.Background(), testPodID); err == nil {
+		t.Fatal("A pod which can be read must not be quarantined")
+	}
+
+	if _, err := os.Stat(filepath.Join(configStoragePath, testPodID)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQuarantinePodCorrupted(t *testing.T) {
+	writeCorruptedPod(t)
+	defer cleanUp()
+
+	q, err := QuarantinePod(context.Background(), testPodID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.ID != testPodID {
+		t.Fatalf("Got pod %q, expecting %q", q.ID, testPodID)
+	}
+
+	if _, err := os.Stat(filepath.Join(configStoragePath, testPodID)); !os.IsNotExist(err) {
+		t.Fatalf("The pod should have been moved: %v", err)
+	}
+}
@@ -14,17 +14,24 @@
 // limitations under the License.
 //
 
-package virtcontainers
+// The mock shim checks it is given the token and URL of the proxy, as the
+// real shim is, and exits.
+package main
 
 import (
-	"errors"
+	"flag"
+	"fmt"
+	"os"
 )
 
-// common error objects used for argument checking
-var (
-	errNeedPod         = errors.New("Pod must be specified")
-	errNeedPodID       = errors.New("Pod ID cannot be empty")
-	errNeedContainerID = errors.New("Container ID cannot be empty")
-	errNeedFile        = errors.New("File cannot be empty")
-	errNeedState       = errors.New("State cannot be empty")
-)
+func main() {
+	token := flag.String("t", "", "Proxy token")
+	url := flag.String("u", "", "Proxy URL")
+
+	flag.Parse()
+
+	if *token == "" || *url == "" {
+		fmt.Fprintf(os.Stderr, "Missing token %q or URL %q\n", *token, *url)
+		os.Exit(1)
+	}
+}
@@ -194,3 +194,8 @@ func (s *sshd) stopContainer(pod Pod, c Container) error {
 func (s *sshd) killContainer(pod Pod, c Container, signal syscall.Signal, all bool) error {
 	return nil
 }
+
+// onlineCPUMem is the agent vCPUs and memory onlining implementation for sshd.
+func (s *sshd) onlineCPUMem() error {
+	return nil
+}
@@ -21,15 +21,19 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
 
 	"github.com/Sirupsen/logrus"
+
+	"github.com/clearcontainers/runtime/virtcontainers/pkg/mock"
 )
 
 const testPodID = "7f49d00d-1995-4156-8c79-5f5ab24ce138"
 const testKernel = "kernel"
 const testImage = "image"
+const testInitrd = "initrd"
 const testHypervisor = "hypervisor"
 const testBundle = "bundle"
 
@@ -45,6 +49,7 @@ var podFileState = ""
 var podFileLock = ""
 var testQemuKernelPath = ""
 var testQemuImagePath = ""
+var testQemuInitrdPath = ""
 var testQemuPath = ""
 var testHyperstartCtlSocket = ""
 var testHyperstartTtySocket = ""
@@ -66,6 +71,33 @@ func cleanUp() {
 	}
 }
 
+// buildMockBinaries builds the mock shim and hook into dir, unless their
+// paths were set at link time.
+func buildMockBinaries(dir string) error {
+	for _, bin := range []struct {
+		path *string
+		pkg  string
+	}{
+		{&mock.DefaultMockCCShimBinPath, "shim"},
+		{&mock.DefaultMockHookBinPath, "hook"},
+	} {
+		if *bin.path != "" {
+			continue
+		}
+
+		path := filepath.Join(dir, bin.pkg)
+
+		cmd := exec.Command("go", "build", "-o", path, "./"+bin.pkg+"/mock")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("Could not build the mock %s: %v: %s", bin.pkg, err, out)
+		}
+
+		*bin.path = path
+	}
+
+	return nil
+}
+
 // TestMain is the common main function used by ALL the test functions
 // for this package.
 func TestMain(m *testing.M) {
@@ -135,13 +167,28 @@ func TestMain(m *testing.M) {
 
 	testQemuKernelPath = filepath.Join(testDir, testKernel)
 	testQemuImagePath = filepath.Join(testDir, testImage)
+	testQemuInitrdPath = filepath.Join(testDir, testInitrd)
 	testQemuPath = filepath.Join(testDir, testHypervisor)
 
 	testHyperstartCtlSocket = filepath.Join(testDir, "test_hyper.sock")
 	testHyperstartTtySocket = filepath.Join(testDir, "test_tty.sock")
 
+	// The mock binaries live out of testDir, which cleanUp() empties.
+	mockDir, err := ioutil.TempDir("", "virtcontainers-mock-")
+	if err != nil {
+		panic(err)
+	}
+
+	if err := buildMockBinaries(mockDir); err != nil {
+		fmt.Println(err)
+		os.RemoveAll(mockDir)
+		os.RemoveAll(testDir)
+		os.Exit(1)
+	}
+
 	ret := m.Run()
 
+	os.RemoveAll(mockDir)
 	os.RemoveAll(testDir)
 
 	os.Exit(ret)